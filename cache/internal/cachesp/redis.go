@@ -121,10 +121,10 @@ func NewRedisCache(opts ...RedisOption) cachespi.Cache {
 		})
 	}
 
-	return &RedisCache{
+	return newTracedCache(&RedisCache{
 		client:     client,
 		defaultTTL: cfg.defaultTTL,
-	}
+	}, "redis")
 }
 
 func (c *RedisCache) resolveTTL(expire time.Duration) time.Duration {
@@ -68,10 +68,10 @@ func NewRistrettoCache(opts ...CacheOption) cachespi.Cache {
 		panic(fmt.Sprintf("cache: failed to create ristretto cache: %v", err))
 	}
 
-	return &RistrettoCache{
+	return newTracedCache(&RistrettoCache{
 		cache:      cache,
 		defaultTTL: cfg.defaultTTL,
-	}
+	}, "ristretto")
 }
 
 // resolveTTL maps cachespi expiration semantics to ristretto TTL.
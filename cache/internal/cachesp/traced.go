@@ -0,0 +1,170 @@
+package cachesp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachespi"
+	"github.com/MrMiaoMIMI/goshared/tracing"
+)
+
+var _ cachespi.Cache = (*tracedCache)(nil)
+
+// tracedCache wraps a Cache and starts a child span for every operation.
+// Spans carry the key prefix rather than the full key, which may contain ids.
+type tracedCache struct {
+	next   cachespi.Cache
+	system string
+}
+
+func newTracedCache(next cachespi.Cache, system string) cachespi.Cache {
+	return &tracedCache{next: next, system: system}
+}
+
+func (c *tracedCache) start(ctx context.Context, operation string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	attrs = append(attrs,
+		tracing.String(tracing.AttrCacheSystem, c.system),
+		tracing.String(tracing.AttrCacheOperation, operation),
+	)
+	return tracing.Start(ctx, "cache."+operation, attrs...)
+}
+
+// keyPrefix returns the part of key before its last ':', e.g. "user:profile"
+// for "user:profile:42".
+func keyPrefix(key string) string {
+	if i := strings.LastIndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+func keyAttr(key string) tracing.Attribute {
+	return tracing.String(tracing.AttrCacheKeyPrefix, keyPrefix(key))
+}
+
+func keyCountAttr(n int) tracing.Attribute {
+	return tracing.Int(tracing.AttrCacheKeyCount, n)
+}
+
+// endSpan records err on span, treating a cache miss as a normal outcome, and ends
+// the span.
+func endSpan(span tracing.Span, err error) {
+	if errors.Is(err, cachespi.ErrCacheMiss) {
+		span.SetAttributes(tracing.Bool(tracing.AttrCacheHit, false))
+	} else if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (c *tracedCache) Get(ctx context.Context, key string, receiver any, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "get", keyAttr(key))
+	err := c.next.Get(ctx, key, receiver, opts...)
+	if err == nil {
+		span.SetAttributes(tracing.Bool(tracing.AttrCacheHit, true))
+	}
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) GetOrDefault(ctx context.Context, key string, defaultVal any, receiver any, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "get_or_default", keyAttr(key))
+	err := c.next.GetOrDefault(ctx, key, defaultVal, receiver, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) Exists(ctx context.Context, key string, opts ...cachespi.OperationOption) (bool, error) {
+	ctx, span := c.start(ctx, "exists", keyAttr(key))
+	ok, err := c.next.Exists(ctx, key, opts...)
+	endSpan(span, err)
+	return ok, err
+}
+
+func (c *tracedCache) GetMany(ctx context.Context, receiverMap map[string]any, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "get_many", keyCountAttr(len(receiverMap)))
+	err := c.next.GetMany(ctx, receiverMap, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) Set(ctx context.Context, key string, value any, expire time.Duration, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "set", keyAttr(key))
+	err := c.next.Set(ctx, key, value, expire, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) SetNX(ctx context.Context, key string, value any, expire time.Duration, opts ...cachespi.OperationOption) (bool, error) {
+	ctx, span := c.start(ctx, "set_nx", keyAttr(key))
+	ok, err := c.next.SetNX(ctx, key, value, expire, opts...)
+	endSpan(span, err)
+	return ok, err
+}
+
+func (c *tracedCache) GetAndDelete(ctx context.Context, key string, receiver any, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "get_and_delete", keyAttr(key))
+	err := c.next.GetAndDelete(ctx, key, receiver, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) SetMany(ctx context.Context, valueMap map[string]any, expire time.Duration, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "set_many", keyCountAttr(len(valueMap)))
+	err := c.next.SetMany(ctx, valueMap, expire, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) Delete(ctx context.Context, key string, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "delete", keyAttr(key))
+	err := c.next.Delete(ctx, key, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) DeleteMany(ctx context.Context, keys []string, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "delete_many", keyCountAttr(len(keys)))
+	err := c.next.DeleteMany(ctx, keys, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) Load(ctx context.Context, loader cachespi.DataLoader, key string, receiver any,
+	expire time.Duration, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "load", keyAttr(key))
+	err := c.next.Load(ctx, loader, key, receiver, expire, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) LoadMany(ctx context.Context, loader cachespi.DataLoader, receiverMap map[string]any,
+	expire time.Duration, opts ...cachespi.OperationOption) error {
+	ctx, span := c.start(ctx, "load_many", keyCountAttr(len(receiverMap)))
+	err := c.next.LoadMany(ctx, loader, receiverMap, expire, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) Incr(ctx context.Context, key string, delta int64, expire time.Duration, opts ...cachespi.OperationOption) (int64, error) {
+	ctx, span := c.start(ctx, "incr", keyAttr(key))
+	v, err := c.next.Incr(ctx, key, delta, expire, opts...)
+	endSpan(span, err)
+	return v, err
+}
+
+func (c *tracedCache) Flush(ctx context.Context) error {
+	ctx, span := c.start(ctx, "flush")
+	err := c.next.Flush(ctx)
+	endSpan(span, err)
+	return err
+}
+
+func (c *tracedCache) Ping(ctx context.Context) error {
+	ctx, span := c.start(ctx, "ping")
+	err := c.next.Ping(ctx)
+	endSpan(span, err)
+	return err
+}
@@ -0,0 +1,47 @@
+package cachesp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachespi"
+	"github.com/MrMiaoMIMI/goshared/tracing"
+	"github.com/MrMiaoMIMI/goshared/tracing/tracetest"
+)
+
+func TestTracedCacheStartsChildSpans(t *testing.T) {
+	recorder := tracetest.NewRecorder()
+	tracing.SetTracer(recorder)
+	defer tracing.SetTracer(nil)
+
+	cache := NewRistrettoCache()
+	ctx, parent := tracing.Start(context.Background(), "handler")
+	var profile string
+	if err := cache.Get(ctx, "user:profile:42", &profile); !errors.Is(err, cachespi.ErrCacheMiss) {
+		t.Fatalf("expected a cache miss, got %v", err)
+	}
+	if err := cache.Set(ctx, "user:profile:42", "alice", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	get, set := spans[0], spans[1]
+	if get.Name != "cache.get" || set.Name != "cache.set" {
+		t.Fatalf("unexpected span names %q and %q", get.Name, set.Name)
+	}
+	if get.ParentSpanID != parent.SpanContext().SpanID || get.SpanContext.TraceID != parent.SpanContext().TraceID {
+		t.Fatalf("expected cache span to be a child of the handler span")
+	}
+	if get.Attributes[tracing.AttrCacheSystem] != "ristretto" || get.Attributes[tracing.AttrCacheKeyPrefix] != "user:profile" {
+		t.Fatalf("unexpected attributes: %v", get.Attributes)
+	}
+	if get.Attributes[tracing.AttrCacheHit] != false || len(get.Errors) != 0 {
+		t.Fatalf("expected a miss without errors, got %v and %v", get.Attributes, get.Errors)
+	}
+}
@@ -0,0 +1,100 @@
+// Command columngen generates typed column sets for entity structs.
+//
+// For every entity named by -type it writes a <Type>Cols variable holding one
+// dbspi.Field per column, e.g. OrderCols.ShopID of type dbspi.Field[int64].
+// With -config it also writes <Type>ShardingKey, which builds a
+// dbspi.ShardingKey from the sharding columns the config declares for the
+// entity's table.
+//
+// Run it with go generate next to the entity declarations:
+//
+//	//go:generate go run github.com/MrMiaoMIMI/goshared/db/cmd/columngen -type Order,OrderItem -config ../../conf/db.yaml
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/columngen"
+
+	"github.com/goccy/go-yaml"
+	"gorm.io/gorm/schema"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("columngen: ")
+
+	types := flag.String("type", "", "comma-separated entity struct names; required")
+	output := flag.String("output", "", "output file; defaults to <first type>_columns_gen.go in snake case")
+	configPath := flag.String("config", "", "YAML or JSON database config used to generate sharding key constructors")
+	configKey := flag.String("config-key", "", "dot-separated path of the database config inside -config, e.g. app.db")
+	flag.Parse()
+
+	if *types == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts := columngen.Options{Dir: ".", Types: strings.Split(*types, ",")}
+	opts.Output = *output
+	if opts.Output == "" {
+		opts.Output = schema.NamingStrategy{}.ColumnName("", opts.Types[0]) + "_columns_gen.go"
+	}
+	if *configPath != "" {
+		cfg, err := loadConfig(*configPath, *configKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Config = &cfg
+	}
+
+	src, err := columngen.Generate(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(opts.Output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadConfig reads the database config at key inside the file at path.
+func loadConfig(path, key string) (dbspi.DatabaseConfig, error) {
+	var cfg dbspi.DatabaseConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	unmarshal := yaml.Unmarshal
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		unmarshal = json.Unmarshal
+	}
+	if key == "" {
+		return cfg, unmarshal(data, &cfg)
+	}
+
+	var doc map[string]any
+	if err := unmarshal(data, &doc); err != nil {
+		return cfg, err
+	}
+	var node any = doc
+	for _, part := range strings.Split(key, ".") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return cfg, fmt.Errorf("config key %q not found in %s", key, path)
+		}
+		if node, ok = m[part]; !ok {
+			return cfg, fmt.Errorf("config key %q not found in %s", key, path)
+		}
+	}
+	sub, err := json.Marshal(node)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, json.Unmarshal(sub, &cfg)
+}
@@ -0,0 +1,105 @@
+package dbhelper
+
+import (
+	"context"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// ArchiveOption configures an archive run started by Archive.
+//
+// ArchiveOption is sealed to this package. Use the WithArchiveXxx helpers in
+// dbhelper instead of implementing this interface directly.
+type ArchiveOption interface {
+	applyArchiveOption(*dbsp.ArchiveOptions)
+}
+
+type archiveOptionFunc func(*dbsp.ArchiveOptions)
+
+func (f archiveOptionFunc) applyArchiveOption(o *dbsp.ArchiveOptions) {
+	f(o)
+}
+
+// WithArchiveBatchSize sets the number of rows moved per transaction.
+// Defaults to 500.
+func WithArchiveBatchSize(batchSize int) ArchiveOption {
+	return archiveOptionFunc(func(o *dbsp.ArchiveOptions) {
+		o.BatchSize = batchSize
+	})
+}
+
+// WithArchiveRowsPerSecond caps the rate rows are moved at, to bound the load
+// an archive run puts on the hot tables. Defaults to no limit.
+func WithArchiveRowsPerSecond(rowsPerSecond int) ArchiveOption {
+	return archiveOptionFunc(func(o *dbsp.ArchiveOptions) {
+		o.RowsPerSecond = rowsPerSecond
+	})
+}
+
+// WithArchiveTableName maps each physical source table to the archive table
+// in the same database, e.g. to keep the shard suffix of table-sharded
+// tables. Defaults to the TableName of the archive entity.
+func WithArchiveTableName(tableName func(sourceTable string) string) ArchiveOption {
+	return archiveOptionFunc(func(o *dbsp.ArchiveOptions) {
+		o.TableName = tableName
+	})
+}
+
+// WithArchiveStore writes archived rows to store, e.g. a table store of
+// another database group, instead of to the archive table in the source
+// database. Rows are upserted into store on their id, so convert must keep
+// a non-zero id; PurgeExpired does not take a store.
+func WithArchiveStore[A dbspi.Entity](store dbspi.TableStore[A]) ArchiveOption {
+	return archiveOptionFunc(func(o *dbsp.ArchiveOptions) {
+		o.Store = store
+	})
+}
+
+// Archive moves the rows of source matching query to an archive table and
+// deletes them from source. It walks every physical table of source like
+// FindAll, one at a time, moving rows in id-ordered batches. Each batch is
+// copied, deleted and checkpointed in one transaction on the source
+// database, in dbspi.DefaultArchiveCheckpointTableName under job, so a run
+// stopped by a crash or by ctx resumes after its last batch when started
+// again with the same job. Cached stores wrapping source drop the rows of
+// each committed batch.
+//
+// convert maps a source row to its archive row and must keep the id. By
+// default archive rows are written to the table of the archive entity in the
+// source database; see WithArchiveTableName and WithArchiveStore. Archived
+// rows emit no change events and are copied as stored: rows of stores
+// WithFieldEncryptor stay encrypted, so do not give the archive store a
+// field encryptor of its own. Ids must be non-negative integers, and
+// tenant tables need a tenant in ctx or dbspi.WithAllTenants.
+//
+// Example:
+//
+//	cutoff := dbhelper.PurgeCutoff(180 * 24 * time.Hour)
+//	report, err := dbhelper.Archive(dbspi.WithAllTenants(ctx), "order-180d", orderStore,
+//		dbhelper.Q(ctimeField.Lt(&cutoff)),
+//		func(o *Order) *OrderArchive { return &OrderArchive{Order: *o} },
+//		dbhelper.WithArchiveBatchSize(200), dbhelper.WithArchiveRowsPerSecond(1000))
+func Archive[T, A dbspi.Entity](ctx context.Context, job string, source dbspi.TableStore[T], query dbspi.Query, convert func(T) A, opts ...ArchiveOption) (*dbspi.ArchiveReport, error) {
+	var options dbsp.ArchiveOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyArchiveOption(&options)
+		}
+	}
+	return dbsp.Archive(ctx, job, source, query, convert, options)
+}
+
+// PurgeExpired deletes the rows of source matching query, e.g. rows past
+// their TTL, the way Archive moves them: per physical table, in throttled,
+// id-ordered batches checkpointed under job. It takes WithArchiveBatchSize
+// and WithArchiveRowsPerSecond.
+//
+// Example:
+//
+//	cutoff := dbhelper.PurgeCutoff(7 * 24 * time.Hour)
+//	report, err := dbhelper.PurgeExpired(ctx, "session-ttl", sessionStore, dbhelper.Q(ctimeField.Lt(&cutoff)),
+//		dbhelper.WithArchiveRowsPerSecond(5000))
+func PurgeExpired[T dbspi.Entity](ctx context.Context, job string, source dbspi.TableStore[T], query dbspi.Query, opts ...ArchiveOption) (*dbspi.ArchiveReport, error) {
+	return Archive[T, T](ctx, job, source, query, nil, opts...)
+}
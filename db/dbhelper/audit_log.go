@@ -0,0 +1,40 @@
+package dbhelper
+
+import (
+	"context"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// WithAuditLog makes NewTableStore/NewSoftDeleteTableStore write a
+// dbspi.AuditRecord for every row changed through the store. A record holds
+// the operator from dbspi.OperatorFromContext, the time, the trace id and
+// the changed columns with their old and new values.
+//
+// Records go to dbspi.DefaultAuditTableName in the database the row lives
+// in, through the same session as the write. Use the store WithTx to make
+// the write and its audit record atomic. Raw SQL run with Exec is not
+// audited.
+//
+// Example:
+//
+//	ctx = dbspi.WithOperator(ctx, "alice")
+//	orderStore := dbhelper.NewTableStore(&Order{}, dbhelper.WithAuditLog())
+//	err := orderStore.UpdateById(ctx, orderID, dbhelper.NewUpdater().Set(statusField, "paid"))
+func WithAuditLog() TableStoreOption {
+	return auditLogTableStoreOption{}
+}
+
+type auditLogTableStoreOption struct{}
+
+func (auditLogTableStoreOption) applyTableStoreOption(opts *tableStoreOptions) {
+	opts.changes.AuditLog = true
+}
+
+// AuditHistory returns the audit records of the row with id in store, newest
+// first unless pagination sets an order. Sharded stores route id like
+// GetById.
+func AuditHistory[T dbspi.Entity](ctx context.Context, store dbspi.TableStore[T], id any, pagination dbspi.Pagination) ([]*dbspi.AuditRecord, error) {
+	return dbsp.AuditHistory(ctx, store, id, pagination)
+}
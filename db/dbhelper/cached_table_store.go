@@ -0,0 +1,36 @@
+package dbhelper
+
+import (
+	"github.com/MrMiaoMIMI/goshared/cache/cachespi"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// NewCachedTableStore wraps store with a read-through cache. The entity type
+// must be a pointer to a struct that encoding/gob can encode; entities are
+// cached gob-encoded, so json tags do not affect what is cached.
+//
+// GetById, ExistsById and GetByUniqueKey read from cache and load misses
+// through cache.Load. Writes made through the returned store invalidate the
+// affected ids; for a store created WithTx, invalidation waits until the
+// transaction commits and reads bypass the cache. Rows changed by Exec or by
+// other processes are not tracked: call Invalidate or rely on the expiration.
+//
+// Example:
+//
+//	users := dbhelper.NewCachedTableStore(
+//	    dbhelper.NewTableStore(&User{}),
+//	    cachehelper.NewInMemCache(),
+//	    dbhelper.WithCacheExpiration(10*time.Minute),
+//	    dbhelper.WithCacheUniqueKey("email", dbhelper.NewField[string]("email")),
+//	)
+//	user, err := users.GetByUniqueKey(ctx, "email", "a@example.com")
+func NewCachedTableStore[T dbspi.Entity](store dbspi.TableStore[T], cache cachespi.Cache, opts ...CachedTableStoreOption) dbspi.CachedTableStore[T] {
+	var options dbsp.CachedTableStoreOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyCachedTableStoreOption(&options)
+		}
+	}
+	return dbsp.NewCachedTableStore(store, cache, options)
+}
@@ -0,0 +1,38 @@
+package dbhelper
+
+import (
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+	"github.com/MrMiaoMIMI/goshared/mq/mqspi"
+)
+
+// WithChangeSinks makes NewTableStore/NewSoftDeleteTableStore report every
+// row changed through the store to sinks as a dbspi.ChangeEvent.
+//
+// Events carry the operation, primary key, physical target and, for entity
+// writes, the before and after images. Capture reads the affected rows
+// before writing, so it costs one extra query per write. For stores created
+// WithTx, events are emitted after the transaction commits. Raw SQL run with
+// Exec is not captured.
+//
+// Example:
+//
+//	sink := dbhelper.NewProducerChangeSink(producer, "cdc.")
+//	orderStore := dbhelper.NewTableStore(&Order{}, dbhelper.WithChangeSinks(sink))
+func WithChangeSinks(sinks ...dbspi.ChangeSink) TableStoreOption {
+	return changeSinksTableStoreOption{sinks: sinks}
+}
+
+type changeSinksTableStoreOption struct {
+	sinks []dbspi.ChangeSink
+}
+
+func (o changeSinksTableStoreOption) applyTableStoreOption(opts *tableStoreOptions) {
+	opts.changes.Sinks = append(opts.changes.Sinks, o.sinks...)
+}
+
+// NewProducerChangeSink creates a ChangeSink that publishes each event as
+// JSON to the topic topicPrefix + Entity.TableName(), keyed by primary key.
+func NewProducerChangeSink(producer mqspi.Producer, topicPrefix string) dbspi.ChangeSink {
+	return dbsp.NewProducerChangeSink(producer, topicPrefix)
+}
@@ -7,9 +7,51 @@ import (
 
 // NewManager creates a new Manager from the given configuration.
 func NewManager(cfg dbspi.DatabaseConfig, opts ...ManagerOption) dbspi.Manager {
-	options := resolveManagerOptions(opts)
+	return dbsp.NewManagerWithOptions(cfg, internalManagerOptions(opts))
+}
+
+// NewMemoryManager creates a Manager that keeps every database target of cfg
+// in memory instead of connecting to MySQL. It is meant for unit tests.
+//
+// Table stores created with WithManager route by the same sharding rules as
+// on MySQL and evaluate queries, pagination and updaters against the stored
+// entities. Joins and raw SQL are not supported.
+func NewMemoryManager(cfg dbspi.DatabaseConfig, opts ...ManagerOption) dbspi.Manager {
+	return dbsp.NewMemoryManager(cfg, internalManagerOptions(opts))
+}
+
+// NewMemoryTableStore creates a non-sharded SoftDeleteTableStore backed by its
+// own in-memory table. It is meant for unit tests.
+//
+// Common-field, change sink, audit log, id generator and field encryption
+// options apply as for NewSoftDeleteTableStore; WithManager, WithTx and
+// WithRowLock are ignored.
+func NewMemoryTableStore[T dbspi.Entity](entity T, opts ...TableStoreOption) dbspi.SoftDeleteTableStore[T] {
+	options := resolveTableStoreOptions(opts)
 	commonFields := options.commonFields.apply(dbsp.DefaultCommonFieldAutoFillOptions())
-	return dbsp.NewManager(cfg, commonFields)
+	var store dbspi.SoftDeleteTableStore[T] = dbsp.NewMemoryTableStore(entity, commonFields)
+	if options.changes.AuditLog || len(options.changes.Sinks) > 0 {
+		store = dbsp.NewChangeCaptureTableStore[T](store, options.changes)
+	}
+	if options.ids.Generator != nil || options.ids.ShardBits != 0 {
+		store = dbsp.NewIdAssigningTableStore[T](store, options.ids)
+	}
+	if options.encryptor != nil {
+		store = dbsp.NewEncryptingTableStore[T](store, options.encryptor)
+	}
+	return store
+}
+
+// ReloadManager applies a new configuration to mgr without restarting the
+// process.
+//
+// Unchanged database groups keep their connections. Table stores created from
+// mgr, including the default manager, route new operations with the new
+// config once ReloadManager returns. In-flight operations and transactions
+// finish on their original connections, which are closed after they drain.
+// If cfg is invalid, mgr keeps its current config and an error is returned.
+func ReloadManager(mgr dbspi.Manager, cfg dbspi.DatabaseConfig) error {
+	return resolveManager(mgr).Reload(cfg)
 }
 
 // SetDefaultManager sets the global default Manager.
@@ -25,31 +67,57 @@ func DefaultManager() dbspi.Manager {
 // NewTableStore creates a TableStore for the given entity using the Manager.
 func NewTableStore[T dbspi.Entity](entity T, opts ...TableStoreOption) dbspi.TableStore[T] {
 	options := resolveTableStoreOptions(opts)
+	var store dbspi.TableStore[T]
 	if options.setTx {
-		return newTxTableStore(entity, options.tx, options.commonFields)
+		store = newTxTableStore(entity, options.tx, options.commonFields, options.rowLock)
+	} else if options.rowLock != nil {
+		store = dbsp.NewErrorTableStore[T](dbspi.ErrRowLockRequiresTransaction)
+	} else {
+		mgr := asInternalManager(options.manager)
+		if mgr == nil {
+			mgr = dbsp.DefaultManager()
+		}
+		commonFields := options.commonFields.apply(mgr.CommonFieldAutoFillOptions())
+		store = dbsp.ForWithCommonFieldAutoFill(entity, mgr, commonFields)
 	}
-
-	mgr := asInternalManager(options.manager)
-	if mgr == nil {
-		mgr = dbsp.DefaultManager()
+	if options.changes.AuditLog || len(options.changes.Sinks) > 0 {
+		store = dbsp.NewChangeCaptureTableStore(store, options.changes)
+	}
+	if options.ids.Generator != nil || options.ids.ShardBits != 0 {
+		store = dbsp.NewIdAssigningTableStore(store, options.ids)
 	}
-	commonFields := options.commonFields.apply(mgr.CommonFieldAutoFillOptions())
-	return dbsp.ForWithCommonFieldAutoFill(entity, mgr, commonFields)
+	if options.encryptor != nil {
+		store = dbsp.NewEncryptingTableStore(store, options.encryptor)
+	}
+	return store
 }
 
 // NewSoftDeleteTableStore creates a SoftDeleteTableStore for the given entity using the Manager.
 func NewSoftDeleteTableStore[T dbspi.Entity](entity T, opts ...TableStoreOption) dbspi.SoftDeleteTableStore[T] {
 	options := resolveTableStoreOptions(opts)
+	var store dbspi.SoftDeleteTableStore[T]
 	if options.setTx {
-		return newTxSoftDeleteTableStore(entity, options.tx, options.commonFields)
+		store = newTxSoftDeleteTableStore(entity, options.tx, options.commonFields, options.rowLock)
+	} else if options.rowLock != nil {
+		store = dbsp.NewErrorSoftDeleteTableStore[T](dbspi.ErrRowLockRequiresTransaction)
+	} else {
+		mgr := asInternalManager(options.manager)
+		if mgr == nil {
+			mgr = dbsp.DefaultManager()
+		}
+		commonFields := options.commonFields.apply(mgr.CommonFieldAutoFillOptions())
+		store = dbsp.ForSoftDeleteWithCommonFieldAutoFill(entity, mgr, commonFields)
 	}
-
-	mgr := asInternalManager(options.manager)
-	if mgr == nil {
-		mgr = dbsp.DefaultManager()
+	if options.changes.AuditLog || len(options.changes.Sinks) > 0 {
+		store = dbsp.NewChangeCaptureTableStore[T](store, options.changes)
+	}
+	if options.ids.Generator != nil || options.ids.ShardBits != 0 {
+		store = dbsp.NewIdAssigningTableStore[T](store, options.ids)
 	}
-	commonFields := options.commonFields.apply(mgr.CommonFieldAutoFillOptions())
-	return dbsp.ForSoftDeleteWithCommonFieldAutoFill(entity, mgr, commonFields)
+	if options.encryptor != nil {
+		store = dbsp.NewEncryptingTableStore[T](store, options.encryptor)
+	}
+	return store
 }
 
 // AsSQLTableStore exposes advanced raw SQL support when store supports it.
@@ -71,6 +139,16 @@ func resolveManagerOptions(opts []ManagerOption) managerOptions {
 	return options
 }
 
+func internalManagerOptions(opts []ManagerOption) dbsp.ManagerOptions {
+	options := resolveManagerOptions(opts)
+	return dbsp.ManagerOptions{
+		CommonFields:       options.commonFields.apply(dbsp.DefaultCommonFieldAutoFillOptions()),
+		ShardDirectories:   options.shardDirectories,
+		ReloadDrainTimeout: options.reloadDrainTimeout,
+		Metrics:            options.metrics,
+	}
+}
+
 func resolveTableStoreOptions(opts []TableStoreOption) tableStoreOptions {
 	var options tableStoreOptions
 	for _, opt := range opts {
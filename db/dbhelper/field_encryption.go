@@ -0,0 +1,72 @@
+package dbhelper
+
+import (
+	"context"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/util/crypto"
+)
+
+// WithFieldEncryptor makes NewTableStore/NewSoftDeleteTableStore store the
+// entity fields tagged `goshared:"encrypt"` as ciphertext produced by enc.
+// Entities passed to writes are encrypted for the duration of the call and
+// keep their plaintext; entities read back are decrypted. Encrypted fields
+// must be string or *string, and empty strings are stored as is. A
+// NewCachedTableStore wrapping the store caches the fields encrypted too.
+//
+// A field tagged `goshared:"encrypt;blind_index:<column>"` also stores a
+// blind index of its plaintext in the string field mapped to <column>. Eq,
+// NotEq, In and NotIn on the encrypted column are then served by the index
+// column; other conditions on encrypted columns return an error.
+//
+// Example:
+//
+//	type User struct {
+//		dbspi.CommonFields
+//		Phone      string `gorm:"column:phone" goshared:"encrypt;blind_index:phone_bidx"`
+//		PhoneIndex string `gorm:"column:phone_bidx"`
+//	}
+//
+//	keyring, err := crypto.NewKeyring("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+//	userStore := dbhelper.NewTableStore(&User{},
+//		dbhelper.WithFieldEncryptor(dbhelper.KeyringFieldEncryptor(keyring, indexKey)))
+//	users, err := userStore.Find(ctx, dbhelper.Q(phone.Eq(&number)), nil)
+func WithFieldEncryptor(enc dbspi.FieldEncryptor) TableStoreOption {
+	return fieldEncryptorTableStoreOption{enc: enc}
+}
+
+type fieldEncryptorTableStoreOption struct {
+	enc dbspi.FieldEncryptor
+}
+
+func (o fieldEncryptorTableStoreOption) applyTableStoreOption(opts *tableStoreOptions) {
+	opts.encryptor = o.enc
+}
+
+// KeyringFieldEncryptor returns a FieldEncryptor that encrypts with keyring
+// and computes blind indexes with HMAC-SHA256 under blindIndexKey, keyed per
+// column. Rotating keyring keeps existing rows readable; changing
+// blindIndexKey requires recomputing every stored blind index.
+func KeyringFieldEncryptor(keyring *crypto.Keyring, blindIndexKey []byte) dbspi.FieldEncryptor {
+	if keyring == nil || len(blindIndexKey) == 0 {
+		panic("dbhelper: keyring field encryptor requires a keyring and a blind index key")
+	}
+	return keyringFieldEncryptor{keyring: keyring, blindIndexKey: blindIndexKey}
+}
+
+type keyringFieldEncryptor struct {
+	keyring       *crypto.Keyring
+	blindIndexKey []byte
+}
+
+func (e keyringFieldEncryptor) Encrypt(_ context.Context, plaintext string) (string, error) {
+	return e.keyring.Encrypt(plaintext)
+}
+
+func (e keyringFieldEncryptor) Decrypt(_ context.Context, ciphertext string) (string, error) {
+	return e.keyring.Decrypt(ciphertext)
+}
+
+func (e keyringFieldEncryptor) BlindIndex(_ context.Context, column, plaintext string) (string, error) {
+	return crypto.BlindIndex(e.blindIndexKey, column+"\x00"+plaintext), nil
+}
@@ -0,0 +1,145 @@
+package dbhelper
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+	"github.com/MrMiaoMIMI/goshared/util/idutil"
+)
+
+// WithIdGenerator makes NewTableStore/NewSoftDeleteTableStore assign an id
+// from gen to every entity passed to Create or BatchCreate with a zero id,
+// before the entity is routed. Entities that already have an id keep it.
+// The entity must implement dbspi.IdAccessor, e.g. by embedding
+// dbspi.CommonFields.
+//
+// Use it for sharded tables, which cannot rely on AUTO_INCREMENT.
+//
+// Example:
+//
+//	orderStore := dbhelper.NewTableStore(&Order{},
+//		dbhelper.WithIdGenerator(dbhelper.SnowflakeIdGeneratorWithShardBits(4)),
+//		dbhelper.WithIdShardBits("shop_id", 4))
+func WithIdGenerator(gen dbspi.IdGenerator) TableStoreOption {
+	return idGeneratorTableStoreOption{gen: gen}
+}
+
+type idGeneratorTableStoreOption struct {
+	gen dbspi.IdGenerator
+}
+
+func (o idGeneratorTableStoreOption) applyTableStoreOption(opts *tableStoreOptions) {
+	opts.ids.Generator = o.gen
+}
+
+// WithIdShardBits embeds the low bits of the entity's column value in the
+// low bits of ids generated by WithIdGenerator, so that GetById and the other
+// id-based methods route from the id alone, without a ShardingKey in ctx.
+//
+// It only fits sharding rules that use column modulo a power of two no larger
+// than 1<<bits, such as "@{shop_id} % 16" with bits = 4. column must hold a
+// non-negative integer, and bits must be between 1 and 16. Generated ids are
+// shifted left by bits, so the generator must leave that many high bits
+// unused: use SnowflakeIdGeneratorWithShardBits rather than
+// SnowflakeIdGenerator, whose ids use all 63 bits. Generators implementing
+// dbspi.MaxIdProvider are checked when the store is built. Without
+// WithIdGenerator, only the routing applies, for ids that are assigned
+// elsewhere with the same layout.
+func WithIdShardBits(column string, bits int) TableStoreOption {
+	return idShardBitsTableStoreOption{column: column, bits: bits}
+}
+
+type idShardBitsTableStoreOption struct {
+	column string
+	bits   int
+}
+
+func (o idShardBitsTableStoreOption) applyTableStoreOption(opts *tableStoreOptions) {
+	opts.ids.ShardColumn = o.column
+	opts.ids.ShardBits = o.bits
+}
+
+// SnowflakeIdGenerator returns an IdGenerator backed by idutil.Snowflake.
+// Set a distinct machine id per process with idutil.SetSnowflakeMachineID or
+// LeaseSnowflakeMachineId.
+func SnowflakeIdGenerator() dbspi.IdGenerator {
+	return snowflakeIdGenerator{}
+}
+
+// SnowflakeIdGeneratorWithShardBits returns an IdGenerator backed by
+// idutil.SnowflakeWithReservedBits, for use with WithIdShardBits and the
+// same bits. bits must be between 1 and idutil.MaxSnowflakeReservedBits.
+func SnowflakeIdGeneratorWithShardBits(bits int) dbspi.IdGenerator {
+	if bits <= 0 || bits > idutil.MaxSnowflakeReservedBits {
+		panic(fmt.Sprintf("dbhelper: snowflake shard bits must be between 1 and %d, got %d", idutil.MaxSnowflakeReservedBits, bits))
+	}
+	return snowflakeIdGenerator{reservedBits: bits}
+}
+
+type snowflakeIdGenerator struct {
+	reservedBits int
+}
+
+func (g snowflakeIdGenerator) NextId(context.Context, string) (uint64, error) {
+	return uint64(idutil.SnowflakeWithReservedBits(g.reservedBits)), nil
+}
+
+// MaxId implements dbspi.MaxIdProvider.
+func (g snowflakeIdGenerator) MaxId() uint64 {
+	return math.MaxInt64 >> g.reservedBits
+}
+
+// SegmentAllocator is a segment id allocator backed by
+// dbspi.DefaultIdSegmentTableName. It is also a dbspi.IdGenerator that uses
+// the table name as the business tag.
+type SegmentAllocator interface {
+	idutil.SegmentAllocator
+	dbspi.IdGenerator
+}
+
+// NewSegmentAllocator returns a SegmentAllocator in the style of Leaf's
+// segment mode: each business tag has a row in
+// dbspi.DefaultIdSegmentTableName whose max_id is moved forward by one step
+// per reservation, and ids are handed out from the reserved range in memory
+// while the next range is prefetched in the background. Reservations run in
+// Transaction with opts, so the table must be in the default database group
+// of the selected Manager.
+//
+// Example:
+//
+//	ids := dbhelper.NewSegmentAllocator(dbspi.DefaultSegmentConfig())
+//	orderStore := dbhelper.NewTableStore(&Order{}, dbhelper.WithIdGenerator(ids))
+func NewSegmentAllocator(cfg dbspi.SegmentConfig, opts ...TransactionOption) SegmentAllocator {
+	return dbsp.NewSegmentAllocator(segmentTransaction(opts), cfg)
+}
+
+// LeaseSnowflakeMachineId leases a snowflake machine id that no other live
+// process holds from dbspi.DefaultIdSegmentTableName, passes it to
+// idutil.SetSnowflakeMachineID and renews the lease every TTL/3 until Close.
+// It returns dbspi.ErrMachineIdUnavailable when every machine id is leased.
+//
+// Call it before the first Snowflake call, and stop generating ids once Lost
+// is closed, since another process may then take over the machine id.
+//
+// Example:
+//
+//	lease, err := dbhelper.LeaseSnowflakeMachineId(ctx, dbspi.DefaultMachineLeaseConfig())
+//	defer lease.Close(ctx)
+func LeaseSnowflakeMachineId(ctx context.Context, cfg dbspi.MachineLeaseConfig, opts ...TransactionOption) (idutil.MachineLease, error) {
+	lease, err := dbsp.LeaseSnowflakeMachineId(ctx, segmentTransaction(opts), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+func segmentTransaction(opts []TransactionOption) dbsp.SegmentTransaction {
+	return func(ctx context.Context, fn func(store dbspi.TableStore[*dbspi.IdSegment]) error) error {
+		return Transaction(ctx, func(tx *Tx) error {
+			return fn(NewTableStore(&dbspi.IdSegment{}, WithTx(tx), WithRowLock(dbspi.RowLock{Strength: dbspi.LockForUpdate})))
+		}, opts...)
+	}
+}
@@ -0,0 +1,36 @@
+package dbhelper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+func newSegmentTestManager() dbspi.Manager {
+	return NewMemoryManager(dbspi.DatabaseConfig{DatabaseGroups: map[string]dbspi.DatabaseGroupConfig{
+		dbspi.DefaultDatabaseGroupKey: {Host: "127.0.0.1", Port: 3306},
+	}})
+}
+
+func TestSegmentAllocatorRunsOnManagerTransactions(t *testing.T) {
+	mgr := newSegmentTestManager()
+	ctx := context.Background()
+	ids := NewSegmentAllocator(dbspi.SegmentConfig{Step: 3, PrefetchRatio: 1}, WithManager(mgr))
+
+	if id, err := ids.NextId(ctx, "order_tab"); err != nil || id != 1 {
+		t.Fatalf("id = %d, err = %v", id, err)
+	}
+	row, err := NewTableStore(&dbspi.IdSegment{}, WithManager(mgr)).GetById(ctx, "order_tab")
+	if err != nil || row == nil || row.MaxId != 3 {
+		t.Fatalf("segment row = %+v, err = %v", row, err)
+	}
+
+	lease, err := LeaseSnowflakeMachineId(ctx, dbspi.MachineLeaseConfig{Owner: "a"}, WithManager(mgr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lease.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package dbhelper
+
+import (
+	"fmt"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// NewJoinQuery starts a join query from entity whose rows are scanned into R.
+//
+// It accepts the table store options WithManager and WithTx; common-field
+// options are ignored. Errors from invalid options, such as a nil Tx or a
+// database group mismatch, are returned by Find and Count.
+//
+// Example:
+//
+//	type OrderItemView struct {
+//		OrderID int64  `gorm:"column:order_id"`
+//		SKU     string `gorm:"column:sku"`
+//	}
+//
+//	order, item := &Order{}, &OrderItem{}
+//	rows, err := dbhelper.NewJoinQuery[OrderItemView](order).
+//		InnerJoin(item, dbhelper.On(dbhelper.TableField(order, orderID), dbhelper.TableField(item, itemOrderID))).
+//		Select(dbhelper.As(dbhelper.TableField(order, orderID), "order_id"), dbhelper.TableField(item, sku)).
+//		Where(dbhelper.TableField(order, shopID).Eq(&shop)).
+//		Find(dbspi.WithShardingKey(ctx, key), nil)
+func NewJoinQuery[R any](from dbspi.Entity, opts ...TableStoreOption) dbspi.JoinQuery[R] {
+	options := resolveTableStoreOptions(opts)
+	if options.setTx {
+		if options.tx == nil || options.tx.manager == nil {
+			return dbsp.NewErrorJoinQuery[R](fmt.Errorf("dbhelper: transaction is nil"))
+		}
+		if err := validateTxEntityDatabaseGroupKey(options.tx, from); err != nil {
+			return dbsp.NewErrorJoinQuery[R](err)
+		}
+		return dbsp.NewJoinQuery[R](from, options.tx.manager)
+	}
+	return dbsp.NewJoinQuery[R](from, asInternalManager(options.manager))
+}
+
+// TableField qualifies field with the table of entity for use in join
+// queries.
+func TableField[T any](entity dbspi.Entity, field dbspi.Field[T]) dbspi.Field[T] {
+	return dbsp.QualifyField(entity.TableName(), field)
+}
+
+// On creates a join condition comparing two columns for equality.
+func On(left, right dbspi.Column) dbspi.Condition {
+	return dbsp.JoinOn(left, right)
+}
+
+// As selects column under alias, typically to map it to a field of the join
+// projection type.
+func As(column dbspi.Column, alias string) dbspi.Column {
+	return dbsp.AliasColumn(column, alias)
+}
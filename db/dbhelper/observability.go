@@ -0,0 +1,31 @@
+package dbhelper
+
+import (
+	"context"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// CheckHealth pings every database target of mgr concurrently and reports
+// per-target status. Each ping is bounded by timeout; a non-positive timeout
+// uses dbspi.DefaultHealthCheckTimeoutSeconds. A nil mgr uses the default
+// manager.
+func CheckHealth(ctx context.Context, mgr dbspi.Manager, timeout time.Duration) dbspi.HealthReport {
+	return resolveManager(mgr).CheckHealth(ctx, timeout)
+}
+
+// PoolStats returns a connection pool snapshot for every database target of
+// mgr. A nil mgr uses the default manager.
+func PoolStats(mgr dbspi.Manager) []dbspi.PoolStats {
+	return resolveManager(mgr).PoolStats()
+}
+
+func resolveManager(mgr dbspi.Manager) *dbsp.Manager {
+	internal := asInternalManager(mgr)
+	if internal == nil {
+		internal = dbsp.DefaultManager()
+	}
+	return internal
+}
@@ -0,0 +1,63 @@
+package dbhelper
+
+import (
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// CachedTableStoreOption configures a table store created by NewCachedTableStore.
+//
+// CachedTableStoreOption is sealed to this package. Use the WithXxx helpers in
+// dbhelper instead of implementing this interface directly.
+type CachedTableStoreOption interface {
+	applyCachedTableStoreOption(*dbsp.CachedTableStoreOptions)
+}
+
+type cachedTableStoreOptionFunc func(*dbsp.CachedTableStoreOptions)
+
+func (f cachedTableStoreOptionFunc) applyCachedTableStoreOption(o *dbsp.CachedTableStoreOptions) {
+	f(o)
+}
+
+// WithCacheKeyPrefix namespaces the cache keys of a cached table store.
+// Defaults to "db".
+func WithCacheKeyPrefix(prefix string) CachedTableStoreOption {
+	return cachedTableStoreOptionFunc(func(o *dbsp.CachedTableStoreOptions) {
+		o.KeyPrefix = prefix
+	})
+}
+
+// WithCacheExpiration sets how long cached entities live. Defaults to the
+// cache's own default expiration.
+func WithCacheExpiration(expiration time.Duration) CachedTableStoreOption {
+	return cachedTableStoreOptionFunc(func(o *dbsp.CachedTableStoreOptions) {
+		o.Expiration = expiration
+	})
+}
+
+// WithCacheUniqueKey declares a unique key that GetByUniqueKey can serve
+// from the cache.
+func WithCacheUniqueKey(name string, columns ...dbspi.Column) CachedTableStoreOption {
+	return cachedTableStoreOptionFunc(func(o *dbsp.CachedTableStoreOptions) {
+		names := make([]string, len(columns))
+		for i, col := range columns {
+			names[i] = col.Name()
+		}
+		if o.UniqueKeys == nil {
+			o.UniqueKeys = make(map[string][]string)
+		}
+		o.UniqueKeys[name] = names
+	})
+}
+
+// WithCacheTenantProvider sets how the cached table store resolves the tenant
+// of ctx for entities implementing dbspi.TenantAccessor. Use the provider
+// given to WithCommonFieldTenantProvider, if any. Defaults to
+// dbspi.TenantFromContext.
+func WithCacheTenantProvider(provider dbspi.TenantProvider) CachedTableStoreOption {
+	return cachedTableStoreOptionFunc(func(o *dbsp.CachedTableStoreOptions) {
+		o.TenantProvider = provider
+	})
+}
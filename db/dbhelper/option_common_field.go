@@ -41,6 +41,24 @@ func WithCommonFieldOperatorProvider(provider dbspi.OperatorProvider) CommonFiel
 	})
 }
 
+// WithCommonFieldTenantProvider sets the tenant provider for entities
+// implementing dbspi.TenantAccessor. The default provider reads the tenant
+// injected by dbspi.WithTenant.
+func WithCommonFieldTenantProvider(provider dbspi.TenantProvider) CommonFieldAutoFillOption {
+	return commonFieldOptionFunc(func(p *commonFieldPatch) {
+		p.tenantProvider = provider
+	})
+}
+
+// WithTenantShardingKey makes sharded table stores of tenant entities add the
+// tenant of ctx to the sharding key, for tables sharded by tenant_id.
+func WithTenantShardingKey(enabled bool) CommonFieldAutoFillOption {
+	return commonFieldOptionFunc(func(p *commonFieldPatch) {
+		p.setTenantShardingKey = true
+		p.tenantShardingKey = enabled
+	})
+}
+
 type commonFieldOptionFunc func(*commonFieldPatch)
 
 func (f commonFieldOptionFunc) applyManagerOption(o *managerOptions) {
@@ -62,6 +80,9 @@ type commonFieldPatch struct {
 	overwriteExplicitValues    bool
 	timeProvider               dbspi.TimeProvider
 	operatorProvider           dbspi.OperatorProvider
+	tenantProvider             dbspi.TenantProvider
+	setTenantShardingKey       bool
+	tenantShardingKey          bool
 }
 
 func (p commonFieldPatch) apply(base dbsp.CommonFieldAutoFillOptions) dbsp.CommonFieldAutoFillOptions {
@@ -77,5 +98,11 @@ func (p commonFieldPatch) apply(base dbsp.CommonFieldAutoFillOptions) dbsp.Commo
 	if p.operatorProvider != nil {
 		base.OperatorProvider = p.operatorProvider
 	}
+	if p.tenantProvider != nil {
+		base.TenantProvider = p.tenantProvider
+	}
+	if p.setTenantShardingKey {
+		base.TenantShardingKey = p.tenantShardingKey
+	}
 	return base.Normalize()
 }
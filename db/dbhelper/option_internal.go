@@ -1,16 +1,28 @@
 package dbhelper
 
-import "github.com/MrMiaoMIMI/goshared/db/dbspi"
+import (
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
 
 type managerOptions struct {
-	commonFields commonFieldPatch
+	commonFields       commonFieldPatch
+	shardDirectories   map[string]dbspi.ShardDirectory
+	reloadDrainTimeout time.Duration
+	metrics            dbspi.MetricsRecorder
 }
 
 type tableStoreOptions struct {
 	manager      dbspi.Manager
 	tx           *Tx
 	setTx        bool
+	rowLock      *dbspi.RowLock
 	commonFields commonFieldPatch
+	changes      dbsp.ChangeCaptureOptions
+	ids          dbsp.IdAssignOptions
+	encryptor    dbspi.FieldEncryptor
 }
 
 type transactionOptions struct {
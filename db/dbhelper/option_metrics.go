@@ -0,0 +1,11 @@
+package dbhelper
+
+import "github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+// WithMetricsRecorder reports the latency and error of every statement
+// executed through the manager, including transactions, to recorder.
+func WithMetricsRecorder(recorder dbspi.MetricsRecorder) ManagerOption {
+	return managerOptionFunc(func(o *managerOptions) {
+		o.metrics = recorder
+	})
+}
@@ -0,0 +1,13 @@
+package dbhelper
+
+import "time"
+
+// WithReloadDrainTimeout bounds how long ReloadManager waits for in-flight
+// operations and transactions before closing connections retired by a reload.
+//
+// Non-positive values use dbspi.DefaultReloadDrainTimeoutSeconds.
+func WithReloadDrainTimeout(timeout time.Duration) ManagerOption {
+	return managerOptionFunc(func(o *managerOptions) {
+		o.reloadDrainTimeout = timeout
+	})
+}
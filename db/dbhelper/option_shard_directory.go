@@ -0,0 +1,22 @@
+package dbhelper
+
+import "github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+// WithShardDirectory registers a ShardDirectory under name so that
+// database_directory and table_directory configs can reference it.
+//
+// Registering the same name twice keeps the last directory.
+func WithShardDirectory(name string, directory dbspi.ShardDirectory) ManagerOption {
+	return managerOptionFunc(func(o *managerOptions) {
+		if o.shardDirectories == nil {
+			o.shardDirectories = make(map[string]dbspi.ShardDirectory)
+		}
+		o.shardDirectories[name] = directory
+	})
+}
+
+type managerOptionFunc func(*managerOptions)
+
+func (f managerOptionFunc) applyManagerOption(o *managerOptions) {
+	f(o)
+}
@@ -1,5 +1,7 @@
 package dbhelper
 
+import "github.com/MrMiaoMIMI/goshared/db/dbspi"
+
 // WithTx makes NewTableStore/NewSoftDeleteTableStore run on tx.
 //
 // If WithTx and WithManager are both provided to a table store factory, WithTx
@@ -13,6 +15,24 @@ func WithTx(tx *Tx) TableStoreOption {
 	return txTableStoreOption{tx: tx}
 }
 
+// WithRowLock makes the Find, Exists, GetById and ExistsById calls of a
+// table store created with WithTx lock the rows they read, e.g. with
+// dbspi.LockForUpdate and dbspi.LockSkipLocked to claim jobs from a queue
+// table. Other stores of the transaction, and reads made with the same ctx
+// through them, do not lock. Without WithTx the store's methods return
+// dbspi.ErrRowLockRequiresTransaction.
+func WithRowLock(lock dbspi.RowLock) TableStoreOption {
+	return rowLockTableStoreOption{lock: lock}
+}
+
+type rowLockTableStoreOption struct {
+	lock dbspi.RowLock
+}
+
+func (o rowLockTableStoreOption) applyTableStoreOption(opts *tableStoreOptions) {
+	opts.rowLock = &o.lock
+}
+
 type txTableStoreOption struct {
 	tx *Tx
 }
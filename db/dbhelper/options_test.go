@@ -2,9 +2,11 @@ package dbhelper
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
 	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
 )
 
@@ -98,3 +100,23 @@ func TestNewSoftDeleteTableStoreWithNilTxReturnsMethodError(t *testing.T) {
 		t.Fatalf("CountNotDeleted error = %v, want transaction nil error", err)
 	}
 }
+
+func TestWithRowLockRequiresTx(t *testing.T) {
+	ctx := context.Background()
+	mgr := newSegmentTestManager()
+	lock := WithRowLock(dbspi.RowLock{Strength: dbspi.LockForUpdate})
+
+	if _, err := NewTableStore(&dbspi.IdSegment{}, WithManager(mgr), lock).GetById(ctx, "order"); !errors.Is(err, dbspi.ErrRowLockRequiresTransaction) {
+		t.Fatalf("locking read outside a transaction err = %v", err)
+	}
+	err := Transaction(ctx, func(tx *Tx) error {
+		if _, err := NewTableStore(&dbspi.IdSegment{}, WithTx(tx), lock).GetById(ctx, "order"); err != nil {
+			return err
+		}
+		_, err := NewTableStore(&dbspi.IdSegment{}, WithManager(mgr)).GetById(ctx, "order")
+		return err
+	}, WithManager(mgr))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -54,3 +54,32 @@ func Asc(column dbspi.Column) dbspi.Order {
 func Desc(column dbspi.Column) dbspi.Order {
 	return dbsp.Desc(column)
 }
+
+// Subquery creates a subquery over the table of entity for InSubquery and
+// Exists conditions. Build query with Select to choose the compared column;
+// InSubquery and NotInSubquery fail unless exactly one column is selected.
+//
+// The logical table name is used; for table-sharded entities use
+// SubqueryTable with the physical table name. Subqueries over tenant-aware
+// entities are isolated to the tenant of ctx, or fail with
+// dbspi.ErrTenantRequired unless dbspi.WithAllTenants is set.
+func Subquery(entity dbspi.Entity, query dbspi.Query) dbspi.Subquery {
+	return dbsp.NewEntitySubquery(entity, query)
+}
+
+// SubqueryTable creates a subquery over the given physical table. The table
+// is not known to be tenant-aware, so add the tenant condition to query
+// yourself.
+func SubqueryTable(table string, query dbspi.Query) dbspi.Subquery {
+	return dbsp.NewSubquery(table, query)
+}
+
+// Exists creates an EXISTS (subquery) condition.
+func Exists(sub dbspi.Subquery) dbspi.Condition {
+	return dbsp.Exists(sub)
+}
+
+// NotExists creates a NOT EXISTS (subquery) condition.
+func NotExists(sub dbspi.Subquery) dbspi.Condition {
+	return dbsp.NotExists(sub)
+}
@@ -0,0 +1,376 @@
+package dbhelper
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/util/validator"
+)
+
+// Reserved query filter parameters.
+const (
+	QueryFilterSortParam = "sort"
+	QueryFilterPageParam = "page"
+	QueryFilterSizeParam = "size"
+)
+
+const (
+	defaultQueryFilterSize       = 20
+	defaultQueryFilterMaxSize    = 100
+	defaultQueryFilterMaxInItems = 100
+)
+
+var conditionType = reflect.TypeOf((*dbspi.Condition)(nil)).Elem()
+
+// QueryFilter parses request parameters into a query and pagination over a
+// whitelist of fields. Each field is filtered by the parameter named after
+// its column:
+//
+//	status=2               status = 2
+//	status=in:1,2          status IN (1, 2), also nin
+//	ctime=gte:1700000000   ctime >= 1700000000, also eq, ne, gt, lt, lte
+//	ctime=between:10,20    ctime BETWEEN 10 AND 20
+//	title=like:50%_off     title LIKE '%50\%\_off%', string fields only
+//	remark=null:true       remark IS NULL, null:false for IS NOT NULL
+//	sort=-ctime,id         ORDER BY ctime DESC, id ASC
+//	page=2&size=20         LIMIT 20 OFFSET 20
+//
+// Repeated parameters are ANDed and empty values are ignored. A value whose
+// prefix is not an operator is compared with eq as a whole. Parameters that
+// are not whitelisted fields, sort, page or size are rejected. like matches
+// its operand literally: %, _ and \ are escaped.
+type QueryFilter struct {
+	fields      map[string]queryFilterField
+	defaultSize int
+	maxSize     int
+	maxInItems  int
+	defaultSort []dbspi.Order
+	ignored     map[string]bool
+}
+
+// QueryFilterResult is a parsed query filter.
+type QueryFilterResult struct {
+	// Query is nil when no filter was given.
+	Query      dbspi.Query
+	Pagination dbspi.Pagination
+	// Page is 1-based. Page and Size are echoed by serverresp.SuccessPage.
+	Page int
+	Size int
+}
+
+type queryFilterField struct {
+	column dbspi.Column
+	field  reflect.Value
+	// valueType is the type parameter of the dbspi.Field.
+	valueType reflect.Type
+}
+
+// NewQueryFilter creates a QueryFilter over fields, which must be
+// dbspi.Field values of string, bool or numeric types. It panics otherwise.
+//
+// Example:
+//
+//	var orderFilter = dbhelper.NewQueryFilter(statusField, ctimeField, shopIDField).
+//		WithDefaultSort(dbhelper.Desc(ctimeField))
+func NewQueryFilter(fields ...dbspi.Column) *QueryFilter {
+	f := &QueryFilter{
+		fields:      make(map[string]queryFilterField, len(fields)),
+		defaultSize: defaultQueryFilterSize,
+		maxSize:     defaultQueryFilterMaxSize,
+		maxInItems:  defaultQueryFilterMaxInItems,
+		ignored:     map[string]bool{},
+	}
+	for _, column := range fields {
+		field := newQueryFilterField(column)
+		switch name := column.Name(); name {
+		case QueryFilterSortParam, QueryFilterPageParam, QueryFilterSizeParam:
+			panic(fmt.Sprintf("dbhelper: query filter field %q clashes with a reserved parameter", name))
+		default:
+			f.fields[name] = field
+		}
+	}
+	return f
+}
+
+func newQueryFilterField(column dbspi.Column) queryFilterField {
+	if column == nil {
+		panic("dbhelper: query filter field is nil")
+	}
+	value := reflect.ValueOf(column)
+	eq := value.MethodByName("Eq")
+	if !eq.IsValid() || eq.Type().NumIn() != 1 || eq.Type().In(0).Kind() != reflect.Pointer ||
+		eq.Type().NumOut() != 1 || eq.Type().Out(0) != conditionType {
+		panic(fmt.Sprintf("dbhelper: query filter field %q is not a dbspi.Field", column.Name()))
+	}
+	valueType := eq.Type().In(0).Elem()
+	switch valueType.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		panic(fmt.Sprintf("dbhelper: query filter field %q has unsupported type %s", column.Name(), valueType))
+	}
+	return queryFilterField{column: column, field: value, valueType: valueType}
+}
+
+// WithDefaultSize sets the page size used when size is omitted. Defaults to
+// 20.
+func (f *QueryFilter) WithDefaultSize(size int) *QueryFilter {
+	f.defaultSize = size
+	return f
+}
+
+// WithMaxSize sets the largest accepted page size. Defaults to 100.
+func (f *QueryFilter) WithMaxSize(size int) *QueryFilter {
+	f.maxSize = size
+	return f
+}
+
+// WithMaxInItems sets the largest number of values accepted by in and nin.
+// Defaults to 100.
+func (f *QueryFilter) WithMaxInItems(n int) *QueryFilter {
+	f.maxInItems = n
+	return f
+}
+
+// WithDefaultSort sets the order used when sort is omitted.
+func (f *QueryFilter) WithDefaultSort(orders ...dbspi.Order) *QueryFilter {
+	f.defaultSort = orders
+	return f
+}
+
+// WithIgnoredParams accepts the parameters named names without filtering on
+// them, for endpoints that read other parameters themselves.
+func (f *QueryFilter) WithIgnoredParams(names ...string) *QueryFilter {
+	for _, name := range names {
+		f.ignored[name] = true
+	}
+	return f
+}
+
+// Parse parses values. Invalid input is reported as validator.ValidationErrors
+// with one entry per offending parameter.
+func (f *QueryFilter) Parse(values url.Values) (*QueryFilterResult, error) {
+	var errs validator.ValidationErrors
+	var conditions []dbspi.Condition
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	// Report errors and build conditions in a stable order.
+	slices.Sort(names)
+	for _, name := range names {
+		if name == QueryFilterSortParam || name == QueryFilterPageParam || name == QueryFilterSizeParam || f.ignored[name] {
+			continue
+		}
+		field, ok := f.fields[name]
+		if !ok {
+			errs = append(errs, &validator.ValidationError{Field: name, Message: "is not a filterable field"})
+			continue
+		}
+		for _, raw := range values[name] {
+			if raw == "" {
+				continue
+			}
+			condition, err := field.condition(raw, f.maxInItems)
+			if err != nil {
+				errs = append(errs, &validator.ValidationError{Field: name, Message: err.Error()})
+				continue
+			}
+			conditions = append(conditions, condition)
+		}
+	}
+
+	page, pageErr := intQueryParam(values, QueryFilterPageParam, 1)
+	if pageErr == nil && page < 1 {
+		pageErr = &validator.ValidationError{Field: QueryFilterPageParam, Message: "must be at least 1"}
+	}
+	size, sizeErr := intQueryParam(values, QueryFilterSizeParam, f.defaultSize)
+	if sizeErr == nil && (size < 1 || size > f.maxSize) {
+		sizeErr = &validator.ValidationError{Field: QueryFilterSizeParam, Message: fmt.Sprintf("must be between 1 and %d", f.maxSize)}
+	}
+	if pageErr == nil && sizeErr == nil && page-1 > math.MaxInt/size {
+		pageErr = &validator.ValidationError{Field: QueryFilterPageParam, Message: "is too large"}
+	}
+	for _, err := range []*validator.ValidationError{pageErr, sizeErr} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	orders, sortErr := f.orders(values.Get(QueryFilterSortParam))
+	if sortErr != nil {
+		errs = append(errs, sortErr)
+	}
+	if errs.HasErrors() {
+		return nil, errs
+	}
+
+	offset := (page - 1) * size
+	pagination := NewPagination().WithLimit(&size).WithOffset(&offset)
+	for _, order := range orders {
+		pagination = pagination.AppendOrder(order)
+	}
+	result := &QueryFilterResult{Pagination: pagination, Page: page, Size: size}
+	if len(conditions) > 0 {
+		result.Query = Q(conditions...)
+	}
+	return result, nil
+}
+
+func intQueryParam(values url.Values, name string, defaultValue int) (int, *validator.ValidationError) {
+	raw := values.Get(name)
+	if raw == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, &validator.ValidationError{Field: name, Message: "must be an integer"}
+	}
+	return n, nil
+}
+
+func (f *QueryFilter) orders(raw string) ([]dbspi.Order, *validator.ValidationError) {
+	if raw == "" {
+		return f.defaultSort, nil
+	}
+	var orders []dbspi.Order
+	for _, name := range strings.Split(raw, ",") {
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		field, ok := f.fields[name]
+		if !ok {
+			return nil, &validator.ValidationError{Field: QueryFilterSortParam, Message: fmt.Sprintf("%q is not a sortable field", name)}
+		}
+		if desc {
+			orders = append(orders, Desc(field.column))
+		} else {
+			orders = append(orders, Asc(field.column))
+		}
+	}
+	return orders, nil
+}
+
+// condition builds the condition of one "op:value" parameter value.
+func (f queryFilterField) condition(raw string, maxInItems int) (dbspi.Condition, error) {
+	op, operand, found := strings.Cut(raw, ":")
+	if !found || !isQueryFilterOperator(op) {
+		op, operand = "eq", raw
+	}
+	switch op {
+	case "eq", "ne", "gt", "gte", "lt", "lte":
+		value, err := f.parse(operand)
+		if err != nil {
+			return nil, err
+		}
+		return f.call(queryFilterMethods[op], value), nil
+	case "in", "nin":
+		items := strings.Split(operand, ",")
+		if len(items) > maxInItems {
+			return nil, fmt.Errorf("%s takes at most %d values", op, maxInItems)
+		}
+		list := reflect.MakeSlice(reflect.SliceOf(f.valueType), 0, len(items))
+		for _, item := range items {
+			value, err := f.parse(item)
+			if err != nil {
+				return nil, err
+			}
+			list = reflect.Append(list, value.Elem())
+		}
+		return f.call(queryFilterMethods[op], list), nil
+	case "between":
+		rawLow, rawHigh, ok := strings.Cut(operand, ",")
+		if !ok {
+			return nil, fmt.Errorf("between takes two values separated by a comma")
+		}
+		low, err := f.parse(rawLow)
+		if err != nil {
+			return nil, err
+		}
+		high, err := f.parse(rawHigh)
+		if err != nil {
+			return nil, err
+		}
+		return f.call("Between", low, high), nil
+	case "like":
+		if f.valueType.Kind() != reflect.String {
+			return nil, fmt.Errorf("like applies to text fields only")
+		}
+		pattern := likeEscaper.Replace(operand)
+		return f.call("Contains", reflect.ValueOf(&pattern)), nil
+	default: // null
+		isNull, err := strconv.ParseBool(operand)
+		if err != nil {
+			return nil, fmt.Errorf("null takes true or false")
+		}
+		if isNull {
+			return f.call("IsNull"), nil
+		}
+		return f.call("IsNotNull"), nil
+	}
+}
+
+// likeEscaper makes like operands match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+var queryFilterMethods = map[string]string{
+	"eq":  "Eq",
+	"ne":  "NotEq",
+	"gt":  "Gt",
+	"gte": "GtEq",
+	"lt":  "Lt",
+	"lte": "LtEq",
+	"in":  "In",
+	"nin": "NotIn",
+}
+
+func isQueryFilterOperator(op string) bool {
+	_, ok := queryFilterMethods[op]
+	return ok || op == "between" || op == "like" || op == "null"
+}
+
+func (f queryFilterField) call(method string, args ...reflect.Value) dbspi.Condition {
+	return f.field.MethodByName(method).Call(args)[0].Interface().(dbspi.Condition)
+}
+
+// parse converts raw to a pointer to a value of the field type.
+func (f queryFilterField) parse(raw string) (reflect.Value, error) {
+	ptr := reflect.New(f.valueType)
+	value := ptr.Elem()
+	switch f.valueType.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return ptr, fmt.Errorf("%q is not a boolean", raw)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, f.valueType.Bits())
+		if err != nil {
+			return ptr, fmt.Errorf("%q is not an integer of %d bits", raw, f.valueType.Bits())
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, f.valueType.Bits())
+		if err != nil {
+			return ptr, fmt.Errorf("%q is not a non-negative integer of %d bits", raw, f.valueType.Bits())
+		}
+		value.SetUint(n)
+	default: // float
+		n, err := strconv.ParseFloat(raw, f.valueType.Bits())
+		if err != nil {
+			return ptr, fmt.Errorf("%q is not a number", raw)
+		}
+		value.SetFloat(n)
+	}
+	return ptr, nil
+}
@@ -0,0 +1,132 @@
+package dbhelper
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/util/validator"
+)
+
+type filterTestOrder struct {
+	dbspi.IdField
+	Status int8   `gorm:"column:status"`
+	Title  string `gorm:"column:title"`
+	Ctime  uint64 `gorm:"column:ctime"`
+}
+
+func (*filterTestOrder) TableName() string { return "filter_order_tab" }
+
+var (
+	filterStatusField = NewField[int8]("status")
+	filterTitleField  = NewField[string]("title")
+	filterCtimeField  = NewField[uint64]("ctime")
+)
+
+func TestQueryFilterParsesConditionsSortAndPage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTableStore(&filterTestOrder{}, WithCommonFieldAutoFill(false))
+	for i, title := range []string{"red shoe", "blue shoe", "red hat", "green shoe", "red shoe"} {
+		order := &filterTestOrder{Status: int8(i%3 + 1), Title: title, Ctime: uint64(100 + i)}
+		if err := store.Create(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := NewQueryFilter(filterStatusField, filterTitleField, filterCtimeField)
+	values, _ := url.ParseQuery("status=in:1,2&ctime=gte:101&title=like:shoe&sort=-ctime&page=1&size=2&remark=")
+	filter.WithIgnoredParams("remark")
+	req, err := filter.Parse(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Page != 1 || req.Size != 2 {
+		t.Fatalf("page = %d, size = %d", req.Page, req.Size)
+	}
+	rows, err := store.Find(ctx, req.Query, req.Pagination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Matching rows are ids 5 (ctime 104), 4 (ctime 103) and 2 (ctime 101).
+	if len(rows) != 2 || rows[0].Id != 5 || rows[1].Id != 4 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if total, err := store.Count(ctx, req.Query); err != nil || total != 3 {
+		t.Fatalf("total = %d, err = %v", total, err)
+	}
+
+	values, _ = url.ParseQuery("status=2&page=2&size=1")
+	req, err = filter.WithDefaultSort(Asc(filterCtimeField)).Parse(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := store.Find(ctx, req.Query, req.Pagination); err != nil || len(rows) != 1 || rows[0].Id != 5 {
+		t.Fatalf("second page = %+v, err = %v", rows, err)
+	}
+}
+
+func TestQueryFilterReportsFieldErrors(t *testing.T) {
+	filter := NewQueryFilter(filterStatusField, filterTitleField, filterCtimeField)
+	values, _ := url.ParseQuery("status=in:1,x&ctime=like:1&owner=bob&sort=-mtime&page=0&size=1000")
+	_, err := filter.Parse(values)
+
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v", err)
+	}
+	got := map[string]bool{}
+	for _, e := range errs {
+		got[e.Field] = true
+	}
+	for _, field := range []string{"status", "ctime", "owner", "sort", "page", "size"} {
+		if !got[field] {
+			t.Errorf("no error for %s in %v", field, err)
+		}
+	}
+}
+
+func TestQueryFilterMatchesLikeLiterally(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTableStore(&filterTestOrder{}, WithCommonFieldAutoFill(false))
+	for _, title := range []string{"50% off", "500 off", "a_b", "axb"} {
+		if err := store.Create(ctx, &filterTestOrder{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := NewQueryFilter(filterTitleField)
+	for raw, want := range map[string]string{"title=like:0%25": "50% off", "title=like:a_b": "a_b"} {
+		values, _ := url.ParseQuery(raw)
+		req, err := filter.Parse(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := store.Find(ctx, req.Query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].Title != want {
+			t.Fatalf("%s matched %+v, want %q", raw, rows, want)
+		}
+	}
+}
+
+func TestQueryFilterRejectsOversizedInput(t *testing.T) {
+	filter := NewQueryFilter(filterStatusField).WithMaxInItems(2)
+	values, _ := url.ParseQuery("status=in:1,2,3&page=9223372036854775807&size=20")
+	_, err := filter.Parse(values)
+
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v", err)
+	}
+	got := map[string]bool{}
+	for _, e := range errs {
+		got[e.Field] = true
+	}
+	if !got["status"] || !got["page"] {
+		t.Fatalf("expected status and page errors, got %v", err)
+	}
+}
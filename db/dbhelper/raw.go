@@ -0,0 +1,40 @@
+package dbhelper
+
+import (
+	"context"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// RawInto runs a raw query through store and scans the rows into R, which
+// can be any struct whose gorm column tags match the selected columns, e.g.
+// a report row with aliases and aggregates.
+//
+// {{table}} in sql is replaced with the quoted physical table name the store
+// routes to. Like SQLTableStore.Raw, sharded stores route with the
+// dbspi.ShardingKey in ctx or the key bound by Shard.
+//
+// Example:
+//
+//	type ShopSales struct {
+//		ShopID int64 `gorm:"column:shop_id"`
+//		Total  int64 `gorm:"column:total"`
+//	}
+//
+//	sqlStore, _ := dbhelper.AsSQLTableStore(orderStore)
+//	rows, err := dbhelper.RawInto[ShopSales](ctx, sqlStore,
+//		"SELECT shop_id, SUM(amount) AS total FROM {{table}} WHERE shop_id = ? GROUP BY shop_id", shopID)
+func RawInto[R any, T dbspi.Entity](ctx context.Context, store dbspi.SQLTableStore[T], sql string, args ...any) ([]R, error) {
+	return dbsp.RawInto[R](ctx, store, sql, args...)
+}
+
+// RawIntoGroup runs a raw query on the database group databaseGroupKey of mgr
+// and scans the rows into R. A nil mgr uses the default manager.
+//
+// Database-sharded groups route with the dbspi.ShardingKey in ctx.
+// {{table:<name>}} in sql is replaced with the quoted physical table name of
+// the logical table <name>, resolved with the same key.
+func RawIntoGroup[R any](ctx context.Context, mgr dbspi.Manager, databaseGroupKey string, sql string, args ...any) ([]R, error) {
+	return dbsp.ManagerRawInto[R](ctx, asInternalManager(mgr), databaseGroupKey, sql, args...)
+}
@@ -0,0 +1,29 @@
+package dbhelper
+
+import (
+	"github.com/MrMiaoMIMI/goshared/cache/cachespi"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// NewTableStoreShardDirectory creates a ShardDirectory backed by a metadata
+// table. Lookup finds the row whose keyColumn equals the looked-up key and maps
+// it to a database target key or physical table name with target.
+//
+// Example:
+//
+//	dir := dbhelper.NewTableStoreShardDirectory(
+//	    dbhelper.NewTableStore(&TenantRoute{}),
+//	    dbhelper.NewField[int64]("tenant_id"),
+//	    func(r *TenantRoute) string { return r.DbKey },
+//	)
+func NewTableStoreShardDirectory[T dbspi.Entity](store dbspi.TableStore[T], keyColumn dbspi.Column, target func(T) string) dbspi.ShardDirectory {
+	return dbsp.NewTableStoreShardDirectory(store, keyColumn, target)
+}
+
+// NewCacheShardDirectory creates a ShardDirectory backed by a cache. Lookup
+// reads the string target stored under keyPrefix+key and reports a cache miss
+// as dbspi.ErrShardDirectoryEntryNotFound.
+func NewCacheShardDirectory(cache cachespi.Cache, keyPrefix string) dbspi.ShardDirectory {
+	return dbsp.NewCacheShardDirectory(cache, keyPrefix)
+}
@@ -0,0 +1,30 @@
+package dbhelper
+
+import (
+	"context"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+)
+
+// PurgeDeleted hard-deletes the rows of store that were soft-deleted before
+// before. The entity must be soft-deleted by timestamp, e.g. by embedding
+// dbspi.DeletedAtField or dbspi.DeletedAtCommonFields, and before is in the
+// unit of the common-field TimeProvider (Unix milliseconds by default).
+// Sharded stores purge every shard, one table at a time in batches of 500
+// rows. Cached stores drop the purged rows; purged rows emit no change events.
+//
+// Example:
+//
+//	cutoff := dbhelper.PurgeCutoff(30 * 24 * time.Hour)
+//	err := dbhelper.PurgeDeleted(dbspi.WithAllTenants(ctx), orderStore, cutoff)
+func PurgeDeleted[T dbspi.Entity](ctx context.Context, store dbspi.TableStore[T], before uint64) error {
+	return dbsp.PurgeDeleted(ctx, store, before)
+}
+
+// PurgeCutoff returns the Unix milliseconds of age ago, as the cutoff for
+// PurgeDeleted with the default TimeProvider.
+func PurgeCutoff(age time.Duration) uint64 {
+	return uint64(time.Now().Add(-age).UnixMilli())
+}
@@ -52,27 +52,44 @@ func Transaction(ctx context.Context, fn func(tx *Tx) error, opts ...Transaction
 	})
 }
 
-func newTxTableStore[T dbspi.Entity](entity T, tx *Tx, commonFields commonFieldPatch) dbspi.TableStore[T] {
+func newTxTableStore[T dbspi.Entity](entity T, tx *Tx, commonFields commonFieldPatch, rowLock *dbspi.RowLock) dbspi.TableStore[T] {
 	if tx == nil || tx.manager == nil {
 		return dbsp.NewErrorTableStore[T](fmt.Errorf("dbhelper: transaction is nil"))
 	}
 	if err := validateTxEntityDatabaseGroupKey(tx, entity); err != nil {
 		return dbsp.NewErrorTableStore[T](err)
 	}
+	mgr, err := tx.managerWithRowLock(rowLock)
+	if err != nil {
+		return dbsp.NewErrorTableStore[T](err)
+	}
 	resolvedCommonFields := commonFields.apply(tx.commonFields)
-	return dbsp.ForWithCommonFieldAutoFill(entity, tx.manager, resolvedCommonFields)
+	return dbsp.ForWithCommonFieldAutoFill(entity, mgr, resolvedCommonFields)
 }
 
-func newTxSoftDeleteTableStore[T dbspi.Entity](entity T, tx *Tx, commonFields commonFieldPatch) dbspi.SoftDeleteTableStore[T] {
+func newTxSoftDeleteTableStore[T dbspi.Entity](entity T, tx *Tx, commonFields commonFieldPatch, rowLock *dbspi.RowLock) dbspi.SoftDeleteTableStore[T] {
 	if tx == nil || tx.manager == nil {
 		return dbsp.NewErrorSoftDeleteTableStore[T](fmt.Errorf("dbhelper: transaction is nil"))
 	}
 	if err := validateTxEntityDatabaseGroupKey(tx, entity); err != nil {
 		return dbsp.NewErrorSoftDeleteTableStore[T](err)
 	}
+	mgr, err := tx.managerWithRowLock(rowLock)
+	if err != nil {
+		return dbsp.NewErrorSoftDeleteTableStore[T](err)
+	}
 
 	resolvedCommonFields := commonFields.apply(tx.commonFields)
-	return dbsp.ForSoftDeleteWithCommonFieldAutoFill(entity, tx.manager, resolvedCommonFields)
+	return dbsp.ForSoftDeleteWithCommonFieldAutoFill(entity, mgr, resolvedCommonFields)
+}
+
+// managerWithRowLock returns the manager of tx, locking reads with rowLock
+// when it is set.
+func (tx *Tx) managerWithRowLock(rowLock *dbspi.RowLock) (*dbsp.Manager, error) {
+	if rowLock == nil {
+		return tx.manager, nil
+	}
+	return tx.manager.WithRowLock(*rowLock)
 }
 
 func resolveTransactionOptions(opts []TransactionOption) transactionOptions {
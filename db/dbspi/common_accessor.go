@@ -10,6 +10,13 @@ type SoftDeleteFieldNameProvider interface {
 	SoftDeleteFieldName() string
 }
 
+// DeletedAtFieldNameProvider customizes the soft-delete timestamp column
+// name. Entities that implement it are soft-deleted by timestamp instead of
+// by the SoftDeleteFieldNameProvider flag.
+type DeletedAtFieldNameProvider interface {
+	DeletedAtFieldName() string
+}
+
 // IdAccessor reads and writes the standard id field.
 type IdAccessor interface {
 	IdFieldNameProvider
@@ -24,6 +31,13 @@ type SoftDeleteAccessor interface {
 	SetDeleted(bool)
 }
 
+// DeletedAtAccessor reads and writes the soft-delete timestamp field.
+type DeletedAtAccessor interface {
+	DeletedAtFieldNameProvider
+	GetDeletedAt() uint64
+	SetDeletedAt(uint64)
+}
+
 // CreateTimeAccessor reads and writes the standard create timestamp field.
 type CreateTimeAccessor interface {
 	GetCtime() uint64
@@ -52,9 +66,18 @@ type UpdaterAccessor interface {
 	UpdaterFieldName() string
 }
 
+// TenantAccessor reads and writes the standard tenant field. Entities that
+// implement it are isolated per tenant by table stores.
+type TenantAccessor interface {
+	GetTenantId() string
+	SetTenantId(string)
+	TenantFieldName() string
+}
+
 var (
 	_ IdAccessor         = (*IdField)(nil)
 	_ SoftDeleteAccessor = (*SoftDeleteField)(nil)
+	_ DeletedAtAccessor  = (*DeletedAtField)(nil)
 	_ CreateTimeAccessor = (*CreateTimeField)(nil)
 	_ UpdateTimeAccessor = (*UpdateTimeField)(nil)
 	_ CreatorAccessor    = (*CreatorField)(nil)
@@ -63,6 +86,7 @@ var (
 	_ UpdateTimeAccessor = (*TimeFields)(nil)
 	_ CreatorAccessor    = (*OperatorFields)(nil)
 	_ UpdaterAccessor    = (*OperatorFields)(nil)
+	_ TenantAccessor     = (*TenantField)(nil)
 
 	_ IdAccessor         = (*CommonFields)(nil)
 	_ SoftDeleteAccessor = (*CommonFields)(nil)
@@ -70,4 +94,11 @@ var (
 	_ UpdateTimeAccessor = (*CommonFields)(nil)
 	_ CreatorAccessor    = (*CommonFields)(nil)
 	_ UpdaterAccessor    = (*CommonFields)(nil)
+
+	_ IdAccessor         = (*DeletedAtCommonFields)(nil)
+	_ DeletedAtAccessor  = (*DeletedAtCommonFields)(nil)
+	_ CreateTimeAccessor = (*DeletedAtCommonFields)(nil)
+	_ UpdateTimeAccessor = (*DeletedAtCommonFields)(nil)
+	_ CreatorAccessor    = (*DeletedAtCommonFields)(nil)
+	_ UpdaterAccessor    = (*DeletedAtCommonFields)(nil)
 )
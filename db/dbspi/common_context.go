@@ -14,3 +14,32 @@ func OperatorFromContext(ctx context.Context) (string, bool) {
 	operator, ok := ctx.Value(operatorCtxKey{}).(string)
 	return operator, ok
 }
+
+type tenantCtxKey struct{}
+
+type allTenantsCtxKey struct{}
+
+// WithTenant injects the current tenant into ctx. Table stores of entities
+// implementing TenantAccessor only read and write rows of this tenant.
+func WithTenant(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenantId)
+}
+
+// TenantFromContext extracts the current tenant from ctx.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantId, ok := ctx.Value(tenantCtxKey{}).(string)
+	return tenantId, ok && tenantId != ""
+}
+
+// WithAllTenants makes table store calls made with ctx skip tenant isolation,
+// for jobs that work across tenants. Creates still stamp the tenant from ctx
+// when there is one.
+func WithAllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allTenantsCtxKey{}, true)
+}
+
+// AllTenantsFromContext reports whether ctx was created by WithAllTenants.
+func AllTenantsFromContext(ctx context.Context) bool {
+	all, _ := ctx.Value(allTenantsCtxKey{}).(bool)
+	return all
+}
@@ -44,6 +44,33 @@ func (*SoftDeleteField) SoftDeleteFieldName() string {
 	return DefaultDeletedFieldName
 }
 
+// DeletedAtField provides a soft-delete timestamp field, an alternative to
+// SoftDeleteField. Zero marks a live row; soft-deleted rows hold the time they
+// were deleted, from the common-field TimeProvider (Unix milliseconds by
+// default). Unlike a bool flag, it lets unique keys include deleted_at so
+// that rows deleted at different times do not collide, and lets old deleted
+// rows be purged.
+type DeletedAtField struct {
+	DeletedAt uint64 `gorm:"column:deleted_at;not null;default:0" json:"deleted_at"`
+}
+
+func (c *DeletedAtField) GetDeletedAt() uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.DeletedAt
+}
+
+func (c *DeletedAtField) SetDeletedAt(v uint64) {
+	if c != nil {
+		c.DeletedAt = v
+	}
+}
+
+func (*DeletedAtField) DeletedAtFieldName() string {
+	return DefaultDeletedAtFieldName
+}
+
 // CreateTimeField provides the standard create timestamp field.
 //
 // By default, dbhelper-managed table stores fill this field with Unix
@@ -144,6 +171,29 @@ func (*UpdaterField) UpdaterFieldName() string {
 	return DefaultUpdaterFieldName
 }
 
+// TenantField provides the standard tenant field. Embedding it puts the
+// entity in tenant mode: table stores isolate its rows to the tenant in ctx.
+type TenantField struct {
+	TenantId string `gorm:"column:tenant_id;size:64;not null;default:''" json:"tenant_id"`
+}
+
+func (c *TenantField) GetTenantId() string {
+	if c == nil {
+		return ""
+	}
+	return c.TenantId
+}
+
+func (c *TenantField) SetTenantId(v string) {
+	if c != nil {
+		c.TenantId = v
+	}
+}
+
+func (*TenantField) TenantFieldName() string {
+	return DefaultTenantFieldName
+}
+
 // OperatorFields provides standard creator and updater fields.
 type OperatorFields struct {
 	CreatorField
@@ -159,3 +209,14 @@ type CommonFields struct {
 	UpdateTimeField
 	SoftDeleteField
 }
+
+// DeletedAtCommonFields is CommonFields with DeletedAtField in place of
+// SoftDeleteField.
+type DeletedAtCommonFields struct {
+	IdField
+	CreatorField
+	UpdaterField
+	CreateTimeField
+	UpdateTimeField
+	DeletedAtField
+}
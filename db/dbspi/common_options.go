@@ -13,6 +13,9 @@ func DefaultTimeProvider(context.Context) uint64 {
 // OperatorProvider resolves the current operator from ctx.
 type OperatorProvider func(ctx context.Context) (string, bool)
 
+// TenantProvider resolves the current tenant from ctx.
+type TenantProvider func(ctx context.Context) (string, bool)
+
 // TimeProvider returns the timestamp value used by common fields.
 //
 // The unit is application-defined. The default provider uses Unix milliseconds.
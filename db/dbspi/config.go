@@ -27,13 +27,27 @@ type DatabaseGroupConfig struct {
 	MaxIdleConns           int `yaml:"max_idle_conns" json:"max_idle_conns"`
 	ConnMaxLifetimeSeconds int `yaml:"conn_max_lifetime_seconds" json:"conn_max_lifetime_seconds"`
 
+	// Statements slower than SlowQueryThresholdMillis are logged at warn level.
+	// Zero uses DefaultSlowQueryThresholdMillis; a negative value disables
+	// slow query logging.
+	SlowQueryThresholdMillis int `yaml:"slow_query_threshold_ms" json:"slow_query_threshold_ms"`
+
 	// Database-level sharding (expression-based).
 	DatabaseSharding *DatabaseShardingConfig `yaml:"database_sharding" json:"database_sharding"`
 
+	// Database-level sharding (directory-based). Mutually exclusive with
+	// DatabaseSharding. Target keys returned by the directory must match
+	// Servers keys.
+	DatabaseDirectory *DirectoryShardingConfig `yaml:"database_directory" json:"database_directory"`
+
 	// Default table-level sharding (expression-based).
 	// Can be overridden per entity via TableRules.
 	TableSharding *TableShardingConfig `yaml:"table_sharding" json:"table_sharding"`
 
+	// Default table-level sharding (directory-based). Mutually exclusive with
+	// TableSharding. Can be overridden per entity via TableRules.
+	TableDirectory *DirectoryShardingConfig `yaml:"table_directory" json:"table_directory"`
+
 	// Per-table sharding overrides.
 	TableRules []TableShardingRuleConfig `yaml:"table_rules" json:"table_rules"`
 
@@ -42,6 +56,36 @@ type DatabaseGroupConfig struct {
 
 	// Max concurrent goroutines for scatter-gather.
 	MaxConcurrency int `yaml:"max_concurrency" json:"max_concurrency"`
+
+	// Default per-operation timeouts. Reads cover Find, Count, Raw and joins;
+	// writes cover every other statement; the transaction timeout bounds a
+	// whole transaction. A deadline already set on the caller's context wins
+	// when it is earlier. Zero leaves operations bounded by the context only.
+	ReadTimeoutMillis        int `yaml:"read_timeout_ms" json:"read_timeout_ms"`
+	WriteTimeoutMillis       int `yaml:"write_timeout_ms" json:"write_timeout_ms"`
+	TransactionTimeoutMillis int `yaml:"transaction_timeout_ms" json:"transaction_timeout_ms"`
+
+	// CircuitBreaker fails operations on a database target fast with
+	// ErrCircuitOpen while the target keeps failing. Each target of the group
+	// has its own breaker. Nil disables circuit breaking.
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker" json:"circuit_breaker"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker of each database target.
+// Zero values use the DefaultCircuitBreakerXxx constants.
+//
+// A closed breaker counts operations in windows of WindowSeconds and opens
+// when at least MinRequests operations ran and FailureRatio of them failed.
+// Only timeouts and connection errors count as failures, not errors such as
+// duplicate keys. After OpenSeconds the breaker is half-open and lets
+// HalfOpenProbes operations through: it closes when they all succeed and
+// opens again on the first failure.
+type CircuitBreakerConfig struct {
+	FailureRatio   float64 `yaml:"failure_ratio" json:"failure_ratio"`
+	MinRequests    int     `yaml:"min_requests" json:"min_requests"`
+	WindowSeconds  int     `yaml:"window_seconds" json:"window_seconds"`
+	OpenSeconds    int     `yaml:"open_seconds" json:"open_seconds"`
+	HalfOpenProbes int     `yaml:"half_open_probes" json:"half_open_probes"`
 }
 
 // TableShardingRuleConfig defines a table sharding override for a group of tables.
@@ -52,6 +96,10 @@ type TableShardingRuleConfig struct {
 	// TableSharding overrides the database-level default for these tables.
 	TableSharding *TableShardingConfig `yaml:"table_sharding" json:"table_sharding"`
 
+	// TableDirectory overrides the database-level default with a
+	// directory-based rule for these tables. Mutually exclusive with TableSharding.
+	TableDirectory *DirectoryShardingConfig `yaml:"table_directory" json:"table_directory"`
+
 	// MaxConcurrency overrides the database-level default.
 	MaxConcurrency *int `yaml:"max_concurrency" json:"max_concurrency"`
 }
@@ -71,6 +119,11 @@ type ServerConfig struct {
 	MaxOpenConns           int `yaml:"max_open_conns" json:"max_open_conns"`
 	MaxIdleConns           int `yaml:"max_idle_conns" json:"max_idle_conns"`
 	ConnMaxLifetimeSeconds int `yaml:"conn_max_lifetime_seconds" json:"conn_max_lifetime_seconds"`
+
+	// Statements slower than SlowQueryThresholdMillis are logged at warn level.
+	// Zero uses DefaultSlowQueryThresholdMillis; a negative value disables
+	// slow query logging.
+	SlowQueryThresholdMillis int `yaml:"slow_query_threshold_ms" json:"slow_query_threshold_ms"`
 }
 
 // NamedServerConfig extends ServerConfig with a routing key for multi-server setups.
@@ -86,6 +139,12 @@ type DatabaseShardingConfig struct {
 
 	// ExpandExprs are variable declarations and computations.
 	ExpandExprs []string `yaml:"expand_exprs" json:"expand_exprs"`
+
+	// LookupMaps are named key-to-value maps used by lookup(key, "map_name")
+	// in ExpandExprs, e.g. to pin VIP tenants to dedicated databases.
+	// Every database a lookup can return must also appear in the := declaration
+	// used to enumerate database targets.
+	LookupMaps map[string]map[string]string `yaml:"lookup_maps" json:"lookup_maps"`
 }
 
 // TableShardingConfig configures table-level sharding via expressions.
@@ -96,3 +155,32 @@ type TableShardingConfig struct {
 	// ExpandExprs are variable declarations and computations.
 	ExpandExprs []string `yaml:"expand_exprs" json:"expand_exprs"`
 }
+
+// DirectoryShardingConfig configures a directory-based sharding rule that maps
+// a key column value to a shard target through a registered ShardDirectory.
+type DirectoryShardingConfig struct {
+	// Directory is the name the ShardDirectory was registered under with
+	// dbhelper.WithShardDirectory.
+	Directory string `yaml:"directory" json:"directory"`
+
+	// KeyColumn is the sharding column whose value is looked up. It is
+	// auto-extracted from entities, ids and queries like @{column} references.
+	KeyColumn string `yaml:"key_column" json:"key_column"`
+
+	// DefaultTarget is used when the directory has no entry for a key.
+	// If empty, unknown keys fail with ErrShardDirectoryEntryNotFound. It must
+	// be one of the configured targets.
+	DefaultTarget string `yaml:"default_target" json:"default_target"`
+
+	// Tables lists every physical table the directory can return. Table
+	// directories require it: FindAll/CountAll enumerate it and lookups
+	// returning other tables fail. Database directories check targets against
+	// Servers instead.
+	Tables []string `yaml:"tables" json:"tables"`
+
+	// Local cache of resolved targets. Zero values use
+	// DefaultShardDirectoryCacheTTLSeconds and DefaultShardDirectoryCacheMaxEntries;
+	// a negative CacheTTLSeconds disables local caching.
+	CacheTTLSeconds int `yaml:"cache_ttl_seconds" json:"cache_ttl_seconds"`
+	CacheMaxEntries int `yaml:"cache_max_entries" json:"cache_max_entries"`
+}
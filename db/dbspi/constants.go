@@ -6,16 +6,43 @@ const (
 	DefaultDatabaseGroupKey = "default"
 
 	// Default common field names used by CommonFields and table store helper methods.
-	DefaultIdFieldName      = "id"
-	DefaultDeletedFieldName = "deleted"
-	DefaultCreatorFieldName = "creator"
-	DefaultUpdaterFieldName = "updater"
-	DefaultCtimeFieldName   = "ctime"
-	DefaultMtimeFieldName   = "mtime"
+	DefaultIdFieldName        = "id"
+	DefaultDeletedFieldName   = "deleted"
+	DefaultDeletedAtFieldName = "deleted_at"
+	DefaultCreatorFieldName   = "creator"
+	DefaultUpdaterFieldName   = "updater"
+	DefaultCtimeFieldName     = "ctime"
+	DefaultMtimeFieldName     = "mtime"
+	DefaultTenantFieldName    = "tenant_id"
 
 	// Default connection pool settings applied when ServerConfig leaves the
 	// corresponding field as zero.
 	DefaultMaxOpenConns           = 100
 	DefaultMaxIdleConns           = 10
 	DefaultConnMaxLifetimeSeconds = 3600
+
+	// Default local cache settings applied when DirectoryShardingConfig leaves
+	// the corresponding field as zero.
+	DefaultShardDirectoryCacheTTLSeconds = 60
+	DefaultShardDirectoryCacheMaxEntries = 10000
+
+	// DefaultReloadDrainTimeoutSeconds bounds how long a config reload waits
+	// for in-flight operations before closing retired connections.
+	DefaultReloadDrainTimeoutSeconds = 30
+
+	// DefaultHealthCheckTimeoutSeconds bounds each target ping of a health
+	// check when the caller does not set a timeout.
+	DefaultHealthCheckTimeoutSeconds = 3
+
+	// DefaultSlowQueryThresholdMillis is the slow query logging threshold used
+	// when ServerConfig leaves SlowQueryThresholdMillis as zero.
+	DefaultSlowQueryThresholdMillis = 200
+
+	// Default circuit breaker settings applied when CircuitBreakerConfig
+	// leaves the corresponding field as zero.
+	DefaultCircuitBreakerFailureRatio   = 0.5
+	DefaultCircuitBreakerMinRequests    = 20
+	DefaultCircuitBreakerWindowSeconds  = 10
+	DefaultCircuitBreakerOpenSeconds    = 5
+	DefaultCircuitBreakerHalfOpenProbes = 3
 )
@@ -40,6 +40,21 @@ type Field[T any] interface {
 	EndsWith(v *string) Condition
 	Contains(v *string) Condition
 	NotContains(v *string) Condition
+
+	// Subquery Methods. sub must select exactly one column, or statements
+	// using the condition fail.
+	InSubquery(sub Subquery) Condition
+	NotInSubquery(sub Subquery) Condition
+
+	// Column Comparison Methods
+	// These compare this field with another column of the same row. They are
+	// never used as sharding keys.
+	EqColumn(other Column) Condition
+	NotEqColumn(other Column) Condition
+	GtColumn(other Column) Condition
+	GtEqColumn(other Column) Condition
+	LtColumn(other Column) Condition
+	LtEqColumn(other Column) Condition
 }
 
 // Query is used to query entities from the database
@@ -47,6 +62,16 @@ type Query interface {
 	Condition
 }
 
+// Subquery is a SELECT over one table used inside a condition, such as
+// Field.InSubquery or dbhelper.Exists.
+//
+// Use dbhelper.Subquery to create values understood by the default
+// implementation. Values compared by a subquery are never used as sharding
+// keys.
+type Subquery interface {
+	Condition
+}
+
 // Updater builds column updates for UpdateById and UpdateByQuery.
 //
 // Use dbhelper.NewUpdater to create values understood by the default table store
@@ -55,6 +80,16 @@ type Updater interface {
 	Set(column Column, value any) Updater
 	SetMap(columnMap map[Column]any) Updater
 	Remove(column Column) Updater
+
+	// Incr sets column = column + delta in SQL, so concurrent updates do not
+	// overwrite each other. Use a negative delta to decrement.
+	Incr(column Column, delta any) Updater
+
+	// SetExpr sets column to a SQL expression. Use ? placeholders for args;
+	// args that are Columns are rendered as quoted column names and all other
+	// args are bound as parameters, e.g.
+	// SetExpr(total, "? * ?", price, quantity) or SetExpr(name, "UPPER(?)", name).
+	SetExpr(column Column, expr string, args ...any) Updater
 }
 
 // Entity is a database model that declares its logical table name.
@@ -108,6 +143,19 @@ type TableStore[T Entity] interface {
 	// FirstOrCreate returns the first entity matching the query, creating it if not found.
 	FirstOrCreate(ctx context.Context, entity T, query Query) (T, error)
 
+	// Upsert inserts entity or, when it conflicts with an existing row on a
+	// primary or unique key, updates that row in the same statement
+	// (INSERT ... ON DUPLICATE KEY UPDATE on MySQL). conflictColumns name the
+	// unique key for dialects that need it; MySQL ignores them.
+	//
+	// updater lists the columns changed on conflict. A nil updater updates
+	// every column except the primary key, conflictColumns and the ctime and
+	// creator common fields.
+	Upsert(ctx context.Context, entity T, conflictColumns []Column, updater Updater) error
+	// BatchUpsert is the batch form of Upsert. On sharded tables rows are
+	// grouped by target shard and each group is written in its own statements.
+	BatchUpsert(ctx context.Context, entities []T, conflictColumns []Column, updater Updater, batchSize int) error
+
 	// Scatter-gather methods across all shards.
 	// For non-sharded TableStore, FindAll is equivalent to Find, CountAll is equivalent to Count.
 	//
@@ -0,0 +1,57 @@
+package dbspi
+
+// DefaultArchiveCheckpointTableName is the table archive jobs record their
+// progress in. Each database holding archived tables needs one:
+//
+//	CREATE TABLE archive_checkpoint_tab (
+//	    checkpoint_key VARCHAR(255)    NOT NULL PRIMARY KEY,
+//	    job            VARCHAR(128)    NOT NULL,
+//	    database_key   VARCHAR(128)    NOT NULL DEFAULT '',
+//	    table_name     VARCHAR(128)    NOT NULL,
+//	    last_id        BIGINT UNSIGNED NOT NULL DEFAULT 0,
+//	    archived       BIGINT UNSIGNED NOT NULL DEFAULT 0,
+//	    mtime          BIGINT UNSIGNED NOT NULL DEFAULT 0
+//	);
+const DefaultArchiveCheckpointTableName = "archive_checkpoint_tab"
+
+// ArchiveCheckpoint is the progress of one archive job on one physical table.
+// It is written in the transaction that deletes the archived rows, so a job
+// restarted after a crash resumes after the last committed batch.
+type ArchiveCheckpoint struct {
+	// CheckpointKey is "<job>:<database>:<table>".
+	CheckpointKey string `gorm:"column:checkpoint_key;primaryKey" json:"checkpoint_key"`
+	Job           string `gorm:"column:job" json:"job"`
+	// Database is the DatabaseTarget key of the table, empty for tables of
+	// groups without database sharding.
+	Database string `gorm:"column:database_key" json:"database_key"`
+	Table    string `gorm:"column:table_name" json:"table_name"`
+	// LastId is the largest id archived by the unfinished run, or 0 once a
+	// run has covered the whole table.
+	LastId uint64 `gorm:"column:last_id" json:"last_id"`
+	// Archived is the number of rows archived from the table by all runs.
+	Archived uint64 `gorm:"column:archived" json:"archived"`
+	UpdateTimeField
+}
+
+func (*ArchiveCheckpoint) TableName() string   { return DefaultArchiveCheckpointTableName }
+func (*ArchiveCheckpoint) IdFieldName() string { return "checkpoint_key" }
+
+// ArchiveReport is the outcome of one archive or purge run.
+type ArchiveReport struct {
+	// Archived is the number of rows moved, or deleted by a purge, by this
+	// run.
+	Archived uint64
+	// Tables holds one entry per physical table the run covered.
+	Tables []ArchiveTableReport
+}
+
+// ArchiveTableReport is the outcome of one archive run on one physical table.
+type ArchiveTableReport struct {
+	Database string
+	Table    string
+	// Archived is the number of rows moved from the table by this run.
+	Archived uint64
+	// Resumed is true when the run continued after the checkpoint of an
+	// interrupted run.
+	Resumed bool
+}
@@ -0,0 +1,60 @@
+package dbspi
+
+import "encoding/json"
+
+// DefaultAuditTableName is the table audit records are written to. Each
+// database holding audited rows needs one:
+//
+//	CREATE TABLE audit_log_tab (
+//	    id           BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	    entity_table VARCHAR(128) NOT NULL,
+//	    entity_id    VARCHAR(128) NOT NULL,
+//	    operation    VARCHAR(32)  NOT NULL,
+//	    operator     VARCHAR(128) NOT NULL DEFAULT '',
+//	    trace_id     VARCHAR(64)  NOT NULL DEFAULT '',
+//	    changes      JSON         NOT NULL,
+//	    ctime        BIGINT UNSIGNED NOT NULL DEFAULT 0,
+//	    KEY idx_entity (entity_table, entity_id, id)
+//	);
+const DefaultAuditTableName = "audit_log_tab"
+
+// AuditRecord is one audited change of one row.
+type AuditRecord struct {
+	Id uint64 `gorm:"primaryKey;column:id" json:"id"`
+	// EntityTable is the logical table name of the changed row.
+	EntityTable string `gorm:"column:entity_table" json:"entity_table"`
+	// EntityId is the primary key of the changed row, formatted with %v.
+	EntityId  string          `gorm:"column:entity_id" json:"entity_id"`
+	Operation ChangeOperation `gorm:"column:operation" json:"operation"`
+	// Operator is taken from OperatorFromContext.
+	Operator string `gorm:"column:operator" json:"operator"`
+	// TraceId is the request trace id, if any.
+	TraceId string `gorm:"column:trace_id" json:"trace_id"`
+	// Changes is the JSON encoding of []AuditChange. Use ChangeList to
+	// decode it.
+	Changes string `gorm:"column:changes" json:"changes"`
+	// Ctime is the time of the change in Unix milliseconds.
+	Ctime uint64 `gorm:"column:ctime" json:"ctime"`
+}
+
+func (*AuditRecord) TableName() string {
+	return DefaultAuditTableName
+}
+
+// ChangeList decodes Changes.
+func (r *AuditRecord) ChangeList() ([]AuditChange, error) {
+	var changes []AuditChange
+	if r == nil || r.Changes == "" {
+		return changes, nil
+	}
+	err := json.Unmarshal([]byte(r.Changes), &changes)
+	return changes, err
+}
+
+// AuditChange is the old and new value of one changed column. Old is nil for
+// created rows and New is nil for deleted rows.
+type AuditChange struct {
+	Column string `json:"column"`
+	Old    any    `json:"old"`
+	New    any    `json:"new"`
+}
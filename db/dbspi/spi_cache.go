@@ -0,0 +1,21 @@
+package dbspi
+
+import "context"
+
+// CachedTableStore is a TableStore that serves GetById, ExistsById and
+// GetByUniqueKey from a cache and invalidates cached entities on writes.
+//
+// Use dbhelper.NewCachedTableStore to create one.
+type CachedTableStore[T Entity] interface {
+	TableStore[T]
+
+	// GetByUniqueKey returns the entity whose unique key declared as name
+	// (see dbhelper.WithCacheUniqueKey) has the given column values, in the
+	// declared column order. It returns the zero T and a nil error when no row
+	// matches, like GetById.
+	GetByUniqueKey(ctx context.Context, name string, values ...any) (T, error)
+
+	// Invalidate drops the cached entities with the given ids, e.g. after a
+	// raw SQL write. Inside a transaction it runs after commit.
+	Invalidate(ctx context.Context, ids ...any) error
+}
@@ -0,0 +1,70 @@
+package dbspi
+
+import (
+	"context"
+	"time"
+)
+
+// ChangeOperation is the kind of mutation a ChangeEvent describes.
+type ChangeOperation string
+
+const (
+	ChangeCreate     ChangeOperation = "create"
+	ChangeUpdate     ChangeOperation = "update"
+	ChangeDelete     ChangeOperation = "delete"
+	ChangeUpsert     ChangeOperation = "upsert"
+	ChangeSoftDelete ChangeOperation = "soft_delete"
+	ChangeRestore    ChangeOperation = "restore"
+)
+
+// ChangeTarget is the physical location a mutation was routed to.
+type ChangeTarget struct {
+	// DatabaseGroup is the database group key of the entity.
+	DatabaseGroup string `json:"database_group"`
+	// Database is the DatabaseTarget key for database-sharded groups and
+	// empty otherwise.
+	Database string `json:"database,omitempty"`
+	// Table is the physical table name.
+	Table string `json:"table"`
+}
+
+// ChangeEvent describes one row changed through a TableStore.
+type ChangeEvent struct {
+	// Table is the logical table name, Entity.TableName().
+	Table string `json:"table"`
+	// EntityType is the Go type name of the entity, e.g. "model.User".
+	EntityType string          `json:"entity_type"`
+	Operation  ChangeOperation `json:"operation"`
+	// PrimaryKey is the id of the changed row. It is empty for rows created
+	// without an id that the database did not report back.
+	PrimaryKey any `json:"primary_key"`
+	// Before is the row as read before the write, for Update, Save, Delete
+	// and Upsert of an entity with an id. With the audit log enabled it is
+	// also set for writes by id and by query.
+	Before any `json:"before,omitempty"`
+	// After is the entity written, for Create, Save, Update and Upsert. With
+	// the audit log enabled it is the row read back after any write that
+	// leaves the row in place.
+	After  any          `json:"after,omitempty"`
+	Target ChangeTarget `json:"target"`
+	Time   time.Time    `json:"time"`
+}
+
+// ChangeSink receives the change events of table stores created with
+// dbhelper.WithChangeSinks.
+//
+// Emit is called synchronously once the write has succeeded, or once the
+// transaction it ran in has committed, with the events of one TableStore
+// call. Errors are logged; the write is not rolled back. Use a transactional
+// outbox when events must not be lost.
+type ChangeSink interface {
+	Emit(ctx context.Context, events []ChangeEvent) error
+}
+
+// ChangeSinkFunc adapts a function to ChangeSink.
+type ChangeSinkFunc func(ctx context.Context, events []ChangeEvent) error
+
+// Emit implements ChangeSink.
+func (f ChangeSinkFunc) Emit(ctx context.Context, events []ChangeEvent) error {
+	return f(ctx, events)
+}
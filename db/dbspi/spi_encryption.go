@@ -0,0 +1,27 @@
+package dbspi
+
+import "context"
+
+// EncryptTagName is the struct tag that marks encrypted entity fields.
+//
+//	Phone      string `gorm:"column:phone" goshared:"encrypt;blind_index:phone_bidx"`
+//	PhoneIndex string `gorm:"column:phone_bidx"`
+//
+// "encrypt" stores the field as ciphertext. "blind_index:<column>" also
+// stores a blind index of the plaintext in another string field of the
+// entity, so that Eq/NotEq/In/NotIn on the encrypted column can be served by
+// the index column.
+const EncryptTagName = "goshared"
+
+// FieldEncryptor encrypts the string fields of entities tagged with
+// EncryptTagName. Table stores take one via dbhelper.WithFieldEncryptor.
+//
+// Ciphertexts must name the key they were encrypted with, so that rows
+// written under a retired key still decrypt after the key is rotated.
+// BlindIndex must be deterministic: equal plaintexts of a column give equal
+// indexes.
+type FieldEncryptor interface {
+	Encrypt(ctx context.Context, plaintext string) (string, error)
+	Decrypt(ctx context.Context, ciphertext string) (string, error)
+	BlindIndex(ctx context.Context, column, plaintext string) (string, error)
+}
@@ -0,0 +1,93 @@
+package dbspi
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// IdGenerator hands out ids for rows created without one. Sharded tables
+// cannot rely on AUTO_INCREMENT, so their stores take one via
+// dbhelper.WithIdGenerator.
+//
+// NextId is called once per row with the logical table name,
+// Entity.TableName(), so a generator can keep one sequence per table. Ids
+// must be unique across every shard of the table and greater than zero.
+type IdGenerator interface {
+	NextId(ctx context.Context, table string) (uint64, error)
+}
+
+// IdGeneratorFunc adapts a function to IdGenerator.
+type IdGeneratorFunc func(ctx context.Context, table string) (uint64, error)
+
+// NextId calls f.
+func (f IdGeneratorFunc) NextId(ctx context.Context, table string) (uint64, error) {
+	return f(ctx, table)
+}
+
+// MaxIdProvider is implemented by IdGenerators that know the largest id they
+// can return. Table stores with id shard bits check it when they are built,
+// so that a generator whose ids cannot make room for the shard bits is
+// rejected up front instead of failing on Create.
+type MaxIdProvider interface {
+	MaxId() uint64
+}
+
+// DefaultIdSegmentTableName is the table that backs
+// dbhelper.NewSegmentAllocator and dbhelper.LeaseSnowflakeMachineId. It
+// lives in the default database group:
+//
+//	CREATE TABLE id_segment_tab (
+//	    biz_tag     VARCHAR(128)    NOT NULL PRIMARY KEY,
+//	    max_id      BIGINT UNSIGNED NOT NULL DEFAULT 0,
+//	    step        BIGINT UNSIGNED NOT NULL DEFAULT 0,
+//	    owner       VARCHAR(128)    NOT NULL DEFAULT '',
+//	    lease_until BIGINT UNSIGNED NOT NULL DEFAULT 0,
+//	    mtime       BIGINT UNSIGNED NOT NULL DEFAULT 0
+//	);
+const DefaultIdSegmentTableName = "id_segment_tab"
+
+// IdSegment is a row of DefaultIdSegmentTableName. Segment rows hold the
+// largest id handed out for a business tag; machine id lease rows hold the
+// lease owner and expiry.
+type IdSegment struct {
+	BizTag     string `gorm:"column:biz_tag;primaryKey" json:"biz_tag"`
+	MaxId      uint64 `gorm:"column:max_id" json:"max_id"`
+	Step       uint64 `gorm:"column:step" json:"step"`
+	Owner      string `gorm:"column:owner" json:"owner"`
+	LeaseUntil uint64 `gorm:"column:lease_until" json:"lease_until"` // Unix milliseconds
+	UpdateTimeField
+}
+
+func (*IdSegment) TableName() string   { return DefaultIdSegmentTableName }
+func (*IdSegment) IdFieldName() string { return "biz_tag" }
+
+// SegmentConfig configures a segment allocator.
+type SegmentConfig struct {
+	Step          uint64  // ids reserved per database round trip for new tags; the step stored in a tag's row wins
+	PrefetchRatio float64 // fraction of a segment handed out before the next one is reserved in the background
+}
+
+// DefaultSegmentConfig returns a config with a step of 1000 that prefetches
+// once 10% of a segment has been handed out.
+func DefaultSegmentConfig() SegmentConfig {
+	return SegmentConfig{
+		Step:          1000,
+		PrefetchRatio: 0.1,
+	}
+}
+
+// ErrMachineIdUnavailable is returned when every snowflake machine id is
+// leased by another owner.
+var ErrMachineIdUnavailable = errors.New("all snowflake machine ids are leased")
+
+// MachineLeaseConfig configures a snowflake machine id lease.
+type MachineLeaseConfig struct {
+	TTL   time.Duration // lease duration, renewed every TTL/3; must exceed the clock skew between hosts
+	Owner string        // identifies this process in the lease rows; defaults to hostname, pid and a random suffix
+}
+
+// DefaultMachineLeaseConfig returns a config with a one-minute TTL.
+func DefaultMachineLeaseConfig() MachineLeaseConfig {
+	return MachineLeaseConfig{TTL: time.Minute}
+}
@@ -0,0 +1,42 @@
+package dbspi
+
+import "context"
+
+// JoinQuery builds a SELECT over several tables joined on column equality and
+// scans each row into the projection type R.
+//
+// Every joined entity is addressed by its logical table name, which is used as
+// the table alias in the generated SQL. Qualify columns with
+// dbhelper.TableField so that Select, On and Where conditions reference the
+// right table. Each entity may be joined once; self-joins are not supported.
+//
+// All entities must belong to the same database group. For sharded groups the
+// sharding key of each entity, taken from Shard or from ctx, must route every
+// entity to the same physical database; physical table names are resolved per
+// entity.
+type JoinQuery[R any] interface {
+	// InnerJoin adds entity with INNER JOIN ... ON the AND of on. At least
+	// one ON condition is required.
+	InnerJoin(entity Entity, on ...Condition) JoinQuery[R]
+
+	// LeftJoin adds entity with LEFT JOIN ... ON the AND of on. At least one
+	// ON condition is required.
+	LeftJoin(entity Entity, on ...Condition) JoinQuery[R]
+
+	// Select sets the projected columns. Without Select the query selects *,
+	// so columns with the same name in several tables are ambiguous.
+	Select(columns ...Column) JoinQuery[R]
+
+	// Where adds conditions combined with AND.
+	Where(conditions ...Condition) JoinQuery[R]
+
+	// Shard sets the sharding key used to route entity. It overrides the
+	// ShardingKey in ctx for that entity.
+	Shard(entity Entity, key *ShardingKey) JoinQuery[R]
+
+	// Find runs the query and scans rows into R.
+	Find(ctx context.Context, pagination Pagination) ([]R, error)
+
+	// Count returns the number of joined rows.
+	Count(ctx context.Context) (uint64, error)
+}
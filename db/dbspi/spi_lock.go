@@ -0,0 +1,38 @@
+package dbspi
+
+import "errors"
+
+// ErrRowLockRequiresTransaction is returned when a locking read is attempted
+// outside a transaction, where the lock would be released immediately.
+var ErrRowLockRequiresTransaction = errors.New("row lock requires a transaction: " +
+	"build the table store with dbhelper.WithRowLock and dbhelper.WithTx")
+
+// LockStrength selects the kind of row lock taken by a locking read.
+type LockStrength string
+
+const (
+	// LockForUpdate takes exclusive locks (SELECT ... FOR UPDATE).
+	LockForUpdate LockStrength = "UPDATE"
+	// LockForShare takes shared locks (SELECT ... FOR SHARE).
+	LockForShare LockStrength = "SHARE"
+)
+
+// LockWait controls what a locking read does with rows locked by others.
+type LockWait string
+
+const (
+	// LockWaitBlock waits for conflicting locks to be released.
+	LockWaitBlock LockWait = ""
+	// LockNoWait fails immediately if a matching row is locked.
+	LockNoWait LockWait = "NOWAIT"
+	// LockSkipLocked skips rows locked by other transactions, e.g. to claim
+	// jobs from a queue table.
+	LockSkipLocked LockWait = "SKIP LOCKED"
+)
+
+// RowLock configures the locking reads of a table store built with
+// dbhelper.WithRowLock.
+type RowLock struct {
+	Strength LockStrength
+	Wait     LockWait
+}
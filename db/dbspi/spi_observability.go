@@ -0,0 +1,90 @@
+package dbspi
+
+import (
+	"context"
+	"time"
+)
+
+// ================== Health ==================
+
+// TargetHealth is the result of pinging one physical database target.
+type TargetHealth struct {
+	// DatabaseGroupKey is the database group the target belongs to.
+	DatabaseGroupKey string
+	// TargetKey is the database target key within the group. Non-sharded
+	// groups report "0".
+	TargetKey string
+	// Latency is the round-trip time of the ping.
+	Latency time.Duration
+	// Err is the ping error, nil if the target is reachable.
+	Err error
+	// Circuit is the state of the target's circuit breaker, empty when the
+	// group has no circuit breaker.
+	Circuit CircuitState
+}
+
+// Healthy reports whether the target answered the ping.
+func (h TargetHealth) Healthy() bool {
+	return h.Err == nil
+}
+
+// HealthReport aggregates TargetHealth for every target of a Manager.
+type HealthReport struct {
+	Targets []TargetHealth
+}
+
+// Healthy reports whether every target answered the ping.
+func (r HealthReport) Healthy() bool {
+	for _, target := range r.Targets {
+		if !target.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// ================== Pool Stats ==================
+
+// PoolStats is a snapshot of the connection pool of one physical database
+// target.
+type PoolStats struct {
+	DatabaseGroupKey string
+	TargetKey        string
+
+	MaxOpenConnections int
+	OpenConnections    int
+	InUse              int
+	Idle               int
+
+	// WaitCount is the total number of connections waited for.
+	WaitCount int64
+	// WaitDuration is the total time blocked waiting for a new connection.
+	WaitDuration time.Duration
+}
+
+// ================== Metrics ==================
+
+// QueryObservation describes one SQL statement executed by a table store.
+type QueryObservation struct {
+	DatabaseGroupKey string
+	// Database is the physical database name, empty when the server is
+	// configured by DSN.
+	Database string
+	// Table is the physical table name.
+	Table string
+	// Operation is one of "create", "query", "update", "delete", "row" and
+	// "raw".
+	Operation string
+	Duration  time.Duration
+	// Err is the statement error. Record-not-found errors from single-row
+	// lookups are reported as well; recorders decide whether to count them.
+	Err error
+}
+
+// MetricsRecorder receives query observations from a Manager.
+//
+// ObserveQuery is called synchronously after every statement, so
+// implementations must be safe for concurrent use and should not block.
+type MetricsRecorder interface {
+	ObserveQuery(ctx context.Context, obs QueryObservation)
+}
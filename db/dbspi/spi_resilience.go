@@ -0,0 +1,71 @@
+package dbspi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCircuitOpen is returned for operations on a database target whose
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("database target circuit breaker is open")
+
+// CircuitState is the state of a database target's circuit breaker.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+type partialResultsCtxKey struct{}
+
+// WithPartialResults makes FindAll and CountAll calls made with ctx return
+// the results of the shards that succeeded together with a
+// *PartialResultError naming the shards that failed, instead of failing the
+// whole call on the first shard error.
+func WithPartialResults(ctx context.Context) context.Context {
+	return context.WithValue(ctx, partialResultsCtxKey{}, true)
+}
+
+// PartialResultsFromContext reports whether ctx was marked by
+// WithPartialResults.
+func PartialResultsFromContext(ctx context.Context) bool {
+	partial, _ := ctx.Value(partialResultsCtxKey{}).(bool)
+	return partial
+}
+
+// ShardFailure is the error of one physical table in a scatter-gather call.
+type ShardFailure struct {
+	// Database is the DatabaseTarget key, empty for groups without database
+	// sharding.
+	Database string
+	Table    string
+	Err      error
+}
+
+// PartialResultError is returned with the results of a scatter-gather call
+// made with WithPartialResults when some shards failed.
+type PartialResultError struct {
+	Failures []ShardFailure
+}
+
+func (e *PartialResultError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, failure := range e.Failures {
+		msgs[i] = fmt.Sprintf("%s/%s: %v", failure.Database, failure.Table, failure.Err)
+	}
+	return fmt.Sprintf("%d shards failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the shard errors, so errors.Is(err, ErrCircuitOpen) reports
+// whether any shard was skipped by its circuit breaker.
+func (e *PartialResultError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, failure := range e.Failures {
+		errs[i] = failure.Err
+	}
+	return errs
+}
@@ -11,6 +11,27 @@ import (
 var ErrShardingKeyRequired = errors.New("sharding key is required: " +
 	"use Shard(key) or pass via WithShardingKey(ctx, key)")
 
+// ErrShardDirectoryEntryNotFound is returned by ShardDirectory.Lookup when the
+// directory has no mapping for the given key.
+var ErrShardDirectoryEntryNotFound = errors.New("shard directory entry not found")
+
+// ================== ShardDirectory ==================
+
+// ShardDirectory resolves a sharding key value to a shard target through an
+// external mapping, such as a metadata table or a cache.
+//
+// Directory-based sharding rules call Lookup with the string form of the
+// configured key column and treat the returned string as the database target
+// key or physical table name. Implementations should return
+// ErrShardDirectoryEntryNotFound when no mapping exists.
+//
+// Use dbhelper.NewTableStoreShardDirectory or dbhelper.NewCacheShardDirectory
+// for the built-in implementations, and register them with
+// dbhelper.WithShardDirectory.
+type ShardDirectory interface {
+	Lookup(ctx context.Context, key string) (target string, err error)
+}
+
 // ================== ShardingKey ==================
 
 // ShardingKey is a composite sharding key that maps column names to values.
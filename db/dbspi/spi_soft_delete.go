@@ -3,6 +3,11 @@ package dbspi
 import "context"
 
 // SoftDeleteTableStore extends TableStore with soft-delete operations.
+//
+// Entities implementing DeletedAtFieldNameProvider, e.g. by embedding
+// DeletedAtField, are soft-deleted by setting the deleted_at timestamp, and
+// restored by resetting it to zero; the "flag" below then refers to it.
+// Soft-deleting a row that is already deleted keeps its original timestamp.
 type SoftDeleteTableStore[T Entity] interface {
 	TableStore[T]
 
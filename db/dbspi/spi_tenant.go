@@ -0,0 +1,12 @@
+package dbspi
+
+import "errors"
+
+// ErrTenantRequired is returned when a table store of an entity implementing
+// TenantAccessor is used without a tenant in ctx.
+var ErrTenantRequired = errors.New("tenant is required: " +
+	"pass via WithTenant(ctx, tenantId), or WithAllTenants(ctx) for cross-tenant jobs")
+
+// ErrCrossTenant is returned when a write names a tenant other than the one
+// in ctx, or targets a row owned by another tenant.
+var ErrCrossTenant = errors.New("cross-tenant write rejected")
@@ -0,0 +1,556 @@
+// Package columngen generates typed column sets for entity structs.
+//
+// It reads entity declarations from source, so it runs before the package
+// compiles, and resolves columns the way gorm does: the column tag, or the
+// snake_case field name, fields embedded from the same package or from dbspi
+// (e.g. dbspi.CommonFields), and embedded:"true" fields with embeddedPrefix.
+package columngen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp"
+
+	"gorm.io/gorm/schema"
+)
+
+const (
+	dbspiPath    = "github.com/MrMiaoMIMI/goshared/db/dbspi"
+	dbhelperPath = "github.com/MrMiaoMIMI/goshared/db/dbhelper"
+)
+
+// dbspiEmbeddables are the dbspi field sets entities may embed.
+var dbspiEmbeddables = map[string]reflect.Type{
+	"CommonFields":    reflect.TypeOf(dbspi.CommonFields{}),
+	"TimeFields":      reflect.TypeOf(dbspi.TimeFields{}),
+	"IdField":         reflect.TypeOf(dbspi.IdField{}),
+	"SoftDeleteField": reflect.TypeOf(dbspi.SoftDeleteField{}),
+	"CreateTimeField": reflect.TypeOf(dbspi.CreateTimeField{}),
+	"UpdateTimeField": reflect.TypeOf(dbspi.UpdateTimeField{}),
+	"CreatorField":    reflect.TypeOf(dbspi.CreatorField{}),
+	"UpdaterField":    reflect.TypeOf(dbspi.UpdaterField{}),
+}
+
+// Options configures Generate.
+type Options struct {
+	// Dir is the directory of the package declaring the entities.
+	Dir string
+	// Types are the names of the entity structs to generate columns for.
+	Types []string
+	// Output is the name of the generated file. It is skipped when reading
+	// Dir so that a stale file does not break generation.
+	Output string
+	// Config, when set, adds a <Type>ShardingKey constructor for every entity
+	// whose database group shards its table by column.
+	Config *dbspi.DatabaseConfig
+}
+
+// columnSpec is one generated column of an entity.
+type columnSpec struct {
+	// Field is the Go field name, used as the name of the typed column.
+	Field string
+	// Name is the database column name.
+	Name string
+	// Type is the Go type of the column values, without a leading pointer.
+	Type string
+}
+
+// entitySpec is an entity struct read from source.
+type entitySpec struct {
+	Name    string
+	Table   string
+	Group   string
+	Columns []columnSpec
+}
+
+// Generate returns the formatted source of the column sets of opts.Types.
+func Generate(opts Options) ([]byte, error) {
+	if len(opts.Types) == 0 {
+		return nil, fmt.Errorf("columngen: no entity types given")
+	}
+	pkg, err := parsePackage(opts.Dir, opts.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &output{imports: map[string]string{dbspiPath: "dbspi", dbhelperPath: "dbhelper"}}
+	var body bytes.Buffer
+	for _, name := range opts.Types {
+		entity, err := pkg.entity(name, out)
+		if err != nil {
+			return nil, err
+		}
+		writeColumns(&body, entity)
+		if opts.Config == nil {
+			continue
+		}
+		if err := writeShardingKey(&body, entity, *opts.Config); err != nil {
+			return nil, err
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by columngen. DO NOT EDIT.\n\npackage %s\n\n", pkg.name)
+	src.WriteString(out.importDecl())
+	src.Write(body.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("columngen: format generated source: %w", err)
+	}
+	return formatted, nil
+}
+
+type sourcePackage struct {
+	name    string
+	types   map[string]*ast.TypeSpec
+	files   map[*ast.TypeSpec]*ast.File
+	methods map[string]map[string]*ast.FuncDecl
+}
+
+func parsePackage(dir, skip string) (*sourcePackage, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &sourcePackage{
+		types:   make(map[string]*ast.TypeSpec),
+		files:   make(map[*ast.TypeSpec]*ast.File),
+		methods: make(map[string]map[string]*ast.FuncDecl),
+	}
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		base := filepath.Base(path)
+		if strings.HasSuffix(base, "_test.go") || (skip != "" && base == filepath.Base(skip)) {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("columngen: %w", err)
+		}
+		if pkg.name == "" {
+			pkg.name = file.Name.Name
+		}
+		if file.Name.Name != pkg.name {
+			continue
+		}
+		pkg.collect(file)
+	}
+	if pkg.name == "" {
+		return nil, fmt.Errorf("columngen: no Go files in %s", dir)
+	}
+	return pkg, nil
+}
+
+func (p *sourcePackage) collect(file *ast.File) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					p.types[ts.Name.Name] = ts
+					p.files[ts] = file
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) != 1 {
+				continue
+			}
+			recv := decl.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			ident, ok := recv.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			if p.methods[ident.Name] == nil {
+				p.methods[ident.Name] = make(map[string]*ast.FuncDecl)
+			}
+			p.methods[ident.Name][decl.Name.Name] = decl
+		}
+	}
+}
+
+func (p *sourcePackage) entity(name string, out *output) (entitySpec, error) {
+	ts, ok := p.types[name]
+	if !ok {
+		return entitySpec{}, fmt.Errorf("columngen: type %s not found in package %s", name, p.name)
+	}
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return entitySpec{}, fmt.Errorf("columngen: %s is not a struct", name)
+	}
+	entity := entitySpec{
+		Name:  name,
+		Table: p.stringMethod(name, "TableName"),
+		Group: p.stringMethod(name, "DatabaseGroupKey"),
+	}
+	if entity.Table == "" {
+		entity.Table = schema.NamingStrategy{}.TableName(name)
+	}
+	if entity.Group == "" {
+		entity.Group = dbspi.DefaultDatabaseGroupKey
+	}
+	columns, err := p.structColumns(p.files[ts], st, "", out)
+	if err != nil {
+		return entitySpec{}, fmt.Errorf("columngen: %s: %w", name, err)
+	}
+	seen := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		if seen[col.Field] {
+			return entitySpec{}, fmt.Errorf("columngen: %s: duplicate field %s", name, col.Field)
+		}
+		seen[col.Field] = true
+	}
+	entity.Columns = columns
+	return entity, nil
+}
+
+// stringMethod returns the string literal returned by the method of typeName,
+// or "" when the method is missing or computes its result.
+func (p *sourcePackage) stringMethod(typeName, method string) string {
+	decl := p.methods[typeName][method]
+	if decl == nil || decl.Body == nil || len(decl.Body.List) != 1 {
+		return ""
+	}
+	ret, ok := decl.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return ""
+	}
+	lit, ok := ret.Results[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func (p *sourcePackage) structColumns(file *ast.File, st *ast.StructType, prefix string, out *output) ([]columnSpec, error) {
+	var columns []columnSpec
+	for _, field := range st.Fields.List {
+		settings := gormSettings(field.Tag)
+		if ignored(settings) {
+			continue
+		}
+		if len(field.Names) == 0 {
+			embedded, err := p.embeddedColumns(file, field.Type, prefix+settings["EMBEDDEDPREFIX"], out)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, embedded...)
+			continue
+		}
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			if _, ok := settings["EMBEDDED"]; ok {
+				embedded, err := p.embeddedColumns(file, field.Type, prefix+settings["EMBEDDEDPREFIX"], out)
+				if err != nil {
+					return nil, err
+				}
+				columns = append(columns, embedded...)
+				continue
+			}
+			if p.isAssociation(field.Type, settings) {
+				continue
+			}
+			typ, err := out.typeString(file, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name.Name, err)
+			}
+			columns = append(columns, columnSpec{
+				Field: name.Name,
+				Name:  prefix + columnName(name.Name, settings),
+				Type:  typ,
+			})
+		}
+	}
+	return columns, nil
+}
+
+func (p *sourcePackage) embeddedColumns(file *ast.File, typ ast.Expr, prefix string, out *output) ([]columnSpec, error) {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		ts, ok := p.types[typ.Name]
+		if !ok {
+			return nil, fmt.Errorf("embedded type %s not found", typ.Name)
+		}
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok {
+			return nil, fmt.Errorf("embedded type %s is not a struct", typ.Name)
+		}
+		return p.structColumns(p.files[ts], st, prefix, out)
+	case *ast.SelectorExpr:
+		pkgIdent, ok := typ.X.(*ast.Ident)
+		if ok && importPath(file, pkgIdent.Name) == dbspiPath {
+			if rt, ok := dbspiEmbeddables[typ.Sel.Name]; ok {
+				return reflectColumns(rt, prefix), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unsupported embedded type %s", exprString(typ))
+}
+
+// isAssociation reports whether a field of typ is a gorm association rather
+// than a column. Without type information, slices, maps and structs of the
+// same package are treated as associations unless a serializer or column
+// type is set.
+func (p *sourcePackage) isAssociation(typ ast.Expr, settings map[string]string) bool {
+	if _, ok := settings["SERIALIZER"]; ok {
+		return false
+	}
+	if _, ok := settings["TYPE"]; ok {
+		return false
+	}
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch typ := typ.(type) {
+	case *ast.ArrayType:
+		elem, ok := typ.Elt.(*ast.Ident)
+		return !ok || elem.Name != "byte"
+	case *ast.MapType:
+		return true
+	case *ast.Ident:
+		ts, ok := p.types[typ.Name]
+		if !ok {
+			return false
+		}
+		_, isStruct := ts.Type.(*ast.StructType)
+		return isStruct
+	}
+	return false
+}
+
+// reflectColumns lists the columns of a dbspi field set.
+func reflectColumns(rt reflect.Type, prefix string) []columnSpec {
+	var columns []columnSpec
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		settings := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")
+		if ignored(settings) {
+			continue
+		}
+		if field.Anonymous {
+			columns = append(columns, reflectColumns(field.Type, prefix+settings["EMBEDDEDPREFIX"])...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		columns = append(columns, columnSpec{
+			Field: field.Name,
+			Name:  prefix + columnName(field.Name, settings),
+			Type:  strings.TrimPrefix(field.Type.String(), "*"),
+		})
+	}
+	return columns
+}
+
+func gormSettings(tag *ast.BasicLit) map[string]string {
+	if tag == nil {
+		return map[string]string{}
+	}
+	value, err := strconv.Unquote(tag.Value)
+	if err != nil {
+		return map[string]string{}
+	}
+	return schema.ParseTagSetting(reflect.StructTag(value).Get("gorm"), ";")
+}
+
+func ignored(settings map[string]string) bool {
+	value, ok := settings["-"]
+	if !ok {
+		return false
+	}
+	value = strings.ToLower(strings.TrimSpace(value))
+	return value == "-" || value == "all"
+}
+
+func columnName(field string, settings map[string]string) string {
+	if name := settings["COLUMN"]; name != "" {
+		return name
+	}
+	return schema.NamingStrategy{}.ColumnName("", field)
+}
+
+func importPath(file *ast.File, name string) string {
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		local := filepath.Base(path)
+		if spec.Name != nil {
+			local = spec.Name.Name
+		}
+		if local == name {
+			return path
+		}
+	}
+	return ""
+}
+
+func exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = format.Node(&buf, token.NewFileSet(), expr)
+	return buf.String()
+}
+
+// output collects the imports of the generated file.
+type output struct {
+	// imports maps import paths to their local names.
+	imports map[string]string
+}
+
+// typeString returns the source of typ without a leading pointer and records
+// the imports it references.
+func (o *output) typeString(file *ast.File, typ ast.Expr) (string, error) {
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	var err error
+	ast.Inspect(typ, func(node ast.Node) bool {
+		sel, ok := node.(*ast.SelectorExpr)
+		if !ok || err != nil {
+			return err == nil
+		}
+		pkgIdent, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		path := importPath(file, pkgIdent.Name)
+		if path == "" {
+			err = fmt.Errorf("package %s is not imported", pkgIdent.Name)
+			return false
+		}
+		if local, ok := o.imports[path]; ok && local != pkgIdent.Name {
+			err = fmt.Errorf("package %s is imported as both %s and %s", path, local, pkgIdent.Name)
+			return false
+		}
+		o.imports[path] = pkgIdent.Name
+		return false
+	})
+	return exprString(typ), err
+}
+
+func (o *output) importDecl() string {
+	paths := make([]string, 0, len(o.imports))
+	for path := range o.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var buf strings.Builder
+	buf.WriteString("import (\n")
+	for _, path := range paths {
+		if local := o.imports[path]; local != filepath.Base(path) {
+			fmt.Fprintf(&buf, "\t%s %q\n", local, path)
+			continue
+		}
+		fmt.Fprintf(&buf, "\t%q\n", path)
+	}
+	buf.WriteString(")\n\n")
+	return buf.String()
+}
+
+func writeColumns(buf *bytes.Buffer, entity entitySpec) {
+	fmt.Fprintf(buf, "// %sCols are the typed columns of %s.\n", entity.Name, entity.Name)
+	fmt.Fprintf(buf, "var %sCols = struct {\n", entity.Name)
+	for _, col := range entity.Columns {
+		fmt.Fprintf(buf, "\t%s dbspi.Field[%s]\n", col.Field, col.Type)
+	}
+	buf.WriteString("}{\n")
+	for _, col := range entity.Columns {
+		fmt.Fprintf(buf, "\t%s: dbhelper.NewField[%s](%q),\n", col.Field, col.Type, col.Name)
+	}
+	buf.WriteString("}\n\n")
+}
+
+// writeShardingKey writes the <Type>ShardingKey constructor of entity. Nothing
+// is written when the entity's table is not sharded by column.
+func writeShardingKey(buf *bytes.Buffer, entity entitySpec, cfg dbspi.DatabaseConfig) error {
+	group, ok := cfg.DatabaseGroups[entity.Group]
+	if !ok {
+		group, ok = cfg.DatabaseGroups[dbspi.DefaultDatabaseGroupKey]
+	}
+	if !ok {
+		return fmt.Errorf("columngen: %s: database group %q not found in config", entity.Name, entity.Group)
+	}
+	names, err := dbsp.ShardingColumns(group, entity.Table)
+	if err != nil {
+		return fmt.Errorf("columngen: %s: %w", entity.Name, err)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	params := make([]string, len(names))
+	setters := make([]string, len(names))
+	for i, name := range names {
+		col, ok := entity.columnByName(name)
+		if !ok {
+			return fmt.Errorf("columngen: %s: sharding column %s is not a field", entity.Name, name)
+		}
+		param := paramName(col.Field)
+		params[i] = param + " " + col.Type
+		setters[i] = fmt.Sprintf(".\n\t\tSetValue(%q, %s)", name, param)
+	}
+	fmt.Fprintf(buf, "// %sShardingKey returns the sharding key of %s from its sharding columns.\n", entity.Name, entity.Name)
+	fmt.Fprintf(buf, "func %sShardingKey(%s) *dbspi.ShardingKey {\n", entity.Name, strings.Join(params, ", "))
+	fmt.Fprintf(buf, "\treturn dbspi.NewShardingKey()%s\n}\n\n", strings.Join(setters, ""))
+	return nil
+}
+
+func (e entitySpec) columnByName(name string) (columnSpec, bool) {
+	for _, col := range e.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return columnSpec{}, false
+}
+
+// paramName lowers the leading initialism of a field name, e.g. ShopID to
+// shopID and ID to id, and avoids Go keywords.
+func paramName(field string) string {
+	runes := []rune(field)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	name := string(runes)
+	if token.IsKeyword(name) {
+		name += "Value"
+	}
+	return name
+}
@@ -0,0 +1,106 @@
+package columngen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+const testEntitySource = `package model
+
+import (
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+type Money struct {
+	Amount   int64  ` + "`gorm:\"column:amount\"`" + `
+	Currency string
+}
+
+type OrderItem struct {
+	ID int64 ` + "`gorm:\"primaryKey\"`" + `
+}
+
+type Order struct {
+	dbspi.CommonFields
+	ShopID    int64      ` + "`gorm:\"column:shop_id\"`" + `
+	PaidAt    *time.Time ` + "`gorm:\"column:paid_at\"`" + `
+	Total     Money      ` + "`gorm:\"embedded;embeddedPrefix:total_\"`" + `
+	Items     []OrderItem
+	Remark    string ` + "`gorm:\"-\"`" + `
+	internal  string
+}
+
+func (*Order) TableName() string        { return "order_tab" }
+func (*Order) DatabaseGroupKey() string { return "order" }
+`
+
+func TestGenerateWritesTypedColumnsAndShardingKey(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "order.go"), []byte(testEntitySource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &dbspi.DatabaseConfig{DatabaseGroups: map[string]dbspi.DatabaseGroupConfig{
+		"order": {
+			DatabaseSharding: &dbspi.DatabaseShardingConfig{
+				NameExpr:    "order_db_${idx}",
+				ExpandExprs: []string{"${idx} := range(0, 2)", "${idx} = @{shop_id} % 2"},
+			},
+		},
+	}}
+
+	src, err := Generate(Options{Dir: dir, Types: []string{"Order"}, Output: "order_columns_gen.go", Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(src)
+	for _, want := range []string{
+		"package model",
+		`"time"`,
+		"Id       dbspi.Field[uint64]",
+		`Deleted:  dbhelper.NewField[bool]("deleted")`,
+		`ShopID:   dbhelper.NewField[int64]("shop_id")`,
+		`PaidAt:   dbhelper.NewField[time.Time]("paid_at")`,
+		`Amount:   dbhelper.NewField[int64]("total_amount")`,
+		`Currency: dbhelper.NewField[string]("total_currency")`,
+		"func OrderShardingKey(shopID int64) *dbspi.ShardingKey {",
+		`SetValue("shop_id", shopID)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("generated source is missing %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"Items", "Remark", "internal"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("generated source contains %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestGenerateRejectsShardingColumnWithoutField(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "order.go"), []byte(testEntitySource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &dbspi.DatabaseConfig{DatabaseGroups: map[string]dbspi.DatabaseGroupConfig{
+		"order": {
+			TableRules: []dbspi.TableShardingRuleConfig{{
+				Tables: []string{"order_tab"},
+				TableSharding: &dbspi.TableShardingConfig{
+					NameExpr:    "${table}_${idx}",
+					ExpandExprs: []string{"${idx} := range(0, 4)", "${idx} = @{buyer_id} % 4"},
+				},
+			}},
+		},
+	}}
+
+	_, err := Generate(Options{Dir: dir, Types: []string{"Order"}, Config: cfg})
+	if err == nil || !strings.Contains(err.Error(), "sharding column buyer_id") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+const defaultArchiveBatchSize = 500
+
+// ArchiveOptions configures Archive.
+type ArchiveOptions struct {
+	// BatchSize is the number of rows moved per transaction. Defaults to 500.
+	BatchSize int
+	// RowsPerSecond caps the rate rows are moved at. Zero means no limit.
+	RowsPerSecond int
+	// TableName maps a physical source table to the archive table in the same
+	// database. Defaults to the TableName of the archive entity. Ignored when
+	// Store is set.
+	TableName func(sourceTable string) string
+	// Store is the dbspi.TableStore of the archive entity to write to instead
+	// of a table in the source database. It is typed by dbhelper's
+	// WithArchiveStore and checked against the archive entity by Archive.
+	Store any
+}
+
+// Archive moves the rows of source matching query to an archive table, one
+// physical table at a time and in batches ordered by id. Each batch is
+// copied, deleted from source and checkpointed under job in one transaction
+// on the source database, so a run interrupted by a crash or by ctx resumes
+// after its last committed batch when started again.
+//
+// Rows are converted with convert. Without opts.Store they are written to the
+// archive table in the source database inside the batch transaction.
+// Otherwise they are upserted into opts.Store on their id before the batch
+// commits, so batches retried after a failed commit do not duplicate rows;
+// converted rows must therefore keep a non-zero id. A nil convert deletes
+// the rows without archiving them. Decorators above the source tables, such
+// as cached stores, are told of the rows of each committed batch.
+func Archive[T, A dbspi.Entity](ctx context.Context, job string, source dbspi.TableStore[T], query dbspi.Query, convert func(T) A, opts ArchiveOptions) (*dbspi.ArchiveReport, error) {
+	if job == "" {
+		return nil, fmt.Errorf("dbhelper: archive requires a job name")
+	}
+	var archive dbspi.TableStore[A]
+	if opts.Store != nil {
+		if convert == nil {
+			return nil, fmt.Errorf("dbhelper: archive job %q has an archive store but no convert func", job)
+		}
+		store, ok := opts.Store.(dbspi.TableStore[A])
+		if !ok {
+			return nil, fmt.Errorf("dbhelper: archive job %q needs an archive store of dbspi.TableStore[%T], got %T", job, *new(A), opts.Store)
+		}
+		archive = store
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultArchiveBatchSize
+	}
+
+	set, err := physicalTablesOf(source, "archiving")
+	if err != nil {
+		return nil, err
+	}
+	defer set.release()
+
+	run := &archiveRun[T, A]{
+		job:     job,
+		query:   query,
+		convert: convert,
+		archive: archive,
+		set:     set,
+		opts:    opts,
+		started: time.Now(),
+	}
+	report := &dbspi.ArchiveReport{}
+	for _, table := range set.tables {
+		tableReport, err := run.archiveTable(ctx, table)
+		report.Archived += tableReport.Archived
+		report.Tables = append(report.Tables, tableReport)
+		if err != nil {
+			return report, fmt.Errorf("dbhelper: archive job %q on %s: %w", job, table.tableName, err)
+		}
+	}
+	return report, nil
+}
+
+type archiveRun[T, A dbspi.Entity] struct {
+	job     string
+	query   dbspi.Query
+	convert func(T) A
+	archive dbspi.TableStore[A]
+	set     *physicalTableSet[T]
+	opts    ArchiveOptions
+
+	// started and moved pace the run to opts.RowsPerSecond.
+	started time.Time
+	moved   uint64
+}
+
+// archiveTable moves the matching rows of one physical table, resuming from
+// its checkpoint. A finished table has its checkpoint reset so that the next
+// run scans it from the start.
+func (r *archiveRun[T, A]) archiveTable(ctx context.Context, hot *GormTableStore[T]) (dbspi.ArchiveTableReport, error) {
+	report := dbspi.ArchiveTableReport{Database: hot.databaseKey, Table: hot.tableName}
+	key := r.job + ":" + hot.databaseKey + ":" + hot.tableName
+	checkpoint, err := newTableStoreWithTableName(hot.session, &dbspi.ArchiveCheckpoint{}, dbspi.DefaultArchiveCheckpointTableName, hot.commonFields).GetById(ctx, key)
+	if err != nil {
+		return report, err
+	}
+	if checkpoint == nil {
+		checkpoint = &dbspi.ArchiveCheckpoint{CheckpointKey: key, Job: r.job, Database: hot.databaseKey, Table: hot.tableName}
+	}
+	report.Resumed = checkpoint.LastId > 0
+
+	for {
+		next, ids, err := r.archiveBatch(ctx, hot, *checkpoint)
+		if err != nil {
+			return report, err
+		}
+		if len(ids) > 0 {
+			r.set.rowsDeleted(ctx, ids)
+		}
+		checkpoint = next
+		moved := uint64(len(ids))
+		report.Archived += moved
+		if moved < uint64(r.opts.BatchSize) {
+			break
+		}
+		if err := r.pace(ctx, moved); err != nil {
+			return report, err
+		}
+	}
+
+	if checkpoint.LastId == 0 {
+		return report, nil
+	}
+	checkpoint.LastId = 0
+	return report, newTableStoreWithTableName(hot.session, checkpoint, dbspi.DefaultArchiveCheckpointTableName, hot.commonFields).Save(ctx, checkpoint)
+}
+
+// archiveBatch moves the next batch of rows after checkpoint.LastId and
+// returns the checkpoint saved with it and the ids of the moved rows.
+func (r *archiveRun[T, A]) archiveBatch(ctx context.Context, hot *GormTableStore[T], checkpoint dbspi.ArchiveCheckpoint) (*dbspi.ArchiveCheckpoint, []any, error) {
+	idColumn := hot.idFieldName()
+	var moved []any
+	err := hot.session.Transaction(ctx, func(tx dbSession) error {
+		txHot := newTableStoreWithTableName(tx, hot.emptyEntityInstance, hot.tableName, hot.commonFields)
+		lockTx, err := lockingSession(tx, dbspi.RowLock{Strength: dbspi.LockForUpdate})
+		if err != nil {
+			return err
+		}
+		lockHot := newTableStoreWithTableName(lockTx, hot.emptyEntityInstance, hot.tableName, hot.commonFields)
+		lastId := checkpoint.LastId
+		query := NewQuery(NewField[uint64](idColumn).Gt(&lastId))
+		if r.query != nil {
+			query = And(r.query, query)
+		}
+		limit := r.opts.BatchSize
+		pagination := NewPagination().WithLimit(&limit).AppendOrder(Asc(NewField[uint64](idColumn)))
+		rows, err := lockHot.Find(ctx, query, pagination)
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+
+		ids := make([]any, 0, len(rows))
+		archived := make([]A, 0, len(rows))
+		for _, row := range rows {
+			id := tenantEntityId(row, idColumn)
+			value, ok := shardBitsValue(id)
+			if !ok {
+				return fmt.Errorf("archiving requires non-negative integer ids, got %T", id)
+			}
+			ids = append(ids, id)
+			checkpoint.LastId = max(checkpoint.LastId, value)
+			if r.convert != nil {
+				archived = append(archived, r.convert(row))
+			}
+		}
+		if len(archived) > 0 {
+			if err := r.writeArchive(ctx, tx, hot.tableName, archived); err != nil {
+				return err
+			}
+		}
+		if err := txHot.DeleteByQuery(ctx, NewQuery(NewField[any](idColumn).In(ids))); err != nil {
+			return err
+		}
+		checkpoint.Archived += uint64(len(rows))
+		moved = ids
+		return newTableStoreWithTableName(tx, &checkpoint, dbspi.DefaultArchiveCheckpointTableName, hot.commonFields).Save(ctx, &checkpoint)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &checkpoint, moved, nil
+}
+
+func (r *archiveRun[T, A]) writeArchive(ctx context.Context, tx dbSession, sourceTable string, rows []A) error {
+	entity := reflect.New(reflect.TypeOf(rows[0]).Elem()).Interface().(A)
+	if r.archive != nil {
+		idColumn := dbspi.DefaultIdFieldName
+		if namer, ok := any(entity).(dbspi.IdFieldNameProvider); ok {
+			idColumn = namer.IdFieldName()
+		}
+		for _, row := range rows {
+			if isZeroId(tenantEntityId(row, idColumn)) {
+				return fmt.Errorf("archive store rows need the source id, convert returned %T without %s", row, idColumn)
+			}
+		}
+		return r.archive.BatchUpsert(ctx, rows, []dbspi.Column{NewColumn(idColumn)}, nil, len(rows))
+	}
+	table := entity.TableName()
+	if r.opts.TableName != nil {
+		table = r.opts.TableName(sourceTable)
+	}
+	return newTableStoreWithTableName(tx, entity, table, DisabledCommonFieldAutoFillOptions()).BatchCreate(ctx, rows, len(rows))
+}
+
+// pace sleeps until the rows moved so far fit opts.RowsPerSecond.
+func (r *archiveRun[T, A]) pace(ctx context.Context, moved uint64) error {
+	r.moved += moved
+	if r.opts.RowsPerSecond <= 0 {
+		return nil
+	}
+	due := r.started.Add(time.Duration(r.moved) * time.Second / time.Duration(r.opts.RowsPerSecond))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,178 @@
+package dbsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachehelper"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+type archiveTestOrder struct {
+	dbspi.IdField
+	ShopID int64  `gorm:"column:shop_id"`
+	Ctime  uint64 `gorm:"column:ctime"`
+}
+
+func (*archiveTestOrder) TableName() string        { return "order_item_tab" }
+func (*archiveTestOrder) DatabaseGroupKey() string { return "order" }
+
+type archiveTestOrderArchive struct {
+	dbspi.IdField
+	ShopID int64  `gorm:"column:shop_id"`
+	Ctime  uint64 `gorm:"column:ctime"`
+}
+
+func (*archiveTestOrderArchive) TableName() string { return "order_item_archive_tab" }
+
+func archiveTestConvert(order *archiveTestOrder) *archiveTestOrderArchive {
+	return &archiveTestOrderArchive{IdField: order.IdField, ShopID: order.ShopID, Ctime: order.Ctime}
+}
+
+func TestArchiveMovesColdRowsOfEveryShard(t *testing.T) {
+	ctx := context.Background()
+	mgr := NewMemoryManager(shardedJoinTestConfig(), ManagerOptions{})
+	source := ForWithCommonFieldAutoFill(&archiveTestOrder{}, mgr, DisabledCommonFieldAutoFillOptions())
+	for i := 0; i < 24; i++ {
+		order := &archiveTestOrder{IdField: dbspi.IdField{Id: uint64(i + 1)}, ShopID: int64(i % 8), Ctime: uint64(i)}
+		if err := source.Create(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := NewMemoryTableStore(&archiveTestOrderArchive{}, DisabledCommonFieldAutoFillOptions())
+
+	cutoff := uint64(16)
+	cold := NewQuery(NewField[uint64]("ctime").Lt(&cutoff))
+	report, err := Archive(ctx, "order-cold", source, cold, archiveTestConvert, ArchiveOptions{BatchSize: 1, Store: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Archived != 16 || len(report.Tables) != 8 {
+		t.Fatalf("report = %+v", report)
+	}
+	if count, err := source.CountAll(ctx, nil); err != nil || count != 8 {
+		t.Fatalf("rows left = %d, err = %v", count, err)
+	}
+	if count, err := archive.Count(ctx, nil); err != nil || count != 16 {
+		t.Fatalf("archived rows = %d, err = %v", count, err)
+	}
+
+	report, err = Archive(ctx, "order-cold", source, cold, archiveTestConvert, ArchiveOptions{Store: archive})
+	if err != nil || report.Archived != 0 {
+		t.Fatalf("second run report = %+v, err = %v", report, err)
+	}
+}
+
+func TestArchiveResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	source := NewMemoryTableStore(&archiveTestOrder{}, DisabledCommonFieldAutoFillOptions())
+	for i := 0; i < 5; i++ {
+		if err := source.Create(ctx, &archiveTestOrder{Ctime: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkpoints := NewTableStore(source.session, &dbspi.ArchiveCheckpoint{})
+	interrupted := &dbspi.ArchiveCheckpoint{CheckpointKey: "order-all::order_item_tab", Job: "order-all", Table: "order_item_tab", LastId: 3, Archived: 3}
+	if err := checkpoints.Create(ctx, interrupted); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Archive(ctx, "order-all", source, nil, archiveTestConvert, ArchiveOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Archived != 2 || !report.Tables[0].Resumed {
+		t.Fatalf("resumed report = %+v", report)
+	}
+	local := NewTableStore(source.session, &archiveTestOrderArchive{})
+	if rows, err := local.Find(ctx, nil, nil); err != nil || len(rows) != 2 || rows[0].Id != 4 || rows[1].Id != 5 {
+		t.Fatalf("archive rows = %+v, err = %v", rows, err)
+	}
+	if saved, err := checkpoints.GetById(ctx, interrupted.CheckpointKey); err != nil || saved.LastId != 0 || saved.Archived != 5 {
+		t.Fatalf("checkpoint = %+v, err = %v", saved, err)
+	}
+
+	report, err = Archive(ctx, "order-all", source, nil, archiveTestConvert, ArchiveOptions{BatchSize: 2})
+	if err != nil || report.Archived != 3 || report.Tables[0].Resumed {
+		t.Fatalf("rescan report = %+v, err = %v", report, err)
+	}
+	if count, err := source.Count(ctx, nil); err != nil || count != 0 {
+		t.Fatalf("rows left = %d, err = %v", count, err)
+	}
+}
+
+func TestArchiveWithoutConvertPurgesRows(t *testing.T) {
+	ctx := context.Background()
+	source := NewMemoryTableStore(&archiveTestOrder{}, DisabledCommonFieldAutoFillOptions())
+	for i := 0; i < 5; i++ {
+		if err := source.Create(ctx, &archiveTestOrder{Ctime: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cutoff := uint64(3)
+	report, err := Archive[*archiveTestOrder, *archiveTestOrder](ctx, "order-ttl", source, NewQuery(NewField[uint64]("ctime").Lt(&cutoff)), nil, ArchiveOptions{BatchSize: 2, RowsPerSecond: 1000})
+	if err != nil || report.Archived != 3 {
+		t.Fatalf("purge report = %+v, err = %v", report, err)
+	}
+	if rows, err := source.Find(ctx, nil, nil); err != nil || len(rows) != 2 || rows[0].Ctime != 3 {
+		t.Fatalf("rows left = %+v, err = %v", rows, err)
+	}
+}
+
+func TestArchiveStoreUpsertsOnId(t *testing.T) {
+	ctx := context.Background()
+	source := NewMemoryTableStore(&archiveTestOrder{}, DisabledCommonFieldAutoFillOptions())
+	for i := 0; i < 3; i++ {
+		if err := source.Create(ctx, &archiveTestOrder{Ctime: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := NewMemoryTableStore(&archiveTestOrderArchive{}, DisabledCommonFieldAutoFillOptions())
+	// A row copied by a batch whose commit failed.
+	if err := archive.Create(ctx, &archiveTestOrderArchive{IdField: dbspi.IdField{Id: 1}, Ctime: 99}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Archive(ctx, "order-all", source, nil, func(o *archiveTestOrder) *archiveTestOrderArchive {
+		return &archiveTestOrderArchive{Ctime: o.Ctime}
+	}, ArchiveOptions{Store: archive}); err == nil {
+		t.Fatal("expected rows without ids to be rejected")
+	}
+	if _, err := Archive(ctx, "order-all", source, nil, archiveTestConvert, ArchiveOptions{Store: source}); err == nil {
+		t.Fatal("expected a store of another entity to be rejected")
+	}
+	if _, err := Archive[*archiveTestOrder, *archiveTestOrder](ctx, "order-all", source, nil, nil, ArchiveOptions{Store: source}); err == nil {
+		t.Fatal("expected a store without convert to be rejected")
+	}
+
+	report, err := Archive(ctx, "order-all", source, nil, archiveTestConvert, ArchiveOptions{Store: archive})
+	if err != nil || report.Archived != 3 {
+		t.Fatalf("report = %+v, err = %v", report, err)
+	}
+	rows, err := archive.Find(ctx, nil, nil)
+	if err != nil || len(rows) != 3 || rows[0].Id != 1 || rows[0].Ctime != 0 {
+		t.Fatalf("archive rows = %+v, err = %v", rows, err)
+	}
+}
+
+func TestArchiveInvalidatesCachedRows(t *testing.T) {
+	ctx := context.Background()
+	hot := NewMemoryTableStore(&archiveTestOrder{}, DisabledCommonFieldAutoFillOptions())
+	source := NewCachedTableStore[*archiveTestOrder](hot, cachehelper.NewInMemCache(), CachedTableStoreOptions{})
+	for i := 0; i < 3; i++ {
+		if err := source.Create(ctx, &archiveTestOrder{Ctime: uint64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if order, err := source.GetById(ctx, uint64(2)); err != nil || order == nil {
+		t.Fatalf("cached order = %+v, err = %v", order, err)
+	}
+
+	report, err := Archive[*archiveTestOrder, *archiveTestOrder](ctx, "order-ttl", source, nil, nil, ArchiveOptions{BatchSize: 2})
+	if err != nil || report.Archived != 3 {
+		t.Fatalf("purge report = %+v, err = %v", report, err)
+	}
+	if order, err := source.GetById(ctx, uint64(2)); err != nil || order != nil {
+		t.Fatalf("purged order still cached: %+v, err = %v", order, err)
+	}
+}
@@ -0,0 +1,155 @@
+package dbsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/logger"
+	"github.com/MrMiaoMIMI/goshared/tracing"
+
+	"gorm.io/gorm/schema"
+)
+
+// auditSchemas caches the parsed schemas of audited entities.
+var auditSchemas sync.Map
+
+// auditLogger is implemented by table stores that can reach the audit table
+// of the database they write to.
+type auditLogger interface {
+	// withAuditStore calls fn with the audit table store. The store is only
+	// valid until fn returns.
+	withAuditStore(fn func(*GormTableStore[*dbspi.AuditRecord]) error) error
+}
+
+// writeAuditRecords writes the audit records of events through the audit
+// table of routed, so records share routed's session and transaction.
+func writeAuditRecords[T dbspi.Entity](ctx context.Context, routed dbspi.TableStore[T], events []dbspi.ChangeEvent) error {
+	provider, ok := routed.(auditLogger)
+	if !ok {
+		return fmt.Errorf("dbhelper: audit log requires a database-backed table store, got %T", routed)
+	}
+	records, err := buildAuditRecords(ctx, events)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	return provider.withAuditStore(func(audit *GormTableStore[*dbspi.AuditRecord]) error {
+		return audit.BatchCreate(ctx, records, len(records))
+	})
+}
+
+// buildAuditRecords returns one audit record per event. Updates that changed
+// no column are skipped.
+func buildAuditRecords(ctx context.Context, events []dbspi.ChangeEvent) ([]*dbspi.AuditRecord, error) {
+	operator, _ := dbspi.OperatorFromContext(ctx)
+	traceId := auditTraceId(ctx)
+
+	records := make([]*dbspi.AuditRecord, 0, len(events))
+	for _, event := range events {
+		changes, err := diffAuditColumns(ctx, event.Before, event.After)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) == 0 && event.Operation != dbspi.ChangeDelete {
+			continue
+		}
+		encoded, err := json.Marshal(changes)
+		if err != nil {
+			return nil, fmt.Errorf("dbhelper: encode audit changes of %q: %w", event.Table, err)
+		}
+		records = append(records, &dbspi.AuditRecord{
+			EntityTable: event.Table,
+			EntityId:    fmt.Sprint(event.PrimaryKey),
+			Operation:   event.Operation,
+			Operator:    operator,
+			TraceId:     traceId,
+			Changes:     string(encoded),
+			Ctime:       uint64(event.Time.UnixMilli()),
+		})
+	}
+	return records, nil
+}
+
+// diffAuditColumns lists the columns whose values differ between before and
+// after. Either image may be nil, in which case every column is listed.
+func diffAuditColumns(ctx context.Context, before, after any) ([]dbspi.AuditChange, error) {
+	sample := after
+	if sample == nil {
+		sample = before
+	}
+	if sample == nil {
+		return nil, nil
+	}
+	entitySchema, err := schema.Parse(sample, &auditSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, fmt.Errorf("dbhelper: parse audited entity %T: %w", sample, err)
+	}
+
+	var changes []dbspi.AuditChange
+	for _, field := range entitySchema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		var oldValue, newValue any
+		if before != nil {
+			oldValue, _ = field.ValueOf(ctx, reflect.ValueOf(before))
+		}
+		if after != nil {
+			newValue, _ = field.ValueOf(ctx, reflect.ValueOf(after))
+		}
+		if before != nil && after != nil && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, dbspi.AuditChange{Column: field.DBName, Old: oldValue, New: newValue})
+	}
+	return changes, nil
+}
+
+// auditTraceId returns the trace id bound by logger.SetTraceID, or else the
+// trace id of the active span.
+func auditTraceId(ctx context.Context) string {
+	if traceId := logger.GetTraceID(ctx); traceId != "" {
+		return traceId
+	}
+	return tracing.SpanContextFromContext(ctx).TraceID
+}
+
+// AuditHistory returns the audit records of the row with id, newest first
+// unless pagination orders otherwise. It reads the audit table of the
+// database store routes id to.
+func AuditHistory[T dbspi.Entity](ctx context.Context, store dbspi.TableStore[T], id any, pagination dbspi.Pagination) ([]*dbspi.AuditRecord, error) {
+	if id == nil {
+		return nil, fmt.Errorf("dbhelper: audit history requires an id")
+	}
+	var zero T
+	routed, err := routeChange(ctx, store, zero, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := routed.(auditLogger)
+	if !ok {
+		return nil, fmt.Errorf("dbhelper: audit log requires a database-backed table store, got %T", routed)
+	}
+
+	table := reflect.New(reflect.TypeOf(zero).Elem()).Interface().(T).TableName()
+	entityId := fmt.Sprint(id)
+	query := And(
+		NewField[string]("entity_table").Eq(&table),
+		NewField[string]("entity_id").Eq(&entityId),
+	)
+	if pagination == nil {
+		pagination = NewPagination()
+	}
+	if len(pagination.Orders()) == 0 {
+		pagination.AppendOrder(Desc(NewColumn(dbspi.DefaultIdFieldName)))
+	}
+	var records []*dbspi.AuditRecord
+	err = provider.withAuditStore(func(audit *GormTableStore[*dbspi.AuditRecord]) error {
+		records, err = audit.Find(ctx, query, pagination)
+		return err
+	})
+	return records, err
+}
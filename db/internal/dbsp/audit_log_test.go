@@ -0,0 +1,107 @@
+package dbsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/logger"
+)
+
+func TestAuditLogRecordsChangedColumns(t *testing.T) {
+	ctx := logger.SetTraceID(dbspi.WithOperator(context.Background(), "alice"), "trace-1")
+	events := []dbspi.ChangeEvent{
+		{
+			Table:      "order_item_tab",
+			Operation:  dbspi.ChangeUpdate,
+			PrimaryKey: int64(7),
+			Before:     &joinTestItem{ID: 7, ShopID: 3, SKU: "old"},
+			After:      &joinTestItem{ID: 7, ShopID: 3, SKU: "new"},
+			Time:       time.UnixMilli(1000),
+		},
+		{
+			// Unchanged rows are not audited.
+			Table:      "order_item_tab",
+			Operation:  dbspi.ChangeUpdate,
+			PrimaryKey: int64(8),
+			Before:     &joinTestItem{ID: 8},
+			After:      &joinTestItem{ID: 8},
+		},
+	}
+
+	records, err := buildAuditRecords(ctx, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected one record, got %+v", records)
+	}
+	record := records[0]
+	if record.EntityTable != "order_item_tab" || record.EntityId != "7" || record.Operation != dbspi.ChangeUpdate ||
+		record.Operator != "alice" || record.TraceId != "trace-1" || record.Ctime != 1000 {
+		t.Fatalf("unexpected record %+v", record)
+	}
+	changes, err := record.ChangeList()
+	if err != nil || len(changes) != 1 || changes[0].Column != "sku" || changes[0].Old != "old" || changes[0].New != "new" {
+		t.Fatalf("unexpected changes %+v, %v", changes, err)
+	}
+
+	recorder := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	store := NewTableStore(newUpsertTestDb(t, recorder, "user:pass@tcp(127.0.0.1:3306)/test_db"), &joinTestItem{})
+	if err := writeAuditRecords(ctx, store, events); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.sqls) != 1 || !strings.HasPrefix(recorder.sqls[0], "INSERT INTO `audit_log_tab`") {
+		t.Fatalf("expected one insert into the audit table, got %q", recorder.sqls)
+	}
+}
+
+func TestAuditHistoryRoutesToShard(t *testing.T) {
+	recorders := make(map[string]*recordingGormLogger)
+	dial := func(server dbspi.ServerConfig) dbSession {
+		recorder := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+		recorders[server.DatabaseName] = recorder
+		return newUpsertTestDb(t, recorder, dbServerDSN(server))
+	}
+	mgr := NewManagerWithOptions(shardedJoinTestConfig(), ManagerOptions{dial: dial})
+	ctx := dbspi.WithShardingKey(context.Background(), dbspi.NewShardingKey().SetValue("shop_id", 5))
+
+	if _, err := AuditHistory(ctx, For(&joinTestItem{}, mgr), int64(7), nil); err != nil {
+		t.Fatal(err)
+	}
+	sqls := recorders["order_db_1"].sqls
+	want := "SELECT * FROM `audit_log_tab` WHERE `entity_table` = ? AND `entity_id` = ? ORDER BY id DESC"
+	if len(sqls) != 1 || sqls[0] != want {
+		t.Fatalf("expected %q on order_db_1, got %q", want, sqls)
+	}
+}
+
+func TestAuditLogOfCrossShardBatchStaysWithEachShard(t *testing.T) {
+	mgr := NewMemoryManager(shardedJoinTestConfig(), ManagerOptions{})
+	store := NewChangeCaptureTableStore(For(&joinTestItem{}, mgr), ChangeCaptureOptions{AuditLog: true})
+	ctx := context.Background()
+
+	items := []*joinTestItem{{ID: 1, ShopID: 5, SKU: "a"}, {ID: 2, ShopID: 6, SKU: "b"}, {ID: 3, ShopID: 7, SKU: "c"}}
+	if err := store.BatchCreate(ctx, items, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		// Audit rows live in the audit table of the row's database only.
+		for _, shopID := range []int64{5, 6} {
+			skCtx := dbspi.WithShardingKey(ctx, dbspi.NewShardingKey().SetValue("shop_id", shopID))
+			records, err := AuditHistory(skCtx, For(&joinTestItem{}, mgr), item.ID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if shopID%2 == item.ShopID%2 {
+				want = 1
+			}
+			if len(records) != want {
+				t.Fatalf("item %d on db of shop %d: expected %d records, got %+v", item.ID, shopID, want, records)
+			}
+		}
+	}
+}
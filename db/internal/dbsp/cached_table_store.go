@@ -0,0 +1,741 @@
+package dbsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachespi"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/logger"
+)
+
+// DefaultCacheKeyPrefix namespaces the keys of cached table stores.
+const DefaultCacheKeyPrefix = "db"
+
+var (
+	_ dbspi.CachedTableStore[*_tableForCheck]     = (*cachedTableStore[*_tableForCheck])(nil)
+	_ dbspi.SoftDeleteTableStore[*_tableForCheck] = (*cachedTableStore[*_tableForCheck])(nil)
+	_ dbspi.SQLTableStore[*_tableForCheck]        = (*cachedTableStore[*_tableForCheck])(nil)
+)
+
+// CachedTableStoreOptions configures NewCachedTableStore.
+type CachedTableStoreOptions struct {
+	// KeyPrefix namespaces cache keys. Empty uses DefaultCacheKeyPrefix.
+	KeyPrefix string
+
+	// Expiration of cached entries. cachespi.DefaultExpiration uses the
+	// cache's default.
+	Expiration time.Duration
+
+	// UniqueKeys maps unique key names to their columns, for GetByUniqueKey.
+	UniqueKeys map[string][]string
+
+	// TenantProvider resolves the tenant of ctx for entities implementing
+	// dbspi.TenantAccessor. If nil, dbspi.TenantFromContext is used.
+	TenantProvider dbspi.TenantProvider
+}
+
+// cachedTableStore is a read-through cache in front of another table store.
+//
+// Entities are cached under "<prefix>:<table>:id:<id>". Unique keys are cached
+// as "<prefix>:<table>:uk:<name>:<values>" pointing to the id, and are checked
+// against the entity on read, so only id keys need invalidation.
+//
+// Invalidation bumps a version counter under "<prefix>:<table>:ver:<id>"
+// before deleting the id key. A load that raced with a write, reading the row
+// before the write committed and caching it after the invalidation, sees the
+// version change and drops what it cached.
+//
+// When inner encrypts fields (see fieldSealer), entities are cached with those
+// fields sealed and decrypted on read, so the cache holds no plaintext of them.
+//
+// Entities are cached gob-encoded rather than handed to the cache's own codec,
+// so fields tagged `json:"-"` survive and every read decodes a fresh copy. T
+// must be gob-encodable: interface fields need gob.Register.
+//
+// Entries of tenant entities are loaded across tenants and shared by them;
+// reads hide entities of tenants other than the one of ctx.
+type cachedTableStore[T dbspi.Entity] struct {
+	inner      dbspi.TableStore[T]
+	cache      cachespi.Cache
+	opts       CachedTableStoreOptions
+	entityType reflect.Type
+	table      string
+	idField    string
+	idType     reflect.Type
+	tenant     bool
+	// sealer is inner when it encrypts fields.
+	sealer fieldSealer[T]
+	// tx is set when inner is bound to a transaction. Invalidation is then
+	// deferred until commit and reads bypass the cache.
+	tx *txState
+}
+
+// NewCachedTableStore wraps store with a read-through cache. T must be a
+// pointer to a struct.
+func NewCachedTableStore[T dbspi.Entity](store dbspi.TableStore[T], cache cachespi.Cache, opts CachedTableStoreOptions) dbspi.CachedTableStore[T] {
+	if store == nil || cache == nil {
+		panic("dbhelper: cached table store requires a table store and a cache")
+	}
+	entityType := reflect.TypeOf((*T)(nil)).Elem()
+	if entityType.Kind() != reflect.Ptr || entityType.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("dbhelper: cached table store requires a pointer to struct entity, got %s", entityType))
+	}
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = DefaultCacheKeyPrefix
+	}
+	if opts.TenantProvider == nil {
+		opts.TenantProvider = dbspi.TenantFromContext
+	}
+
+	s := &cachedTableStore[T]{
+		inner:      store,
+		cache:      cache,
+		opts:       opts,
+		entityType: entityType.Elem(),
+		idField:    dbspi.DefaultIdFieldName,
+		tx:         boundTxOf(store),
+	}
+	s.sealer, _ = store.(fieldSealer[T])
+	sample := s.newEntity()
+	s.table = sample.TableName()
+	if _, err := encodeCachedEntity(sample); err != nil {
+		panic(fmt.Sprintf("dbhelper: cached table store for %q: %v", s.table, err))
+	}
+	_, s.tenant = any(sample).(dbspi.TenantAccessor)
+	if namer, ok := any(sample).(dbspi.IdFieldNameProvider); ok {
+		s.idField = namer.IdFieldName()
+	}
+	if id := extractFieldValue(sample, s.idField); id != nil {
+		s.idType = reflect.TypeOf(id)
+	}
+	if len(opts.UniqueKeys) > 0 && s.idType == nil {
+		panic(fmt.Sprintf("dbhelper: cached table store for %q needs id field %q for unique keys", s.table, s.idField))
+	}
+	for name, columns := range opts.UniqueKeys {
+		for _, column := range columns {
+			// Unique key values are part of the cache keys.
+			if s.sealer != nil && s.sealer.encryptsColumn(column) {
+				panic(fmt.Sprintf("dbhelper: cached table store for %q cannot cache unique key %q on encrypted column %q", s.table, name, column))
+			}
+		}
+	}
+	return s
+}
+
+// ================== Cached reads ==================
+
+func (s *cachedTableStore[T]) GetById(ctx context.Context, id any) (T, error) {
+	_, entity, err := s.ExistsById(ctx, id)
+	return entity, err
+}
+
+func (s *cachedTableStore[T]) ExistsById(ctx context.Context, id any) (bool, T, error) {
+	var zero T
+	if id == nil {
+		return false, zero, nil
+	}
+	if s.bypassCache(ctx) {
+		return s.inner.ExistsById(ctx, id)
+	}
+
+	entity := s.newEntity()
+	err := s.loadById(ctx, id, entity)
+	if errors.Is(err, cachespi.ErrCacheMiss) {
+		return false, zero, nil
+	}
+	if err != nil {
+		return false, zero, err
+	}
+	if !s.visible(ctx, entity) {
+		return false, zero, nil
+	}
+	return true, entity, nil
+}
+
+// GetByUniqueKey implements dbspi.CachedTableStore.
+func (s *cachedTableStore[T]) GetByUniqueKey(ctx context.Context, name string, values ...any) (T, error) {
+	var zero T
+	columns, ok := s.opts.UniqueKeys[name]
+	if !ok {
+		return zero, fmt.Errorf("dbhelper: unique key %q is not declared for cached table %q", name, s.table)
+	}
+	if len(values) != len(columns) {
+		return zero, fmt.Errorf("dbhelper: unique key %q has %d columns, got %d values", name, len(columns), len(values))
+	}
+	query := uniqueKeyQuery(columns, values)
+	if s.bypassCache(ctx) {
+		entity, _, err := s.findOne(ctx, query)
+		return entity, err
+	}
+
+	key := s.uniqueKeyKey(name, values)
+	idReceiver := reflect.New(s.idType)
+	var loaded T
+	err := s.cache.Load(ctx, func(ctx context.Context, _ []string) ([]any, error) {
+		entity, found, err := s.findOne(dbspi.WithAllTenants(ctx), query)
+		if err != nil || !found {
+			return []any{nil}, err
+		}
+		// The entity is returned directly but not cached under its id key:
+		// its version was not read before the query.
+		loaded = s.copyEntity(entity)
+		return []any{extractFieldValue(entity, s.idField)}, nil
+	}, key, idReceiver.Interface(), s.opts.Expiration)
+	if errors.Is(err, cachespi.ErrCacheMiss) {
+		return zero, nil
+	}
+	if err != nil {
+		return zero, err
+	}
+	if any(loaded) != nil && !reflect.ValueOf(loaded).IsNil() {
+		if !s.visible(ctx, loaded) {
+			return zero, nil
+		}
+		return loaded, nil
+	}
+
+	found, entity, err := s.ExistsById(ctx, idReceiver.Elem().Interface())
+	if err != nil {
+		return zero, err
+	}
+	if found && matchesUniqueKey(entity, columns, values) {
+		return entity, nil
+	}
+	// The row was deleted or its unique key changed since the mapping was
+	// cached.
+	if err := s.cache.Delete(ctx, key); err != nil && !errors.Is(err, cachespi.ErrCacheMiss) {
+		return zero, err
+	}
+	entity, _, err = s.findOne(ctx, query)
+	return entity, err
+}
+
+// Invalidate implements dbspi.CachedTableStore.
+func (s *cachedTableStore[T]) Invalidate(ctx context.Context, ids ...any) error {
+	keys := s.idKeys(ids)
+	if len(keys) == 0 {
+		return nil
+	}
+	if s.tx != nil {
+		s.tx.addAfterCommit(func() { s.deleteKeys(ctx, keys) })
+		return nil
+	}
+	return s.expireKeys(ctx, keys)
+}
+
+// ================== Writes with invalidation ==================
+
+func (s *cachedTableStore[T]) Shard(key *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
+	store, err := s.inner.Shard(key)
+	if err != nil {
+		return store, err
+	}
+	return NewCachedTableStore(store, s.cache, s.opts), nil
+}
+
+func (s *cachedTableStore[T]) UpdateById(ctx context.Context, id any, updater dbspi.Updater) error {
+	if err := s.inner.UpdateById(ctx, id, updater); err != nil {
+		return err
+	}
+	s.invalidate(ctx, []any{id})
+	return nil
+}
+
+func (s *cachedTableStore[T]) DeleteById(ctx context.Context, id any) error {
+	if err := s.inner.DeleteById(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx, []any{id})
+	return nil
+}
+
+func (s *cachedTableStore[T]) Save(ctx context.Context, entity T) error {
+	if err := s.inner.Save(ctx, entity); err != nil {
+		return err
+	}
+	s.invalidateEntities(ctx, entity)
+	return nil
+}
+
+func (s *cachedTableStore[T]) Update(ctx context.Context, entity T) error {
+	if err := s.inner.Update(ctx, entity); err != nil {
+		return err
+	}
+	s.invalidateEntities(ctx, entity)
+	return nil
+}
+
+func (s *cachedTableStore[T]) Delete(ctx context.Context, entity T) error {
+	if err := s.inner.Delete(ctx, entity); err != nil {
+		return err
+	}
+	s.invalidateEntities(ctx, entity)
+	return nil
+}
+
+func (s *cachedTableStore[T]) BatchSave(ctx context.Context, entities []T) error {
+	if err := s.inner.BatchSave(ctx, entities); err != nil {
+		return err
+	}
+	s.invalidateEntities(ctx, entities...)
+	return nil
+}
+
+// UpdateByQuery looks up the matching ids first, so that rows the update
+// moves out of query are invalidated too.
+func (s *cachedTableStore[T]) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	ids, err := s.idsMatching(ctx, query)
+	if err != nil {
+		return err
+	}
+	if err := s.inner.UpdateByQuery(ctx, query, updater); err != nil {
+		return err
+	}
+	s.invalidate(ctx, ids)
+	return nil
+}
+
+func (s *cachedTableStore[T]) DeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	ids, err := s.idsMatching(ctx, query)
+	if err != nil {
+		return err
+	}
+	if err := s.inner.DeleteByQuery(ctx, query); err != nil {
+		return err
+	}
+	s.invalidate(ctx, ids)
+	return nil
+}
+
+func (s *cachedTableStore[T]) Upsert(ctx context.Context, entity T, conflictColumns []dbspi.Column, updater dbspi.Updater) error {
+	if err := s.inner.Upsert(ctx, entity, conflictColumns, updater); err != nil {
+		return err
+	}
+	return s.invalidateUpserted(ctx, []T{entity}, conflictColumns)
+}
+
+func (s *cachedTableStore[T]) BatchUpsert(ctx context.Context, entities []T, conflictColumns []dbspi.Column, updater dbspi.Updater, batchSize int) error {
+	if err := s.inner.BatchUpsert(ctx, entities, conflictColumns, updater, batchSize); err != nil {
+		return err
+	}
+	return s.invalidateUpserted(ctx, entities, conflictColumns)
+}
+
+// invalidateUpserted invalidates upserted rows by id, looking up the ids of
+// rows that were matched by conflictColumns only.
+func (s *cachedTableStore[T]) invalidateUpserted(ctx context.Context, entities []T, conflictColumns []dbspi.Column) error {
+	var ids []any
+	for _, entity := range entities {
+		if id := extractFieldValue(entity, s.idField); !isZeroId(id) {
+			ids = append(ids, id)
+			continue
+		}
+		if len(conflictColumns) == 0 {
+			continue
+		}
+		conditions := make([]dbspi.Condition, 0, len(conflictColumns))
+		for _, col := range conflictColumns {
+			value := extractFieldValue(entity, col.Name())
+			conditions = append(conditions, NewField[any](col.Name()).Eq(&value))
+		}
+		matched, err := s.idsMatching(ctx, And(conditions...))
+		if err != nil {
+			return err
+		}
+		ids = append(ids, matched...)
+	}
+	s.invalidate(ctx, ids)
+	return nil
+}
+
+// ================== Soft delete ==================
+
+func (s *cachedTableStore[T]) SoftDeleteById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	if err := store.SoftDeleteById(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx, []any{id})
+	return nil
+}
+
+func (s *cachedTableStore[T]) SoftDeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	ids, err := s.idsMatching(ctx, query)
+	if err != nil {
+		return err
+	}
+	if err := store.SoftDeleteByQuery(ctx, query); err != nil {
+		return err
+	}
+	s.invalidate(ctx, ids)
+	return nil
+}
+
+func (s *cachedTableStore[T]) RestoreById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	if err := store.RestoreById(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate(ctx, []any{id})
+	return nil
+}
+
+func (s *cachedTableStore[T]) RestoreByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	ids, err := s.idsMatching(ctx, query)
+	if err != nil {
+		return err
+	}
+	if err := store.RestoreByQuery(ctx, query); err != nil {
+		return err
+	}
+	s.invalidate(ctx, ids)
+	return nil
+}
+
+func (s *cachedTableStore[T]) FindNotDeleted(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return store.FindNotDeleted(ctx, query, pagination)
+}
+
+func (s *cachedTableStore[T]) CountNotDeleted(ctx context.Context, query dbspi.Query) (uint64, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return 0, err
+	}
+	return store.CountNotDeleted(ctx, query)
+}
+
+func (s *cachedTableStore[T]) ExistsByIdNotDeleted(ctx context.Context, id any) (bool, T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	return store.ExistsByIdNotDeleted(ctx, id)
+}
+
+func (s *cachedTableStore[T]) ExistsNotDeleted(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	return store.ExistsNotDeleted(ctx, query)
+}
+
+// ================== Pass-through ==================
+
+func (s *cachedTableStore[T]) Find(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	return s.inner.Find(ctx, query, pagination)
+}
+
+func (s *cachedTableStore[T]) Exists(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	return s.inner.Exists(ctx, query)
+}
+
+func (s *cachedTableStore[T]) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	return s.inner.Count(ctx, query)
+}
+
+func (s *cachedTableStore[T]) Create(ctx context.Context, entity T) error {
+	return s.inner.Create(ctx, entity)
+}
+
+func (s *cachedTableStore[T]) BatchCreate(ctx context.Context, entities []T, batchSize int) error {
+	return s.inner.BatchCreate(ctx, entities, batchSize)
+}
+
+func (s *cachedTableStore[T]) FirstOrCreate(ctx context.Context, entity T, query dbspi.Query) (T, error) {
+	return s.inner.FirstOrCreate(ctx, entity, query)
+}
+
+func (s *cachedTableStore[T]) FindAll(ctx context.Context, query dbspi.Query, batchSize int) ([]T, error) {
+	return s.inner.FindAll(ctx, query, batchSize)
+}
+
+func (s *cachedTableStore[T]) CountAll(ctx context.Context, query dbspi.Query) (uint64, error) {
+	return s.inner.CountAll(ctx, query)
+}
+
+// Raw implements dbspi.SQLTableStore.
+func (s *cachedTableStore[T]) Raw(ctx context.Context, sql string, args ...any) ([]T, error) {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return store.Raw(ctx, sql, args...)
+}
+
+// Exec implements dbspi.SQLTableStore. It cannot tell which rows changed;
+// call Invalidate for them.
+func (s *cachedTableStore[T]) Exec(ctx context.Context, sql string, args ...any) error {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.Exec(ctx, sql, args...)
+}
+
+// RawScan implements rawScanner.
+func (s *cachedTableStore[T]) RawScan(ctx context.Context, dest any, sql string, args ...any) error {
+	scanner, err := toRawScanner(s.inner)
+	if err != nil {
+		return err
+	}
+	return scanner.RawScan(ctx, dest, sql, args...)
+}
+
+// unwrap implements tableStoreWrapper.
+func (s *cachedTableStore[T]) unwrap() (dbspi.TableStore[T], func(), error) {
+	return s.inner, func() {}, nil
+}
+
+// rowsDeleted implements deletionObserver.
+func (s *cachedTableStore[T]) rowsDeleted(ctx context.Context, ids []any) {
+	s.invalidate(ctx, ids)
+}
+
+// boundTx implements txBound.
+func (s *cachedTableStore[T]) boundTx() *txState {
+	return s.tx
+}
+
+// routeChange implements changeRouter.
+func (s *cachedTableStore[T]) routeChange(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error) {
+	return routeChange(ctx, s.inner, entity, id, query)
+}
+
+// ================== Helpers ==================
+
+// loadById reads the entity of id through the cache into receiver. If the id
+// is invalidated while the loader runs, the entry the loader cached may hold
+// the row from before the write and is dropped again.
+func (s *cachedTableStore[T]) loadById(ctx context.Context, id any, receiver T) error {
+	key := s.idKey(id)
+	var version int64
+	var versionErr error
+	loaded := false
+	var data []byte
+	err := s.cache.Load(ctx, func(ctx context.Context, _ []string) ([]any, error) {
+		version, versionErr = s.version(ctx, key)
+		loaded = true
+		found, entity, err := s.inner.ExistsById(dbspi.WithAllTenants(ctx), id)
+		if err != nil || !found {
+			return []any{nil}, err
+		}
+		if s.sealer != nil {
+			if entity, err = s.sealer.sealedCopy(ctx, entity); err != nil {
+				return []any{nil}, err
+			}
+		}
+		encoded, err := encodeCachedEntity(entity)
+		if err != nil {
+			return []any{nil}, err
+		}
+		return []any{encoded}, nil
+	}, key, &data, s.opts.Expiration)
+	if loaded {
+		after, afterErr := s.version(ctx, key)
+		if versionErr != nil || afterErr != nil || after != version {
+			s.deleteKeys(ctx, []string{key})
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(receiver); err != nil {
+		return fmt.Errorf("dbhelper: decode cached %s %v: %w", s.table, id, err)
+	}
+	if s.sealer != nil {
+		return s.sealer.open(ctx, receiver)
+	}
+	return nil
+}
+
+// encodeCachedEntity gob-encodes entity for the cache.
+func encodeCachedEntity(entity any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entity); err != nil {
+		return nil, fmt.Errorf("dbhelper: encode %T for the cache: %w", entity, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// version returns the invalidation counter of an id key; a missing counter
+// reads as 0.
+func (s *cachedTableStore[T]) version(ctx context.Context, key string) (int64, error) {
+	var version int64
+	err := s.cache.Get(ctx, s.versionKey(key), &version)
+	if errors.Is(err, cachespi.ErrCacheMiss) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// bypassCache reports whether a read must go to the database: inside a
+// transaction, to see its own uncommitted writes and take row locks.
+func (s *cachedTableStore[T]) bypassCache(ctx context.Context) bool {
+	if s.tx != nil {
+		return true
+	}
+	// Without a tenant, the inner store rejects the read.
+	if s.tenant && !dbspi.AllTenantsFromContext(ctx) {
+		_, found := s.opts.TenantProvider(ctx)
+		return !found
+	}
+	return false
+}
+
+// visible reports whether a cached entity belongs to the tenant of ctx.
+func (s *cachedTableStore[T]) visible(ctx context.Context, entity T) bool {
+	accessor, isTenant := any(entity).(dbspi.TenantAccessor)
+	if !isTenant || dbspi.AllTenantsFromContext(ctx) {
+		return true
+	}
+	tenantId, _ := s.opts.TenantProvider(ctx)
+	return accessor.GetTenantId() == tenantId
+}
+
+func (s *cachedTableStore[T]) findOne(ctx context.Context, query dbspi.Query) (T, bool, error) {
+	var zero T
+	limit := 1
+	rows, err := s.inner.Find(ctx, query, NewPagination().WithLimit(&limit))
+	if err != nil || len(rows) == 0 {
+		return zero, false, err
+	}
+	return rows[0], true, nil
+}
+
+// idsMatching returns the ids of the rows matching query.
+func (s *cachedTableStore[T]) idsMatching(ctx context.Context, query dbspi.Query) ([]any, error) {
+	return findIds(ctx, s.inner, s.idField, query)
+}
+
+func (s *cachedTableStore[T]) invalidateEntities(ctx context.Context, entities ...T) {
+	ids := make([]any, 0, len(entities))
+	for _, entity := range entities {
+		ids = append(ids, extractFieldValue(entity, s.idField))
+	}
+	s.invalidate(ctx, ids)
+}
+
+// invalidate drops ids after a successful write. Cache errors are logged
+// rather than returned because the write itself has succeeded.
+func (s *cachedTableStore[T]) invalidate(ctx context.Context, ids []any) {
+	keys := s.idKeys(ids)
+	if len(keys) == 0 {
+		return
+	}
+	if s.tx != nil {
+		s.tx.addAfterCommit(func() { s.deleteKeys(ctx, keys) })
+		return
+	}
+	s.deleteKeys(ctx, keys)
+}
+
+func (s *cachedTableStore[T]) deleteKeys(ctx context.Context, keys []string) {
+	// Invalidation must not be skipped because the request finished first.
+	ctx = context.WithoutCancel(ctx)
+	if err := s.expireKeys(ctx, keys); err != nil {
+		logger.Warn(ctx, "cache invalidation failed", logger.String("table", s.table), logger.Strings("keys", keys), logger.Err(err))
+	}
+}
+
+// expireKeys bumps the versions of id keys, then deletes them. The bump comes
+// first so that a load racing with the delete sees it after caching.
+func (s *cachedTableStore[T]) expireKeys(ctx context.Context, keys []string) error {
+	var errs []error
+	for _, key := range keys {
+		if _, err := s.cache.Incr(ctx, s.versionKey(key), 1, s.opts.Expiration); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.cache.DeleteMany(ctx, keys); err != nil && !errors.Is(err, cachespi.ErrCacheMiss) {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *cachedTableStore[T]) idKeys(ids []any) []string {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !isZeroId(id) {
+			keys = append(keys, s.idKey(id))
+		}
+	}
+	return keys
+}
+
+func (s *cachedTableStore[T]) idKey(id any) string {
+	return fmt.Sprintf("%s:%s:id:%v", s.opts.KeyPrefix, s.table, id)
+}
+
+// versionKey maps the id key "<prefix>:<table>:id:<id>" to the key of its
+// version counter, "<prefix>:<table>:ver:<id>".
+func (s *cachedTableStore[T]) versionKey(idKey string) string {
+	return fmt.Sprintf("%s:%s:ver:%s", s.opts.KeyPrefix, s.table, strings.TrimPrefix(idKey, s.idKey("")))
+}
+
+func (s *cachedTableStore[T]) uniqueKeyKey(name string, values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return fmt.Sprintf("%s:%s:uk:%s:%s", s.opts.KeyPrefix, s.table, name, strings.Join(parts, ":"))
+}
+
+func (s *cachedTableStore[T]) newEntity() T {
+	return reflect.New(s.entityType).Interface().(T)
+}
+
+func (s *cachedTableStore[T]) copyEntity(entity T) T {
+	copied := reflect.New(s.entityType)
+	copied.Elem().Set(reflect.ValueOf(entity).Elem())
+	return copied.Interface().(T)
+}
+
+func uniqueKeyQuery(columns []string, values []any) dbspi.Query {
+	conditions := make([]dbspi.Condition, len(columns))
+	for i, col := range columns {
+		value := values[i]
+		conditions[i] = NewField[any](col).Eq(&value)
+	}
+	return And(conditions...)
+}
+
+func matchesUniqueKey(entity any, columns []string, values []any) bool {
+	for i, col := range columns {
+		if fmt.Sprint(extractFieldValue(entity, col)) != fmt.Sprint(values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isZeroId(id any) bool {
+	return id == nil || reflect.ValueOf(id).IsZero()
+}
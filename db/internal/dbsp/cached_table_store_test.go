@@ -0,0 +1,240 @@
+package dbsp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachehelper"
+	"github.com/MrMiaoMIMI/goshared/cache/cachespi"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// countingItemStore serves joinTestItem rows from memory and counts reads.
+// Methods the tests do not use panic through the nil embedded interface.
+type countingItemStore struct {
+	dbspi.TableStore[*joinTestItem]
+	rows  map[int64]joinTestItem
+	reads int
+	tx    *txState
+	// afterRead runs once a row has been read, before it is returned.
+	afterRead func()
+}
+
+func (s *countingItemStore) ExistsById(_ context.Context, id any) (bool, *joinTestItem, error) {
+	s.reads++
+	row, ok := s.rows[id.(int64)]
+	if s.afterRead != nil {
+		s.afterRead()
+	}
+	if !ok {
+		return false, nil, nil
+	}
+	return true, &row, nil
+}
+
+func (s *countingItemStore) Find(_ context.Context, _ dbspi.Query, _ dbspi.Pagination) ([]*joinTestItem, error) {
+	s.reads++
+	var rows []*joinTestItem
+	for _, row := range s.rows {
+		if row.SKU == "sku-1" {
+			rows = append(rows, &row)
+		}
+	}
+	return rows, nil
+}
+
+func (s *countingItemStore) UpdateById(_ context.Context, id any, _ dbspi.Updater) error {
+	row := s.rows[id.(int64)]
+	row.SKU += "-updated"
+	s.rows[id.(int64)] = row
+	return nil
+}
+
+func (s *countingItemStore) boundTx() *txState { return s.tx }
+
+func newCountingItemStore() *countingItemStore {
+	return &countingItemStore{rows: map[int64]joinTestItem{1: {ID: 1, ShopID: 3, SKU: "sku-1"}}}
+}
+
+func TestCachedTableStoreServesReadsFromCache(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingItemStore()
+	store := NewCachedTableStore[*joinTestItem](inner, cachehelper.NewInMemCache(), CachedTableStoreOptions{})
+
+	for i := 0; i < 2; i++ {
+		item, err := store.GetById(ctx, int64(1))
+		if err != nil || item == nil || item.SKU != "sku-1" {
+			t.Fatalf("unexpected GetById result %+v, %v", item, err)
+		}
+	}
+	if inner.reads != 1 {
+		t.Fatalf("expected one database read, got %d", inner.reads)
+	}
+
+	found, item, err := store.ExistsById(ctx, int64(2))
+	if err != nil || found || item != nil {
+		t.Fatalf("expected missing row, got %v %+v %v", found, item, err)
+	}
+
+	if err := store.UpdateById(ctx, int64(1), NewUpdater()); err != nil {
+		t.Fatal(err)
+	}
+	item, err = store.GetById(ctx, int64(1))
+	if err != nil || item.SKU != "sku-1-updated" {
+		t.Fatalf("expected fresh row after update, got %+v, %v", item, err)
+	}
+}
+
+func TestCachedTableStoreGetByUniqueKey(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingItemStore()
+	store := NewCachedTableStore[*joinTestItem](inner, cachehelper.NewInMemCache(), CachedTableStoreOptions{
+		UniqueKeys: map[string][]string{"sku": {"sku"}},
+	})
+
+	// The first call queries by unique key, the second loads the id once.
+	for i := 0; i < 3; i++ {
+		item, err := store.GetByUniqueKey(ctx, "sku", "sku-1")
+		if err != nil || item == nil || item.ID != 1 {
+			t.Fatalf("unexpected GetByUniqueKey result %+v, %v", item, err)
+		}
+	}
+	if inner.reads != 2 {
+		t.Fatalf("expected two database reads, got %d", inner.reads)
+	}
+
+	// The cached mapping no longer matches once the unique key changes.
+	if err := store.UpdateById(ctx, int64(1), NewUpdater()); err != nil {
+		t.Fatal(err)
+	}
+	item, err := store.GetByUniqueKey(ctx, "sku", "sku-1")
+	if err != nil || item != nil {
+		t.Fatalf("expected no row for stale unique key, got %+v, %v", item, err)
+	}
+
+	if _, err := store.GetByUniqueKey(ctx, "email", "x"); err == nil {
+		t.Fatal("expected undeclared unique key to fail")
+	}
+}
+
+func TestCachedTableStoreDropsLoadRacingWithInvalidation(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingItemStore()
+	store := NewCachedTableStore[*joinTestItem](inner, cachehelper.NewInMemCache(), CachedTableStoreOptions{})
+
+	// A write commits and invalidates after the load read the old row but
+	// before the loaded row is cached.
+	inner.afterRead = func() {
+		inner.afterRead = nil
+		if err := store.UpdateById(ctx, int64(1), NewUpdater()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if item, err := store.GetById(ctx, int64(1)); err != nil || item.SKU != "sku-1" {
+		t.Fatalf("expected the row read before the write, got %+v, %v", item, err)
+	}
+	if item, err := store.GetById(ctx, int64(1)); err != nil || item.SKU != "sku-1-updated" {
+		t.Fatalf("expected stale load to be dropped, got %+v, %v", item, err)
+	}
+	if item, _ := store.GetById(ctx, int64(1)); item.SKU != "sku-1-updated" || inner.reads != 2 {
+		t.Fatalf("expected fresh row to stay cached, got %+v after %d reads", item, inner.reads)
+	}
+}
+
+func TestCachedTableStoreDefersInvalidationInTransaction(t *testing.T) {
+	ctx := context.Background()
+	cache := cachehelper.NewInMemCache()
+	inner := newCountingItemStore()
+	store := NewCachedTableStore[*joinTestItem](inner, cache, CachedTableStoreOptions{})
+	if _, err := store.GetById(ctx, int64(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	txInner := newCountingItemStore()
+	txInner.rows, txInner.tx = inner.rows, &txState{}
+	txStore := NewCachedTableStore[*joinTestItem](txInner, cache, CachedTableStoreOptions{})
+	if err := txStore.UpdateById(ctx, int64(1), NewUpdater()); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := txStore.GetById(ctx, int64(1)); item.SKU != "sku-1-updated" {
+		t.Fatalf("expected transaction to read its own write, got %+v", item)
+	}
+	if item, _ := store.GetById(ctx, int64(1)); item.SKU != "sku-1" {
+		t.Fatalf("expected cached row before commit, got %+v", item)
+	}
+
+	txInner.tx.runAfterCommit()
+	if item, _ := store.GetById(ctx, int64(1)); item.SKU != "sku-1-updated" {
+		t.Fatalf("expected fresh row after commit, got %+v", item)
+	}
+}
+
+// jsonCache stores the values of Load as JSON, like the Redis cache does.
+// Other methods use the embedded in-memory cache.
+type jsonCache struct {
+	cachespi.Cache
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func newJSONCache() *jsonCache {
+	return &jsonCache{Cache: cachehelper.NewInMemCache(), entries: make(map[string][]byte)}
+}
+
+func (c *jsonCache) Load(ctx context.Context, loader cachespi.DataLoader, key string, receiver any, _ time.Duration, _ ...cachespi.OperationOption) error {
+	c.mu.Lock()
+	data, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		results, err := loader(ctx, []string{key})
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 || results[0] == nil {
+			return cachespi.ErrCacheMiss
+		}
+		if data, err = json.Marshal(results[0]); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.entries[key] = data
+		c.mu.Unlock()
+	}
+	return json.Unmarshal(data, receiver)
+}
+
+func (c *jsonCache) DeleteMany(ctx context.Context, keys []string, opts ...cachespi.OperationOption) error {
+	c.mu.Lock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	return c.Cache.DeleteMany(ctx, keys, opts...)
+}
+
+type cachedTestAccount struct {
+	dbspi.CommonFields
+	Email        string `gorm:"column:email"`
+	PasswordHash string `gorm:"column:password_hash" json:"-"`
+}
+
+func (*cachedTestAccount) TableName() string { return "cached_account_tab" }
+
+func TestCachedTableStoreKeepsFieldsHiddenFromJSON(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryTableStore(&cachedTestAccount{}, testCommonFieldAutoFillOptions())
+	if err := inner.Create(ctx, &cachedTestAccount{Email: "a@x.io", PasswordHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+	store := NewCachedTableStore[*cachedTestAccount](inner, newJSONCache(), CachedTableStoreOptions{})
+
+	for i := 0; i < 2; i++ {
+		account, err := store.GetById(ctx, uint64(1))
+		if err != nil || account == nil || account.PasswordHash != "hash" {
+			t.Fatalf("read %d = %+v, %v", i, account, err)
+		}
+	}
+}
@@ -0,0 +1,628 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/logger"
+)
+
+var (
+	_ dbspi.SoftDeleteTableStore[*_tableForCheck] = (*changeCaptureTableStore[*_tableForCheck])(nil)
+	_ dbspi.SQLTableStore[*_tableForCheck]        = (*changeCaptureTableStore[*_tableForCheck])(nil)
+)
+
+// changeRouter is implemented by table stores that route writes, so change
+// events can name the physical target and read before-images from it.
+type changeRouter[T dbspi.Entity] interface {
+	// routeChange returns the single-table store a write with the given
+	// entity, id or query is routed to.
+	routeChange(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error)
+}
+
+// changeTargeter is implemented by table stores that write to a single
+// physical table.
+type changeTargeter interface {
+	changeTarget() dbspi.ChangeTarget
+}
+
+// routeChange returns the store store routes a write to, or store itself when
+// it does not route.
+func routeChange[T dbspi.Entity](ctx context.Context, store dbspi.TableStore[T], entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error) {
+	if router, ok := store.(changeRouter[T]); ok {
+		return router.routeChange(ctx, entity, id, query)
+	}
+	return store, nil
+}
+
+// ChangeCaptureOptions configures NewChangeCaptureTableStore.
+type ChangeCaptureOptions struct {
+	// Sinks receive the change events once the write has committed.
+	Sinks []dbspi.ChangeSink
+
+	// AuditLog writes a dbspi.AuditRecord per changed row to the audit table
+	// of the database the row lives in, in the same session as the write.
+	AuditLog bool
+}
+
+// changeCaptureTableStore reports every row changed through it to sinks and,
+// optionally, to the audit log.
+//
+// Writes by query and by id look up the affected ids or the target shard
+// before writing, and entity updates and deletes read the before-image, so
+// capture costs an extra read per write. With the audit log, the after-image
+// is read back as well.
+type changeCaptureTableStore[T dbspi.Entity] struct {
+	inner      dbspi.TableStore[T]
+	opts       ChangeCaptureOptions
+	table      string
+	entityType string
+	groupKey   string
+	idField    string
+	// tx is set when inner is bound to a transaction. Events are then
+	// emitted after commit and dropped on rollback.
+	tx *txState
+}
+
+// NewChangeCaptureTableStore wraps store so that its writes are reported as
+// configured by opts.
+func NewChangeCaptureTableStore[T dbspi.Entity](store dbspi.TableStore[T], opts ChangeCaptureOptions) dbspi.SoftDeleteTableStore[T] {
+	if store == nil {
+		panic("dbhelper: change capture requires a table store")
+	}
+	var entity T
+	entityType := reflect.TypeOf(entity)
+	if entityType == nil || entityType.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("dbhelper: change capture requires a pointer entity, got %v", entityType))
+	}
+	entity = reflect.New(entityType.Elem()).Interface().(T)
+
+	s := &changeCaptureTableStore[T]{
+		inner:      store,
+		opts:       opts,
+		table:      entity.TableName(),
+		entityType: entityType.Elem().String(),
+		groupKey:   dbspi.DefaultDatabaseGroupKey,
+		idField:    dbspi.DefaultIdFieldName,
+		tx:         boundTxOf(store),
+	}
+	if provider, ok := any(entity).(dbspi.DatabaseGroupKeyProvider); ok {
+		s.groupKey = provider.DatabaseGroupKey()
+	}
+	if namer, ok := any(entity).(dbspi.IdFieldNameProvider); ok {
+		s.idField = namer.IdFieldName()
+	}
+	return s
+}
+
+// ================== Entity writes ==================
+
+func (s *changeCaptureTableStore[T]) Create(ctx context.Context, entity T) error {
+	routed, target, err := s.route(ctx, entity, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.inner.Create(ctx, entity); err != nil {
+		return err
+	}
+	return s.record(ctx, routed, s.entityEvent(dbspi.ChangeCreate, target, nil, entity))
+}
+
+// BatchCreate writes the audit records of each shard through that shard's
+// store.
+func (s *changeCaptureTableStore[T]) BatchCreate(ctx context.Context, entities []T, batchSize int) error {
+	if len(entities) == 0 {
+		return s.inner.BatchCreate(ctx, entities, batchSize)
+	}
+	events := make([]dbspi.ChangeEvent, len(entities))
+	routedStores := make([]dbspi.TableStore[T], len(entities))
+	for i, entity := range entities {
+		routed, target, err := s.route(ctx, entity, nil, nil)
+		if err != nil {
+			return err
+		}
+		routedStores[i] = routed
+		events[i].Target = target
+	}
+	if err := s.inner.BatchCreate(ctx, entities, batchSize); err != nil {
+		return err
+	}
+	for i, entity := range entities {
+		events[i] = s.entityEvent(dbspi.ChangeCreate, events[i].Target, nil, entity)
+	}
+	return s.recordRouted(ctx, routedStores, events)
+}
+
+func (s *changeCaptureTableStore[T]) Save(ctx context.Context, entity T) error {
+	return s.writeEntity(ctx, dbspi.ChangeUpdate, entity, s.inner.Save, true)
+}
+
+func (s *changeCaptureTableStore[T]) Update(ctx context.Context, entity T) error {
+	return s.writeEntity(ctx, dbspi.ChangeUpdate, entity, s.inner.Update, false)
+}
+
+func (s *changeCaptureTableStore[T]) Delete(ctx context.Context, entity T) error {
+	return s.writeEntity(ctx, dbspi.ChangeDelete, entity, s.inner.Delete, false)
+}
+
+func (s *changeCaptureTableStore[T]) BatchSave(ctx context.Context, entities []T) error {
+	return s.writeEntities(ctx, dbspi.ChangeUpdate, entities, s.inner.BatchSave, true)
+}
+
+func (s *changeCaptureTableStore[T]) Upsert(ctx context.Context, entity T, conflictColumns []dbspi.Column, updater dbspi.Updater) error {
+	return s.writeEntity(ctx, dbspi.ChangeUpsert, entity, func(ctx context.Context, entity T) error {
+		return s.inner.Upsert(ctx, entity, conflictColumns, updater)
+	}, false)
+}
+
+func (s *changeCaptureTableStore[T]) BatchUpsert(ctx context.Context, entities []T, conflictColumns []dbspi.Column, updater dbspi.Updater, batchSize int) error {
+	return s.writeEntities(ctx, dbspi.ChangeUpsert, entities, func(ctx context.Context, entities []T) error {
+		return s.inner.BatchUpsert(ctx, entities, conflictColumns, updater, batchSize)
+	}, false)
+}
+
+// FirstOrCreate records a create only when no row matched query.
+func (s *changeCaptureTableStore[T]) FirstOrCreate(ctx context.Context, entity T, query dbspi.Query) (T, error) {
+	var zero T
+	routed, target, err := s.route(ctx, entity, nil, query)
+	if err != nil {
+		return zero, err
+	}
+	found, _, err := routed.Exists(ctx, query)
+	if err != nil {
+		return zero, err
+	}
+	result, err := s.inner.FirstOrCreate(ctx, entity, query)
+	if err != nil || found {
+		return result, err
+	}
+	return result, s.record(ctx, routed, s.entityEvent(dbspi.ChangeCreate, target, nil, result))
+}
+
+// writeEntity runs write for entity and records op with the before-image read
+// from the routed store. With createIfNew, a write of a row that did not
+// exist is recorded as a create.
+func (s *changeCaptureTableStore[T]) writeEntity(ctx context.Context, op dbspi.ChangeOperation, entity T, write func(context.Context, T) error, createIfNew bool) error {
+	return s.writeEntities(ctx, op, []T{entity}, func(ctx context.Context, entities []T) error {
+		return write(ctx, entities[0])
+	}, createIfNew)
+}
+
+func (s *changeCaptureTableStore[T]) writeEntities(ctx context.Context, op dbspi.ChangeOperation, entities []T, write func(context.Context, []T) error, createIfNew bool) error {
+	events := make([]dbspi.ChangeEvent, len(entities))
+	routedStores := make([]dbspi.TableStore[T], len(entities))
+	for i, entity := range entities {
+		routed, target, err := s.route(ctx, entity, nil, nil)
+		if err != nil {
+			return err
+		}
+		before, err := s.readById(ctx, routed, s.idOf(entity))
+		if err != nil {
+			return err
+		}
+		routedStores[i] = routed
+		events[i] = dbspi.ChangeEvent{Operation: op, Target: target, Before: before}
+	}
+	if err := write(ctx, entities); err != nil {
+		return err
+	}
+	for i, entity := range entities {
+		// Rows written without an id get one from the database.
+		events[i].PrimaryKey = s.idOf(entity)
+		if createIfNew && events[i].Before == nil {
+			events[i].Operation = dbspi.ChangeCreate
+		}
+		if op == dbspi.ChangeDelete {
+			continue
+		}
+		events[i].After = snapshotEntity(entity)
+		if s.opts.AuditLog {
+			// Read back what was stored, including defaults and fields the
+			// write left untouched.
+			after, err := s.readById(ctx, routedStores[i], events[i].PrimaryKey)
+			if err != nil {
+				return err
+			}
+			if after != nil {
+				events[i].After = after
+			}
+		}
+	}
+	return s.recordRouted(ctx, routedStores, events)
+}
+
+// ================== Id and query writes ==================
+
+func (s *changeCaptureTableStore[T]) UpdateById(ctx context.Context, id any, updater dbspi.Updater) error {
+	return s.writeById(ctx, dbspi.ChangeUpdate, id, func(ctx context.Context) error {
+		return s.inner.UpdateById(ctx, id, updater)
+	})
+}
+
+func (s *changeCaptureTableStore[T]) DeleteById(ctx context.Context, id any) error {
+	return s.writeById(ctx, dbspi.ChangeDelete, id, func(ctx context.Context) error {
+		return s.inner.DeleteById(ctx, id)
+	})
+}
+
+func (s *changeCaptureTableStore[T]) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	return s.writeByQuery(ctx, dbspi.ChangeUpdate, query, func(ctx context.Context) error {
+		return s.inner.UpdateByQuery(ctx, query, updater)
+	})
+}
+
+func (s *changeCaptureTableStore[T]) DeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	return s.writeByQuery(ctx, dbspi.ChangeDelete, query, func(ctx context.Context) error {
+		return s.inner.DeleteByQuery(ctx, query)
+	})
+}
+
+func (s *changeCaptureTableStore[T]) SoftDeleteById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return s.writeById(ctx, dbspi.ChangeSoftDelete, id, func(ctx context.Context) error {
+		return store.SoftDeleteById(ctx, id)
+	})
+}
+
+func (s *changeCaptureTableStore[T]) SoftDeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return s.writeByQuery(ctx, dbspi.ChangeSoftDelete, query, func(ctx context.Context) error {
+		return store.SoftDeleteByQuery(ctx, query)
+	})
+}
+
+func (s *changeCaptureTableStore[T]) RestoreById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return s.writeById(ctx, dbspi.ChangeRestore, id, func(ctx context.Context) error {
+		return store.RestoreById(ctx, id)
+	})
+}
+
+func (s *changeCaptureTableStore[T]) RestoreByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return s.writeByQuery(ctx, dbspi.ChangeRestore, query, func(ctx context.Context) error {
+		return store.RestoreByQuery(ctx, query)
+	})
+}
+
+// writeById records op for id. Row images are read only for the audit log.
+func (s *changeCaptureTableStore[T]) writeById(ctx context.Context, op dbspi.ChangeOperation, id any, write func(context.Context) error) error {
+	if id == nil {
+		return write(ctx)
+	}
+	var zero T
+	routed, target, err := s.route(ctx, zero, id, nil)
+	if err != nil {
+		return err
+	}
+	event := dbspi.ChangeEvent{Operation: op, PrimaryKey: id, Target: target}
+	if s.opts.AuditLog {
+		if event.Before, err = s.readById(ctx, routed, id); err != nil {
+			return err
+		}
+	}
+	if err := write(ctx); err != nil {
+		return err
+	}
+	if s.opts.AuditLog && op != dbspi.ChangeDelete {
+		if event.After, err = s.readById(ctx, routed, id); err != nil {
+			return err
+		}
+	}
+	return s.record(ctx, routed, event)
+}
+
+// writeByQuery looks up the rows matching query before write and records one
+// event per row. Row images are read only for the audit log.
+func (s *changeCaptureTableStore[T]) writeByQuery(ctx context.Context, op dbspi.ChangeOperation, query dbspi.Query, write func(context.Context) error) error {
+	var zero T
+	routed, target, err := s.route(ctx, zero, nil, query)
+	if err != nil {
+		return err
+	}
+	var events []dbspi.ChangeEvent
+	if s.opts.AuditLog {
+		rows, err := routed.Find(ctx, query, nil)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			events = append(events, dbspi.ChangeEvent{Operation: op, PrimaryKey: s.idOf(row), Before: row, Target: target})
+		}
+	} else {
+		ids, err := findIds(ctx, routed, s.idField, query)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			events = append(events, dbspi.ChangeEvent{Operation: op, PrimaryKey: id, Target: target})
+		}
+	}
+	if err := write(ctx); err != nil {
+		return err
+	}
+	if s.opts.AuditLog && op != dbspi.ChangeDelete && len(events) > 0 {
+		ids := make([]any, len(events))
+		for i, event := range events {
+			ids[i] = event.PrimaryKey
+		}
+		rows, err := routed.Find(ctx, NewQuery(NewField[any](s.idField).In(ids)), nil)
+		if err != nil {
+			return err
+		}
+		after := make(map[string]T, len(rows))
+		for _, row := range rows {
+			after[fmt.Sprint(s.idOf(row))] = row
+		}
+		for i := range events {
+			if row, ok := after[fmt.Sprint(events[i].PrimaryKey)]; ok {
+				events[i].After = row
+			}
+		}
+	}
+	return s.record(ctx, routed, events...)
+}
+
+// ================== Pass-through ==================
+
+// Shard returns the shard store wrapped with the same options.
+func (s *changeCaptureTableStore[T]) Shard(key *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
+	store, err := s.inner.Shard(key)
+	if err != nil {
+		return store, err
+	}
+	return NewChangeCaptureTableStore(store, s.opts), nil
+}
+
+func (s *changeCaptureTableStore[T]) GetById(ctx context.Context, id any) (T, error) {
+	return s.inner.GetById(ctx, id)
+}
+
+func (s *changeCaptureTableStore[T]) ExistsById(ctx context.Context, id any) (bool, T, error) {
+	return s.inner.ExistsById(ctx, id)
+}
+
+func (s *changeCaptureTableStore[T]) Find(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	return s.inner.Find(ctx, query, pagination)
+}
+
+func (s *changeCaptureTableStore[T]) Exists(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	return s.inner.Exists(ctx, query)
+}
+
+func (s *changeCaptureTableStore[T]) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	return s.inner.Count(ctx, query)
+}
+
+func (s *changeCaptureTableStore[T]) FindAll(ctx context.Context, query dbspi.Query, batchSize int) ([]T, error) {
+	return s.inner.FindAll(ctx, query, batchSize)
+}
+
+func (s *changeCaptureTableStore[T]) CountAll(ctx context.Context, query dbspi.Query) (uint64, error) {
+	return s.inner.CountAll(ctx, query)
+}
+
+func (s *changeCaptureTableStore[T]) FindNotDeleted(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return store.FindNotDeleted(ctx, query, pagination)
+}
+
+func (s *changeCaptureTableStore[T]) CountNotDeleted(ctx context.Context, query dbspi.Query) (uint64, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return 0, err
+	}
+	return store.CountNotDeleted(ctx, query)
+}
+
+func (s *changeCaptureTableStore[T]) ExistsByIdNotDeleted(ctx context.Context, id any) (bool, T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	return store.ExistsByIdNotDeleted(ctx, id)
+}
+
+func (s *changeCaptureTableStore[T]) ExistsNotDeleted(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	return store.ExistsNotDeleted(ctx, query)
+}
+
+// Raw implements dbspi.SQLTableStore.
+func (s *changeCaptureTableStore[T]) Raw(ctx context.Context, sql string, args ...any) ([]T, error) {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return store.Raw(ctx, sql, args...)
+}
+
+// Exec implements dbspi.SQLTableStore. Raw SQL writes are not captured.
+func (s *changeCaptureTableStore[T]) Exec(ctx context.Context, sql string, args ...any) error {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.Exec(ctx, sql, args...)
+}
+
+// RawScan implements rawScanner.
+func (s *changeCaptureTableStore[T]) RawScan(ctx context.Context, dest any, sql string, args ...any) error {
+	scanner, err := toRawScanner(s.inner)
+	if err != nil {
+		return err
+	}
+	return scanner.RawScan(ctx, dest, sql, args...)
+}
+
+// unwrap implements tableStoreWrapper.
+func (s *changeCaptureTableStore[T]) unwrap() (dbspi.TableStore[T], func(), error) {
+	return s.inner, func() {}, nil
+}
+
+// boundTx implements txBound.
+func (s *changeCaptureTableStore[T]) boundTx() *txState {
+	return s.tx
+}
+
+// routeChange implements changeRouter.
+func (s *changeCaptureTableStore[T]) routeChange(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error) {
+	return routeChange(ctx, s.inner, entity, id, query)
+}
+
+// ================== Helpers ==================
+
+// route returns the store and target a write is routed to.
+func (s *changeCaptureTableStore[T]) route(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], dbspi.ChangeTarget, error) {
+	routed, err := routeChange(ctx, s.inner, entity, id, query)
+	if err != nil {
+		return nil, dbspi.ChangeTarget{}, err
+	}
+	target := dbspi.ChangeTarget{Table: s.table}
+	if provider, ok := routed.(changeTargeter); ok {
+		target = provider.changeTarget()
+	}
+	target.DatabaseGroup = s.groupKey
+	return routed, target, nil
+}
+
+// readById reads the stored row with id from routed, or nil when id is
+// empty or no row exists.
+func (s *changeCaptureTableStore[T]) readById(ctx context.Context, routed dbspi.TableStore[T], id any) (any, error) {
+	if isZeroId(id) {
+		return nil, nil
+	}
+	found, row, err := routed.ExistsById(ctx, id)
+	if err != nil || !found {
+		return nil, err
+	}
+	return row, nil
+}
+
+func (s *changeCaptureTableStore[T]) entityEvent(op dbspi.ChangeOperation, target dbspi.ChangeTarget, before any, after T) dbspi.ChangeEvent {
+	return dbspi.ChangeEvent{Operation: op, Target: target, PrimaryKey: s.idOf(after), Before: before, After: snapshotEntity(after)}
+}
+
+// snapshotEntity returns a shallow copy of entity. Events keep the copy, so
+// they report the row as written even when the caller's entity changes
+// afterwards, e.g. when field encryption restores plaintext before the events
+// of a transaction are emitted on commit.
+func snapshotEntity[T dbspi.Entity](entity T) any {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return entity
+	}
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	return cp.Interface()
+}
+
+func (s *changeCaptureTableStore[T]) idOf(entity T) any {
+	return extractFieldValue(entity, s.idField)
+}
+
+// record fills the common event fields, writes the audit log through routed
+// and hands the events to the sinks, after commit when the store is bound to
+// a transaction. Audit errors are returned so that a transaction rolls back;
+// sink errors are logged because the write has already succeeded.
+func (s *changeCaptureTableStore[T]) record(ctx context.Context, routed dbspi.TableStore[T], events ...dbspi.ChangeEvent) error {
+	routedStores := make([]dbspi.TableStore[T], len(events))
+	for i := range routedStores {
+		routedStores[i] = routed
+	}
+	return s.recordRouted(ctx, routedStores, events)
+}
+
+// recordRouted is record for events whose rows were routed to different
+// stores: events[i] was written through routed[i]. The audit records of each
+// target are written through that target's store, so they stay in the
+// database, and the transaction, of their rows.
+func (s *changeCaptureTableStore[T]) recordRouted(ctx context.Context, routed []dbspi.TableStore[T], events []dbspi.ChangeEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for i := range events {
+		events[i].Table = s.table
+		events[i].EntityType = s.entityType
+		events[i].Time = now
+	}
+	if s.opts.AuditLog {
+		var targets []dbspi.ChangeTarget
+		groups := make(map[dbspi.ChangeTarget][]int)
+		for i, event := range events {
+			if _, ok := groups[event.Target]; !ok {
+				targets = append(targets, event.Target)
+			}
+			groups[event.Target] = append(groups[event.Target], i)
+		}
+		for _, target := range targets {
+			indexes := groups[target]
+			group := make([]dbspi.ChangeEvent, len(indexes))
+			for j, i := range indexes {
+				group[j] = events[i]
+			}
+			if err := writeAuditRecords(ctx, routed[indexes[0]], group); err != nil {
+				return err
+			}
+		}
+	}
+	if len(s.opts.Sinks) == 0 {
+		return nil
+	}
+	send := func() {
+		ctx := context.WithoutCancel(ctx)
+		for _, sink := range s.opts.Sinks {
+			if err := sink.Emit(ctx, events); err != nil {
+				logger.Warn(ctx, "change event emit failed", logger.String("table", s.table), logger.Err(err))
+			}
+		}
+	}
+	if s.tx != nil {
+		s.tx.addAfterCommit(send)
+		return nil
+	}
+	send()
+	return nil
+}
+
+// findIds returns the ids of the rows of store matching query.
+func findIds[T dbspi.Entity](ctx context.Context, store dbspi.TableStore[T], idField string, query dbspi.Query) ([]any, error) {
+	columns := []dbspi.Column{NewColumn(idField)}
+	selectQuery := Select(columns)
+	if query != nil {
+		selectQuery = Select(columns, query)
+	}
+	rows, err := store.Find(ctx, selectQuery, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]any, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, extractFieldValue(row, idField))
+	}
+	return ids, nil
+}
@@ -0,0 +1,158 @@
+package dbsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/mq/mqspi"
+)
+
+type recordingChangeSink struct {
+	events []dbspi.ChangeEvent
+}
+
+func (s *recordingChangeSink) Emit(_ context.Context, events []dbspi.ChangeEvent) error {
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func TestChangeCaptureReportsShardTarget(t *testing.T) {
+	logger := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	dial := func(server dbspi.ServerConfig) dbSession {
+		return newUpsertTestDb(t, logger, dbServerDSN(server))
+	}
+	mgr := NewManagerWithOptions(shardedJoinTestConfig(), ManagerOptions{dial: dial})
+	sink := &recordingChangeSink{}
+	store := NewChangeCaptureTableStore(For(&joinTestItem{}, mgr), ChangeCaptureOptions{Sinks: []dbspi.ChangeSink{sink}})
+	ctx := context.Background()
+
+	item := &joinTestItem{ID: 7, ShopID: 5, SKU: "sku"}
+	if err := store.Create(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	skCtx := dbspi.WithShardingKey(ctx, dbspi.NewShardingKey().SetValue("shop_id", 5))
+	if err := store.DeleteById(skCtx, int64(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", sink.events)
+	}
+	wantTarget := dbspi.ChangeTarget{DatabaseGroup: "order", Database: "order_db_1", Table: "order_item_tab_1"}
+	for i, want := range []dbspi.ChangeOperation{dbspi.ChangeCreate, dbspi.ChangeUpdate, dbspi.ChangeDelete} {
+		event := sink.events[i]
+		if event.Operation != want || event.Target != wantTarget || event.Table != "order_item_tab" || event.PrimaryKey != int64(7) {
+			t.Fatalf("unexpected event %d: %+v", i, event)
+		}
+		if event.EntityType != "dbsp.joinTestItem" || event.Time.IsZero() {
+			t.Fatalf("expected common fields to be filled, got %+v", event)
+		}
+	}
+	if after, ok := sink.events[0].After.(*joinTestItem); !ok || after == item || *after != *item || sink.events[2].After != nil {
+		t.Fatalf("unexpected after images: %+v", sink.events)
+	}
+}
+
+func TestChangeCaptureEmitsAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	inner := newCountingItemStore()
+	inner.tx = &txState{}
+	sink := &recordingChangeSink{}
+	store := NewChangeCaptureTableStore[*joinTestItem](inner, ChangeCaptureOptions{Sinks: []dbspi.ChangeSink{sink}})
+
+	if err := store.UpdateById(ctx, int64(1), NewUpdater()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.events) != 0 {
+		t.Fatalf("expected no events before commit, got %+v", sink.events)
+	}
+	inner.tx.runAfterCommit()
+	if len(sink.events) != 1 || sink.events[0].Operation != dbspi.ChangeUpdate || sink.events[0].PrimaryKey != int64(1) {
+		t.Fatalf("unexpected events after commit: %+v", sink.events)
+	}
+}
+
+func TestChangeCaptureDropsEventsOfRolledBackSavepoints(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryTableStore(&memoryTestUser{}, testCommonFieldAutoFillOptions())
+	sink := &recordingChangeSink{}
+	capture := func(session dbSession) dbspi.TableStore[*memoryTestUser] {
+		store := NewTableStoreWithCommonFieldAutoFill(session, &memoryTestUser{}, users.commonFields)
+		return NewChangeCaptureTableStore[*memoryTestUser](store, ChangeCaptureOptions{Sinks: []dbspi.ChangeSink{sink}})
+	}
+	errAbort := errors.New("abort")
+
+	err := users.session.Transaction(ctx, func(tx dbSession) error {
+		if err := capture(tx).Create(ctx, &memoryTestUser{Email: "kept@x.io", Name: "kept"}); err != nil {
+			return err
+		}
+		err := tx.Transaction(ctx, func(savepoint dbSession) error {
+			if err := capture(savepoint).Create(ctx, &memoryTestUser{Email: "dropped@x.io", Name: "dropped"}); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("savepoint err = %v", err)
+		}
+		if err := tx.Transaction(ctx, func(savepoint dbSession) error {
+			return capture(savepoint).Create(ctx, &memoryTestUser{Email: "released@x.io", Name: "released"})
+		}); err != nil {
+			return err
+		}
+		if len(sink.events) != 0 {
+			t.Fatalf("expected no events before commit, got %+v", sink.events)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, event := range sink.events {
+		names = append(names, event.After.(*memoryTestUser).Name)
+	}
+	if !reflect.DeepEqual(names, []string{"kept", "released"}) {
+		t.Fatalf("events after commit = %v", names)
+	}
+}
+
+type recordingProducer struct {
+	mqspi.Producer
+	msgs []*mqspi.ProducerMessage
+}
+
+func (p *recordingProducer) BatchProduce(_ context.Context, msgs []*mqspi.ProducerMessage) error {
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func TestProducerChangeSinkPublishesPerTable(t *testing.T) {
+	producer := &recordingProducer{}
+	sink := NewProducerChangeSink(producer, "cdc.")
+	err := sink.Emit(context.Background(), []dbspi.ChangeEvent{
+		{Table: "order_item_tab", Operation: dbspi.ChangeDelete, PrimaryKey: int64(7)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(producer.msgs) != 1 {
+		t.Fatalf("expected one message, got %d", len(producer.msgs))
+	}
+	msg := producer.msgs[0]
+	if msg.Topic != "cdc.order_item_tab" || string(msg.Key) != "7" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	var event dbspi.ChangeEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil || event.Operation != dbspi.ChangeDelete {
+		t.Fatalf("unexpected payload %s: %v", msg.Value, err)
+	}
+}
@@ -0,0 +1,47 @@
+package dbsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/mq/mqspi"
+)
+
+// producerChangeSink publishes change events as JSON to the topic
+// topicPrefix + Table, keyed by primary key so that events of one row stay
+// in order within a partition.
+type producerChangeSink struct {
+	producer    mqspi.Producer
+	topicPrefix string
+}
+
+// NewProducerChangeSink creates a ChangeSink that publishes through producer.
+func NewProducerChangeSink(producer mqspi.Producer, topicPrefix string) dbspi.ChangeSink {
+	if producer == nil {
+		panic("dbhelper: producer change sink requires a producer")
+	}
+	return &producerChangeSink{producer: producer, topicPrefix: topicPrefix}
+}
+
+// Emit implements dbspi.ChangeSink.
+func (s *producerChangeSink) Emit(ctx context.Context, events []dbspi.ChangeEvent) error {
+	msgs := make([]*mqspi.ProducerMessage, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("dbhelper: marshal change event of %q: %w", event.Table, err)
+		}
+		msgs = append(msgs, &mqspi.ProducerMessage{
+			Topic:     s.topicPrefix + event.Table,
+			Key:       []byte(fmt.Sprint(event.PrimaryKey)),
+			Value:     value,
+			Timestamp: event.Time,
+		})
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return s.producer.BatchProduce(ctx, msgs)
+}
@@ -113,6 +113,22 @@ func applyUpdateCommonFieldsToUpdater(ctx context.Context, opts CommonFieldAutoF
 	}
 }
 
+// insertOnlyCommonFieldNames returns the common field columns of model that
+// an upsert must keep from the original insert.
+func insertOnlyCommonFieldNames(model any) []string {
+	var names []string
+	if managed, ok := model.(dbspi.CreateTimeAccessor); ok {
+		names = append(names, managed.CtimeFieldName())
+	}
+	if managed, ok := model.(dbspi.CreatorAccessor); ok {
+		names = append(names, managed.CreatorFieldName())
+	}
+	if managed, ok := model.(dbspi.TenantAccessor); ok {
+		names = append(names, managed.TenantFieldName())
+	}
+	return names
+}
+
 func shouldSkipCommonFields(opts CommonFieldAutoFillOptions, entity any) bool {
 	return !opts.AutoFillEnabled || isNilEntity(entity)
 }
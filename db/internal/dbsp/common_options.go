@@ -23,17 +23,30 @@ type CommonFieldAutoFillOptions struct {
 	// OperatorProvider resolves creator and updater values from ctx. If nil,
 	// Normalize uses dbspi.OperatorFromContext.
 	OperatorProvider dbspi.OperatorProvider
+
+	// TenantProvider resolves the tenant of entities implementing
+	// dbspi.TenantAccessor from ctx. If nil, Normalize uses
+	// dbspi.TenantFromContext. Tenant isolation applies even when
+	// AutoFillEnabled is false.
+	TenantProvider dbspi.TenantProvider
+
+	// TenantShardingKey makes sharded table stores add the tenant to the
+	// ShardingKey under the entity's tenant field name, so tables sharded by
+	// tenant route without an explicit key.
+	TenantShardingKey bool
 }
 
 // DefaultCommonFieldAutoFillOptions returns the default common-field behavior.
 //
 // Common-field automation is enabled by default, uses Unix milliseconds for
-// ctime/mtime, and resolves creator/updater from ctx with dbspi.OperatorFromContext.
+// ctime/mtime, resolves creator/updater from ctx with dbspi.OperatorFromContext
+// and the tenant with dbspi.TenantFromContext.
 func DefaultCommonFieldAutoFillOptions() CommonFieldAutoFillOptions {
 	return CommonFieldAutoFillOptions{
 		AutoFillEnabled:  true,
 		TimeProvider:     dbspi.DefaultTimeProvider,
 		OperatorProvider: dbspi.OperatorFromContext,
+		TenantProvider:   dbspi.TenantFromContext,
 	}
 }
 
@@ -51,5 +64,8 @@ func (o CommonFieldAutoFillOptions) Normalize() CommonFieldAutoFillOptions {
 	if o.OperatorProvider == nil {
 		o.OperatorProvider = defaults.OperatorProvider
 	}
+	if o.TenantProvider == nil {
+		o.TenantProvider = defaults.TenantProvider
+	}
 	return o
 }
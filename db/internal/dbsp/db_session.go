@@ -2,6 +2,7 @@ package dbsp
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/MrMiaoMIMI/goshared/db/dbspi"
 )
@@ -22,11 +23,52 @@ type dbSession interface {
 	UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error
 	DeleteByQuery(ctx context.Context, entity dbspi.Entity, query dbspi.Query) error
 	FirstOrCreate(ctx context.Context, entity dbspi.Entity, query dbspi.Query) error
+	Upsert(ctx context.Context, entities any, spec upsertSpec, batchSize int) error
 	Raw(ctx context.Context, dest any, sql string, args ...any) error
 	Exec(ctx context.Context, sql string, args ...any) error
 	Transaction(ctx context.Context, fn transactionFunc) error
 }
 
+// txBound is implemented by sessions and table stores that can report the
+// transaction they run in.
+type txBound interface {
+	boundTx() *txState
+}
+
+// boundTxOf returns the transaction v is bound to, or nil.
+func boundTxOf(v any) *txState {
+	if bound, ok := v.(txBound); ok {
+		return bound.boundTx()
+	}
+	return nil
+}
+
+// rowLocker is implemented by sessions that can take row locks.
+// withRowLock returns a session whose reads lock the rows they return; it
+// fails with dbspi.ErrRowLockRequiresTransaction outside a transaction.
+type rowLocker interface {
+	withRowLock(lock dbspi.RowLock) (dbSession, error)
+}
+
+// lockingSession returns session reading with lock.
+func lockingSession(session dbSession, lock dbspi.RowLock) (dbSession, error) {
+	locker, ok := session.(rowLocker)
+	if !ok {
+		return nil, fmt.Errorf("dbhelper: session %T does not support row locks", session)
+	}
+	return locker.withRowLock(lock)
+}
+
+// upsertSpec describes the ON CONFLICT part of an upsert.
+type upsertSpec struct {
+	conflictColumns []string
+	// updates are assigned on conflict. When nil, every updatable column
+	// except the primary key, conflictColumns and insertOnlyColumns is
+	// overwritten with the inserted value.
+	updates           map[string]any
+	insertOnlyColumns []string
+}
+
 type DatabaseTarget struct {
 	Key string
 	Db  dbSession
@@ -0,0 +1,164 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachehelper"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+type deletedAtTestUser struct {
+	dbspi.IdField
+	dbspi.TimeFields
+	Email     string `gorm:"column:email;uniqueIndex:uk_email_deleted_at"`
+	DeletedAt uint64 `gorm:"column:deleted_at;uniqueIndex:uk_email_deleted_at"`
+}
+
+func (*deletedAtTestUser) TableName() string          { return "deleted_at_user_tab" }
+func (*deletedAtTestUser) DeletedAtFieldName() string { return dbspi.DefaultDeletedAtFieldName }
+
+type deletedAtTestOrder struct {
+	dbspi.DeletedAtCommonFields
+	ShopID int64 `gorm:"column:shop_id"`
+}
+
+func (*deletedAtTestOrder) TableName() string        { return "order_item_tab" }
+func (*deletedAtTestOrder) DatabaseGroupKey() string { return "order" }
+
+func deletedAtTestOptions(now *uint64) CommonFieldAutoFillOptions {
+	opts := testCommonFieldAutoFillOptions()
+	opts.TimeProvider = func(context.Context) uint64 { return *now }
+	return opts
+}
+
+func TestDeletedAtSoftDeleteKeepsFirstDeletionTime(t *testing.T) {
+	ctx := context.Background()
+	now := uint64(1000)
+	store := NewMemoryTableStore(&deletedAtTestUser{}, deletedAtTestOptions(&now))
+
+	first := &deletedAtTestUser{Email: "a@x.io"}
+	if err := store.Create(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	now = 2000
+	if err := store.SoftDeleteById(ctx, first.Id); err != nil {
+		t.Fatal(err)
+	}
+	now = 3000
+	if err := store.SoftDeleteById(ctx, first.Id); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetById(ctx, first.Id); got == nil || got.DeletedAt != 2000 {
+		t.Fatalf("deleted row = %+v", got)
+	}
+	if count, err := store.CountNotDeleted(ctx, nil); err != nil || count != 0 {
+		t.Fatalf("live count = %d, err = %v", count, err)
+	}
+
+	second := &deletedAtTestUser{Email: "a@x.io"}
+	if err := store.Create(ctx, second); err != nil {
+		t.Fatalf("re-create after soft delete: %v", err)
+	}
+	if found, _, err := store.ExistsByIdNotDeleted(ctx, second.Id); err != nil || !found {
+		t.Fatalf("live row found = %v, err = %v", found, err)
+	}
+	if err := store.SoftDeleteById(ctx, second.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RestoreById(ctx, first.Id); err != nil {
+		t.Fatal(err)
+	}
+	live, err := store.FindNotDeleted(ctx, nil, nil)
+	if err != nil || len(live) != 1 || live[0].Id != first.Id {
+		t.Fatalf("live rows after restore = %+v, err = %v", live, err)
+	}
+}
+
+func TestPurgeDeletedRemovesRowsDeletedBeforeCutoff(t *testing.T) {
+	ctx := context.Background()
+	now := uint64(1000)
+	store := NewMemoryTableStore(&deletedAtTestUser{}, deletedAtTestOptions(&now))
+	for _, email := range []string{"old@x.io", "new@x.io", "live@x.io"} {
+		if err := store.Create(ctx, &deletedAtTestUser{Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = 2000
+	if err := store.SoftDeleteById(ctx, uint64(1)); err != nil {
+		t.Fatal(err)
+	}
+	now = 5000
+	if err := store.SoftDeleteById(ctx, uint64(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PurgeDeleted[*deletedAtTestUser](ctx, store, 3000); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := store.Find(ctx, nil, nil)
+	if err != nil || len(rows) != 2 || rows[0].Email != "new@x.io" || rows[1].Email != "live@x.io" {
+		t.Fatalf("rows after purge = %+v, err = %v", rows, err)
+	}
+
+	flagged := NewMemoryTableStore(&memoryTestUser{}, testCommonFieldAutoFillOptions())
+	if err := PurgeDeleted[*memoryTestUser](ctx, flagged, 3000); err == nil {
+		t.Fatal("purging a table with a bool soft-delete flag succeeded")
+	}
+}
+
+func TestPurgeDeletedCoversEveryShard(t *testing.T) {
+	now := uint64(1000)
+	mgr := NewMemoryManager(shardedJoinTestConfig(), ManagerOptions{})
+	store := ForSoftDeleteWithCommonFieldAutoFill(&deletedAtTestOrder{}, mgr, deletedAtTestOptions(&now))
+	ctx := context.Background()
+
+	for shopID := int64(0); shopID < 8; shopID++ {
+		order := &deletedAtTestOrder{ShopID: shopID}
+		if err := store.Create(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+		if shopID%2 == 0 {
+			shopCtx := dbspi.WithShardingKey(ctx, dbspi.NewShardingKey().SetValue("shop_id", shopID))
+			if err := store.SoftDeleteById(shopCtx, order.Id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := PurgeDeleted(ctx, store, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := store.CountAll(ctx, nil); err != nil || count != 4 {
+		t.Fatalf("rows after purge = %d, err = %v", count, err)
+	}
+}
+
+func TestPurgeDeletedBatchesAndInvalidatesCache(t *testing.T) {
+	ctx := context.Background()
+	now := uint64(1000)
+	inner := NewMemoryTableStore(&deletedAtTestUser{}, deletedAtTestOptions(&now))
+	store := NewCachedTableStore[*deletedAtTestUser](inner, cachehelper.NewInMemCache(), CachedTableStoreOptions{})
+	for i := 0; i < defaultPurgeBatchSize+1; i++ {
+		if err := store.Create(ctx, &deletedAtTestUser{Email: fmt.Sprintf("u%d@x.io", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := inner.SoftDeleteByQuery(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := store.GetById(ctx, uint64(1)); err != nil || user == nil || user.DeletedAt != 1000 {
+		t.Fatalf("cached deleted user = %+v, err = %v", user, err)
+	}
+
+	if err := PurgeDeleted[*deletedAtTestUser](ctx, store, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := inner.Count(ctx, nil); err != nil || count != 0 {
+		t.Fatalf("rows after purge = %d, err = %v", count, err)
+	}
+	if user, err := store.GetById(ctx, uint64(1)); err != nil || user != nil {
+		t.Fatalf("purged user still cached: %+v, err = %v", user, err)
+	}
+}
@@ -86,14 +86,30 @@ func (e errorTableStore[T]) FirstOrCreate(context.Context, T, dbspi.Query) (T, e
 	return zero, e.err
 }
 
+func (e errorTableStore[T]) Upsert(context.Context, T, []dbspi.Column, dbspi.Updater) error {
+	return e.err
+}
+
+func (e errorTableStore[T]) BatchUpsert(context.Context, []T, []dbspi.Column, dbspi.Updater, int) error {
+	return e.err
+}
+
 func (e errorTableStore[T]) Raw(context.Context, string, ...any) ([]T, error) {
 	return nil, e.err
 }
 
+func (e errorTableStore[T]) RawScan(context.Context, any, string, ...any) error {
+	return e.err
+}
+
 func (e errorTableStore[T]) Exec(context.Context, string, ...any) error {
 	return e.err
 }
 
+func (e errorTableStore[T]) unwrap() (dbspi.TableStore[T], func(), error) {
+	return nil, nil, e.err
+}
+
 func (e errorTableStore[T]) FindAll(context.Context, dbspi.Query, int) ([]T, error) {
 	return nil, e.err
 }
@@ -26,14 +26,50 @@ type BinaryOp struct {
 	Right Expr
 }
 
+type UnaryOp struct {
+	Op      TokenKind
+	Operand Expr
+}
+
 type FuncCall struct {
 	Name string
 	Args []Expr
 }
 
-func (*IntLit) exprNode()   {}
-func (*StrLit) exprNode()   {}
-func (*ColRef) exprNode()   {}
-func (*VarRef) exprNode()   {}
-func (*BinaryOp) exprNode() {}
-func (*FuncCall) exprNode() {}
+// IfExpr is the lazily evaluated if(cond, then, else) form.
+type IfExpr struct {
+	Cond Expr
+	Then Expr
+	Else Expr
+}
+
+// CaseWhen is one (cond, value) branch of a CaseExpr.
+type CaseWhen struct {
+	Cond  Expr
+	Value Expr
+}
+
+// CaseExpr is the lazily evaluated case(cond1, v1, cond2, v2, ..., default) form.
+type CaseExpr struct {
+	Whens []CaseWhen
+	Else  Expr
+}
+
+// LookupExpr is the lookup(key, "map_name"[, default]) form that resolves key
+// through a named lookup map bound to the EvalContext.
+type LookupExpr struct {
+	Key     Expr
+	MapName string
+	Default Expr
+}
+
+func (*IntLit) exprNode()     {}
+func (*StrLit) exprNode()     {}
+func (*ColRef) exprNode()     {}
+func (*VarRef) exprNode()     {}
+func (*BinaryOp) exprNode()   {}
+func (*FuncCall) exprNode()   {}
+func (*UnaryOp) exprNode()    {}
+func (*IfExpr) exprNode()     {}
+func (*CaseExpr) exprNode()   {}
+func (*LookupExpr) exprNode() {}
@@ -2,12 +2,14 @@ package expr
 
 import (
 	"fmt"
+	"strings"
 )
 
-// EvalContext holds variables and column values for expression evaluation.
+// EvalContext holds variables, column values and lookup maps for expression evaluation.
 type EvalContext struct {
-	vars map[string]Value
-	cols map[string]Value
+	vars    map[string]Value
+	cols    map[string]Value
+	lookups map[string]map[string]string
 }
 
 func NewContext() *EvalContext {
@@ -35,6 +37,17 @@ func (c *EvalContext) GetCol(name string) (Value, bool) {
 	return v, ok
 }
 
+// SetLookupMaps binds the named maps used by lookup(key, "map_name").
+func (c *EvalContext) SetLookupMaps(maps map[string]map[string]string) {
+	c.lookups = maps
+}
+
+// GetLookupMap returns the lookup map registered under name.
+func (c *EvalContext) GetLookupMap(name string) (map[string]string, bool) {
+	m, ok := c.lookups[name]
+	return m, ok
+}
+
 // CopyTo copies all vars and cols from this context to the target.
 // Existing entries in target are NOT overwritten.
 func (c *EvalContext) CopyTo(target *EvalContext) {
@@ -110,6 +123,9 @@ func Eval(node Expr, ctx *EvalContext) (Value, error) {
 		if err != nil {
 			return Value{}, err
 		}
+		if n.Op == TokenAnd || n.Op == TokenOr {
+			return evalLogicalOp(n, left, ctx)
+		}
 		right, err := Eval(n.Right, ctx)
 		if err != nil {
 			return Value{}, err
@@ -131,12 +147,108 @@ func Eval(node Expr, ctx *EvalContext) (Value, error) {
 		}
 		return fn(args)
 
+	case *UnaryOp:
+		operand, err := Eval(n.Operand, ctx)
+		if err != nil {
+			return Value{}, err
+		}
+		return boolValue(!operand.Truthy()), nil
+
+	case *IfExpr:
+		cond, err := Eval(n.Cond, ctx)
+		if err != nil {
+			return Value{}, fmt.Errorf("if() condition: %w", err)
+		}
+		if cond.Truthy() {
+			return Eval(n.Then, ctx)
+		}
+		return Eval(n.Else, ctx)
+
+	case *CaseExpr:
+		for i, when := range n.Whens {
+			cond, err := Eval(when.Cond, ctx)
+			if err != nil {
+				return Value{}, fmt.Errorf("case() condition %d: %w", i+1, err)
+			}
+			if cond.Truthy() {
+				return Eval(when.Value, ctx)
+			}
+		}
+		return Eval(n.Else, ctx)
+
+	case *LookupExpr:
+		return evalLookup(n, ctx)
+
 	default:
 		return Value{}, fmt.Errorf("unknown AST node type %T", node)
 	}
 }
 
+func evalLogicalOp(n *BinaryOp, left Value, ctx *EvalContext) (Value, error) {
+	if n.Op == TokenAnd && !left.Truthy() {
+		return boolValue(false), nil
+	}
+	if n.Op == TokenOr && left.Truthy() {
+		return boolValue(true), nil
+	}
+	right, err := Eval(n.Right, ctx)
+	if err != nil {
+		return Value{}, err
+	}
+	return boolValue(right.Truthy()), nil
+}
+
+func evalLookup(n *LookupExpr, ctx *EvalContext) (Value, error) {
+	m, ok := ctx.GetLookupMap(n.MapName)
+	if !ok {
+		return Value{}, fmt.Errorf("lookup map %q not defined", n.MapName)
+	}
+	key, err := Eval(n.Key, ctx)
+	if err != nil {
+		return Value{}, err
+	}
+	if v, ok := m[key.String()]; ok {
+		return StrValue(v), nil
+	}
+	if n.Default == nil {
+		return Value{}, fmt.Errorf("key %q not found in lookup map %q", key.String(), n.MapName)
+	}
+	return Eval(n.Default, ctx)
+}
+
+// compareValues compares numerically when both sides convert to int64 and
+// lexically otherwise, so "1001" == 1001 holds for string-typed keys.
+func compareValues(left, right Value) int {
+	lv, lerr := left.Int64()
+	rv, rerr := right.Int64()
+	if lerr == nil && rerr == nil {
+		switch {
+		case lv < rv:
+			return -1
+		case lv > rv:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(left.String(), right.String())
+}
+
 func evalBinaryOp(op TokenKind, left, right Value) (Value, error) {
+	switch op {
+	case TokenEq:
+		return boolValue(compareValues(left, right) == 0), nil
+	case TokenNotEq:
+		return boolValue(compareValues(left, right) != 0), nil
+	case TokenLt:
+		return boolValue(compareValues(left, right) < 0), nil
+	case TokenLtEq:
+		return boolValue(compareValues(left, right) <= 0), nil
+	case TokenGt:
+		return boolValue(compareValues(left, right) > 0), nil
+	case TokenGtEq:
+		return boolValue(compareValues(left, right) >= 0), nil
+	}
+
 	lv, err := left.Int64()
 	if err != nil {
 		return Value{}, fmt.Errorf("left operand: %w", err)
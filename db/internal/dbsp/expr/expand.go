@@ -128,56 +128,78 @@ func ParseExpands(raw []string) (*ExpandSet, error) {
 
 // validateFuncRefs checks that all function calls in an expression reference registered functions.
 func validateFuncRefs(e Expr) error {
-	switch n := e.(type) {
-	case *FuncCall:
+	if n, ok := e.(*FuncCall); ok {
 		if _, ok := LookupFunc(n.Name); !ok {
 			return fmt.Errorf("unknown function %s()", n.Name)
 		}
-		for _, arg := range n.Args {
-			if err := validateFuncRefs(arg); err != nil {
-				return err
-			}
-		}
-	case *BinaryOp:
-		if err := validateFuncRefs(n.Left); err != nil {
+	}
+	for _, child := range childExprs(e) {
+		if err := validateFuncRefs(child); err != nil {
 			return err
 		}
-		return validateFuncRefs(n.Right)
 	}
 	return nil
 }
 
-func collectVarRefsFromExpr(e Expr) []string {
-	var refs []string
+// childExprs returns the direct sub-expressions of e in evaluation order.
+func childExprs(e Expr) []Expr {
 	switch n := e.(type) {
-	case *VarRef:
-		refs = append(refs, n.Name)
 	case *BinaryOp:
-		refs = append(refs, collectVarRefsFromExpr(n.Left)...)
-		refs = append(refs, collectVarRefsFromExpr(n.Right)...)
+		return []Expr{n.Left, n.Right}
+	case *UnaryOp:
+		return []Expr{n.Operand}
 	case *FuncCall:
-		for _, arg := range n.Args {
-			refs = append(refs, collectVarRefsFromExpr(arg)...)
+		return n.Args
+	case *IfExpr:
+		return []Expr{n.Cond, n.Then, n.Else}
+	case *CaseExpr:
+		children := make([]Expr, 0, len(n.Whens)*2+1)
+		for _, when := range n.Whens {
+			children = append(children, when.Cond, when.Value)
 		}
+		return append(children, n.Else)
+	case *LookupExpr:
+		if n.Default != nil {
+			return []Expr{n.Key, n.Default}
+		}
+		return []Expr{n.Key}
+	}
+	return nil
+}
+
+func collectVarRefsFromExpr(e Expr) []string {
+	if n, ok := e.(*VarRef); ok {
+		return []string{n.Name}
+	}
+	var refs []string
+	for _, child := range childExprs(e) {
+		refs = append(refs, collectVarRefsFromExpr(child)...)
 	}
 	return refs
 }
 
 // collectColRefsFromExpr recursively collects all @{column} references from an expression.
 func collectColRefsFromExpr(e Expr) []string {
-	switch n := e.(type) {
-	case *ColRef:
+	if n, ok := e.(*ColRef); ok {
 		return []string{n.Name}
-	case *BinaryOp:
-		return append(collectColRefsFromExpr(n.Left), collectColRefsFromExpr(n.Right)...)
-	case *FuncCall:
-		var refs []string
-		for _, arg := range n.Args {
-			refs = append(refs, collectColRefsFromExpr(arg)...)
-		}
-		return refs
 	}
-	return nil
+	var refs []string
+	for _, child := range childExprs(e) {
+		refs = append(refs, collectColRefsFromExpr(child)...)
+	}
+	return refs
+}
+
+// collectLookupMapsFromExpr recursively collects the map names used by lookup().
+func collectLookupMapsFromExpr(e Expr) []string {
+	var names []string
+	if n, ok := e.(*LookupExpr); ok {
+		names = append(names, n.MapName)
+	}
+	for _, child := range childExprs(e) {
+		names = append(names, collectLookupMapsFromExpr(child)...)
+	}
+	return names
 }
 
 // RequiredColumns returns the deduplicated list of @{column} references
@@ -196,6 +218,85 @@ func (s *ExpandSet) RequiredColumns() []string {
 	return cols
 }
 
+// LookupMapNames returns the deduplicated list of map names referenced by
+// lookup() across all compute expressions in this ExpandSet.
+func (s *ExpandSet) LookupMapNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, comp := range s.Computes {
+		for _, name := range collectLookupMapsFromExpr(comp.Expr) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// ValidateLookupValues checks that every value a lookup map can assign to a
+// declared variable is one of that variable's := values. A lookup counts as
+// assigning when it is the result of the computation, directly or through an
+// if()/case() branch.
+func (s *ExpandSet) ValidateLookupValues(maps map[string]map[string]string) error {
+	decls := make(map[string]*ExpandDecl, len(s.Decls))
+	for _, d := range s.Decls {
+		decls[d.VarName] = d
+	}
+	for _, comp := range s.Computes {
+		decl, ok := decls[comp.VarName]
+		if !ok {
+			continue
+		}
+		for _, name := range collectResultLookupMaps(comp.Expr) {
+			for key, value := range maps[name] {
+				if !decl.Contains(value) {
+					return fmt.Errorf("lookup map %q maps %q to %q, which is not declared in ${%s} := ...", name, key, value, comp.VarName)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Contains reports whether value is one of the declared values.
+func (d *ExpandDecl) Contains(value string) bool {
+	switch d.Kind {
+	case DeclEnum:
+		for _, v := range d.Values {
+			if v == value {
+				return true
+			}
+		}
+	case DeclRange:
+		n, err := intFromString(value)
+		return err == nil && n >= d.Start && n < d.End
+	}
+	return false
+}
+
+// collectResultLookupMaps collects the map names of lookup() calls whose
+// result becomes the value of e.
+func collectResultLookupMaps(e Expr) []string {
+	switch n := e.(type) {
+	case *LookupExpr:
+		names := []string{n.MapName}
+		if n.Default != nil {
+			names = append(names, collectResultLookupMaps(n.Default)...)
+		}
+		return names
+	case *IfExpr:
+		return append(collectResultLookupMaps(n.Then), collectResultLookupMaps(n.Else)...)
+	case *CaseExpr:
+		var names []string
+		for _, when := range n.Whens {
+			names = append(names, collectResultLookupMaps(when.Value)...)
+		}
+		return append(names, collectResultLookupMaps(n.Else)...)
+	}
+	return nil
+}
+
 // parseDeclRHS parses the RHS of a := declaration.
 // Supports: enum(val1, val2, ...) and range(start, end)
 func parseDeclRHS(varName, rhs string) (*ExpandDecl, error) {
@@ -184,6 +184,170 @@ func TestParseNestedFuncCall(t *testing.T) {
 	t.Logf("nested func result: %s", val.String())
 }
 
+func TestParseComparisonAndLogical(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"@{tenant_id} == 1001", 1},
+		{"@{tenant_id} != 1001", 0},
+		{"@{tenant_id} > 1000 && @{tenant_id} < 2000", 1},
+		{"@{tenant_id} < 1000 || @{region} == SG", 1},
+		{"!(@{tenant_id} >= 1001)", 0},
+		{"@{tenant_id} % 10 + 1 <= 2", 1},
+	}
+	for _, tt := range tests {
+		e, err := ParseExpressionString(tt.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		ctx := NewContext()
+		ctx.SetCol("tenant_id", IntValue(1001))
+		ctx.SetCol("region", StrValue("SG"))
+		val, err := Eval(e, ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if val.MustInt64() != tt.want {
+			t.Fatalf("%s: expected %d, got %s", tt.input, tt.want, val)
+		}
+	}
+}
+
+func TestParseChainedComparisonRejected(t *testing.T) {
+	_, err := ParseExpressionString("1 < @{a} < 3")
+	if err == nil {
+		t.Fatal("expected error for chained comparison")
+	}
+}
+
+func TestCompareStringAndInt(t *testing.T) {
+	e, err := ParseExpressionString(`@{tenant_id} == 1001`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext()
+	ctx.SetCol("tenant_id", StrValue("1001"))
+	val, err := Eval(e, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !val.Truthy() {
+		t.Fatal("expected numeric string to equal int literal")
+	}
+}
+
+func TestIfOnlyEvaluatesSelectedBranch(t *testing.T) {
+	e, err := ParseExpressionString("if(@{x} == 0, 0, 100 / @{x})")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext()
+	ctx.SetCol("x", IntValue(0))
+	val, err := Eval(e, ctx)
+	if err != nil {
+		t.Fatalf("unselected branch should not be evaluated: %v", err)
+	}
+	if val.MustInt64() != 0 {
+		t.Fatalf("expected 0, got %s", val)
+	}
+}
+
+func TestCaseExpression(t *testing.T) {
+	e, err := ParseExpressionString("case(@{x} < 100, a, @{x} < 200, b, c)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		x    int64
+		want string
+	}{
+		{50, "a"},
+		{150, "b"},
+		{250, "c"},
+	}
+	for _, tt := range tests {
+		ctx := NewContext()
+		ctx.SetCol("x", IntValue(tt.x))
+		val, err := Eval(e, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.String() != tt.want {
+			t.Fatalf("x=%d: expected %q, got %q", tt.x, tt.want, val.String())
+		}
+	}
+}
+
+func TestCaseRequiresDefault(t *testing.T) {
+	if _, err := ParseExpressionString("case(@{x} < 100, a)"); err == nil {
+		t.Fatal("expected error for case() without default")
+	}
+}
+
+func TestLookupExpression(t *testing.T) {
+	e, err := ParseExpressionString(`lookup(@{tenant_id}, "vip_map", hash(@{tenant_id}) % 4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookups := map[string]map[string]string{
+		"vip_map": {"1001": "vip_a"},
+	}
+
+	ctx := NewContext()
+	ctx.SetLookupMaps(lookups)
+	ctx.SetCol("tenant_id", IntValue(1001))
+	val, err := Eval(e, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.String() != "vip_a" {
+		t.Fatalf("expected 'vip_a', got %q", val.String())
+	}
+
+	ctx = NewContext()
+	ctx.SetLookupMaps(lookups)
+	ctx.SetCol("tenant_id", IntValue(42))
+	val, err = Eval(e, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := val.MustInt64(); n < 0 || n >= 4 {
+		t.Fatalf("expected default bucket in [0, 4), got %d", n)
+	}
+}
+
+func TestLookupMissingKeyWithoutDefault(t *testing.T) {
+	e, err := ParseExpressionString(`lookup(@{tenant_id}, vip_map)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext()
+	ctx.SetLookupMaps(map[string]map[string]string{"vip_map": {}})
+	ctx.SetCol("tenant_id", IntValue(42))
+	if _, err := Eval(e, ctx); err == nil {
+		t.Fatal("expected error for missing lookup key")
+	}
+}
+
+func TestExpandConditionalRefs(t *testing.T) {
+	expands, err := ParseExpands([]string{
+		`${db} := enum(0, 1, vip)`,
+		`${db} = if(lookup(@{tenant_id}, "vip_map", "") != "", vip, hash(@{shop_id}) % 2)`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := expands.RequiredColumns()
+	if len(cols) != 2 || cols[0] != "tenant_id" || cols[1] != "shop_id" {
+		t.Fatalf("expected [tenant_id shop_id], got %v", cols)
+	}
+	maps := expands.LookupMapNames()
+	if len(maps) != 1 || maps[0] != "vip_map" {
+		t.Fatalf("expected [vip_map], got %v", maps)
+	}
+}
+
 // ================== Template Tests ==================
 
 func TestTemplateSimpleVar(t *testing.T) {
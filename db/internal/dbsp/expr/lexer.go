@@ -25,6 +25,15 @@ const (
 	TokenComma
 	TokenAssign     // =
 	TokenDeclAssign // :=
+	TokenEq         // ==
+	TokenNotEq      // !=
+	TokenLt         // <
+	TokenLtEq       // <=
+	TokenGt         // >
+	TokenGtEq       // >=
+	TokenAnd        // &&
+	TokenOr         // ||
+	TokenNot        // !
 )
 
 type Token struct {
@@ -213,7 +222,50 @@ func (l *Lexer) Tokenize() ([]Token, error) {
 			}
 		case ch == '=':
 			l.advance()
-			tokens = append(tokens, Token{Kind: TokenAssign, Val: "=", Pos: startPos})
+			if l.peek() == '=' {
+				l.advance()
+				tokens = append(tokens, Token{Kind: TokenEq, Val: "==", Pos: startPos})
+			} else {
+				tokens = append(tokens, Token{Kind: TokenAssign, Val: "=", Pos: startPos})
+			}
+		case ch == '!':
+			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				tokens = append(tokens, Token{Kind: TokenNotEq, Val: "!=", Pos: startPos})
+			} else {
+				tokens = append(tokens, Token{Kind: TokenNot, Val: "!", Pos: startPos})
+			}
+		case ch == '<':
+			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				tokens = append(tokens, Token{Kind: TokenLtEq, Val: "<=", Pos: startPos})
+			} else {
+				tokens = append(tokens, Token{Kind: TokenLt, Val: "<", Pos: startPos})
+			}
+		case ch == '>':
+			l.advance()
+			if l.peek() == '=' {
+				l.advance()
+				tokens = append(tokens, Token{Kind: TokenGtEq, Val: ">=", Pos: startPos})
+			} else {
+				tokens = append(tokens, Token{Kind: TokenGt, Val: ">", Pos: startPos})
+			}
+		case ch == '&':
+			l.advance()
+			if l.peek() != '&' {
+				return nil, fmt.Errorf("unexpected '&' at position %d (expected '&&')", startPos)
+			}
+			l.advance()
+			tokens = append(tokens, Token{Kind: TokenAnd, Val: "&&", Pos: startPos})
+		case ch == '|':
+			l.advance()
+			if l.peek() != '|' {
+				return nil, fmt.Errorf("unexpected '|' at position %d (expected '||')", startPos)
+			}
+			l.advance()
+			tokens = append(tokens, Token{Kind: TokenOr, Val: "||", Pos: startPos})
 		default:
 			return nil, fmt.Errorf("unexpected character %q at position %d", ch, startPos)
 		}
@@ -37,10 +37,72 @@ func (p *Parser) expect(kind TokenKind) (Token, error) {
 
 // ParseExpression parses a full expression.
 func (p *Parser) ParseExpression() (Expr, error) {
-	return p.parseAddSub()
+	return p.parseOr()
 }
 
-// parseAddSub handles + and - (lowest precedence).
+// parseOr handles || (lowest precedence).
+func (p *Parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == TokenOr {
+		op := p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryOp{Op: op.Kind, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd handles &&.
+func (p *Parser) parseAnd() (Expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == TokenAnd {
+		op := p.advance()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryOp{Op: op.Kind, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseComparison handles ==, !=, <, <=, > and >= (non-associative).
+func (p *Parser) parseComparison() (Expr, error) {
+	left, err := p.parseAddSub()
+	if err != nil {
+		return nil, err
+	}
+	if isComparisonToken(p.peek().Kind) {
+		op := p.advance()
+		right, err := p.parseAddSub()
+		if err != nil {
+			return nil, err
+		}
+		if isComparisonToken(p.peek().Kind) {
+			return nil, fmt.Errorf("chained comparison at position %d, use && to combine comparisons", p.peek().Pos)
+		}
+		left = &BinaryOp{Op: op.Kind, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func isComparisonToken(kind TokenKind) bool {
+	switch kind {
+	case TokenEq, TokenNotEq, TokenLt, TokenLtEq, TokenGt, TokenGtEq:
+		return true
+	}
+	return false
+}
+
+// parseAddSub handles + and -.
 func (p *Parser) parseAddSub() (Expr, error) {
 	left, err := p.parseMulDivMod()
 	if err != nil {
@@ -74,8 +136,16 @@ func (p *Parser) parseMulDivMod() (Expr, error) {
 	return left, nil
 }
 
-// parseUnary handles unary minus.
+// parseUnary handles unary minus and logical not.
 func (p *Parser) parseUnary() (Expr, error) {
+	if p.peek().Kind == TokenNot {
+		p.advance()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryOp{Op: TokenNot, Operand: operand}, nil
+	}
 	if p.peek().Kind == TokenMinus {
 		p.advance()
 		operand, err := p.parsePrimary()
@@ -162,9 +232,55 @@ func (p *Parser) parseFuncCall() (Expr, error) {
 		return nil, fmt.Errorf("expected ')' after function arguments for %q", nameToken.Val)
 	}
 
+	switch nameToken.Val {
+	case "if":
+		return buildIfExpr(args)
+	case "case":
+		return buildCaseExpr(args)
+	case "lookup":
+		return buildLookupExpr(args)
+	}
 	return &FuncCall{Name: nameToken.Val, Args: args}, nil
 }
 
+// buildIfExpr builds if(cond, then, else). Only the selected branch is evaluated.
+func buildIfExpr(args []Expr) (Expr, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("if() expects 3 arguments, got %d", len(args))
+	}
+	return &IfExpr{Cond: args[0], Then: args[1], Else: args[2]}, nil
+}
+
+// buildCaseExpr builds case(cond1, v1, cond2, v2, ..., default). The first
+// branch whose condition is true wins; the trailing default is required.
+func buildCaseExpr(args []Expr) (Expr, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, fmt.Errorf("case() expects (cond, value) pairs followed by a default, got %d arguments", len(args))
+	}
+	c := &CaseExpr{Else: args[len(args)-1]}
+	for i := 0; i+1 < len(args); i += 2 {
+		c.Whens = append(c.Whens, CaseWhen{Cond: args[i], Value: args[i+1]})
+	}
+	return c, nil
+}
+
+// buildLookupExpr builds lookup(key, "map_name"[, default]). The map name must be
+// a string literal or bare identifier so it can be validated at load time.
+func buildLookupExpr(args []Expr) (Expr, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("lookup() expects 2 or 3 arguments, got %d", len(args))
+	}
+	name, ok := args[1].(*StrLit)
+	if !ok {
+		return nil, fmt.Errorf("lookup() second argument must be a map name literal")
+	}
+	l := &LookupExpr{Key: args[0], MapName: name.Value}
+	if len(args) == 3 {
+		l.Default = args[2]
+	}
+	return l, nil
+}
+
 // ParseExpressionString is a convenience that tokenizes and parses an expression string.
 func ParseExpressionString(input string) (Expr, error) {
 	tokens, err := TokenizeExpression(input)
@@ -25,6 +25,27 @@ func (v Value) Kind() valueKind { return v.kind }
 func (v Value) IsInt() bool     { return v.kind == KindInt64 }
 func (v Value) IsString() bool  { return v.kind == KindString }
 
+// boolValue encodes a boolean as 1 or 0; the grammar has no separate bool kind.
+func boolValue(b bool) Value {
+	if b {
+		return IntValue(1)
+	}
+	return IntValue(0)
+}
+
+// Truthy reports whether v counts as true in if()/case() conditions and
+// logical operators: non-zero integers and non-empty strings other than "0"
+// and "false".
+func (v Value) Truthy() bool {
+	switch v.kind {
+	case KindInt64:
+		return v.intVal != 0
+	case KindString:
+		return v.strVal != "" && v.strVal != "0" && v.strVal != "false"
+	}
+	return false
+}
+
 func (v Value) Int64() (int64, error) {
 	switch v.kind {
 	case KindInt64:
@@ -0,0 +1,852 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm/clause"
+)
+
+var (
+	_ dbspi.SoftDeleteTableStore[*_tableForCheck] = (*encryptingTableStore[*_tableForCheck])(nil)
+	_ dbspi.SQLTableStore[*_tableForCheck]        = (*encryptingTableStore[*_tableForCheck])(nil)
+	_ fieldSealer[*_tableForCheck]                = (*encryptingTableStore[*_tableForCheck])(nil)
+)
+
+// fieldSealer is implemented by table stores that encrypt entity fields, so
+// that stores in front of them can keep entities sealed, e.g. in a cache.
+type fieldSealer[T dbspi.Entity] interface {
+	// sealedCopy returns a copy of entity with its encrypted fields sealed.
+	sealedCopy(ctx context.Context, entity T) (T, error)
+	// open decrypts the encrypted fields of entities in place.
+	open(ctx context.Context, entities ...T) error
+	// encryptsColumn reports whether column is stored encrypted.
+	encryptsColumn(column string) bool
+}
+
+// encryptedField is an entity field tagged `goshared:"encrypt"`.
+type encryptedField struct {
+	column string
+	index  []int
+	// blindIndex is the column of the blind index field at indexField, empty
+	// when the field has none.
+	blindIndex string
+	indexField []int
+}
+
+// encryptingTableStore stores the fields tagged `goshared:"encrypt"` as
+// ciphertext. Entities are sealed in place for the duration of a write and
+// restored afterwards; rows read back are decrypted. Eq, NotEq, In and NotIn
+// conditions on an encrypted column are rewritten to its blind index column.
+type encryptingTableStore[T dbspi.Entity] struct {
+	inner    dbspi.TableStore[T]
+	enc      dbspi.FieldEncryptor
+	fields   []encryptedField
+	byColumn map[string]*encryptedField
+}
+
+// NewEncryptingTableStore wraps store so that the fields of T tagged
+// `goshared:"encrypt"` are encrypted with enc. T must be a pointer to a
+// struct with at least one such string or *string field.
+func NewEncryptingTableStore[T dbspi.Entity](store dbspi.TableStore[T], enc dbspi.FieldEncryptor) dbspi.SoftDeleteTableStore[T] {
+	if store == nil || enc == nil {
+		panic("dbhelper: field encryption requires a table store and a FieldEncryptor")
+	}
+	entityType := reflect.TypeOf((*T)(nil)).Elem()
+	if entityType.Kind() != reflect.Ptr || entityType.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("dbhelper: field encryption requires a pointer to struct entity, got %s", entityType))
+	}
+	fields, err := parseEncryptedFields(entityType.Elem())
+	if err != nil {
+		panic(fmt.Sprintf("dbhelper: field encryption for %s: %v", entityType, err))
+	}
+	if len(fields) == 0 {
+		panic(fmt.Sprintf("dbhelper: field encryption requires fields of %s tagged %s:\"encrypt\"", entityType, dbspi.EncryptTagName))
+	}
+	s := &encryptingTableStore[T]{inner: store, enc: enc, fields: fields, byColumn: make(map[string]*encryptedField, len(fields))}
+	for i := range s.fields {
+		s.byColumn[s.fields[i].column] = &s.fields[i]
+	}
+	return s
+}
+
+// parseEncryptedFields collects the encrypted fields of t, including those of
+// embedded structs.
+func parseEncryptedFields(t reflect.Type) ([]encryptedField, error) {
+	columns := make(map[string]reflect.StructField)
+	var tagged []reflect.StructField
+	var walk func(t reflect.Type, prefix []int)
+	walk = func(t reflect.Type, prefix []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			field.Index = append(append([]int(nil), prefix...), i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type, field.Index)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			columns[structFieldColumn(field)] = field
+			if _, ok := field.Tag.Lookup(dbspi.EncryptTagName); ok {
+				tagged = append(tagged, field)
+			}
+		}
+	}
+	walk(t, nil)
+
+	fields := make([]encryptedField, 0, len(tagged))
+	for _, field := range tagged {
+		encrypted := encryptedField{column: structFieldColumn(field), index: field.Index}
+		isEncrypted := false
+		for _, part := range strings.Split(field.Tag.Get(dbspi.EncryptTagName), ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), ":")
+			switch key {
+			case "encrypt":
+				isEncrypted = true
+			case "blind_index":
+				encrypted.blindIndex = value
+			case "":
+			default:
+				return nil, fmt.Errorf("field %s: unknown %s tag option %q", field.Name, dbspi.EncryptTagName, key)
+			}
+		}
+		if !isEncrypted {
+			return nil, fmt.Errorf("field %s: %s tag lacks \"encrypt\"", field.Name, dbspi.EncryptTagName)
+		}
+		if !isStringType(field.Type) {
+			return nil, fmt.Errorf("encrypted field %s must be a string or *string, got %s", field.Name, field.Type)
+		}
+		if encrypted.blindIndex != "" {
+			indexField, ok := columns[encrypted.blindIndex]
+			if !ok {
+				return nil, fmt.Errorf("blind index column %q of field %s not found", encrypted.blindIndex, field.Name)
+			}
+			if !isStringType(indexField.Type) {
+				return nil, fmt.Errorf("blind index field %s must be a string or *string, got %s", indexField.Name, indexField.Type)
+			}
+			encrypted.indexField = indexField.Index
+		}
+		fields = append(fields, encrypted)
+	}
+	return fields, nil
+}
+
+// structFieldColumn returns the gorm column name of field.
+func structFieldColumn(field reflect.StructField) string {
+	for _, part := range strings.Split(field.Tag.Get("gorm"), ";") {
+		if key, value, ok := strings.Cut(part, ":"); ok && key == "column" {
+			return value
+		}
+	}
+	return toSnakeCase(field.Name)
+}
+
+func isStringType(t reflect.Type) bool {
+	return t.Kind() == reflect.String || t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.String
+}
+
+// stringFieldValue returns the string held by a string or *string field; ok
+// is false for a nil *string.
+func stringFieldValue(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		return v.Elem().String(), true
+	}
+	return v.String(), true
+}
+
+// setStringField sets a string or *string field. A *string field gets a new
+// pointer, so strings shared with the caller are never modified; ok false
+// sets it to nil.
+func setStringField(v reflect.Value, s string, ok bool) {
+	if v.Kind() != reflect.Ptr {
+		v.SetString(s)
+		return
+	}
+	if !ok {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	v.Set(reflect.ValueOf(&s))
+}
+
+// ================== Values ==================
+
+// encrypt encrypts plaintext, keeping empty strings empty.
+func (s *encryptingTableStore[T]) encrypt(ctx context.Context, f *encryptedField, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	ciphertext, err := s.enc.Encrypt(ctx, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("dbhelper: encrypt column %q: %w", f.column, err)
+	}
+	return ciphertext, nil
+}
+
+func (s *encryptingTableStore[T]) decrypt(ctx context.Context, f *encryptedField, ciphertext string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+	plaintext, err := s.enc.Decrypt(ctx, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("dbhelper: decrypt column %q: %w", f.column, err)
+	}
+	return plaintext, nil
+}
+
+// index returns the blind index of plaintext, keeping empty strings empty.
+func (s *encryptingTableStore[T]) index(ctx context.Context, f *encryptedField, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	index, err := s.enc.BlindIndex(ctx, f.column, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("dbhelper: blind index of column %q: %w", f.column, err)
+	}
+	return index, nil
+}
+
+// ================== Entities ==================
+
+// seal replaces the plaintext of the encrypted fields of entities with
+// ciphertext and fills their blind indexes. restore puts the plaintext back
+// and must be called once the write is done.
+func (s *encryptingTableStore[T]) seal(ctx context.Context, entities ...T) (restore func(), err error) {
+	type saved struct{ field, value reflect.Value }
+	var plaintexts []saved
+	restore = func() {
+		for i := len(plaintexts) - 1; i >= 0; i-- {
+			plaintexts[i].field.Set(plaintexts[i].value)
+		}
+	}
+	for _, entity := range entities {
+		if isNilEntity(entity) {
+			continue
+		}
+		v := reflect.ValueOf(entity).Elem()
+		for i := range s.fields {
+			f := &s.fields[i]
+			field := v.FieldByIndex(f.index)
+			plaintext, ok := stringFieldValue(field)
+			ciphertext, err := s.encrypt(ctx, f, plaintext)
+			if err != nil {
+				restore()
+				return nil, err
+			}
+			value := reflect.New(field.Type()).Elem()
+			value.Set(field)
+			plaintexts = append(plaintexts, saved{field: field, value: value})
+			setStringField(field, ciphertext, ok)
+			if f.blindIndex == "" {
+				continue
+			}
+			index, err := s.index(ctx, f, plaintext)
+			if err != nil {
+				restore()
+				return nil, err
+			}
+			setStringField(v.FieldByIndex(f.indexField), index, ok)
+		}
+	}
+	return restore, nil
+}
+
+// sealedCopy returns a copy of entity with its encrypted fields sealed.
+// entity keeps its plaintext.
+func (s *encryptingTableStore[T]) sealedCopy(ctx context.Context, entity T) (T, error) {
+	if isNilEntity(entity) {
+		return entity, nil
+	}
+	copied := reflect.New(reflect.TypeOf(entity).Elem())
+	copied.Elem().Set(reflect.ValueOf(entity).Elem())
+	sealed := copied.Interface().(T)
+	if _, err := s.seal(ctx, sealed); err != nil {
+		var zero T
+		return zero, err
+	}
+	return sealed, nil
+}
+
+func (s *encryptingTableStore[T]) encryptsColumn(column string) bool {
+	_, ok := s.byColumn[column]
+	return ok
+}
+
+// open decrypts the encrypted fields of entities in place.
+func (s *encryptingTableStore[T]) open(ctx context.Context, entities ...T) error {
+	for _, entity := range entities {
+		if isNilEntity(entity) {
+			continue
+		}
+		v := reflect.ValueOf(entity).Elem()
+		for i := range s.fields {
+			f := &s.fields[i]
+			field := v.FieldByIndex(f.index)
+			ciphertext, ok := stringFieldValue(field)
+			if !ok {
+				continue
+			}
+			plaintext, err := s.decrypt(ctx, f, ciphertext)
+			if err != nil {
+				return err
+			}
+			setStringField(field, plaintext, true)
+		}
+	}
+	return nil
+}
+
+// openRows decrypts rows read with err. Partial scatter-gather results are
+// decrypted and returned with their *dbspi.PartialResultError.
+func (s *encryptingTableStore[T]) openRows(ctx context.Context, rows []T, err error) ([]T, error) {
+	if err != nil && !isPartialResult(err) {
+		return rows, err
+	}
+	if err := s.open(ctx, rows...); err != nil {
+		return nil, err
+	}
+	return rows, err
+}
+
+func (s *encryptingTableStore[T]) openFound(ctx context.Context, found bool, entity T, err error) (bool, T, error) {
+	if err != nil || !found {
+		return found, entity, err
+	}
+	if err := s.open(ctx, entity); err != nil {
+		var zero T
+		return false, zero, err
+	}
+	return found, entity, nil
+}
+
+// ================== Queries and updaters ==================
+
+// sealQuery rewrites conditions on encrypted columns to their blind index.
+func (s *encryptingTableStore[T]) sealQuery(ctx context.Context, query dbspi.Query) (dbspi.Query, error) {
+	if query == nil {
+		return nil, nil
+	}
+	return s.sealCondition(ctx, query)
+}
+
+func (s *encryptingTableStore[T]) sealCondition(ctx context.Context, cond dbspi.Condition) (dbspi.Condition, error) {
+	switch c := cond.(type) {
+	case *GormQuery:
+		conditions := make([]dbspi.Condition, len(c.conditions))
+		for i, inner := range c.conditions {
+			sealed, err := s.sealCondition(ctx, inner)
+			if err != nil {
+				return nil, err
+			}
+			conditions[i] = sealed
+		}
+		return &GormQuery{keyword: c.keyword, conditions: conditions}, nil
+	case *gormColumnSelectionQuery:
+		sealed, err := s.sealCondition(ctx, c.GormQuery)
+		if err != nil {
+			return nil, err
+		}
+		return &gormColumnSelectionQuery{GormQuery: sealed.(*GormQuery), columns: c.columns}, nil
+	case *GormCondition:
+		expr, err := s.sealExpr(ctx, c.expr)
+		if err != nil {
+			return nil, err
+		}
+		return &GormCondition{expr: expr}, nil
+	default:
+		return cond, nil
+	}
+}
+
+func (s *encryptingTableStore[T]) sealExpr(ctx context.Context, expr clause.Expression) (clause.Expression, error) {
+	switch e := expr.(type) {
+	case clause.Eq:
+		f := s.encryptedColumn(e.Column)
+		if f == nil || e.Value == nil {
+			return e, nil
+		}
+		column, index, err := s.indexValue(ctx, f, e.Column, e.Value)
+		return clause.Eq{Column: column, Value: index}, err
+	case clause.Neq:
+		f := s.encryptedColumn(e.Column)
+		if f == nil || e.Value == nil {
+			return e, nil
+		}
+		column, index, err := s.indexValue(ctx, f, e.Column, e.Value)
+		return clause.Neq{Column: column, Value: index}, err
+	case clause.IN:
+		f := s.encryptedColumn(e.Column)
+		if f == nil {
+			return e, nil
+		}
+		var column clause.Column
+		values := make([]any, len(e.Values))
+		for i, value := range e.Values {
+			var err error
+			if column, values[i], err = s.indexValue(ctx, f, e.Column, value); err != nil {
+				return nil, err
+			}
+		}
+		return clause.IN{Column: column, Values: values}, nil
+	case clause.AndConditions:
+		exprs, err := s.sealExprs(ctx, e.Exprs)
+		return clause.AndConditions{Exprs: exprs}, err
+	case clause.OrConditions:
+		exprs, err := s.sealExprs(ctx, e.Exprs)
+		return clause.OrConditions{Exprs: exprs}, err
+	case clause.NotConditions:
+		exprs, err := s.sealExprs(ctx, e.Exprs)
+		return clause.NotConditions{Exprs: exprs}, err
+	case clause.Gt:
+		return e, s.rejectEncrypted(e.Column)
+	case clause.Gte:
+		return e, s.rejectEncrypted(e.Column)
+	case clause.Lt:
+		return e, s.rejectEncrypted(e.Column)
+	case clause.Lte:
+		return e, s.rejectEncrypted(e.Column)
+	case clause.Like:
+		return e, s.rejectEncrypted(e.Column)
+	case columnComparison:
+		if err := s.rejectEncrypted(e.left); err != nil {
+			return e, err
+		}
+		return e, s.rejectEncrypted(e.right)
+	default:
+		return expr, nil
+	}
+}
+
+func (s *encryptingTableStore[T]) sealExprs(ctx context.Context, exprs []clause.Expression) ([]clause.Expression, error) {
+	sealed := make([]clause.Expression, len(exprs))
+	for i, expr := range exprs {
+		var err error
+		if sealed[i], err = s.sealExpr(ctx, expr); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+func (s *encryptingTableStore[T]) encryptedColumn(column any) *encryptedField {
+	col, ok := column.(clause.Column)
+	if !ok {
+		return nil
+	}
+	return s.byColumn[col.Name]
+}
+
+func (s *encryptingTableStore[T]) rejectEncrypted(column any) error {
+	if f := s.encryptedColumn(column); f != nil {
+		return fmt.Errorf("dbhelper: encrypted column %q can only be queried with Eq, NotEq, In and NotIn", f.column)
+	}
+	return nil
+}
+
+// indexValue returns the blind index column and the index of value that
+// replace a comparison of the encrypted column with value.
+func (s *encryptingTableStore[T]) indexValue(ctx context.Context, f *encryptedField, column any, value any) (clause.Column, any, error) {
+	if f.blindIndex == "" {
+		return clause.Column{}, nil, fmt.Errorf("dbhelper: encrypted column %q has no blind index to query by", f.column)
+	}
+	plaintext, ok := value.(string)
+	if !ok {
+		return clause.Column{}, nil, fmt.Errorf("dbhelper: encrypted column %q must be compared with a string, got %T", f.column, value)
+	}
+	index, err := s.index(ctx, f, plaintext)
+	if err != nil {
+		return clause.Column{}, nil, err
+	}
+	indexColumn := column.(clause.Column)
+	indexColumn.Name = f.blindIndex
+	return indexColumn, index, nil
+}
+
+// sealUpdater encrypts the values an updater sets on encrypted columns and
+// sets their blind indexes along with them.
+func (s *encryptingTableStore[T]) sealUpdater(ctx context.Context, updater dbspi.Updater) (dbspi.Updater, error) {
+	values, ok := readUpdaterValues(updater)
+	if !ok {
+		return updater, nil
+	}
+	sealed := NewUpdater()
+	for column, value := range values {
+		sealed.updates[column] = value
+	}
+	for i := range s.fields {
+		f := &s.fields[i]
+		value, set := values[f.column]
+		if !set {
+			continue
+		}
+		var plaintext string
+		var isNull bool
+		switch v := value.(type) {
+		case nil:
+			isNull = true
+		case string:
+			plaintext = v
+		case *string:
+			if v == nil {
+				isNull = true
+			} else {
+				plaintext = *v
+			}
+		default:
+			return nil, fmt.Errorf("dbhelper: encrypted column %q must be set to a string, got %T", f.column, value)
+		}
+		if isNull {
+			sealed.updates[f.column] = nil
+			if f.blindIndex != "" {
+				sealed.updates[f.blindIndex] = nil
+			}
+			continue
+		}
+		ciphertext, err := s.encrypt(ctx, f, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		sealed.updates[f.column] = ciphertext
+		if f.blindIndex != "" {
+			index, err := s.index(ctx, f, plaintext)
+			if err != nil {
+				return nil, err
+			}
+			sealed.updates[f.blindIndex] = index
+		}
+	}
+	return sealed, nil
+}
+
+// ================== Reads ==================
+
+func (s *encryptingTableStore[T]) GetById(ctx context.Context, id any) (T, error) {
+	_, entity, err := s.ExistsById(ctx, id)
+	return entity, err
+}
+
+func (s *encryptingTableStore[T]) ExistsById(ctx context.Context, id any) (bool, T, error) {
+	found, entity, err := s.inner.ExistsById(ctx, id)
+	return s.openFound(ctx, found, entity, err)
+}
+
+func (s *encryptingTableStore[T]) Find(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.inner.Find(ctx, query, pagination)
+	return s.openRows(ctx, rows, err)
+}
+
+func (s *encryptingTableStore[T]) Exists(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	found, entity, err := s.inner.Exists(ctx, query)
+	return s.openFound(ctx, found, entity, err)
+}
+
+func (s *encryptingTableStore[T]) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return s.inner.Count(ctx, query)
+}
+
+func (s *encryptingTableStore[T]) FindAll(ctx context.Context, query dbspi.Query, batchSize int) ([]T, error) {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.inner.FindAll(ctx, query, batchSize)
+	return s.openRows(ctx, rows, err)
+}
+
+func (s *encryptingTableStore[T]) CountAll(ctx context.Context, query dbspi.Query) (uint64, error) {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return s.inner.CountAll(ctx, query)
+}
+
+func (s *encryptingTableStore[T]) FindNotDeleted(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	if query, err = s.sealQuery(ctx, query); err != nil {
+		return nil, err
+	}
+	rows, err := store.FindNotDeleted(ctx, query, pagination)
+	return s.openRows(ctx, rows, err)
+}
+
+func (s *encryptingTableStore[T]) CountNotDeleted(ctx context.Context, query dbspi.Query) (uint64, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return 0, err
+	}
+	if query, err = s.sealQuery(ctx, query); err != nil {
+		return 0, err
+	}
+	return store.CountNotDeleted(ctx, query)
+}
+
+func (s *encryptingTableStore[T]) ExistsNotDeleted(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	var zero T
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return false, zero, err
+	}
+	if query, err = s.sealQuery(ctx, query); err != nil {
+		return false, zero, err
+	}
+	found, entity, err := store.ExistsNotDeleted(ctx, query)
+	return s.openFound(ctx, found, entity, err)
+}
+
+func (s *encryptingTableStore[T]) ExistsByIdNotDeleted(ctx context.Context, id any) (bool, T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	found, entity, err := store.ExistsByIdNotDeleted(ctx, id)
+	return s.openFound(ctx, found, entity, err)
+}
+
+// ================== Writes ==================
+
+func (s *encryptingTableStore[T]) Create(ctx context.Context, entity T) error {
+	restore, err := s.seal(ctx, entity)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return s.inner.Create(ctx, entity)
+}
+
+func (s *encryptingTableStore[T]) BatchCreate(ctx context.Context, entities []T, batchSize int) error {
+	restore, err := s.seal(ctx, entities...)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return s.inner.BatchCreate(ctx, entities, batchSize)
+}
+
+func (s *encryptingTableStore[T]) Save(ctx context.Context, entity T) error {
+	restore, err := s.seal(ctx, entity)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return s.inner.Save(ctx, entity)
+}
+
+func (s *encryptingTableStore[T]) BatchSave(ctx context.Context, entities []T) error {
+	restore, err := s.seal(ctx, entities...)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return s.inner.BatchSave(ctx, entities)
+}
+
+func (s *encryptingTableStore[T]) Update(ctx context.Context, entity T) error {
+	restore, err := s.seal(ctx, entity)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return s.inner.Update(ctx, entity)
+}
+
+func (s *encryptingTableStore[T]) Delete(ctx context.Context, entity T) error {
+	return s.inner.Delete(ctx, entity)
+}
+
+func (s *encryptingTableStore[T]) UpdateById(ctx context.Context, id any, updater dbspi.Updater) error {
+	updater, err := s.sealUpdater(ctx, updater)
+	if err != nil {
+		return err
+	}
+	return s.inner.UpdateById(ctx, id, updater)
+}
+
+func (s *encryptingTableStore[T]) DeleteById(ctx context.Context, id any) error {
+	return s.inner.DeleteById(ctx, id)
+}
+
+func (s *encryptingTableStore[T]) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+	if updater, err = s.sealUpdater(ctx, updater); err != nil {
+		return err
+	}
+	return s.inner.UpdateByQuery(ctx, query, updater)
+}
+
+func (s *encryptingTableStore[T]) DeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+	return s.inner.DeleteByQuery(ctx, query)
+}
+
+// FirstOrCreate leaves entity decrypted, whether it was found or created.
+func (s *encryptingTableStore[T]) FirstOrCreate(ctx context.Context, entity T, query dbspi.Query) (T, error) {
+	query, err := s.sealQuery(ctx, query)
+	if err != nil {
+		return entity, err
+	}
+	restore, err := s.seal(ctx, entity)
+	if err != nil {
+		return entity, err
+	}
+	result, err := s.inner.FirstOrCreate(ctx, entity, query)
+	if err != nil {
+		restore()
+		return result, err
+	}
+	// entity now holds the ciphertext of the row found or created.
+	if err := s.open(ctx, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (s *encryptingTableStore[T]) Upsert(ctx context.Context, entity T, conflictColumns []dbspi.Column, updater dbspi.Updater) error {
+	updater, err := s.sealUpdater(ctx, updater)
+	if err != nil {
+		return err
+	}
+	restore, err := s.seal(ctx, entity)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return s.inner.Upsert(ctx, entity, conflictColumns, updater)
+}
+
+func (s *encryptingTableStore[T]) BatchUpsert(ctx context.Context, entities []T, conflictColumns []dbspi.Column, updater dbspi.Updater, batchSize int) error {
+	updater, err := s.sealUpdater(ctx, updater)
+	if err != nil {
+		return err
+	}
+	restore, err := s.seal(ctx, entities...)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	return s.inner.BatchUpsert(ctx, entities, conflictColumns, updater, batchSize)
+}
+
+func (s *encryptingTableStore[T]) SoftDeleteById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.SoftDeleteById(ctx, id)
+}
+
+func (s *encryptingTableStore[T]) RestoreById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.RestoreById(ctx, id)
+}
+
+func (s *encryptingTableStore[T]) SoftDeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	if query, err = s.sealQuery(ctx, query); err != nil {
+		return err
+	}
+	return store.SoftDeleteByQuery(ctx, query)
+}
+
+func (s *encryptingTableStore[T]) RestoreByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	if query, err = s.sealQuery(ctx, query); err != nil {
+		return err
+	}
+	return store.RestoreByQuery(ctx, query)
+}
+
+// ================== Pass-through ==================
+
+// Shard returns the shard store wrapped with the same encryptor.
+func (s *encryptingTableStore[T]) Shard(key *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
+	store, err := s.inner.Shard(key)
+	if err != nil {
+		return store, err
+	}
+	return NewEncryptingTableStore(store, s.enc), nil
+}
+
+// Raw implements dbspi.SQLTableStore. Rows are decrypted; the SQL and its
+// args are passed as is.
+func (s *encryptingTableStore[T]) Raw(ctx context.Context, sql string, args ...any) ([]T, error) {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := store.Raw(ctx, sql, args...)
+	return s.openRows(ctx, rows, err)
+}
+
+// Exec implements dbspi.SQLTableStore.
+func (s *encryptingTableStore[T]) Exec(ctx context.Context, sql string, args ...any) error {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.Exec(ctx, sql, args...)
+}
+
+// RawScan implements rawScanner.
+func (s *encryptingTableStore[T]) RawScan(ctx context.Context, dest any, sql string, args ...any) error {
+	scanner, err := toRawScanner(s.inner)
+	if err != nil {
+		return err
+	}
+	return scanner.RawScan(ctx, dest, sql, args...)
+}
+
+// routeChange implements changeRouter.
+func (s *encryptingTableStore[T]) routeChange(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error) {
+	return routeChange(ctx, s.inner, entity, id, query)
+}
+
+// unwrap implements tableStoreWrapper.
+func (s *encryptingTableStore[T]) unwrap() (dbspi.TableStore[T], func(), error) {
+	return s.inner, func() {}, nil
+}
+
+// boundTx implements txBound.
+func (s *encryptingTableStore[T]) boundTx() *txState {
+	return boundTxOf(s.inner)
+}
@@ -0,0 +1,213 @@
+package dbsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/util/crypto"
+)
+
+type encryptTestUser struct {
+	dbspi.CommonFields
+	Name       string  `gorm:"column:name"`
+	Phone      string  `gorm:"column:phone" goshared:"encrypt;blind_index:phone_bidx"`
+	PhoneIndex string  `gorm:"column:phone_bidx"`
+	IdNumber   *string `gorm:"column:id_number" goshared:"encrypt"`
+}
+
+func (*encryptTestUser) TableName() string { return "encrypt_user_tab" }
+
+// keyringTestEncryptor encrypts with a crypto.Keyring.
+type keyringTestEncryptor struct {
+	keyring *crypto.Keyring
+}
+
+func (e keyringTestEncryptor) Encrypt(_ context.Context, plaintext string) (string, error) {
+	return e.keyring.Encrypt(plaintext)
+}
+
+func (e keyringTestEncryptor) Decrypt(_ context.Context, ciphertext string) (string, error) {
+	return e.keyring.Decrypt(ciphertext)
+}
+
+func (e keyringTestEncryptor) BlindIndex(_ context.Context, column, plaintext string) (string, error) {
+	return crypto.BlindIndex([]byte("index-key"), column+":"+plaintext), nil
+}
+
+func newKeyringTestEncryptor(t *testing.T, primary string) keyringTestEncryptor {
+	t.Helper()
+	keyring, err := crypto.NewKeyring(primary, map[string][]byte{
+		"k1": []byte(strings.Repeat("1", 32)),
+		"k2": []byte(strings.Repeat("2", 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyringTestEncryptor{keyring: keyring}
+}
+
+func TestEncryptingTableStoreEncryptsAtRest(t *testing.T) {
+	ctx := context.Background()
+	raw := NewMemoryTableStore(&encryptTestUser{}, testCommonFieldAutoFillOptions())
+	store := NewEncryptingTableStore[*encryptTestUser](raw, newKeyringTestEncryptor(t, "k1"))
+
+	idNumber := "110101199001011234"
+	user := &encryptTestUser{Name: "alice", Phone: "13800000000", IdNumber: &idNumber}
+	if err := store.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Phone != "13800000000" || *user.IdNumber != idNumber || user.PhoneIndex == "" {
+		t.Fatalf("caller entity after create = %+v", user)
+	}
+	if err := store.Create(ctx, &encryptTestUser{Name: "bob", Phone: "13900000000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := raw.GetById(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyId, _ := crypto.KeyID(stored.Phone); keyId != "k1" || strings.Contains(stored.Phone, "13800000000") || *stored.IdNumber == idNumber {
+		t.Fatalf("stored row = %+v", stored)
+	}
+
+	phone := NewField[string]("phone")
+	number := "13800000000"
+	found, err := store.Find(ctx, NewQuery(phone.Eq(&number)), nil)
+	if err != nil || len(found) != 1 || found[0].Name != "alice" || found[0].Phone != number || *found[0].IdNumber != idNumber {
+		t.Fatalf("find by phone = %+v, err = %v", found, err)
+	}
+	if count, err := store.Count(ctx, NewQuery(phone.In([]string{"13800000000", "13900000000"}))); err != nil || count != 2 {
+		t.Fatalf("count by phones = %d, err = %v", count, err)
+	}
+	prefix := "138"
+	if _, err := store.Find(ctx, NewQuery(phone.StartsWith(&prefix)), nil); err == nil {
+		t.Fatal("prefix query on encrypted column succeeded")
+	}
+}
+
+func TestCachedEncryptingTableStoreCachesCiphertext(t *testing.T) {
+	ctx := context.Background()
+	raw := NewMemoryTableStore(&encryptTestUser{}, testCommonFieldAutoFillOptions())
+	store := NewEncryptingTableStore[*encryptTestUser](raw, newKeyringTestEncryptor(t, "k1"))
+	idNumber := "110101199001011234"
+	if err := store.Create(ctx, &encryptTestUser{Name: "alice", Phone: "13800000000", IdNumber: &idNumber}); err != nil {
+		t.Fatal(err)
+	}
+	cache := newJSONCache()
+	cached := NewCachedTableStore[*encryptTestUser](store, cache, CachedTableStoreOptions{})
+
+	for i := 0; i < 2; i++ {
+		user, err := cached.GetById(ctx, uint64(1))
+		if err != nil || user == nil || user.Phone != "13800000000" || *user.IdNumber != idNumber {
+			t.Fatalf("read %d = %+v, %v", i, user, err)
+		}
+	}
+	if len(cache.entries) != 1 {
+		t.Fatalf("cache entries = %d", len(cache.entries))
+	}
+	for key, entry := range cache.entries {
+		var data []byte
+		if err := json.Unmarshal(entry, &data); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte("alice")) || bytes.Contains(data, []byte("13800000000")) || bytes.Contains(data, []byte(idNumber)) {
+			t.Fatalf("cache entry %s holds plaintext of encrypted fields: %q", key, data)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unique key on an encrypted column did not panic")
+		}
+	}()
+	NewCachedTableStore[*encryptTestUser](store, cache, CachedTableStoreOptions{UniqueKeys: map[string][]string{"phone": {"phone"}}})
+}
+
+func TestEncryptingTableStoreUpdatesAndRotatesKeys(t *testing.T) {
+	ctx := context.Background()
+	raw := NewMemoryTableStore(&encryptTestUser{}, testCommonFieldAutoFillOptions())
+	oldStore := NewEncryptingTableStore[*encryptTestUser](raw, newKeyringTestEncryptor(t, "k1"))
+	user := &encryptTestUser{Name: "alice", Phone: "13800000000"}
+	if err := oldStore.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewEncryptingTableStore[*encryptTestUser](raw, newKeyringTestEncryptor(t, "k2"))
+	loaded, err := store.GetById(ctx, user.Id)
+	if err != nil || loaded.Phone != "13800000000" {
+		t.Fatalf("row written under k1 = %+v, err = %v", loaded, err)
+	}
+
+	phone := NewField[string]("phone")
+	number := "13700000000"
+	if err := store.UpdateById(ctx, user.Id, NewUpdater().Set(phone, &number)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := raw.GetById(ctx, user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyId, _ := crypto.KeyID(stored.Phone); keyId != "k2" {
+		t.Fatalf("phone after update stored as %q", stored.Phone)
+	}
+	found, _, err := store.Exists(ctx, NewQuery(phone.Eq(&number)))
+	if err != nil || !found {
+		t.Fatalf("exists by updated phone = %v, err = %v", found, err)
+	}
+}
+
+type encryptTestContact struct {
+	Id    uint64 `gorm:"primaryKey;column:id"`
+	Phone string `gorm:"column:phone" goshared:"encrypt"`
+}
+
+func (*encryptTestContact) TableName() string { return "encrypt_contact_tab" }
+
+func TestEncryptingTableStoreChangeEventsCarryCiphertextAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	raw := NewMemoryTableStore(&encryptTestContact{}, testCommonFieldAutoFillOptions())
+	sink := &recordingChangeSink{}
+	enc := newKeyringTestEncryptor(t, "k1")
+
+	user := &encryptTestContact{Phone: "13800000000"}
+	err := raw.db.Transaction(ctx, func(tx dbSession) error {
+		txStore := NewTableStoreWithCommonFieldAutoFill(tx, &encryptTestContact{}, raw.commonFields)
+		captured := NewChangeCaptureTableStore[*encryptTestContact](txStore, ChangeCaptureOptions{Sinks: []dbspi.ChangeSink{sink}})
+		store := NewEncryptingTableStore[*encryptTestContact](captured, enc)
+		if err := store.Create(ctx, user); err != nil {
+			return err
+		}
+		user.Phone = "13700000000"
+		return store.Save(ctx, user)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Phone != "13700000000" {
+		t.Fatalf("caller entity after commit = %+v", user)
+	}
+	if len(sink.events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", sink.events)
+	}
+	for i, event := range sink.events {
+		after, ok := event.After.(*encryptTestContact)
+		if !ok {
+			t.Fatalf("event %d after image = %T", i, event.After)
+		}
+		if keyId, _ := crypto.KeyID(after.Phone); keyId != "k1" {
+			t.Fatalf("event %d after image holds plaintext phone %q", i, after.Phone)
+		}
+	}
+	before, ok := sink.events[1].Before.(*encryptTestContact)
+	if !ok {
+		t.Fatalf("update before image = %T", sink.events[1].Before)
+	}
+	if keyId, _ := crypto.KeyID(before.Phone); keyId != "k1" {
+		t.Fatalf("update before image holds plaintext phone %q", before.Phone)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/MrMiaoMIMI/goshared/db/dbspi"
@@ -97,6 +98,7 @@ func (c *GormColumn) WithTable(table string) dbspi.Column {
 	return &GormColumn{
 		name:  c.name,
 		table: table,
+		alias: c.alias,
 	}
 }
 
@@ -104,6 +106,7 @@ func (c *GormColumn) WithTable(table string) dbspi.Column {
 func (c *GormColumn) WithAlias(alias string) dbspi.Column {
 	return &GormColumn{
 		name:  c.name,
+		table: c.table,
 		alias: alias,
 	}
 }
@@ -122,10 +125,17 @@ func NewField[T any](name string) *GormField[T] {
 	}
 }
 
+// Table returns the table the field is qualified with, empty for fields
+// created by NewField.
+func (f *GormField[T]) Table() string {
+	return columnTable(f.Column)
+}
+
 // columnExpr returns the column expression for queries
 func (f *GormField[T]) columnExpr() clause.Column {
 	return clause.Column{
-		Name: f.Column.Name(),
+		Table: f.Table(),
+		Name:  f.Column.Name(),
 	}
 }
 
@@ -318,6 +328,63 @@ func (f *GormField[T]) NotContains(v *string) dbspi.Condition {
 	}))
 }
 
+// EqColumn implements dbspi.Field
+func (f *GormField[T]) EqColumn(other dbspi.Column) dbspi.Condition {
+	return f.compareColumn("=", other)
+}
+
+// NotEqColumn implements dbspi.Field
+func (f *GormField[T]) NotEqColumn(other dbspi.Column) dbspi.Condition {
+	return f.compareColumn("<>", other)
+}
+
+// GtColumn implements dbspi.Field
+func (f *GormField[T]) GtColumn(other dbspi.Column) dbspi.Condition {
+	return f.compareColumn(">", other)
+}
+
+// GtEqColumn implements dbspi.Field
+func (f *GormField[T]) GtEqColumn(other dbspi.Column) dbspi.Condition {
+	return f.compareColumn(">=", other)
+}
+
+// LtColumn implements dbspi.Field
+func (f *GormField[T]) LtColumn(other dbspi.Column) dbspi.Condition {
+	return f.compareColumn("<", other)
+}
+
+// LtEqColumn implements dbspi.Field
+func (f *GormField[T]) LtEqColumn(other dbspi.Column) dbspi.Condition {
+	return f.compareColumn("<=", other)
+}
+
+func (f *GormField[T]) compareColumn(operator string, other dbspi.Column) dbspi.Condition {
+	if other == nil {
+		return nil
+	}
+	return newCondition(columnComparison{
+		left:     f.columnExpr(),
+		operator: operator,
+		right:    columnClause(other),
+	})
+}
+
+// columnComparison renders "left operator right" for two columns. It is a
+// distinct expression type so that sharding key extraction ignores it.
+type columnComparison struct {
+	left     clause.Column
+	operator string
+	right    clause.Column
+}
+
+func (c columnComparison) Build(builder clause.Builder) {
+	builder.WriteQuoted(c.left)
+	builder.WriteByte(' ')
+	builder.WriteString(c.operator)
+	builder.WriteByte(' ')
+	builder.WriteQuoted(c.right)
+}
+
 // ================== Query Implementation ==================
 
 type queryKeyword string
@@ -540,6 +607,29 @@ func (u *GormUpdater) Remove(column dbspi.Column) dbspi.Updater {
 	return u
 }
 
+// Incr implements dbspi.Updater
+func (u *GormUpdater) Incr(column dbspi.Column, delta any) dbspi.Updater {
+	u.updates[column.Name()] = clause.Expr{
+		SQL:  "? + ?",
+		Vars: []any{clause.Column{Name: column.Name()}, delta},
+	}
+	return u
+}
+
+// SetExpr implements dbspi.Updater
+func (u *GormUpdater) SetExpr(column dbspi.Column, expr string, args ...any) dbspi.Updater {
+	vars := make([]any, len(args))
+	for i, arg := range args {
+		if col, ok := arg.(dbspi.Column); ok {
+			vars[i] = clause.Column{Name: col.Name()}
+			continue
+		}
+		vars[i] = arg
+	}
+	u.updates[column.Name()] = clause.Expr{SQL: expr, Vars: vars}
+	return u
+}
+
 func (u *GormUpdater) Values() map[string]any {
 	return u.updates
 }
@@ -568,9 +658,16 @@ func requireUpdaterValues(updater dbspi.Updater) (map[string]any, error) {
 
 // GormTableStore implements dbspi.TableStore[T]
 type GormTableStore[T dbspi.Entity] struct {
-	db                  dbSession
+	db dbSession
+	// session is db before it was scoped to the table, for statements on
+	// other tables of the same database.
+	session             dbSession
 	emptyEntityInstance T
+	tableName           string
 	commonFields        CommonFieldAutoFillOptions
+	// databaseKey is the DatabaseTarget key of db for stores resolved from a
+	// database-sharded table store, and empty otherwise.
+	databaseKey string
 }
 
 // NewTableStore creates a new GormTableStore with the given entity instance
@@ -620,10 +717,11 @@ func newTableStoreWithTableName[T dbspi.Entity](db dbSession, entityInstance T,
 
 	// New a empty entity instance
 	entity := reflect.New(reflect.TypeOf(reflect.ValueOf(entityInstance).Elem().Interface())).Interface()
-	db = db.WithModel(entity).WithTableName(tableName)
 	return &GormTableStore[T]{
-		db:                  db,
+		db:                  db.WithModel(entity).WithTableName(tableName),
+		session:             db,
 		emptyEntityInstance: entity.(T),
+		tableName:           tableName,
 		commonFields:        commonFields,
 	}
 }
@@ -662,8 +760,12 @@ func (e *GormTableStore[T]) DeleteById(ctx context.Context, id any) error {
 
 // Find implements dbspi.TableStore
 func (e *GormTableStore[T]) Find(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	query, err := e.withTenant(ctx, query)
+	if err != nil {
+		return nil, err
+	}
 	var results []T
-	err := e.db.Find(ctx, &results, query, pagination)
+	err = e.db.Find(ctx, &results, query, pagination)
 	return results, err
 }
 
@@ -684,45 +786,81 @@ func (e *GormTableStore[T]) Exists(ctx context.Context, query dbspi.Query) (bool
 
 // Count implements dbspi.TableStore
 func (e *GormTableStore[T]) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	query, err := e.withTenant(ctx, query)
+	if err != nil {
+		return 0, err
+	}
 	return e.db.Count(ctx, query)
 }
 
 // Create implements dbspi.TableStore
 func (e *GormTableStore[T]) Create(ctx context.Context, value T) error {
+	if err := e.stampTenant(ctx, value); err != nil {
+		return err
+	}
 	applyCreateCommonFields(ctx, e.commonFields, value)
 	return e.db.Create(ctx, value)
 }
 
 // Save implements dbspi.TableStore
 func (e *GormTableStore[T]) Save(ctx context.Context, value T) error {
+	if err := e.stampTenant(ctx, value); err != nil {
+		return err
+	}
+	if err := e.checkTenantOwnership(ctx, value); err != nil {
+		return err
+	}
 	applySaveCommonFields(ctx, e.commonFields, value)
 	return e.db.Save(ctx, value)
 }
 
 // Update implements dbspi.TableStore
 func (e *GormTableStore[T]) Update(ctx context.Context, entity T) error {
+	if err := e.stampTenant(ctx, entity); err != nil {
+		return err
+	}
+	if err := e.checkTenantOwnership(ctx, entity); err != nil {
+		return err
+	}
 	applyUpdateCommonFields(ctx, e.commonFields, entity)
 	return e.db.Update(ctx, entity)
 }
 
 // Delete implements dbspi.TableStore
 func (e *GormTableStore[T]) Delete(ctx context.Context, entity T) error {
+	if err := e.checkTenantOwnership(ctx, entity); err != nil {
+		return err
+	}
 	return e.db.Delete(ctx, entity)
 }
 
 // UpdateByQuery implements dbspi.TableStore
 func (e *GormTableStore[T]) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	if err := e.checkTenantUpdater(ctx, updater); err != nil {
+		return err
+	}
+	query, err := e.withTenant(ctx, query)
+	if err != nil {
+		return err
+	}
 	applyUpdateCommonFieldsToUpdater(ctx, e.commonFields, e.emptyEntityInstance, updater)
 	return e.db.UpdateByQuery(ctx, query, updater)
 }
 
 // DeleteByQuery implements dbspi.TableStore
 func (e *GormTableStore[T]) DeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	query, err := e.withTenant(ctx, query)
+	if err != nil {
+		return err
+	}
 	return e.db.DeleteByQuery(ctx, e.emptyEntityInstance, query)
 }
 
 // BatchCreate implements dbspi.TableStore
 func (e *GormTableStore[T]) BatchCreate(ctx context.Context, entities []T, batchSize int) error {
+	if err := e.stampTenant(ctx, entities...); err != nil {
+		return err
+	}
 	applyCreateCommonFieldsToSlice(ctx, e.commonFields, entities)
 	err := e.db.BatchCreate(ctx, entities, batchSize)
 	return err
@@ -730,73 +868,286 @@ func (e *GormTableStore[T]) BatchCreate(ctx context.Context, entities []T, batch
 
 // BatchSave implements dbspi.TableStore
 func (e *GormTableStore[T]) BatchSave(ctx context.Context, entities []T) error {
+	if err := e.stampTenant(ctx, entities...); err != nil {
+		return err
+	}
+	if err := e.checkTenantOwnership(ctx, entities...); err != nil {
+		return err
+	}
 	applySaveCommonFieldsToSlice(ctx, e.commonFields, entities)
 	err := e.db.BatchSave(ctx, entities)
 	return err
 }
 
+// Upsert implements dbspi.TableStore
+func (e *GormTableStore[T]) Upsert(ctx context.Context, entity T, conflictColumns []dbspi.Column, updater dbspi.Updater) error {
+	if err := e.checkTenantUpsert(ctx, conflictColumns, updater, entity); err != nil {
+		return err
+	}
+	applyCreateCommonFields(ctx, e.commonFields, entity)
+	spec, err := e.upsertSpec(ctx, conflictColumns, updater)
+	if err != nil {
+		return err
+	}
+	return e.db.Upsert(ctx, entity, spec, 1)
+}
+
+// BatchUpsert implements dbspi.TableStore
+func (e *GormTableStore[T]) BatchUpsert(ctx context.Context, entities []T, conflictColumns []dbspi.Column, updater dbspi.Updater, batchSize int) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	if err := e.checkTenantUpsert(ctx, conflictColumns, updater, entities...); err != nil {
+		return err
+	}
+	applyCreateCommonFieldsToSlice(ctx, e.commonFields, entities)
+	spec, err := e.upsertSpec(ctx, conflictColumns, updater)
+	if err != nil {
+		return err
+	}
+	return e.db.Upsert(ctx, entities, spec, batchSize)
+}
+
+// upsertSpec builds the conflict handling for Upsert. Explicit updaters get
+// the mtime and updater common fields; without one, the ctime and creator
+// columns are kept from the original insert.
+func (e *GormTableStore[T]) upsertSpec(ctx context.Context, conflictColumns []dbspi.Column, updater dbspi.Updater) (upsertSpec, error) {
+	var spec upsertSpec
+	for _, col := range conflictColumns {
+		spec.conflictColumns = append(spec.conflictColumns, col.Name())
+	}
+	if updater == nil {
+		spec.insertOnlyColumns = insertOnlyCommonFieldNames(e.emptyEntityInstance)
+		return spec, nil
+	}
+	applyUpdateCommonFieldsToUpdater(ctx, e.commonFields, e.emptyEntityInstance, updater)
+	updates, err := requireUpdaterValues(updater)
+	if err != nil {
+		return spec, err
+	}
+	spec.updates = updates
+	return spec, nil
+}
+
 // FirstOrCreate implements dbspi.TableStore
 func (e *GormTableStore[T]) FirstOrCreate(ctx context.Context, entity T, query dbspi.Query) (T, error) {
+	if err := e.stampTenant(ctx, entity); err != nil {
+		return entity, err
+	}
+	query, err := e.withTenant(ctx, query)
+	if err != nil {
+		return entity, err
+	}
 	applyCreateCommonFields(ctx, e.commonFields, entity)
-	err := e.db.FirstOrCreate(ctx, entity, query)
+	err = e.db.FirstOrCreate(ctx, entity, query)
 	return entity, err
 }
 
+// boundTx implements txBound.
+func (e *GormTableStore[T]) boundTx() *txState {
+	return boundTxOf(e.db)
+}
+
+// routeChange implements changeRouter.
+func (e *GormTableStore[T]) routeChange(context.Context, T, any, dbspi.Query) (dbspi.TableStore[T], error) {
+	return e, nil
+}
+
+// withAuditStore implements auditLogger.
+func (e *GormTableStore[T]) withAuditStore(fn func(*GormTableStore[*dbspi.AuditRecord]) error) error {
+	return fn(NewTableStore(e.session, &dbspi.AuditRecord{}))
+}
+
+// changeTarget reports the physical table the store writes to.
+func (e *GormTableStore[T]) changeTarget() dbspi.ChangeTarget {
+	return dbspi.ChangeTarget{Database: e.databaseKey, Table: e.tableName}
+}
+
 // Raw implements dbspi.SQLTableStore.
 func (e *GormTableStore[T]) Raw(ctx context.Context, sql string, args ...any) ([]T, error) {
 	var results []T
-	err := e.db.Raw(ctx, &results, sql, args...)
+	err := e.RawScan(ctx, &results, sql, args...)
 	return results, err
 }
 
+// RawScan implements rawScanner.
+func (e *GormTableStore[T]) RawScan(ctx context.Context, dest any, sql string, args ...any) error {
+	sql, err := e.expandTable(sql)
+	if err != nil {
+		return err
+	}
+	return e.db.Raw(ctx, dest, sql, args...)
+}
+
 // Exec implements dbspi.SQLTableStore.
 func (e *GormTableStore[T]) Exec(ctx context.Context, sql string, args ...any) error {
+	sql, err := e.expandTable(sql)
+	if err != nil {
+		return err
+	}
 	return e.db.Exec(ctx, sql, args...)
 }
 
+// expandTable replaces {{table}} placeholders with the physical table name.
+func (e *GormTableStore[T]) expandTable(sql string) (string, error) {
+	logical := e.emptyEntityInstance.TableName()
+	return expandTablePlaceholders(sql, func(name string) (string, error) {
+		if name != "" && name != logical {
+			return "", fmt.Errorf("dbhelper: table placeholder %q does not match table store table %q; use dbhelper.RawIntoGroup for other tables", name, logical)
+		}
+		return e.tableName, nil
+	})
+}
+
 func (e *GormTableStore[T]) buildQueryById(id any) dbspi.Query {
-	idFieldName := dbspi.DefaultIdFieldName
+	return NewQuery(NewField[any](e.idFieldName()).Eq(&id))
+}
+
+// physicalTables implements physicalTableLister.
+func (e *GormTableStore[T]) physicalTables() ([]*GormTableStore[T], func(), error) {
+	return []*GormTableStore[T]{e}, func() {}, nil
+}
+
+func (e *GormTableStore[T]) idFieldName() string {
 	if namer, ok := any(e.emptyEntityInstance).(dbspi.IdFieldNameProvider); ok {
-		idFieldName = namer.IdFieldName()
+		return namer.IdFieldName()
 	}
-	return NewQuery(NewField[any](idFieldName).Eq(&id))
+	return dbspi.DefaultIdFieldName
 }
 
 type GormDb struct {
 	db *gorm.DB
+	// tx is set when db is bound to a transaction. Locking reads require it.
+	tx *txState
+	// lock is set on sessions returned by withRowLock.
+	lock *dbspi.RowLock
+}
+
+// txState is shared by every session of one transaction or savepoint.
+//
+// afterCommit hooks run once the outermost transaction commits and are
+// dropped on rollback. A nested transaction records its hooks in its own
+// txState, handed to the enclosing one by mergeInto when the savepoint is
+// released, so hooks of a savepoint rolled back on its own never run.
+type txState struct {
+	mu          sync.Mutex
+	afterCommit []func()
+}
+
+func (s *txState) addAfterCommit(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.afterCommit = append(s.afterCommit, fn)
+}
+
+// mergeInto appends the hooks of the committed savepoint s to parent.
+func (s *txState) mergeInto(parent *txState) {
+	s.mu.Lock()
+	hooks := s.afterCommit
+	s.afterCommit = nil
+	s.mu.Unlock()
+	parent.mu.Lock()
+	defer parent.mu.Unlock()
+	parent.afterCommit = append(parent.afterCommit, hooks...)
+}
+
+// endTransaction settles the hooks of state once its transaction returned
+// err: dropped on rollback, merged into parent for a released savepoint and
+// run for a committed outermost transaction.
+func endTransaction(state, parent *txState, err error) {
+	switch {
+	case err != nil:
+	case parent != nil:
+		state.mergeInto(parent)
+	default:
+		state.runAfterCommit()
+	}
+}
+
+func (s *txState) runAfterCommit() {
+	s.mu.Lock()
+	hooks := s.afterCommit
+	s.afterCommit = nil
+	s.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// boundTx implements txBound.
+func (d *GormDb) boundTx() *txState {
+	return d.tx
 }
 
 // NewGormDb creates a new GormDb.
 func NewGormDb(dbConfig dbspi.ServerConfig) dbSession {
 	dbConfig = normalizeServerConfig(dbConfig)
-	gormCfg := &gorm.Config{}
+	dialector := mysql.Open(dbServerDSN(dbConfig))
+	database := dbConfig.DatabaseName
+	if md, ok := dialector.(*mysql.Dialector); ok && md.DSNConfig != nil {
+		database = md.DSNConfig.DBName
+	}
+	gormCfg := &gorm.Config{
+		Logger: newGormLogger(database, dbConfig),
+	}
 
-	db, err := gorm.Open(mysql.Open(dbServerDSN(dbConfig)), gormCfg)
+	db, err := gorm.Open(dialector, gormCfg)
 	if err != nil {
 		panic(err)
 	}
+	if err := registerStatementTableCallbacks(db); err != nil {
+		panic(err)
+	}
+	if err := registerTracingCallbacks(db, database); err != nil {
+		panic(err)
+	}
 
 	if dbConfig.Debug {
 		db = db.Debug()
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
+	gormDb := &GormDb{db: db}
+	if err := gormDb.ConfigurePool(dbConfig); err != nil {
 		panic(err)
 	}
-	if dbConfig.MaxOpenConns > 0 {
-		sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	return gormDb
+}
+
+// LabelLogs names groupKey as the database group in the statement logs of
+// d. It must be called before d is shared.
+func (d *GormDb) LabelLogs(groupKey string) {
+	if l, ok := d.db.Logger.(*gormLogger); ok {
+		l.group = groupKey
+	}
+}
+
+// ConfigurePool applies the connection pool settings of cfg to the underlying
+// sql.DB. It is used when a reloaded config keeps the same server but changes
+// its pool limits.
+func (d *GormDb) ConfigurePool(cfg dbspi.ServerConfig) error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 	}
-	if dbConfig.MaxIdleConns > 0 {
-		sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 	}
-	if dbConfig.ConnMaxLifetimeSeconds > 0 {
-		sqlDB.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetimeSeconds) * time.Second)
+	if cfg.ConnMaxLifetimeSeconds > 0 {
+		sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second)
 	}
+	return nil
+}
 
-	return &GormDb{
-		db: db,
+// Close closes the underlying connection pool.
+func (d *GormDb) Close() error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return err
 	}
+	return sqlDB.Close()
 }
 
 func normalizeServerConfig(cfg dbspi.ServerConfig) dbspi.ServerConfig {
@@ -819,19 +1170,30 @@ func dbServerDSN(cfg dbspi.ServerConfig) string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DatabaseName)
 }
 
+// withRowLock implements rowLocker.
+func (d *GormDb) withRowLock(lock dbspi.RowLock) (dbSession, error) {
+	if d.tx == nil {
+		return nil, dbspi.ErrRowLockRequiresTransaction
+	}
+	return &GormDb{db: d.db, tx: d.tx, lock: &lock}, nil
+}
+
 // WithModel implements dbSession
 func (d *GormDb) WithModel(model any) dbSession {
-	return &GormDb{db: d.db.Model(model)}
+	return &GormDb{db: d.db.Model(model), tx: d.tx, lock: d.lock}
 }
 
 // WithTable implements dbSession
 func (d *GormDb) WithTableName(tableName string) dbSession {
-	return &GormDb{db: d.db.Table(tableName)}
+	return &GormDb{db: d.db.Table(tableName), tx: d.tx, lock: d.lock}
 }
 
 // Find implements dbSession
 func (d *GormDb) Find(ctx context.Context, dest any, query dbspi.Query, pagination dbspi.Pagination) error {
 	db := d.db.WithContext(ctx)
+	if d.lock != nil {
+		db = db.Clauses(clause.Locking{Strength: string(d.lock.Strength), Options: string(d.lock.Wait)})
+	}
 	if pagination != nil {
 		if pagination.Limit() != nil {
 			db = db.Limit(*pagination.Limit())
@@ -957,6 +1319,48 @@ func (d *GormDb) Exec(ctx context.Context, sql string, args ...any) error {
 	return err
 }
 
+// FindJoin runs a join query and scans the rows into dest.
+func (d *GormDb) FindJoin(ctx context.Context, dest any, stmt joinStatement, pagination dbspi.Pagination) error {
+	db := d.joinDb(ctx, stmt).Clauses(clause.Select{Columns: stmt.columns})
+	if pagination != nil {
+		if pagination.Limit() != nil {
+			db = db.Limit(*pagination.Limit())
+		}
+		if pagination.Offset() != nil {
+			db = db.Offset(*pagination.Offset())
+		}
+		if len(pagination.Orders()) > 0 {
+			orders := make([]clause.OrderByColumn, 0, len(pagination.Orders()))
+			for _, order := range pagination.Orders() {
+				orders = append(orders, clause.OrderByColumn{
+					Column: clause.Column{Table: columnTable(order.Column()), Name: order.Column().Name()},
+					Desc:   order.Desc(),
+				})
+			}
+			db = db.Clauses(clause.OrderBy{Columns: orders})
+		}
+	}
+	return db.Find(dest).Error
+}
+
+// CountJoin counts the rows of a join query.
+func (d *GormDb) CountJoin(ctx context.Context, stmt joinStatement) (uint64, error) {
+	var count int64
+	err := d.joinDb(ctx, stmt).Count(&count).Error
+	return uint64(count), err
+}
+
+func (d *GormDb) joinDb(ctx context.Context, stmt joinStatement) *gorm.DB {
+	db := d.db.WithContext(ctx).Table(stmt.from.Name).Clauses(clause.From{
+		Tables: []clause.Table{stmt.from},
+		Joins:  stmt.joins,
+	})
+	if stmt.where != nil {
+		db = db.Clauses(stmt.where)
+	}
+	return db
+}
+
 // FirstOrCreate implements dbSession
 func (d *GormDb) FirstOrCreate(ctx context.Context, entity dbspi.Entity, query dbspi.Query) error {
 	db := d.db.WithContext(ctx)
@@ -967,12 +1371,64 @@ func (d *GormDb) FirstOrCreate(ctx context.Context, entity dbspi.Entity, query d
 	return db.FirstOrCreate(entity).Error
 }
 
+// Upsert implements dbSession
+func (d *GormDb) Upsert(ctx context.Context, entities any, spec upsertSpec, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	db := d.db.WithContext(ctx)
+	onConflict := clause.OnConflict{}
+	for _, name := range spec.conflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: name})
+	}
+	if spec.updates != nil {
+		onConflict.DoUpdates = clause.Assignments(spec.updates)
+	} else {
+		columns, err := upsertOverwriteColumns(db, entities, spec)
+		if err != nil {
+			return err
+		}
+		onConflict.DoUpdates = clause.AssignmentColumns(columns)
+	}
+	return db.Clauses(onConflict).CreateInBatches(entities, batchSize).Error
+}
+
+// upsertOverwriteColumns lists the columns an upsert without an updater
+// overwrites on conflict.
+func upsertOverwriteColumns(db *gorm.DB, entities any, spec upsertSpec) ([]string, error) {
+	if err := db.Statement.Parse(entities); err != nil {
+		return nil, err
+	}
+	skip := make(map[string]bool, len(spec.conflictColumns)+len(spec.insertOnlyColumns))
+	for _, name := range spec.conflictColumns {
+		skip[name] = true
+	}
+	for _, name := range spec.insertOnlyColumns {
+		skip[name] = true
+	}
+	var columns []string
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName == "" || field.PrimaryKey || !field.Creatable || !field.Updatable || skip[field.DBName] {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns, nil
+}
+
 // Transaction implements dbSession
+//
+// Hooks added to the transaction's txState run once the outermost transaction
+// commits. Nested transactions run on savepoints with a txState of their own,
+// whose hooks are dropped when the savepoint rolls back.
 func (d *GormDb) Transaction(ctx context.Context, fn transactionFunc) error {
-	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		txDB := &GormDb{db: tx}
+	state := &txState{}
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txDB := &GormDb{db: tx, tx: state}
 		return fn(txDB)
 	})
+	endTransaction(state, d.tx, err)
+	return err
 }
 
 func queryToGormClause(query dbspi.Query) clause.Expression {
@@ -0,0 +1,140 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/logger"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+var (
+	_ gormlogger.Interface = (*gormLogger)(nil)
+	_ gorm.ParamsFilter    = (*gormLogger)(nil)
+)
+
+type statementTableKey struct{}
+
+// gormLogger writes gorm logs through the logger package, so SQL logs carry
+// the trace_id bound by logger.SetTraceID. Bound parameters are never logged.
+//
+// Statements are logged at debug level when Debug is enabled, and at warn
+// level when they fail or exceed the slow query threshold. Their fields name
+// the shard target: database group, physical database and table, and the
+// ShardingKey of ctx when it has one.
+type gormLogger struct {
+	group         string
+	database      string
+	slowThreshold time.Duration
+	debug         bool
+}
+
+func newGormLogger(database string, cfg dbspi.ServerConfig) *gormLogger {
+	threshold := time.Duration(cfg.SlowQueryThresholdMillis) * time.Millisecond
+	if cfg.SlowQueryThresholdMillis == 0 {
+		threshold = dbspi.DefaultSlowQueryThresholdMillis * time.Millisecond
+	}
+	return &gormLogger{
+		database:      database,
+		slowThreshold: threshold,
+	}
+}
+
+// LogMode implements gormlogger.Interface. gorm.DB.Debug switches to Info,
+// which enables per-statement debug logs.
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *l
+	clone.debug = level >= gormlogger.Info
+	return &clone
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...any) {
+	logger.Info(ctx, fmt.Sprintf(msg, args...), logger.String("database", l.database))
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	logger.Warn(ctx, fmt.Sprintf(msg, args...), logger.String("database", l.database))
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...any) {
+	logger.Error(ctx, fmt.Sprintf(msg, args...), logger.String("database", l.database))
+}
+
+// ParamsFilter implements gorm.ParamsFilter. Dropping the params keeps the
+// placeholders in the logged SQL instead of the bound values.
+func (l *gormLogger) ParamsFilter(_ context.Context, sql string, _ ...any) (string, []any) {
+	return sql, nil
+}
+
+// Trace implements gormlogger.Interface.
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+	if !failed && !slow && !(l.debug && logger.IsDebugEnabled()) {
+		return
+	}
+
+	sql, rows := fc()
+	table, _ := ctx.Value(statementTableKey{}).(string)
+	fields := []logger.Field{
+		logger.String("database_group", l.group),
+		logger.String("database", l.database),
+		logger.String("table", table),
+		logger.String("sharding_key", logShardingKey(ctx)),
+		logger.String("sql", sql),
+		logger.Int64("rows", rows),
+		logger.Duration("elapsed", elapsed),
+	}
+	switch {
+	case failed:
+		logger.Warn(ctx, "sql error", append(fields, logger.Err(err))...)
+	case slow:
+		logger.Warn(ctx, "slow sql", append(fields, logger.Duration("threshold", l.slowThreshold))...)
+	default:
+		logger.Debug(ctx, "sql", fields...)
+	}
+}
+
+// logShardingKey formats the ShardingKey of ctx as sorted `column=value`
+// pairs, or returns "" when ctx has none.
+func logShardingKey(ctx context.Context) string {
+	sk, ok := dbspi.ShardingKeyFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	fields := sk.Fields()
+	pairs := make([]string, 0, len(fields))
+	for name, value := range fields {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", name, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// registerStatementTableCallbacks stores the physical table of each statement
+// in its context so that gormLogger can log it.
+func registerStatementTableCallbacks(db *gorm.DB) error {
+	setTable := func(db *gorm.DB) {
+		if db.Statement.Context == nil || db.Statement.Table == "" {
+			return
+		}
+		db.Statement.Context = context.WithValue(db.Statement.Context, statementTableKey{}, db.Statement.Table)
+	}
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("goshared:log_table_create", setTable),
+		callbacks.Query().Before("gorm:query").Register("goshared:log_table_query", setTable),
+		callbacks.Update().Before("gorm:update").Register("goshared:log_table_update", setTable),
+		callbacks.Delete().Before("gorm:delete").Register("goshared:log_table_delete", setTable),
+		callbacks.Row().Before("gorm:row").Register("goshared:log_table_row", setTable),
+		callbacks.Raw().Before("gorm:raw").Register("goshared:log_table_raw", setTable),
+	)
+}
@@ -0,0 +1,84 @@
+package dbsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// capturingGormLogger keeps gormLogger's params filter but records traces
+// instead of writing them.
+type capturingGormLogger struct {
+	*gormLogger
+	sql   string
+	table string
+}
+
+func (l *capturingGormLogger) Trace(ctx context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	l.sql, _ = fc()
+	l.table, _ = ctx.Value(statementTableKey{}).(string)
+}
+
+func TestGormLoggerRedactsParamsAndRecordsTable(t *testing.T) {
+	capture := &capturingGormLogger{gormLogger: newGormLogger("order_db", dbspi.ServerConfig{})}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/order_db",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: capture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerStatementTableCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []testOrder
+	db.WithContext(context.Background()).Table("order_tab_3").Where("shop_id = ?", 4242).Find(&rows)
+
+	if strings.Contains(capture.sql, "4242") || !strings.Contains(capture.sql, "?") {
+		t.Fatalf("expected bound params to be redacted, got %q", capture.sql)
+	}
+	if capture.table != "order_tab_3" {
+		t.Fatalf("expected table order_tab_3, got %q", capture.table)
+	}
+}
+
+func TestNewGormLoggerSlowThreshold(t *testing.T) {
+	if got := newGormLogger("", dbspi.ServerConfig{}).slowThreshold; got != dbspi.DefaultSlowQueryThresholdMillis*time.Millisecond {
+		t.Fatalf("expected default threshold, got %v", got)
+	}
+	if got := newGormLogger("", dbspi.ServerConfig{SlowQueryThresholdMillis: 50}).slowThreshold; got != 50*time.Millisecond {
+		t.Fatalf("expected 50ms threshold, got %v", got)
+	}
+	if got := newGormLogger("", dbspi.ServerConfig{SlowQueryThresholdMillis: -1}).slowThreshold; got > 0 {
+		t.Fatalf("expected disabled threshold, got %v", got)
+	}
+}
+
+func TestGormLoggerNamesShardTarget(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/order_db_1",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: newGormLogger("order_db_1", dbspi.ServerConfig{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	(&GormDb{db: db}).LabelLogs("order")
+	if got := db.Logger.(*gormLogger).group; got != "order" {
+		t.Fatalf("expected database group order, got %q", got)
+	}
+
+	ctx := dbspi.WithShardingKey(context.Background(), dbspi.NewShardingKey().SetValue("shop_id", 5).SetValue("order_id", 7))
+	if got := logShardingKey(ctx); got != "order_id=7,shop_id=5" {
+		t.Fatalf("unexpected sharding key %q", got)
+	}
+	if got := logShardingKey(context.Background()); got != "" {
+		t.Fatalf("expected no sharding key, got %q", got)
+	}
+}
@@ -0,0 +1,87 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm"
+)
+
+const metricsStartKey = "goshared:metrics_start"
+
+// Ping verifies the connection to the database is alive.
+func (d *GormDb) Ping(ctx context.Context) error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// PoolStats returns a snapshot of the underlying connection pool.
+func (d *GormDb) PoolStats() (dbspi.PoolStats, error) {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return dbspi.PoolStats{}, err
+	}
+	stats := sqlDB.Stats()
+	return dbspi.PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration,
+	}, nil
+}
+
+// InstrumentMetrics registers gorm callbacks that report every statement to
+// recorder. Sessions derived from d, including transactions, are covered.
+func (d *GormDb) InstrumentMetrics(recorder dbspi.MetricsRecorder, groupKey string, server dbspi.ServerConfig) error {
+	before := func(db *gorm.DB) {
+		db.InstanceSet(metricsStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			value, ok := db.InstanceGet(metricsStartKey)
+			if !ok {
+				return
+			}
+			start, ok := value.(time.Time)
+			if !ok {
+				return
+			}
+			ctx := db.Statement.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			recorder.ObserveQuery(ctx, dbspi.QueryObservation{
+				DatabaseGroupKey: groupKey,
+				Database:         server.DatabaseName,
+				Table:            db.Statement.Table,
+				Operation:        operation,
+				Duration:         time.Since(start),
+				Err:              db.Error,
+			})
+		}
+	}
+
+	callbacks := d.db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("goshared:metrics_before_create", before),
+		callbacks.Create().After("gorm:create").Register("goshared:metrics_after_create", after("create")),
+		callbacks.Query().Before("gorm:query").Register("goshared:metrics_before_query", before),
+		callbacks.Query().After("gorm:query").Register("goshared:metrics_after_query", after("query")),
+		callbacks.Update().Before("gorm:update").Register("goshared:metrics_before_update", before),
+		callbacks.Update().After("gorm:update").Register("goshared:metrics_after_update", after("update")),
+		callbacks.Delete().Before("gorm:delete").Register("goshared:metrics_before_delete", before),
+		callbacks.Delete().After("gorm:delete").Register("goshared:metrics_after_delete", after("delete")),
+		callbacks.Row().Before("gorm:row").Register("goshared:metrics_before_row", before),
+		callbacks.Row().After("gorm:row").Register("goshared:metrics_after_row", after("row")),
+		callbacks.Raw().Before("gorm:raw").Register("goshared:metrics_before_raw", before),
+		callbacks.Raw().After("gorm:raw").Register("goshared:metrics_after_raw", after("raw")),
+	)
+}
@@ -2,6 +2,7 @@ package dbsp
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/MrMiaoMIMI/goshared/db/dbspi"
 )
@@ -16,26 +17,29 @@ func NewDefaultDeletedFiled() dbspi.Field[bool] {
 
 // SoftDeleteById implements dbspi.SoftDeleteTableStore
 func (e *GormTableStore[T]) SoftDeleteById(ctx context.Context, id any) error {
-	updater := NewUpdater().Set(e.getDeletedField(e.emptyEntityInstance), true)
-	return e.UpdateById(ctx, id, updater)
+	if _, ok := e.deletedAtField(); ok {
+		return e.SoftDeleteByQuery(ctx, e.buildQueryById(id))
+	}
+	return e.UpdateById(ctx, id, e.softDeleteUpdater(ctx))
 }
 
 // SoftDeleteByQuery implements dbspi.SoftDeleteTableStore
 func (e *GormTableStore[T]) SoftDeleteByQuery(ctx context.Context, query dbspi.Query) error {
-	updater := NewUpdater().Set(e.getDeletedField(e.emptyEntityInstance), true)
-	return e.UpdateByQuery(ctx, query, updater)
+	if _, ok := e.deletedAtField(); ok {
+		// Rows already deleted keep the time they were first deleted.
+		query = e.withNotDeleted(query)
+	}
+	return e.UpdateByQuery(ctx, query, e.softDeleteUpdater(ctx))
 }
 
 // RestoreById implements dbspi.SoftDeleteTableStore
 func (e *GormTableStore[T]) RestoreById(ctx context.Context, id any) error {
-	updater := NewUpdater().Set(e.getDeletedField(e.emptyEntityInstance), false)
-	return e.UpdateById(ctx, id, updater)
+	return e.UpdateById(ctx, id, e.restoreUpdater())
 }
 
 // RestoreByQuery implements dbspi.SoftDeleteTableStore
 func (e *GormTableStore[T]) RestoreByQuery(ctx context.Context, query dbspi.Query) error {
-	updater := NewUpdater().Set(e.getDeletedField(e.emptyEntityInstance), false)
-	return e.UpdateByQuery(ctx, query, updater)
+	return e.UpdateByQuery(ctx, query, e.restoreUpdater())
 }
 
 // FindNotDeleted implements dbspi.SoftDeleteTableStore
@@ -72,13 +76,102 @@ func (e *GormTableStore[T]) getDeletedField(entity dbspi.Entity) dbspi.Field[boo
 	return NewDefaultDeletedFiled()
 }
 
-// withNotDeleted appends a `deleted = false` condition to the given query.
+// deletedAtField returns the soft-delete timestamp field when the entity
+// instance implements dbspi.DeletedAtFieldNameProvider.
+func (e *GormTableStore[T]) deletedAtField() (dbspi.Field[uint64], bool) {
+	if namer, ok := any(e.emptyEntityInstance).(dbspi.DeletedAtFieldNameProvider); ok {
+		return NewField[uint64](namer.DeletedAtFieldName()), true
+	}
+	return nil, false
+}
+
+// softDeleteUpdater marks rows deleted: deleted_at is set to the current time
+// of the common-field TimeProvider, or else the deleted flag to true.
+func (e *GormTableStore[T]) softDeleteUpdater(ctx context.Context) dbspi.Updater {
+	if field, ok := e.deletedAtField(); ok {
+		return NewUpdater().Set(field, e.commonFields.Normalize().TimeProvider(ctx))
+	}
+	return NewUpdater().Set(e.getDeletedField(e.emptyEntityInstance), true)
+}
+
+// restoreUpdater marks rows live again.
+func (e *GormTableStore[T]) restoreUpdater() dbspi.Updater {
+	if field, ok := e.deletedAtField(); ok {
+		return NewUpdater().Set(field, uint64(0))
+	}
+	return NewUpdater().Set(e.getDeletedField(e.emptyEntityInstance), false)
+}
+
+// withNotDeleted appends a `deleted = false` condition to the given query, or
+// `deleted_at = 0` for entities soft-deleted by timestamp.
 // If the query is nil, it returns a query with only the not-deleted condition.
 func (e *GormTableStore[T]) withNotDeleted(query dbspi.Query) dbspi.Query {
-	falseVal := false
-	notDeletedCond := e.getDeletedField(e.emptyEntityInstance).Eq(&falseVal)
+	var notDeletedCond dbspi.Condition
+	if field, ok := e.deletedAtField(); ok {
+		live := uint64(0)
+		notDeletedCond = field.Eq(&live)
+	} else {
+		falseVal := false
+		notDeletedCond = e.getDeletedField(e.emptyEntityInstance).Eq(&falseVal)
+	}
 	if query == nil {
 		return NewQuery(notDeletedCond)
 	}
 	return And(query, notDeletedCond)
 }
+
+// defaultPurgeBatchSize is the number of rows PurgeDeleted deletes per
+// statement.
+const defaultPurgeBatchSize = 500
+
+// purgeDeleted deletes the rows of e soft-deleted before before in batches
+// ordered by id, reporting each batch to observer.
+func (e *GormTableStore[T]) purgeDeleted(ctx context.Context, before uint64, observer deletionObserver) error {
+	field, ok := e.deletedAtField()
+	if !ok {
+		return fmt.Errorf("dbhelper: purging %s requires a deleted_at soft-delete field (dbspi.DeletedAtField)", e.tableName)
+	}
+	live := uint64(0)
+	idColumn := e.idFieldName()
+	limit := defaultPurgeBatchSize
+	for {
+		pagination := NewPagination().WithLimit(&limit).AppendOrder(Asc(NewColumn(idColumn)))
+		rows, err := e.Find(ctx, Select([]dbspi.Column{NewColumn(idColumn)}, field.Gt(&live), field.Lt(&before)), pagination)
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+		ids := make([]any, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, tenantEntityId(row, idColumn))
+		}
+		// Rows restored since they were read are kept.
+		if err := e.DeleteByQuery(ctx, NewQuery(field.Gt(&live), field.Lt(&before), NewField[any](idColumn).In(ids))); err != nil {
+			return err
+		}
+		observer.rowsDeleted(ctx, ids)
+		if len(rows) < limit {
+			return nil
+		}
+	}
+}
+
+// PurgeDeleted hard-deletes the rows of store soft-deleted by timestamp before
+// before, in the unit of the common-field TimeProvider. Sharded stores purge
+// every shard, one physical table at a time in batches of 500 rows, and
+// cached stores drop the purged rows.
+func PurgeDeleted[T dbspi.Entity](ctx context.Context, store dbspi.TableStore[T], before uint64) error {
+	if before == 0 {
+		return fmt.Errorf("dbhelper: purge requires a cutoff time")
+	}
+	set, err := physicalTablesOf(store, "purging deleted rows")
+	if err != nil {
+		return err
+	}
+	defer set.release()
+	for _, table := range set.tables {
+		if err := table.purgeDeleted(ctx, before, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// tenantSchemas caches the gorm schemas of tenant entities for the unique key
+// checks of upserts.
+var tenantSchemas sync.Map
+
+// tenantScope resolves the tenant the calls made with ctx are isolated to.
+// ok is false when the entity does not implement dbspi.TenantAccessor or ctx
+// opts out with dbspi.WithAllTenants.
+func (e *GormTableStore[T]) tenantScope(ctx context.Context) (column, tenantId string, ok bool, err error) {
+	accessor, isTenant := any(e.emptyEntityInstance).(dbspi.TenantAccessor)
+	if !isTenant || dbspi.AllTenantsFromContext(ctx) {
+		return "", "", false, nil
+	}
+	tenantId, found := e.commonFields.Normalize().TenantProvider(ctx)
+	if !found || tenantId == "" {
+		return "", "", false, dbspi.ErrTenantRequired
+	}
+	return accessor.TenantFieldName(), tenantId, true, nil
+}
+
+// withTenant appends a `tenant_id = ?` condition for the tenant of ctx to
+// query and to the subqueries of tenant-aware tables in query.
+func (e *GormTableStore[T]) withTenant(ctx context.Context, query dbspi.Query) (dbspi.Query, error) {
+	query, err := scopeSubqueryTenants(ctx, e.commonFields.Normalize().TenantProvider, query)
+	if err != nil {
+		return nil, err
+	}
+	column, tenantId, ok, err := e.tenantScope(ctx)
+	if err != nil || !ok {
+		return query, err
+	}
+	tenantCond := NewField[string](column).Eq(&tenantId)
+	if query == nil {
+		return NewQuery(tenantCond), nil
+	}
+	return And(query, tenantCond), nil
+}
+
+// stampTenant sets the tenant of ctx on entities with an empty tenant and
+// rejects entities of another tenant. With dbspi.WithAllTenants, entities keep
+// an explicit tenant.
+func (e *GormTableStore[T]) stampTenant(ctx context.Context, entities ...T) error {
+	if _, isTenant := any(e.emptyEntityInstance).(dbspi.TenantAccessor); !isTenant {
+		return nil
+	}
+	tenantId, found := e.commonFields.Normalize().TenantProvider(ctx)
+	allTenants := dbspi.AllTenantsFromContext(ctx)
+	if (!found || tenantId == "") && !allTenants {
+		return dbspi.ErrTenantRequired
+	}
+	for _, entity := range entities {
+		accessor, ok := any(entity).(dbspi.TenantAccessor)
+		if !ok || isNilEntity(entity) {
+			continue
+		}
+		switch current := accessor.GetTenantId(); {
+		case current == "":
+			accessor.SetTenantId(tenantId)
+		case current != tenantId && !allTenants:
+			return fmt.Errorf("%w: entity of tenant %q written by tenant %q", dbspi.ErrCrossTenant, current, tenantId)
+		}
+	}
+	return nil
+}
+
+// checkTenantOwnership rejects entity writes whose ids name rows of another
+// tenant, since gorm writes entities by primary key alone.
+func (e *GormTableStore[T]) checkTenantOwnership(ctx context.Context, entities ...T) error {
+	column, tenantId, ok, err := e.tenantScope(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	idField := e.idFieldName()
+	var ids []any
+	for _, entity := range entities {
+		if id := tenantEntityId(entity, idField); !isZeroId(id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	foreign, err := e.db.Count(ctx, NewQuery(NewField[any](idField).In(ids), NewField[string](column).NotEq(&tenantId)))
+	if err != nil {
+		return err
+	}
+	if foreign > 0 {
+		return fmt.Errorf("%w: %d of the rows belong to another tenant than %q", dbspi.ErrCrossTenant, foreign, tenantId)
+	}
+	return nil
+}
+
+// checkTenantUpdater rejects updaters that move rows to another tenant.
+func (e *GormTableStore[T]) checkTenantUpdater(ctx context.Context, updater dbspi.Updater) error {
+	column, tenantId, ok, err := e.tenantScope(ctx)
+	if err != nil || !ok || updater == nil {
+		return err
+	}
+	params, _ := readUpdaterValues(updater)
+	if value, set := params[column]; set && fmt.Sprint(value) != tenantId {
+		return fmt.Errorf("%w: updater sets %s to %v for tenant %q", dbspi.ErrCrossTenant, column, value, tenantId)
+	}
+	return nil
+}
+
+// checkTenantUpsert applies the tenant checks of a create and, for rows that
+// already exist, of an update.
+func (e *GormTableStore[T]) checkTenantUpsert(ctx context.Context, conflictColumns []dbspi.Column, updater dbspi.Updater, entities ...T) error {
+	if err := e.stampTenant(ctx, entities...); err != nil {
+		return err
+	}
+	if err := e.checkTenantOwnership(ctx, entities...); err != nil {
+		return err
+	}
+	if err := e.checkTenantUniqueKeys(ctx, conflictColumns, entities...); err != nil {
+		return err
+	}
+	return e.checkTenantUpdater(ctx, updater)
+}
+
+// checkTenantUniqueKeys rejects upserts whose entities collide with rows of
+// another tenant on conflictColumns or on a unique index. MySQL's ON
+// DUPLICATE KEY UPDATE fires on any unique index, so the conflict columns
+// alone do not bound the rows an upsert may update. Keys that include the
+// tenant column cannot collide across tenants and are skipped.
+func (e *GormTableStore[T]) checkTenantUniqueKeys(ctx context.Context, conflictColumns []dbspi.Column, entities ...T) error {
+	column, tenantId, ok, err := e.tenantScope(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	entitySchema, err := schema.Parse(e.emptyEntityInstance, &tenantSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return fmt.Errorf("dbhelper: parse tenant entity %T: %w", e.emptyEntityInstance, err)
+	}
+	keys, err := tenantUniqueKeys(entitySchema, conflictColumns, column)
+	if err != nil {
+		return err
+	}
+	var collisions []dbspi.Condition
+	for _, entity := range entities {
+		if isNilEntity(entity) {
+			continue
+		}
+		value := reflect.ValueOf(entity)
+		for _, key := range keys {
+			if cond := uniqueKeyCondition(ctx, key, value); cond != nil {
+				collisions = append(collisions, cond)
+			}
+		}
+	}
+	if len(collisions) == 0 {
+		return nil
+	}
+	foreign, err := e.db.Count(ctx, NewQuery(Or(collisions...), NewField[string](column).NotEq(&tenantId)))
+	if err != nil {
+		return err
+	}
+	if foreign > 0 {
+		return fmt.Errorf("%w: upsert collides with %d rows of another tenant than %q", dbspi.ErrCrossTenant, foreign, tenantId)
+	}
+	return nil
+}
+
+// tenantUniqueKeys returns conflictColumns and the unique indexes declared in
+// the gorm tags of entitySchema, leaving out the primary key and keys that
+// include tenantColumn.
+func tenantUniqueKeys(entitySchema *schema.Schema, conflictColumns []dbspi.Column, tenantColumn string) ([][]*schema.Field, error) {
+	var keys [][]*schema.Field
+	if len(conflictColumns) > 0 {
+		key := make([]*schema.Field, 0, len(conflictColumns))
+		for _, col := range conflictColumns {
+			field := entitySchema.LookUpField(col.Name())
+			if field == nil || field.DBName == "" {
+				return nil, fmt.Errorf("dbhelper: unknown conflict column %q of %s", col.Name(), entitySchema.Table)
+			}
+			key = append(key, field)
+		}
+		keys = append(keys, key)
+	}
+	for _, index := range entitySchema.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		key := make([]*schema.Field, 0, len(index.Fields))
+		for _, option := range index.Fields {
+			key = append(key, option.Field)
+		}
+		keys = append(keys, key)
+	}
+	for _, field := range entitySchema.Fields {
+		if field.Unique && !field.PrimaryKey {
+			keys = append(keys, []*schema.Field{field})
+		}
+	}
+
+	kept := keys[:0]
+	for _, key := range keys {
+		scoped := false
+		for _, field := range key {
+			scoped = scoped || field.DBName == tenantColumn
+		}
+		if !scoped {
+			kept = append(kept, key)
+		}
+	}
+	return kept, nil
+}
+
+// uniqueKeyCondition returns the condition matching rows that share key with
+// entity, or nil when a key value is NULL and so matches no row.
+func uniqueKeyCondition(ctx context.Context, key []*schema.Field, entity reflect.Value) dbspi.Condition {
+	conditions := make([]dbspi.Condition, 0, len(key))
+	for _, field := range key {
+		value, _ := field.ValueOf(ctx, entity)
+		if rv := reflect.ValueOf(value); value == nil || rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil
+		}
+		conditions = append(conditions, NewField[any](field.DBName).Eq(&value))
+	}
+	return And(conditions...)
+}
+
+// tenantEntityId returns the id of entity, reading embedded id fields through
+// dbspi.IdAccessor.
+func tenantEntityId(entity any, idField string) any {
+	if accessor, ok := entity.(dbspi.IdAccessor); ok && accessor.IdFieldName() == idField {
+		return accessor.GetId()
+	}
+	return extractFieldValue(entity, idField)
+}
+
+// tenantCondition returns the `column = ?` condition isolating a tenant-aware
+// table to the tenant of ctx, or nil with dbspi.WithAllTenants.
+func tenantCondition(ctx context.Context, provider dbspi.TenantProvider, column clause.Column) (clause.Expression, error) {
+	if dbspi.AllTenantsFromContext(ctx) {
+		return nil, nil
+	}
+	tenantId, found := provider(ctx)
+	if !found || tenantId == "" {
+		return nil, dbspi.ErrTenantRequired
+	}
+	return clause.Eq{Column: column, Value: tenantId}, nil
+}
+
+// scopeSubqueryTenants adds the tenant condition of ctx to every subquery in
+// query that selects from a tenant-aware table. query is returned unchanged
+// when it has none.
+func scopeSubqueryTenants(ctx context.Context, provider dbspi.TenantProvider, query dbspi.Query) (dbspi.Query, error) {
+	if query == nil {
+		return nil, nil
+	}
+	scoped, err := scopeConditionTenants(ctx, provider, query)
+	if err != nil {
+		return nil, err
+	}
+	return scoped.(dbspi.Query), nil
+}
+
+func scopeConditionTenants(ctx context.Context, provider dbspi.TenantProvider, cond dbspi.Condition) (dbspi.Condition, error) {
+	switch c := cond.(type) {
+	case *GormQuery:
+		conditions := make([]dbspi.Condition, len(c.conditions))
+		for i, inner := range c.conditions {
+			scoped, err := scopeConditionTenants(ctx, provider, inner)
+			if err != nil {
+				return nil, err
+			}
+			conditions[i] = scoped
+		}
+		return &GormQuery{keyword: c.keyword, conditions: conditions}, nil
+	case *gormColumnSelectionQuery:
+		scoped, err := scopeConditionTenants(ctx, provider, c.GormQuery)
+		if err != nil {
+			return nil, err
+		}
+		return &gormColumnSelectionQuery{GormQuery: scoped.(*GormQuery), columns: c.columns}, nil
+	case *GormCondition:
+		expr, err := scopeExprTenants(ctx, provider, c.expr)
+		if err != nil {
+			return nil, err
+		}
+		return &GormCondition{expr: expr}, nil
+	default:
+		return cond, nil
+	}
+}
+
+func scopeExprTenants(ctx context.Context, provider dbspi.TenantProvider, expr clause.Expression) (clause.Expression, error) {
+	switch e := expr.(type) {
+	case clause.AndConditions:
+		exprs, err := scopeExprsTenants(ctx, provider, e.Exprs)
+		return clause.AndConditions{Exprs: exprs}, err
+	case clause.OrConditions:
+		exprs, err := scopeExprsTenants(ctx, provider, e.Exprs)
+		return clause.OrConditions{Exprs: exprs}, err
+	case clause.NotConditions:
+		exprs, err := scopeExprsTenants(ctx, provider, e.Exprs)
+		return clause.NotConditions{Exprs: exprs}, err
+	case subqueryCondition:
+		sub := e.sub
+		if sub.where != nil {
+			where, err := scopeExprTenants(ctx, provider, sub.where)
+			if err != nil {
+				return nil, err
+			}
+			sub.where = where
+		}
+		if sub.tenantColumn != "" {
+			// Unqualified, the column resolves to the subquery's own table.
+			cond, err := tenantCondition(ctx, provider, clause.Column{Name: sub.tenantColumn})
+			if err != nil {
+				return nil, fmt.Errorf("subquery on %s: %w", sub.table, err)
+			}
+			sub.where = andClause(sub.where, cond)
+			sub.tenantColumn = ""
+		}
+		e.sub = sub
+		return e, nil
+	default:
+		return expr, nil
+	}
+}
+
+func scopeExprsTenants(ctx context.Context, provider dbspi.TenantProvider, exprs []clause.Expression) ([]clause.Expression, error) {
+	scoped := make([]clause.Expression, len(exprs))
+	for i, expr := range exprs {
+		var err error
+		if scoped[i], err = scopeExprTenants(ctx, provider, expr); err != nil {
+			return nil, err
+		}
+	}
+	return scoped, nil
+}
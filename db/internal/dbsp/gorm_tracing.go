@@ -0,0 +1,62 @@
+package dbsp
+
+import (
+	"errors"
+
+	"github.com/MrMiaoMIMI/goshared/tracing"
+
+	"gorm.io/gorm"
+)
+
+const traceSpanKey = "goshared:trace_span"
+
+// registerTracingCallbacks starts a child span of the statement context for
+// every statement executed on db. The span carries the physical database and
+// table, so it identifies the shard target a sharded query was routed to.
+func registerTracingCallbacks(db *gorm.DB, database string) error {
+	before := func(operation string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			ctx, span := tracing.Start(db.Statement.Context, "db."+operation,
+				tracing.String(tracing.AttrDBSystem, "mysql"),
+				tracing.String(tracing.AttrDBName, database),
+				tracing.String(tracing.AttrDBOperation, operation),
+			)
+			if db.Statement.Table != "" {
+				span.SetAttributes(tracing.String(tracing.AttrDBTable, db.Statement.Table))
+			}
+			db.Statement.Context = ctx
+			db.InstanceSet(traceSpanKey, span)
+		}
+	}
+	after := func(db *gorm.DB) {
+		value, ok := db.InstanceGet(traceSpanKey)
+		if !ok {
+			return
+		}
+		span, ok := value.(tracing.Span)
+		if !ok {
+			return
+		}
+		span.SetAttributes(tracing.Int64(tracing.AttrDBRowsAffected, db.Statement.RowsAffected))
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(db.Error)
+		}
+		span.End()
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("goshared:trace_before_create", before("create")),
+		callbacks.Create().After("gorm:create").Register("goshared:trace_after_create", after),
+		callbacks.Query().Before("gorm:query").Register("goshared:trace_before_query", before("query")),
+		callbacks.Query().After("gorm:query").Register("goshared:trace_after_query", after),
+		callbacks.Update().Before("gorm:update").Register("goshared:trace_before_update", before("update")),
+		callbacks.Update().After("gorm:update").Register("goshared:trace_after_update", after),
+		callbacks.Delete().Before("gorm:delete").Register("goshared:trace_before_delete", before("delete")),
+		callbacks.Delete().After("gorm:delete").Register("goshared:trace_after_delete", after),
+		callbacks.Row().Before("gorm:row").Register("goshared:trace_before_row", before("row")),
+		callbacks.Row().After("gorm:row").Register("goshared:trace_after_row", after),
+		callbacks.Raw().Before("gorm:raw").Register("goshared:trace_before_raw", before("raw")),
+		callbacks.Raw().After("gorm:raw").Register("goshared:trace_after_raw", after),
+	)
+}
@@ -0,0 +1,49 @@
+package dbsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/tracing"
+	"github.com/MrMiaoMIMI/goshared/tracing/tracetest"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestTracingCallbacksStartChildSpans(t *testing.T) {
+	recorder := tracetest.NewRecorder()
+	tracing.SetTracer(recorder)
+	defer tracing.SetTracer(nil)
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/order_db_2",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerTracingCallbacks(db, "order_db_2"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := tracing.Start(context.Background(), "handler")
+	var rows []testOrder
+	db.WithContext(ctx).Table("order_tab_3").Where("shop_id = ?", 1).Find(&rows)
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "db.query" {
+		t.Fatalf("expected db.query span, got %q", span.Name)
+	}
+	if span.ParentSpanID != parent.SpanContext().SpanID || span.SpanContext.TraceID != parent.SpanContext().TraceID {
+		t.Fatalf("expected db span to be a child of the handler span")
+	}
+	if span.Attributes[tracing.AttrDBName] != "order_db_2" || span.Attributes[tracing.AttrDBTable] != "order_tab_3" {
+		t.Fatalf("unexpected shard attributes: %v", span.Attributes)
+	}
+}
@@ -0,0 +1,60 @@
+package dbsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestUpdaterExpressionsRenderSQL(t *testing.T) {
+	capture := &capturingGormLogger{gormLogger: newGormLogger("shop_db", dbspi.ServerConfig{})}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/shop_db",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: capture})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stock, reserved, sku := NewField[int64]("stock"), NewField[int64]("reserved"), NewField[string]("sku")
+	one, id := int64(1), int64(42)
+	updater := NewUpdater().
+		Incr(stock, -1).
+		SetExpr(sku, "UPPER(?)", sku)
+	query := And(
+		NewField[int64]("id").Eq(&id),
+		stock.GtEq(&one),
+		stock.GtColumn(reserved),
+	)
+
+	session := &GormDb{db: db.Table("product_tab")}
+	if err := session.UpdateByQuery(context.Background(), query, updater); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "UPDATE `product_tab` SET `sku`=UPPER(`sku`),`stock`=`stock` + ? WHERE `id` = ? AND `stock` >= ? AND `stock` > `reserved`"
+	if capture.sql != want {
+		t.Fatalf("unexpected SQL:\n got %q\nwant %q", capture.sql, want)
+	}
+}
+
+func TestExtractColumnsIgnoresColumnComparisons(t *testing.T) {
+	shopID := int64(6)
+	query := And(
+		NewField[int64]("shop_id").Eq(&shopID),
+		NewField[int64]("shop_id").EqColumn(NewColumn("origin_shop_id")),
+		NewField[int64]("shop_id").LtColumn(NewColumn("max_shop_id")),
+	)
+
+	values, rangeCols := ExtractColumnsFromQuery(query)
+	if got := values["shop_id"]; len(got) != 1 || got[0] != shopID {
+		t.Fatalf("expected only the literal shop_id value, got %v", got)
+	}
+	if rangeCols["shop_id"] {
+		t.Fatal("expected column comparisons not to count as range conditions")
+	}
+}
@@ -0,0 +1,384 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+var (
+	_ dbspi.SoftDeleteTableStore[*_tableForCheck] = (*idAssigningTableStore[*_tableForCheck])(nil)
+	_ dbspi.SQLTableStore[*_tableForCheck]        = (*idAssigningTableStore[*_tableForCheck])(nil)
+)
+
+// maxIdShardBits bounds IdAssignOptions.ShardBits so that generated ids keep
+// enough bits for the generator's own value.
+const maxIdShardBits = 16
+
+// IdAssignOptions configures NewIdAssigningTableStore.
+type IdAssignOptions struct {
+	// Generator hands out the ids of entities created with a zero id. With a
+	// nil Generator, ids are left to the caller and only shard bit routing
+	// applies.
+	Generator dbspi.IdGenerator
+
+	// ShardColumn and ShardBits embed the low ShardBits bits of the entity's
+	// ShardColumn value in the low bits of generated ids:
+	//
+	//	id = generated<<ShardBits | ShardColumn&(1<<ShardBits-1)
+	//
+	// Writes and reads by id then route from the id alone, by taking the low
+	// bits of the id as the ShardColumn value. This only holds for rules that
+	// depend on ShardColumn modulo a power of two no larger than 1<<ShardBits,
+	// e.g. "@{shop_id} % 4" with ShardBits >= 2.
+	ShardColumn string
+	ShardBits   int
+}
+
+// idAssigningTableStore assigns ids from a generator to entities created with
+// a zero id and, with shard bits, routes id-based calls by the shard bits of
+// the id.
+type idAssigningTableStore[T dbspi.Entity] struct {
+	inner dbspi.TableStore[T]
+	opts  IdAssignOptions
+	table string
+}
+
+// NewIdAssigningTableStore wraps store so that Create and BatchCreate assign
+// ids as configured by opts. T must implement dbspi.IdAccessor.
+func NewIdAssigningTableStore[T dbspi.Entity](store dbspi.TableStore[T], opts IdAssignOptions) dbspi.SoftDeleteTableStore[T] {
+	if store == nil {
+		panic("dbhelper: id assignment requires a table store")
+	}
+	if opts.Generator == nil && opts.ShardBits == 0 {
+		panic("dbhelper: id assignment requires an IdGenerator or shard bits")
+	}
+	var entity T
+	entityType := reflect.TypeOf(entity)
+	if entityType == nil || entityType.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("dbhelper: id assignment requires a pointer entity, got %v", entityType))
+	}
+	entity = reflect.New(entityType.Elem()).Interface().(T)
+	if _, ok := any(entity).(dbspi.IdAccessor); !ok {
+		panic(fmt.Sprintf("dbhelper: id assignment requires %v to implement dbspi.IdAccessor", entityType))
+	}
+	if opts.ShardColumn != "" || opts.ShardBits != 0 {
+		if opts.ShardBits <= 0 || opts.ShardBits > maxIdShardBits {
+			panic(fmt.Sprintf("dbhelper: id shard bits must be between 1 and %d, got %d", maxIdShardBits, opts.ShardBits))
+		}
+		if extractFieldValue(entity, opts.ShardColumn) == nil {
+			panic(fmt.Sprintf("dbhelper: id shard column %q not found in %v", opts.ShardColumn, entityType))
+		}
+		if bounded, ok := opts.Generator.(dbspi.MaxIdProvider); ok && bounded.MaxId() > math.MaxInt64>>opts.ShardBits {
+			panic(fmt.Sprintf("dbhelper: id generator %T returns ids up to %d, which leaves no room for %d shard bits", opts.Generator, bounded.MaxId(), opts.ShardBits))
+		}
+	}
+	return &idAssigningTableStore[T]{inner: store, opts: opts, table: entity.TableName()}
+}
+
+// ================== Id assignment ==================
+
+func (s *idAssigningTableStore[T]) Create(ctx context.Context, entity T) error {
+	if err := s.assignId(ctx, entity); err != nil {
+		return err
+	}
+	return s.inner.Create(ctx, entity)
+}
+
+func (s *idAssigningTableStore[T]) BatchCreate(ctx context.Context, entities []T, batchSize int) error {
+	for _, entity := range entities {
+		if err := s.assignId(ctx, entity); err != nil {
+			return err
+		}
+	}
+	return s.inner.BatchCreate(ctx, entities, batchSize)
+}
+
+// assignId sets a generated id on entity unless it already has one.
+func (s *idAssigningTableStore[T]) assignId(ctx context.Context, entity T) error {
+	accessor := any(entity).(dbspi.IdAccessor)
+	if s.opts.Generator == nil || accessor.GetId() != 0 {
+		return nil
+	}
+	id, err := s.opts.Generator.NextId(ctx, s.table)
+	if err != nil {
+		return fmt.Errorf("generate id for %s: %w", s.table, err)
+	}
+	if id == 0 {
+		return fmt.Errorf("generate id for %s: generator returned 0", s.table)
+	}
+	if s.opts.ShardBits > 0 {
+		if id > math.MaxInt64>>s.opts.ShardBits {
+			return fmt.Errorf("generate id for %s: id %d leaves no room for %d shard bits", s.table, id, s.opts.ShardBits)
+		}
+		value := extractFieldValue(entity, s.opts.ShardColumn)
+		shard, ok := shardBitsValue(value)
+		if !ok {
+			return fmt.Errorf("generate id for %s: shard column %q must be a non-negative integer, got %T %v", s.table, s.opts.ShardColumn, value, value)
+		}
+		id = id<<s.opts.ShardBits | shard&s.shardMask()
+	}
+	accessor.SetId(id)
+	return nil
+}
+
+func (s *idAssigningTableStore[T]) shardMask() uint64 {
+	return 1<<s.opts.ShardBits - 1
+}
+
+// withIdShard returns ctx with the shard column value encoded in id added to
+// its ShardingKey. Values already in ctx take precedence, and ctx is returned
+// unchanged when the store has no shard bits or id is not an integer.
+func (s *idAssigningTableStore[T]) withIdShard(ctx context.Context, id any) context.Context {
+	if s.opts.ShardBits == 0 {
+		return ctx
+	}
+	value, ok := shardBitsValue(id)
+	if !ok {
+		return ctx
+	}
+	key := dbspi.NewShardingKey()
+	if ctxKey, ok := dbspi.ShardingKeyFromContext(ctx); ok {
+		if _, err := ctxKey.Get(s.opts.ShardColumn); err == nil {
+			return ctx
+		}
+		for name, v := range ctxKey.Fields() {
+			key.SetValue(name, v)
+		}
+	}
+	key.SetValue(s.opts.ShardColumn, int64(value&s.shardMask()))
+	return dbspi.WithShardingKey(ctx, key)
+}
+
+// shardBitsValue converts a non-negative integer of any width to uint64.
+func shardBitsValue(v any) (uint64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() < 0 {
+			return 0, false
+		}
+		return uint64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	default:
+		return 0, false
+	}
+}
+
+// ================== Id-routed calls ==================
+
+func (s *idAssigningTableStore[T]) GetById(ctx context.Context, id any) (T, error) {
+	return s.inner.GetById(s.withIdShard(ctx, id), id)
+}
+
+func (s *idAssigningTableStore[T]) ExistsById(ctx context.Context, id any) (bool, T, error) {
+	return s.inner.ExistsById(s.withIdShard(ctx, id), id)
+}
+
+func (s *idAssigningTableStore[T]) UpdateById(ctx context.Context, id any, updater dbspi.Updater) error {
+	return s.inner.UpdateById(s.withIdShard(ctx, id), id, updater)
+}
+
+func (s *idAssigningTableStore[T]) DeleteById(ctx context.Context, id any) error {
+	return s.inner.DeleteById(s.withIdShard(ctx, id), id)
+}
+
+func (s *idAssigningTableStore[T]) SoftDeleteById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.SoftDeleteById(s.withIdShard(ctx, id), id)
+}
+
+func (s *idAssigningTableStore[T]) RestoreById(ctx context.Context, id any) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.RestoreById(s.withIdShard(ctx, id), id)
+}
+
+func (s *idAssigningTableStore[T]) ExistsByIdNotDeleted(ctx context.Context, id any) (bool, T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	return store.ExistsByIdNotDeleted(s.withIdShard(ctx, id), id)
+}
+
+// routeChange implements changeRouter.
+func (s *idAssigningTableStore[T]) routeChange(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error) {
+	if query == nil && id != nil {
+		ctx = s.withIdShard(ctx, id)
+	}
+	return routeChange(ctx, s.inner, entity, id, query)
+}
+
+// ================== Pass-through ==================
+
+// Shard returns the shard store wrapped with the same options.
+func (s *idAssigningTableStore[T]) Shard(key *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
+	store, err := s.inner.Shard(key)
+	if err != nil {
+		return store, err
+	}
+	return NewIdAssigningTableStore(store, s.opts), nil
+}
+
+func (s *idAssigningTableStore[T]) Find(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	return s.inner.Find(ctx, query, pagination)
+}
+
+func (s *idAssigningTableStore[T]) Exists(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	return s.inner.Exists(ctx, query)
+}
+
+func (s *idAssigningTableStore[T]) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	return s.inner.Count(ctx, query)
+}
+
+func (s *idAssigningTableStore[T]) FindAll(ctx context.Context, query dbspi.Query, batchSize int) ([]T, error) {
+	return s.inner.FindAll(ctx, query, batchSize)
+}
+
+func (s *idAssigningTableStore[T]) CountAll(ctx context.Context, query dbspi.Query) (uint64, error) {
+	return s.inner.CountAll(ctx, query)
+}
+
+func (s *idAssigningTableStore[T]) Save(ctx context.Context, entity T) error {
+	return s.inner.Save(ctx, entity)
+}
+
+func (s *idAssigningTableStore[T]) Update(ctx context.Context, entity T) error {
+	return s.inner.Update(ctx, entity)
+}
+
+func (s *idAssigningTableStore[T]) Delete(ctx context.Context, entity T) error {
+	return s.inner.Delete(ctx, entity)
+}
+
+func (s *idAssigningTableStore[T]) BatchSave(ctx context.Context, entities []T) error {
+	return s.inner.BatchSave(ctx, entities)
+}
+
+func (s *idAssigningTableStore[T]) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	return s.inner.UpdateByQuery(ctx, query, updater)
+}
+
+func (s *idAssigningTableStore[T]) DeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	return s.inner.DeleteByQuery(ctx, query)
+}
+
+// FirstOrCreate assigns an id only when no row matches query, because a
+// non-zero id is added to the lookup and would never match an existing row.
+func (s *idAssigningTableStore[T]) FirstOrCreate(ctx context.Context, entity T, query dbspi.Query) (T, error) {
+	if s.opts.Generator == nil || any(entity).(dbspi.IdAccessor).GetId() != 0 {
+		return s.inner.FirstOrCreate(ctx, entity, query)
+	}
+	routed, err := routeChange(ctx, s.inner, entity, nil, query)
+	if err != nil {
+		return entity, err
+	}
+	found, _, err := routed.Exists(ctx, query)
+	if err != nil {
+		return entity, err
+	}
+	if !found {
+		if err := s.assignId(ctx, entity); err != nil {
+			return entity, err
+		}
+	}
+	return s.inner.FirstOrCreate(ctx, entity, query)
+}
+
+func (s *idAssigningTableStore[T]) Upsert(ctx context.Context, entity T, conflictColumns []dbspi.Column, updater dbspi.Updater) error {
+	return s.inner.Upsert(ctx, entity, conflictColumns, updater)
+}
+
+func (s *idAssigningTableStore[T]) BatchUpsert(ctx context.Context, entities []T, conflictColumns []dbspi.Column, updater dbspi.Updater, batchSize int) error {
+	return s.inner.BatchUpsert(ctx, entities, conflictColumns, updater, batchSize)
+}
+
+func (s *idAssigningTableStore[T]) SoftDeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.SoftDeleteByQuery(ctx, query)
+}
+
+func (s *idAssigningTableStore[T]) RestoreByQuery(ctx context.Context, query dbspi.Query) error {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.RestoreByQuery(ctx, query)
+}
+
+func (s *idAssigningTableStore[T]) FindNotDeleted(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return store.FindNotDeleted(ctx, query, pagination)
+}
+
+func (s *idAssigningTableStore[T]) CountNotDeleted(ctx context.Context, query dbspi.Query) (uint64, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		return 0, err
+	}
+	return store.CountNotDeleted(ctx, query)
+}
+
+func (s *idAssigningTableStore[T]) ExistsNotDeleted(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	store, err := toSoftDeleteTableStore(s.inner)
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	return store.ExistsNotDeleted(ctx, query)
+}
+
+// Raw implements dbspi.SQLTableStore.
+func (s *idAssigningTableStore[T]) Raw(ctx context.Context, sql string, args ...any) ([]T, error) {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return store.Raw(ctx, sql, args...)
+}
+
+// Exec implements dbspi.SQLTableStore.
+func (s *idAssigningTableStore[T]) Exec(ctx context.Context, sql string, args ...any) error {
+	store, err := toSQLTableStore(s.inner)
+	if err != nil {
+		return err
+	}
+	return store.Exec(ctx, sql, args...)
+}
+
+// RawScan implements rawScanner.
+func (s *idAssigningTableStore[T]) RawScan(ctx context.Context, dest any, sql string, args ...any) error {
+	scanner, err := toRawScanner(s.inner)
+	if err != nil {
+		return err
+	}
+	return scanner.RawScan(ctx, dest, sql, args...)
+}
+
+// unwrap implements tableStoreWrapper.
+func (s *idAssigningTableStore[T]) unwrap() (dbspi.TableStore[T], func(), error) {
+	return s.inner, func() {}, nil
+}
+
+// boundTx implements txBound.
+func (s *idAssigningTableStore[T]) boundTx() *txState {
+	return boundTxOf(s.inner)
+}
@@ -0,0 +1,123 @@
+package dbsp
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+type idAssignTestOrder struct {
+	dbspi.CommonFields
+	ShopID int64  `gorm:"column:shop_id"`
+	SKU    string `gorm:"column:sku"`
+}
+
+func (*idAssignTestOrder) TableName() string        { return "order_item_tab" }
+func (*idAssignTestOrder) DatabaseGroupKey() string { return "order" }
+
+func TestIdAssigningTableStoreRoutesByShardBits(t *testing.T) {
+	mgr := NewMemoryManager(shardedJoinTestConfig(), ManagerOptions{})
+	var next atomic.Uint64
+	gen := dbspi.IdGeneratorFunc(func(_ context.Context, table string) (uint64, error) {
+		if table != "order_item_tab" {
+			t.Errorf("table = %q", table)
+		}
+		return next.Add(1), nil
+	})
+	store := NewIdAssigningTableStore[*idAssignTestOrder](For(&idAssignTestOrder{}, mgr), IdAssignOptions{Generator: gen, ShardColumn: "shop_id", ShardBits: 2})
+	ctx := context.Background()
+
+	orders := []*idAssignTestOrder{{ShopID: 5, SKU: "a"}, {ShopID: 9, SKU: "b"}, {ShopID: 6, SKU: "c"}}
+	if err := store.BatchCreate(ctx, orders[:2], 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, orders[2]); err != nil {
+		t.Fatal(err)
+	}
+	kept := &idAssignTestOrder{CommonFields: dbspi.CommonFields{IdField: dbspi.IdField{Id: 99}}, ShopID: 7, SKU: "d"}
+	if err := store.Create(ctx, kept); err != nil {
+		t.Fatal(err)
+	}
+	if orders[0].Id != 1<<2|1 || orders[1].Id != 2<<2|1 || orders[2].Id != 3<<2|2 || kept.Id != 99 {
+		t.Fatalf("ids = %d, %d, %d, %d", orders[0].Id, orders[1].Id, orders[2].Id, kept.Id)
+	}
+
+	for _, order := range orders {
+		got, err := store.GetById(ctx, order.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.SKU != order.SKU {
+			t.Fatalf("GetById(%d) = %+v", order.Id, got)
+		}
+	}
+	if err := store.DeleteById(ctx, orders[2].Id); err != nil {
+		t.Fatal(err)
+	}
+	if found, _, err := store.ExistsById(ctx, orders[2].Id); err != nil || found {
+		t.Fatalf("after delete found = %v, err = %v", found, err)
+	}
+}
+
+func TestIdAssigningTableStoreRejectsZeroId(t *testing.T) {
+	gen := dbspi.IdGeneratorFunc(func(context.Context, string) (uint64, error) { return 0, nil })
+	store := NewIdAssigningTableStore[*memoryTestUser](NewMemoryTableStore(&memoryTestUser{}, testCommonFieldAutoFillOptions()), IdAssignOptions{Generator: gen})
+
+	err := store.Create(context.Background(), &memoryTestUser{Email: "a@x.io"})
+	if err == nil || !strings.Contains(err.Error(), "generator returned 0") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestIdAssigningTableStoreFirstOrCreateAssignsShardBits(t *testing.T) {
+	mgr := NewMemoryManager(shardedJoinTestConfig(), ManagerOptions{})
+	var next atomic.Uint64
+	gen := dbspi.IdGeneratorFunc(func(context.Context, string) (uint64, error) { return next.Add(1), nil })
+	store := NewIdAssigningTableStore[*idAssignTestOrder](For(&idAssignTestOrder{}, mgr), IdAssignOptions{Generator: gen, ShardColumn: "shop_id", ShardBits: 2})
+	ctx := context.Background()
+
+	shopID, sku := int64(5), "a"
+	query := And(NewField[int64]("shop_id").Eq(&shopID), NewField[string]("sku").Eq(&sku))
+	created, err := store.FirstOrCreate(ctx, &idAssignTestOrder{ShopID: shopID, SKU: sku}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id != 1<<2|1 {
+		t.Fatalf("created id = %d", created.Id)
+	}
+	found, err := store.FirstOrCreate(ctx, &idAssignTestOrder{ShopID: shopID, SKU: sku}, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Id != created.Id || next.Load() != 1 {
+		t.Fatalf("found id = %d, generated %d ids", found.Id, next.Load())
+	}
+}
+
+type boundedTestIdGenerator struct {
+	dbspi.IdGeneratorFunc
+	max uint64
+}
+
+func (g boundedTestIdGenerator) MaxId() uint64 { return g.max }
+
+func TestIdAssigningTableStoreRejectsGeneratorWithoutRoomForShardBits(t *testing.T) {
+	gen := boundedTestIdGenerator{
+		IdGeneratorFunc: func(context.Context, string) (uint64, error) { return 1, nil },
+		max:             1<<62 - 1,
+	}
+	newStore := func(bits int) {
+		NewIdAssigningTableStore[*idAssignTestOrder](NewMemoryTableStore(&idAssignTestOrder{}, testCommonFieldAutoFillOptions()), IdAssignOptions{Generator: gen, ShardColumn: "shop_id", ShardBits: bits})
+	}
+
+	newStore(1)
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "no room for 2 shard bits") {
+			t.Fatalf("recovered %v", r)
+		}
+	}()
+	newStore(2)
+}
@@ -0,0 +1,174 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// SegmentTransaction runs fn in one database transaction, passing a table
+// store of dbspi.IdSegment bound to it that locks the rows it reads FOR
+// UPDATE.
+type SegmentTransaction func(ctx context.Context, fn func(store dbspi.TableStore[*dbspi.IdSegment]) error) error
+
+// SegmentAllocator hands out ids per business tag from ranges reserved in
+// dbspi.DefaultIdSegmentTableName, in the style of Leaf's segment mode.
+//
+// Each tag keeps two segments in memory: the one ids are handed out from and
+// the next one, reserved in the background once PrefetchRatio of the current
+// segment is used, so the database is rarely on the hot path. Ids of a tag
+// are monotonic within a process and unique across processes sharing the
+// table; ids left in memory when a process exits are skipped.
+//
+// SegmentAllocator implements idutil.SegmentAllocator, and
+// dbspi.IdGenerator with the table name as the business tag.
+type SegmentAllocator struct {
+	tx  SegmentTransaction
+	cfg dbspi.SegmentConfig
+
+	mu      sync.Mutex
+	buffers map[string]*segmentBuffer
+}
+
+// NewSegmentAllocator creates a SegmentAllocator that reserves ranges
+// through tx.
+func NewSegmentAllocator(tx SegmentTransaction, cfg dbspi.SegmentConfig) *SegmentAllocator {
+	if tx == nil {
+		panic("dbhelper: segment allocator requires a SegmentTransaction")
+	}
+	defaults := dbspi.DefaultSegmentConfig()
+	if cfg.Step == 0 {
+		cfg.Step = defaults.Step
+	}
+	if cfg.PrefetchRatio <= 0 || cfg.PrefetchRatio > 1 {
+		cfg.PrefetchRatio = defaults.PrefetchRatio
+	}
+	return &SegmentAllocator{tx: tx, cfg: cfg, buffers: make(map[string]*segmentBuffer)}
+}
+
+// segment is the id range [next, max].
+type segment struct {
+	next, max, size uint64
+}
+
+// segmentBuffer is the double buffer of one business tag.
+type segmentBuffer struct {
+	mu      sync.Mutex
+	current segment
+	next    *segment
+	// loading is closed when the in-flight reservation finishes; nil when
+	// none is in flight.
+	loading chan struct{}
+}
+
+// Next returns the next id of bizTag.
+func (a *SegmentAllocator) Next(ctx context.Context, bizTag string) (uint64, error) {
+	if bizTag == "" {
+		return 0, fmt.Errorf("dbhelper: business tag is empty")
+	}
+	buf := a.buffer(bizTag)
+	buf.mu.Lock()
+	for {
+		if buf.current.next <= buf.current.max {
+			id := buf.current.next
+			buf.current.next++
+			used := buf.current.size - (buf.current.max - id)
+			if buf.next == nil && buf.loading == nil && float64(used) >= a.cfg.PrefetchRatio*float64(buf.current.size) {
+				loading := make(chan struct{})
+				buf.loading = loading
+				go a.load(context.WithoutCancel(ctx), bizTag, buf, loading)
+			}
+			buf.mu.Unlock()
+			return id, nil
+		}
+		if buf.next != nil {
+			buf.current, buf.next = *buf.next, nil
+			continue
+		}
+		loading := buf.loading
+		if loading == nil {
+			loading = make(chan struct{})
+			buf.loading = loading
+			buf.mu.Unlock()
+			if err := a.load(ctx, bizTag, buf, loading); err != nil {
+				return 0, err
+			}
+		} else {
+			buf.mu.Unlock()
+			select {
+			case <-loading:
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}
+		buf.mu.Lock()
+	}
+}
+
+// NextId implements dbspi.IdGenerator.
+func (a *SegmentAllocator) NextId(ctx context.Context, table string) (uint64, error) {
+	return a.Next(ctx, table)
+}
+
+func (a *SegmentAllocator) buffer(bizTag string) *segmentBuffer {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	buf, ok := a.buffers[bizTag]
+	if !ok {
+		buf = &segmentBuffer{current: segment{next: 1}}
+		a.buffers[bizTag] = buf
+	}
+	return buf
+}
+
+// load reserves a segment into buf.next and closes loading. A failed
+// background reservation is retried by the next call that runs out of ids.
+func (a *SegmentAllocator) load(ctx context.Context, bizTag string, buf *segmentBuffer, loading chan struct{}) error {
+	seg, err := a.reserve(ctx, bizTag)
+	buf.mu.Lock()
+	if err == nil {
+		buf.next = &seg
+	}
+	buf.loading = nil
+	buf.mu.Unlock()
+	close(loading)
+	return err
+}
+
+// reserve moves the max id of bizTag forward by its step and returns the
+// range in between, creating the row on first use.
+func (a *SegmentAllocator) reserve(ctx context.Context, bizTag string) (segment, error) {
+	for attempt := 0; ; attempt++ {
+		var seg segment
+		created := false
+		err := a.tx(ctx, func(store dbspi.TableStore[*dbspi.IdSegment]) error {
+			row, err := store.GetById(ctx, bizTag)
+			if err != nil {
+				return err
+			}
+			if row == nil {
+				created = true
+				row = &dbspi.IdSegment{BizTag: bizTag, Step: a.cfg.Step}
+			}
+			if row.Step == 0 {
+				row.Step = a.cfg.Step
+			}
+			seg = segment{next: row.MaxId + 1, max: row.MaxId + row.Step, size: row.Step}
+			row.MaxId = seg.max
+			if created {
+				return store.Create(ctx, row)
+			}
+			return store.Save(ctx, row)
+		})
+		// Another process may have created the row first; the retry locks it.
+		if err != nil && created && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return segment{}, fmt.Errorf("dbhelper: reserve segment for %q: %w", bizTag, err)
+		}
+		return seg, nil
+	}
+}
@@ -0,0 +1,75 @@
+package dbsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// newSegmentTestTransaction returns a SegmentTransaction on an in-memory
+// segment table, and a store reading that table outside transactions.
+func newSegmentTestTransaction() (SegmentTransaction, *GormTableStore[*dbspi.IdSegment]) {
+	segments := NewMemoryTableStore(&dbspi.IdSegment{}, DisabledCommonFieldAutoFillOptions())
+	tx := func(ctx context.Context, fn func(store dbspi.TableStore[*dbspi.IdSegment]) error) error {
+		return segments.session.Transaction(ctx, func(tx dbSession) error {
+			lockTx, err := lockingSession(tx, dbspi.RowLock{Strength: dbspi.LockForUpdate})
+			if err != nil {
+				return err
+			}
+			return fn(NewTableStoreWithCommonFieldAutoFill(lockTx, &dbspi.IdSegment{}, segments.commonFields))
+		})
+	}
+	return tx, segments
+}
+
+func TestSegmentAllocatorReservesMonotonicRanges(t *testing.T) {
+	ctx := context.Background()
+	tx, segments := newSegmentTestTransaction()
+	first := NewSegmentAllocator(tx, dbspi.SegmentConfig{Step: 3, PrefetchRatio: 1})
+	second := NewSegmentAllocator(tx, dbspi.SegmentConfig{Step: 3, PrefetchRatio: 1})
+
+	var got []uint64
+	for _, alloc := range []*SegmentAllocator{first, first, second, first, first} {
+		id, err := alloc.Next(ctx, "order")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] == got[i-1] {
+			t.Fatalf("duplicate id in %v", got)
+		}
+	}
+	if got[0] != 1 || got[1] != 2 || got[2] <= 3 || got[3] != 3 {
+		t.Fatalf("ids = %v", got)
+	}
+
+	row, err := segments.GetById(ctx, "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row == nil || row.MaxId%3 != 0 || row.MaxId < got[len(got)-1] {
+		t.Fatalf("segment row = %+v", row)
+	}
+	if _, err := first.Next(ctx, ""); err == nil {
+		t.Fatal("expected an empty business tag to be rejected")
+	}
+}
+
+func TestSegmentAllocatorKeepsStoredStep(t *testing.T) {
+	ctx := context.Background()
+	tx, segments := newSegmentTestTransaction()
+	if err := segments.Create(ctx, &dbspi.IdSegment{BizTag: "order_tab", MaxId: 100, Step: 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := NewSegmentAllocator(tx, dbspi.SegmentConfig{Step: 3, PrefetchRatio: 1}).NextId(ctx, "order_tab")
+	if err != nil || id != 101 {
+		t.Fatalf("id = %d, err = %v", id, err)
+	}
+	if row, err := segments.GetById(ctx, "order_tab"); err != nil || row.MaxId != 150 {
+		t.Fatalf("segment row = %+v, err = %v", row, err)
+	}
+}
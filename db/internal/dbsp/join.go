@@ -0,0 +1,354 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm/clause"
+)
+
+var _ dbspi.JoinQuery[struct{}] = (*gormJoinQuery[struct{}])(nil)
+
+// joinSession is implemented by sessions that can run multi-table queries.
+type joinSession interface {
+	FindJoin(ctx context.Context, dest any, stmt joinStatement, pagination dbspi.Pagination) error
+	CountJoin(ctx context.Context, stmt joinStatement) (uint64, error)
+}
+
+// joinStatement is a join query with every table resolved to its physical name.
+type joinStatement struct {
+	from    clause.Table
+	joins   []clause.Join
+	columns []clause.Column
+	where   clause.Expression
+}
+
+type joinedEntity struct {
+	joinType clause.JoinType
+	entity   dbspi.Entity
+	on       []dbspi.Condition
+}
+
+// gormJoinQuery implements dbspi.JoinQuery. Builder methods return a copy, so a
+// partially built query can be reused.
+type gormJoinQuery[R any] struct {
+	mgr     *Manager
+	from    dbspi.Entity
+	joins   []joinedEntity
+	columns []dbspi.Column
+	where   []dbspi.Condition
+	keys    map[string]*dbspi.ShardingKey
+	err     error
+}
+
+// NewJoinQuery creates a join query starting from entity on mgr.
+func NewJoinQuery[R any](from dbspi.Entity, mgr *Manager) dbspi.JoinQuery[R] {
+	if mgr == nil {
+		mgr = DefaultManager()
+	}
+	return &gormJoinQuery[R]{mgr: mgr, from: from}
+}
+
+// NewErrorJoinQuery returns a join query whose Find and Count fail with err.
+func NewErrorJoinQuery[R any](err error) dbspi.JoinQuery[R] {
+	return &gormJoinQuery[R]{err: err}
+}
+
+func (q *gormJoinQuery[R]) clone() *gormJoinQuery[R] {
+	c := *q
+	c.joins = append([]joinedEntity(nil), q.joins...)
+	c.columns = append([]dbspi.Column(nil), q.columns...)
+	c.where = append([]dbspi.Condition(nil), q.where...)
+	c.keys = make(map[string]*dbspi.ShardingKey, len(q.keys))
+	for k, v := range q.keys {
+		c.keys[k] = v
+	}
+	return &c
+}
+
+// InnerJoin implements dbspi.JoinQuery.
+func (q *gormJoinQuery[R]) InnerJoin(entity dbspi.Entity, on ...dbspi.Condition) dbspi.JoinQuery[R] {
+	return q.join(clause.InnerJoin, entity, on)
+}
+
+// LeftJoin implements dbspi.JoinQuery.
+func (q *gormJoinQuery[R]) LeftJoin(entity dbspi.Entity, on ...dbspi.Condition) dbspi.JoinQuery[R] {
+	return q.join(clause.LeftJoin, entity, on)
+}
+
+func (q *gormJoinQuery[R]) join(joinType clause.JoinType, entity dbspi.Entity, on []dbspi.Condition) dbspi.JoinQuery[R] {
+	c := q.clone()
+	c.joins = append(c.joins, joinedEntity{joinType: joinType, entity: entity, on: on})
+	return c
+}
+
+// Select implements dbspi.JoinQuery.
+func (q *gormJoinQuery[R]) Select(columns ...dbspi.Column) dbspi.JoinQuery[R] {
+	c := q.clone()
+	c.columns = columns
+	return c
+}
+
+// Where implements dbspi.JoinQuery.
+func (q *gormJoinQuery[R]) Where(conditions ...dbspi.Condition) dbspi.JoinQuery[R] {
+	c := q.clone()
+	c.where = append(c.where, conditions...)
+	return c
+}
+
+// Shard implements dbspi.JoinQuery.
+func (q *gormJoinQuery[R]) Shard(entity dbspi.Entity, key *dbspi.ShardingKey) dbspi.JoinQuery[R] {
+	c := q.clone()
+	if entity != nil {
+		c.keys[entity.TableName()] = key
+	}
+	return c
+}
+
+// Find implements dbspi.JoinQuery.
+func (q *gormJoinQuery[R]) Find(ctx context.Context, pagination dbspi.Pagination) ([]R, error) {
+	session, stmt, release, err := q.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var results []R
+	err = session.FindJoin(ctx, &results, stmt, pagination)
+	return results, err
+}
+
+// Count implements dbspi.JoinQuery.
+func (q *gormJoinQuery[R]) Count(ctx context.Context) (uint64, error) {
+	session, stmt, release, err := q.prepare(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return session.CountJoin(ctx, stmt)
+}
+
+// prepare resolves every entity to its physical database and table, checks
+// that they share one database, and builds the statement. release must be
+// called once the statement has run.
+func (q *gormJoinQuery[R]) prepare(ctx context.Context) (joinSession, joinStatement, func(), error) {
+	if q.err != nil {
+		return nil, joinStatement{}, nil, q.err
+	}
+	if q.from == nil {
+		return nil, joinStatement{}, nil, fmt.Errorf("dbhelper: join query has no base entity")
+	}
+
+	entities := make([]dbspi.Entity, 0, len(q.joins)+1)
+	entities = append(entities, q.from)
+	for _, j := range q.joins {
+		if j.entity == nil {
+			return nil, joinStatement{}, nil, fmt.Errorf("dbhelper: joined entity is nil")
+		}
+		entities = append(entities, j.entity)
+	}
+
+	var entries []*resolvedDbEntry
+	release := func() {
+		for _, entry := range entries {
+			entry.release()
+		}
+	}
+
+	targets := make([]joinTarget, len(entities))
+	aliases := make(map[string]bool, len(entities))
+	for i, entity := range entities {
+		alias := entity.TableName()
+		if aliases[alias] {
+			release()
+			return nil, joinStatement{}, nil, fmt.Errorf("dbhelper: table %q is joined more than once; self-joins are not supported", alias)
+		}
+		aliases[alias] = true
+
+		sk := q.keys[alias]
+		if sk == nil {
+			sk, _ = dbspi.ShardingKeyFromContext(ctx)
+		}
+		target, err := q.mgr.resolveJoinTarget(ctx, entity, sk)
+		if target.entry != nil {
+			entries = append(entries, target.entry)
+		}
+		if err != nil {
+			release()
+			return nil, joinStatement{}, nil, err
+		}
+		targets[i] = target
+	}
+
+	base := targets[0]
+	for _, t := range targets[1:] {
+		if t.entry != base.entry {
+			release()
+			return nil, joinStatement{}, nil, fmt.Errorf("dbhelper: join across database groups not allowed: %q uses %q, %q uses %q",
+				base.alias, base.groupKey, t.alias, t.groupKey)
+		}
+		if t.targetKey != base.targetKey {
+			release()
+			return nil, joinStatement{}, nil, fmt.Errorf("cross-shard join not allowed: %q routes to db %q, %q routes to db %q",
+				base.alias, base.targetKey, t.alias, t.targetKey)
+		}
+	}
+
+	session, ok := base.db.(joinSession)
+	if !ok {
+		release()
+		return nil, joinStatement{}, nil, fmt.Errorf("dbhelper: database session does not support joins")
+	}
+
+	// Every tenant-aware table is isolated to the tenant of ctx: the base
+	// table in WHERE, joined tables in their ON clause so left joins keep
+	// their outer rows.
+	tenants := q.mgr.CommonFieldAutoFillOptions().Normalize().TenantProvider
+	tenantConditions := make([]clause.Expression, len(entities))
+	for i, entity := range entities {
+		accessor, ok := entity.(dbspi.TenantAccessor)
+		if !ok {
+			continue
+		}
+		cond, err := tenantCondition(ctx, tenants, clause.Column{Table: targets[i].alias, Name: accessor.TenantFieldName()})
+		if err != nil {
+			release()
+			return nil, joinStatement{}, nil, fmt.Errorf("dbhelper: join of table %q: %w", targets[i].alias, err)
+		}
+		tenantConditions[i] = cond
+	}
+
+	where, err := scopeSubqueryTenants(ctx, tenants, NewQuery(q.where...))
+	if err != nil {
+		release()
+		return nil, joinStatement{}, nil, err
+	}
+	stmt := joinStatement{
+		from:  clause.Table{Name: base.table, Alias: base.alias},
+		where: andClause(queryToGormClause(where), tenantConditions[0]),
+	}
+	for i, j := range q.joins {
+		t := targets[i+1]
+		join := clause.Join{
+			Type:  j.joinType,
+			Table: clause.Table{Name: t.table, Alias: t.alias},
+		}
+		on, err := scopeSubqueryTenants(ctx, tenants, NewQuery(j.on...))
+		if err != nil {
+			release()
+			return nil, joinStatement{}, nil, err
+		}
+		onClause := queryToGormClause(on)
+		if onClause == nil {
+			release()
+			return nil, joinStatement{}, nil, fmt.Errorf("dbhelper: join of table %q requires an ON condition", t.alias)
+		}
+		join.ON = clause.Where{Exprs: []clause.Expression{andClause(onClause, tenantConditions[i+1])}}
+		stmt.joins = append(stmt.joins, join)
+	}
+	for _, col := range q.columns {
+		stmt.columns = append(stmt.columns, columnClause(col))
+	}
+	if len(stmt.columns) == 0 {
+		stmt.columns = []clause.Column{{Name: "*", Raw: true}}
+	}
+	return session, stmt, release, nil
+}
+
+// andClause joins the non-nil expressions with AND.
+func andClause(left, right clause.Expression) clause.Expression {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	default:
+		return clause.And(left, right)
+	}
+}
+
+// joinTarget is the physical location of one joined entity.
+type joinTarget struct {
+	alias     string
+	groupKey  string
+	entry     *resolvedDbEntry
+	targetKey string
+	db        dbSession
+	table     string
+}
+
+// resolveJoinTarget routes entity with sk the same way its table store would.
+// The returned entry is acquired and must be released by the caller, even when
+// an error is returned.
+func (m *Manager) resolveJoinTarget(ctx context.Context, entity dbspi.Entity, sk *dbspi.ShardingKey) (joinTarget, error) {
+	target := joinTarget{
+		alias:    entity.TableName(),
+		groupKey: dbspi.DefaultDatabaseGroupKey,
+	}
+	if provider, ok := entity.(dbspi.DatabaseGroupKeyProvider); ok {
+		target.groupKey = provider.DatabaseGroupKey()
+	}
+
+	entry, ok := m.acquireEntry(target.groupKey, dbspi.DefaultDatabaseGroupKey)
+	if !ok {
+		return target, fmt.Errorf("dbhelper: database config %q not found (and no %q fallback)", target.groupKey, dbspi.DefaultDatabaseGroupKey)
+	}
+	target.entry = entry
+
+	db, key, err := entry.resolveDb(ctx, sk)
+	if err != nil {
+		return target, fmt.Errorf("join table %q: %w", target.alias, err)
+	}
+	target.targetKey, target.db = key, db
+
+	target.table = target.alias
+	if tableRule, _ := entry.tableRuleFor(target.alias); tableRule != nil {
+		if sk == nil {
+			return target, fmt.Errorf("join table %q: %w", target.alias, dbspi.ErrShardingKeyRequired)
+		}
+		table, err := resolveTable(ctx, tableRule, target.alias, sk)
+		if err != nil {
+			return target, fmt.Errorf("join table %q: resolve table failed: %w", target.alias, err)
+		}
+		target.table = table
+	}
+	return target, nil
+}
+
+// ================== Join Columns ==================
+
+// QualifyField returns field bound to table, for use in join queries.
+func QualifyField[T any](table string, field dbspi.Field[T]) dbspi.Field[T] {
+	return &GormField[T]{Column: &GormColumn{name: field.Name(), table: table}}
+}
+
+// AliasColumn returns column selected under alias.
+func AliasColumn(column dbspi.Column, alias string) dbspi.Column {
+	return &GormColumn{name: column.Name(), table: columnTable(column), alias: alias}
+}
+
+// JoinOn creates a condition comparing two columns for equality.
+func JoinOn(left, right dbspi.Column) dbspi.Condition {
+	return newCondition(clause.Eq{Column: columnClause(left), Value: columnClause(right)})
+}
+
+type tableColumn interface {
+	Table() string
+}
+
+func columnTable(column dbspi.Column) string {
+	if tc, ok := column.(tableColumn); ok {
+		return tc.Table()
+	}
+	return ""
+}
+
+func columnClause(column dbspi.Column) clause.Column {
+	col := clause.Column{Name: column.Name(), Table: columnTable(column)}
+	if ac, ok := column.(interface{ Alias() string }); ok {
+		col.Alias = ac.Alias()
+	}
+	return col
+}
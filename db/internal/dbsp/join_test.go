@@ -0,0 +1,160 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type joinTestItem struct {
+	ID      int64  `gorm:"primaryKey"`
+	OrderID int64  `gorm:"column:order_id"`
+	ShopID  int64  `gorm:"column:shop_id"`
+	SKU     string `gorm:"column:sku"`
+}
+
+func (*joinTestItem) TableName() string        { return "order_item_tab" }
+func (*joinTestItem) DatabaseGroupKey() string { return "order" }
+
+type joinTestView struct {
+	OrderID int64  `gorm:"column:order_id"`
+	SKU     string `gorm:"column:sku"`
+}
+
+// newJoinTestManager returns a manager whose sessions run in DryRun mode and
+// report their SQL to capture.
+func newJoinTestManager(t *testing.T, cfg dbspi.DatabaseConfig) (*Manager, *capturingGormLogger) {
+	t.Helper()
+	capture := &capturingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	dial := func(server dbspi.ServerConfig) dbSession {
+		db, err := gorm.Open(mysql.New(mysql.Config{
+			DSN:                       dbServerDSN(server),
+			SkipInitializeWithVersion: true,
+		}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: capture})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &GormDb{db: db}
+	}
+	return NewManagerWithOptions(cfg, ManagerOptions{dial: dial}), capture
+}
+
+func shardedJoinTestConfig() dbspi.DatabaseConfig {
+	return dbspi.DatabaseConfig{
+		DatabaseGroups: map[string]dbspi.DatabaseGroupConfig{
+			"order": {
+				Host: "127.0.0.1",
+				Port: 3306,
+				DatabaseSharding: &dbspi.DatabaseShardingConfig{
+					NameExpr:    "order_db_${idx}",
+					ExpandExprs: []string{"${idx} := range(0, 2)", "${idx} = @{shop_id} % 2"},
+				},
+				TableSharding: &dbspi.TableShardingConfig{
+					NameExpr:    "${table}_${tidx}",
+					ExpandExprs: []string{"${tidx} := range(0, 4)", "${tidx} = @{shop_id} % 4"},
+				},
+			},
+		},
+	}
+}
+
+func TestJoinQueryBuildsQualifiedSQL(t *testing.T) {
+	mgr, capture := newJoinTestManager(t, shardedJoinTestConfig())
+	order, item := &reloadTestOrder{}, &joinTestItem{}
+	orderID := QualifyField(order.TableName(), NewField[int64]("id"))
+	itemOrderID := QualifyField(item.TableName(), NewField[int64]("order_id"))
+	shopID := int64(6)
+
+	ctx := dbspi.WithShardingKey(context.Background(), dbspi.NewShardingKey().SetValue("shop_id", shopID))
+	_, err := NewJoinQuery[joinTestView](order, mgr).
+		LeftJoin(item, JoinOn(orderID, itemOrderID)).
+		Select(AliasColumn(orderID, "order_id"), QualifyField(item.TableName(), NewField[string]("sku"))).
+		Where(QualifyField(order.TableName(), NewField[int64]("shop_id")).Eq(&shopID)).
+		Find(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"SELECT `order_tab`.`id` AS `order_id`,`order_item_tab`.`sku`",
+		"FROM `order_tab_2` `order_tab` LEFT JOIN `order_item_tab_2` `order_item_tab` ON `order_tab`.`id` = `order_item_tab`.`order_id`",
+		"WHERE `order_tab`.`shop_id` = ?",
+	} {
+		if !strings.Contains(capture.sql, want) {
+			t.Fatalf("expected SQL to contain %q, got %q", want, capture.sql)
+		}
+	}
+}
+
+func TestJoinQueryRejectsCrossShardJoin(t *testing.T) {
+	mgr, _ := newJoinTestManager(t, shardedJoinTestConfig())
+	order, item := &reloadTestOrder{}, &joinTestItem{}
+
+	_, err := NewJoinQuery[joinTestView](order, mgr).
+		InnerJoin(item, JoinOn(QualifyField(order.TableName(), NewField[int64]("id")), QualifyField(item.TableName(), NewField[int64]("order_id")))).
+		Shard(order, dbspi.NewShardingKey().SetValue("shop_id", 1)).
+		Shard(item, dbspi.NewShardingKey().SetValue("shop_id", 2)).
+		Count(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "cross-shard join not allowed") {
+		t.Fatalf("expected cross-shard error, got %v", err)
+	}
+
+	_, err = NewJoinQuery[joinTestView](order, mgr).
+		InnerJoin(item, JoinOn(QualifyField(order.TableName(), NewField[int64]("id")), QualifyField(item.TableName(), NewField[int64]("order_id")))).
+		Count(context.Background())
+	if !errors.Is(err, dbspi.ErrShardingKeyRequired) {
+		t.Fatalf("expected ErrShardingKeyRequired, got %v", err)
+	}
+}
+
+func TestJoinQueryRejectsCrossGroupJoin(t *testing.T) {
+	cfg := shardedJoinTestConfig()
+	cfg.DatabaseGroups[dbspi.DefaultDatabaseGroupKey] = dbspi.DatabaseGroupConfig{Host: "127.0.0.1", Port: 3306, DatabaseName: "main_db"}
+	mgr, _ := newJoinTestManager(t, cfg)
+
+	ctx := dbspi.WithShardingKey(context.Background(), dbspi.NewShardingKey().SetValue("shop_id", 1))
+	order, item := &testOrder{}, &joinTestItem{}
+	_, err := NewJoinQuery[joinTestView](order, mgr).
+		InnerJoin(item, JoinOn(QualifyField(order.TableName(), NewField[int64]("id")), QualifyField(item.TableName(), NewField[int64]("order_id")))).
+		Count(ctx)
+	if err == nil || !strings.Contains(err.Error(), "join across database groups") {
+		t.Fatalf("expected cross-group error, got %v", err)
+	}
+}
+
+type tenantJoinTestItem struct {
+	joinTestItem
+	dbspi.TenantField
+}
+
+func TestJoinQueryScopesTenantAwareTables(t *testing.T) {
+	mgr, capture := newJoinTestManager(t, shardedJoinTestConfig())
+	order, item := &reloadTestOrder{}, &tenantJoinTestItem{}
+	query := NewJoinQuery[joinTestView](order, mgr).
+		LeftJoin(item, JoinOn(QualifyField(order.TableName(), NewField[int64]("id")), QualifyField(item.TableName(), NewField[int64]("order_id"))))
+	ctx := dbspi.WithShardingKey(context.Background(), dbspi.NewShardingKey().SetValue("shop_id", 6))
+
+	if _, err := query.Find(dbspi.WithTenant(ctx, "a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "ON `order_tab`.`id` = `order_item_tab`.`order_id` AND `order_item_tab`.`tenant_id` = ?"
+	if !strings.Contains(capture.sql, want) {
+		t.Fatalf("expected SQL to contain %q, got %q", want, capture.sql)
+	}
+
+	if _, err := query.Count(ctx); !errors.Is(err, dbspi.ErrTenantRequired) {
+		t.Fatalf("join without tenant err = %v", err)
+	}
+	if _, err := query.Find(dbspi.WithAllTenants(ctx), nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(capture.sql, "tenant_id") {
+		t.Fatalf("expected no tenant condition for all tenants, got %q", capture.sql)
+	}
+}
@@ -0,0 +1,186 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+	"github.com/MrMiaoMIMI/goshared/util/idutil"
+)
+
+const (
+	maxSnowflakeMachineID = 1023
+	machineLeaseTagPrefix = "snowflake.machine."
+)
+
+// MachineLease is a snowflake machine id leased from
+// dbspi.DefaultIdSegmentTableName. It implements idutil.MachineLease.
+type MachineLease struct {
+	tx        SegmentTransaction
+	cfg       dbspi.MachineLeaseConfig
+	machineID int64
+
+	lost      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// LeaseSnowflakeMachineId leases a machine id that no other live process
+// holds, passes it to idutil.SetSnowflakeMachineID and renews the lease in
+// the background until Close. Each machine id has a row
+// "snowflake.machine.<id>" in dbspi.DefaultIdSegmentTableName; a lease that
+// was not renewed within TTL can be taken over by another process.
+func LeaseSnowflakeMachineId(ctx context.Context, tx SegmentTransaction, cfg dbspi.MachineLeaseConfig) (*MachineLease, error) {
+	if tx == nil {
+		return nil, fmt.Errorf("dbhelper: machine id lease requires a SegmentTransaction")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = dbspi.DefaultMachineLeaseConfig().TTL
+	}
+	if cfg.Owner == "" {
+		host, _ := os.Hostname()
+		cfg.Owner = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), idutil.ShortID(4))
+	}
+	lease := &MachineLease{
+		tx:   tx,
+		cfg:  cfg,
+		lost: make(chan struct{}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	start := rand.Int64N(maxSnowflakeMachineID + 1)
+	for i := int64(0); i <= maxSnowflakeMachineID; i++ {
+		machineID := (start + i) % (maxSnowflakeMachineID + 1)
+		ok, err := lease.claim(ctx, machineID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			lease.machineID = machineID
+			idutil.SetSnowflakeMachineID(machineID)
+			go lease.renewLoop()
+			return lease, nil
+		}
+	}
+	return nil, dbspi.ErrMachineIdUnavailable
+}
+
+// MachineID returns the leased machine id.
+func (l *MachineLease) MachineID() int64 {
+	return l.machineID
+}
+
+// Lost is closed when the lease could not be renewed before it expired or
+// was taken over by another owner.
+func (l *MachineLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Close stops renewing the lease and releases the machine id.
+func (l *MachineLease) Close(ctx context.Context) error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+		err = l.tx(ctx, func(store dbspi.TableStore[*dbspi.IdSegment]) error {
+			row, err := l.lockRow(ctx, store, l.machineID)
+			if err != nil || row == nil || row.Owner != l.cfg.Owner {
+				return err
+			}
+			row.LeaseUntil = 0
+			return store.Save(ctx, row)
+		})
+	})
+	return err
+}
+
+// claim takes machineID if its lease is free, expired or already ours.
+func (l *MachineLease) claim(ctx context.Context, machineID int64) (bool, error) {
+	claimed := false
+	created := false
+	err := l.tx(ctx, func(store dbspi.TableStore[*dbspi.IdSegment]) error {
+		row, err := l.lockRow(ctx, store, machineID)
+		if err != nil {
+			return err
+		}
+		now := uint64(time.Now().UnixMilli())
+		if row == nil {
+			created = true
+			row = &dbspi.IdSegment{BizTag: machineLeaseTag(machineID)}
+		} else if row.Owner != l.cfg.Owner && row.LeaseUntil > now {
+			return nil
+		}
+		row.Owner = l.cfg.Owner
+		row.LeaseUntil = now + uint64(l.cfg.TTL.Milliseconds())
+		if created {
+			err = store.Create(ctx, row)
+		} else {
+			err = store.Save(ctx, row)
+		}
+		claimed = err == nil
+		return err
+	})
+	// Another process created the row first; try the next machine id.
+	if err != nil && created {
+		return false, nil
+	}
+	return claimed, err
+}
+
+// renewLoop extends the lease every TTL/3 and closes lost once the lease has
+// expired without a successful renewal or has another owner.
+func (l *MachineLease) renewLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.cfg.TTL / 3)
+	defer ticker.Stop()
+	expiry := time.Now().Add(l.cfg.TTL)
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.cfg.TTL/3)
+		renewedAt := time.Now()
+		owned, err := l.renew(ctx)
+		cancel()
+		switch {
+		case err == nil && owned:
+			expiry = renewedAt.Add(l.cfg.TTL)
+		case err == nil || time.Now().After(expiry):
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// renew extends the lease and reports whether it is still ours.
+func (l *MachineLease) renew(ctx context.Context) (bool, error) {
+	owned := false
+	err := l.tx(ctx, func(store dbspi.TableStore[*dbspi.IdSegment]) error {
+		row, err := l.lockRow(ctx, store, l.machineID)
+		if err != nil || row == nil || row.Owner != l.cfg.Owner {
+			return err
+		}
+		owned = true
+		row.LeaseUntil = uint64(time.Now().Add(l.cfg.TTL).UnixMilli())
+		return store.Save(ctx, row)
+	})
+	return owned, err
+}
+
+// lockRow reads the lease row of machineID, which the SegmentTransaction
+// store locks until the transaction ends.
+func (l *MachineLease) lockRow(ctx context.Context, store dbspi.TableStore[*dbspi.IdSegment], machineID int64) (*dbspi.IdSegment, error) {
+	return store.GetById(ctx, machineLeaseTag(machineID))
+}
+
+func machineLeaseTag(machineID int64) string {
+	return fmt.Sprintf("%s%d", machineLeaseTagPrefix, machineID)
+}
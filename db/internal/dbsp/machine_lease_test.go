@@ -0,0 +1,52 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+func TestLeaseSnowflakeMachineIdGivesDistinctIds(t *testing.T) {
+	ctx := context.Background()
+	tx, segments := newSegmentTestTransaction()
+
+	first, err := LeaseSnowflakeMachineId(ctx, tx, dbspi.MachineLeaseConfig{Owner: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LeaseSnowflakeMachineId(ctx, tx, dbspi.MachineLeaseConfig{Owner: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.MachineID() == second.MachineID() {
+		t.Fatalf("both leases got machine id %d", first.MachineID())
+	}
+	if err := first.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	row, err := segments.GetById(ctx, machineLeaseTag(first.MachineID()))
+	if err != nil || row == nil || row.Owner != "a" || row.LeaseUntil != 0 {
+		t.Fatalf("released lease row = %+v, err = %v", row, err)
+	}
+}
+
+func TestLeaseSnowflakeMachineIdFailsWhenAllIdsAreLeased(t *testing.T) {
+	ctx := context.Background()
+	tx, segments := newSegmentTestTransaction()
+	until := uint64(time.Now().Add(time.Hour).UnixMilli())
+	for machineID := int64(0); machineID <= maxSnowflakeMachineID; machineID++ {
+		if err := segments.Create(ctx, &dbspi.IdSegment{BizTag: machineLeaseTag(machineID), Owner: "other", LeaseUntil: until}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := LeaseSnowflakeMachineId(ctx, tx, dbspi.MachineLeaseConfig{Owner: "a"}); !errors.Is(err, dbspi.ErrMachineIdUnavailable) {
+		t.Fatalf("lease err = %v", err)
+	}
+}
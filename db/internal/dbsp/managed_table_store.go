@@ -0,0 +1,485 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+var (
+	_ dbspi.SoftDeleteTableStore[_tableForCheck] = (*managedTableStore[_tableForCheck])(nil)
+	_ dbspi.SQLTableStore[_tableForCheck]        = (*managedTableStore[_tableForCheck])(nil)
+)
+
+// managedTableStore resolves its database group from the Manager on every
+// call, so table stores created before Manager.Reload follow the new config.
+// The underlying store is rebuilt only when the group's entry changes.
+type managedTableStore[T dbspi.Entity] struct {
+	mgr          *Manager
+	entity       T
+	groupKey     string
+	commonFields CommonFieldAutoFillOptions
+	current      atomic.Pointer[managedStoreSnapshot[T]]
+
+	// narrow, when set, picks a shard or routed store out of the group's
+	// store. It runs on every call, so stores returned by Shard and
+	// routeChange keep their entry acquired while they are in use.
+	narrow func(dbspi.TableStore[T]) (dbspi.TableStore[T], error)
+}
+
+type managedStoreSnapshot[T dbspi.Entity] struct {
+	entry *resolvedDbEntry
+	store dbspi.TableStore[T]
+}
+
+func newManagedTableStore[T dbspi.Entity](entity T, mgr *Manager, groupKey string, commonFields CommonFieldAutoFillOptions, entry *resolvedDbEntry, store dbspi.TableStore[T]) *managedTableStore[T] {
+	managed := &managedTableStore[T]{
+		mgr:          mgr,
+		entity:       entity,
+		groupKey:     groupKey,
+		commonFields: commonFields,
+	}
+	managed.current.Store(&managedStoreSnapshot[T]{entry: entry, store: store})
+	return managed
+}
+
+// acquire returns the store for the manager's current config. The caller must
+// call release once the operation has finished.
+func (s *managedTableStore[T]) acquire() (dbspi.TableStore[T], func(), error) {
+	entry, ok := s.mgr.acquireEntry(s.groupKey, dbspi.DefaultDatabaseGroupKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("dbhelper: database config %q not found (and no %q fallback)", s.groupKey, dbspi.DefaultDatabaseGroupKey)
+	}
+	snapshot := s.current.Load()
+	if snapshot.entry != entry {
+		snapshot = &managedStoreSnapshot[T]{entry: entry, store: newEntryTableStore(s.entity, entry, s.commonFields)}
+		s.current.Store(snapshot)
+	}
+	if s.narrow == nil {
+		return snapshot.store, entry.release, nil
+	}
+	store, err := s.narrow(snapshot.store)
+	if err != nil {
+		entry.release()
+		return nil, nil, err
+	}
+	return store, entry.release, nil
+}
+
+// narrowed returns a store that applies narrow on top of s on every call.
+func (s *managedTableStore[T]) narrowed(narrow func(dbspi.TableStore[T]) (dbspi.TableStore[T], error)) *managedTableStore[T] {
+	if outer := s.narrow; outer != nil {
+		inner := narrow
+		narrow = func(store dbspi.TableStore[T]) (dbspi.TableStore[T], error) {
+			store, err := outer(store)
+			if err != nil {
+				return nil, err
+			}
+			return inner(store)
+		}
+	}
+	managed := &managedTableStore[T]{
+		mgr:          s.mgr,
+		entity:       s.entity,
+		groupKey:     s.groupKey,
+		commonFields: s.commonFields,
+		narrow:       narrow,
+	}
+	managed.current.Store(s.current.Load())
+	return managed
+}
+
+func (s *managedTableStore[T]) acquireSoftDelete() (dbspi.SoftDeleteTableStore[T], func(), error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+	softDeleteStore, err := toSoftDeleteTableStore(store)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return softDeleteStore, release, nil
+}
+
+func (s *managedTableStore[T]) acquireSQL() (dbspi.SQLTableStore[T], func(), error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlStore, err := toSQLTableStore(store)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return sqlStore, release, nil
+}
+
+// Shard returns a store that resolves key against the current config on every
+// call. The key is resolved once up front so that invalid keys fail here.
+func (s *managedTableStore[T]) Shard(key *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return NewErrorTableStore[T](err), err
+	}
+	shard, err := store.Shard(key)
+	release()
+	if err != nil {
+		return shard, err
+	}
+	return s.narrowed(func(store dbspi.TableStore[T]) (dbspi.TableStore[T], error) {
+		return store.Shard(key)
+	}), nil
+}
+
+func (s *managedTableStore[T]) GetById(ctx context.Context, id any) (T, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer release()
+	return store.GetById(ctx, id)
+}
+
+func (s *managedTableStore[T]) ExistsById(ctx context.Context, id any) (bool, T, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	defer release()
+	return store.ExistsById(ctx, id)
+}
+
+func (s *managedTableStore[T]) UpdateById(ctx context.Context, id any, updater dbspi.Updater) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.UpdateById(ctx, id, updater)
+}
+
+func (s *managedTableStore[T]) DeleteById(ctx context.Context, id any) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.DeleteById(ctx, id)
+}
+
+func (s *managedTableStore[T]) Find(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return store.Find(ctx, query, pagination)
+}
+
+func (s *managedTableStore[T]) Exists(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	defer release()
+	return store.Exists(ctx, query)
+}
+
+func (s *managedTableStore[T]) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return store.Count(ctx, query)
+}
+
+func (s *managedTableStore[T]) Create(ctx context.Context, entity T) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.Create(ctx, entity)
+}
+
+func (s *managedTableStore[T]) Save(ctx context.Context, entity T) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.Save(ctx, entity)
+}
+
+func (s *managedTableStore[T]) Update(ctx context.Context, entity T) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.Update(ctx, entity)
+}
+
+func (s *managedTableStore[T]) Delete(ctx context.Context, entity T) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.Delete(ctx, entity)
+}
+
+func (s *managedTableStore[T]) BatchCreate(ctx context.Context, entities []T, batchSize int) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.BatchCreate(ctx, entities, batchSize)
+}
+
+func (s *managedTableStore[T]) BatchSave(ctx context.Context, entities []T) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.BatchSave(ctx, entities)
+}
+
+func (s *managedTableStore[T]) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.UpdateByQuery(ctx, query, updater)
+}
+
+func (s *managedTableStore[T]) DeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.DeleteByQuery(ctx, query)
+}
+
+func (s *managedTableStore[T]) FirstOrCreate(ctx context.Context, entity T, query dbspi.Query) (T, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer release()
+	return store.FirstOrCreate(ctx, entity, query)
+}
+
+func (s *managedTableStore[T]) Upsert(ctx context.Context, entity T, conflictColumns []dbspi.Column, updater dbspi.Updater) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.Upsert(ctx, entity, conflictColumns, updater)
+}
+
+func (s *managedTableStore[T]) BatchUpsert(ctx context.Context, entities []T, conflictColumns []dbspi.Column, updater dbspi.Updater, batchSize int) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.BatchUpsert(ctx, entities, conflictColumns, updater, batchSize)
+}
+
+func (s *managedTableStore[T]) FindAll(ctx context.Context, query dbspi.Query, batchSize int) ([]T, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return store.FindAll(ctx, query, batchSize)
+}
+
+func (s *managedTableStore[T]) CountAll(ctx context.Context, query dbspi.Query) (uint64, error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return store.CountAll(ctx, query)
+}
+
+// Raw implements dbspi.SQLTableStore.
+func (s *managedTableStore[T]) Raw(ctx context.Context, sql string, args ...any) ([]T, error) {
+	store, release, err := s.acquireSQL()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return store.Raw(ctx, sql, args...)
+}
+
+// routeChange implements changeRouter. Like Shard, the returned store routes
+// again on every call instead of holding on to the current entry.
+func (s *managedTableStore[T]) routeChange(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error) {
+	store, release, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	_, err = routeChange(ctx, store, entity, id, query)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	return s.narrowed(func(store dbspi.TableStore[T]) (dbspi.TableStore[T], error) {
+		return routeChange(ctx, store, entity, id, query)
+	}), nil
+}
+
+// changeTarget reports the physical table of a store returned by routeChange.
+func (s *managedTableStore[T]) changeTarget() dbspi.ChangeTarget {
+	store, release, err := s.acquire()
+	if err != nil {
+		return dbspi.ChangeTarget{Table: s.entity.TableName()}
+	}
+	defer release()
+	if provider, ok := store.(changeTargeter); ok {
+		return provider.changeTarget()
+	}
+	return dbspi.ChangeTarget{Table: s.entity.TableName()}
+}
+
+// withAuditStore implements auditLogger.
+func (s *managedTableStore[T]) withAuditStore(fn func(*GormTableStore[*dbspi.AuditRecord]) error) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	provider, ok := store.(auditLogger)
+	if !ok {
+		return fmt.Errorf("dbhelper: audit log requires a database-backed table store, got %T", store)
+	}
+	return provider.withAuditStore(fn)
+}
+
+// RawScan implements rawScanner.
+func (s *managedTableStore[T]) RawScan(ctx context.Context, dest any, sql string, args ...any) error {
+	store, release, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	defer release()
+	scanner, err := toRawScanner(store)
+	if err != nil {
+		return err
+	}
+	return scanner.RawScan(ctx, dest, sql, args...)
+}
+
+// unwrap implements tableStoreWrapper. The store stays usable until release
+// is called, even across a Manager reload.
+func (s *managedTableStore[T]) unwrap() (dbspi.TableStore[T], func(), error) {
+	return s.acquire()
+}
+
+// Exec implements dbspi.SQLTableStore.
+func (s *managedTableStore[T]) Exec(ctx context.Context, sql string, args ...any) error {
+	store, release, err := s.acquireSQL()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.Exec(ctx, sql, args...)
+}
+
+// SoftDeleteById implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) SoftDeleteById(ctx context.Context, id any) error {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.SoftDeleteById(ctx, id)
+}
+
+// SoftDeleteByQuery implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) SoftDeleteByQuery(ctx context.Context, query dbspi.Query) error {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.SoftDeleteByQuery(ctx, query)
+}
+
+// RestoreById implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) RestoreById(ctx context.Context, id any) error {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.RestoreById(ctx, id)
+}
+
+// RestoreByQuery implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) RestoreByQuery(ctx context.Context, query dbspi.Query) error {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.RestoreByQuery(ctx, query)
+}
+
+// FindNotDeleted implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) FindNotDeleted(ctx context.Context, query dbspi.Query, pagination dbspi.Pagination) ([]T, error) {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return store.FindNotDeleted(ctx, query, pagination)
+}
+
+// CountNotDeleted implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) CountNotDeleted(ctx context.Context, query dbspi.Query) (uint64, error) {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return store.CountNotDeleted(ctx, query)
+}
+
+// ExistsByIdNotDeleted implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) ExistsByIdNotDeleted(ctx context.Context, id any) (bool, T, error) {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	defer release()
+	return store.ExistsByIdNotDeleted(ctx, id)
+}
+
+// ExistsNotDeleted implements dbspi.SoftDeleteTableStore.
+func (s *managedTableStore[T]) ExistsNotDeleted(ctx context.Context, query dbspi.Query) (bool, T, error) {
+	store, release, err := s.acquireSoftDelete()
+	if err != nil {
+		var zero T
+		return false, zero, err
+	}
+	defer release()
+	return store.ExistsNotDeleted(ctx, query)
+}
@@ -0,0 +1,130 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// pinger is implemented by sessions that can verify their connection.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// poolStatsProvider is implemented by sessions backed by a connection pool.
+type poolStatsProvider interface {
+	PoolStats() (dbspi.PoolStats, error)
+}
+
+type groupTarget struct {
+	groupKey string
+	target   DatabaseTarget
+}
+
+// CheckHealth pings every database target concurrently, each bounded by
+// timeout. A non-positive timeout uses dbspi.DefaultHealthCheckTimeoutSeconds.
+func (m *Manager) CheckHealth(ctx context.Context, timeout time.Duration) dbspi.HealthReport {
+	if timeout <= 0 {
+		timeout = dbspi.DefaultHealthCheckTimeoutSeconds * time.Second
+	}
+	targets, release := m.acquireTargets()
+	defer release()
+
+	results := make([]dbspi.TargetHealth, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = pingTarget(ctx, t, timeout)
+		}()
+	}
+	wg.Wait()
+	return dbspi.HealthReport{Targets: results}
+}
+
+// PoolStats returns a connection pool snapshot for every database target.
+// Targets whose session is not backed by a pool are skipped.
+func (m *Manager) PoolStats() []dbspi.PoolStats {
+	targets, release := m.acquireTargets()
+	defer release()
+
+	stats := make([]dbspi.PoolStats, 0, len(targets))
+	for _, t := range targets {
+		provider, ok := t.target.Db.(poolStatsProvider)
+		if !ok {
+			continue
+		}
+		s, err := provider.PoolStats()
+		if err != nil {
+			continue
+		}
+		s.DatabaseGroupKey = t.groupKey
+		s.TargetKey = t.target.Key
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// acquireTargets lists the targets of all groups in group order and keeps
+// their entries in use until release is called.
+func (m *Manager) acquireTargets() ([]groupTarget, func()) {
+	m.mu.RLock()
+	groupKeys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		groupKeys = append(groupKeys, key)
+	}
+	sort.Strings(groupKeys)
+
+	var targets []groupTarget
+	entries := make([]*resolvedDbEntry, 0, len(groupKeys))
+	for _, key := range groupKeys {
+		entry, _ := m.acquireEntryLocked(key)
+		entries = append(entries, entry)
+		for _, target := range entryTargets(entry) {
+			targets = append(targets, groupTarget{groupKey: key, target: target})
+		}
+	}
+	m.mu.RUnlock()
+
+	return targets, func() {
+		for _, entry := range entries {
+			entry.release()
+		}
+	}
+}
+
+func entryTargets(entry *resolvedDbEntry) []DatabaseTarget {
+	if len(entry.dbs) > 0 {
+		return entry.dbs
+	}
+	if entry.db != nil {
+		return SingleDb(entry.db)
+	}
+	return nil
+}
+
+func pingTarget(ctx context.Context, t groupTarget, timeout time.Duration) dbspi.TargetHealth {
+	health := dbspi.TargetHealth{
+		DatabaseGroupKey: t.groupKey,
+		TargetKey:        t.target.Key,
+	}
+	if guarded, ok := t.target.Db.(*guardedSession); ok {
+		health.Circuit = guarded.CircuitState()
+	}
+	p, ok := t.target.Db.(pinger)
+	if !ok {
+		health.Err = fmt.Errorf("dbhelper: database target %s/%s does not support ping", t.groupKey, t.target.Key)
+		return health
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	health.Err = p.Ping(ctx)
+	health.Latency = time.Since(start)
+	return health
+}
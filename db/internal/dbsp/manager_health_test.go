@@ -0,0 +1,105 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func (s *fakeSession) Ping(context.Context) error {
+	return s.pingErr
+}
+
+func (s *fakeSession) PoolStats() (dbspi.PoolStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return dbspi.PoolStats{MaxOpenConnections: s.maxOpenConns}, nil
+}
+
+func TestManagerCheckHealth(t *testing.T) {
+	mgr, _ := newReloadTestManager(t, reloadTestConfig("order_db"))
+	mgr.entries["order"].db.(*fakeSession).pingErr = errors.New("connection refused")
+
+	report := mgr.CheckHealth(context.Background(), time.Second)
+	if report.Healthy() {
+		t.Fatal("expected unhealthy report")
+	}
+	if len(report.Targets) != 2 {
+		t.Fatalf("expected 2 targets, got %d", len(report.Targets))
+	}
+	if got := report.Targets[0]; got.DatabaseGroupKey != dbspi.DefaultDatabaseGroupKey || !got.Healthy() {
+		t.Fatalf("expected healthy default target, got %+v", got)
+	}
+	if got := report.Targets[1]; got.DatabaseGroupKey != "order" || got.TargetKey != "0" || got.Healthy() {
+		t.Fatalf("expected unhealthy order target, got %+v", got)
+	}
+	if mgr.entries["order"].inFlight != 0 {
+		t.Fatal("expected health check to release entries")
+	}
+}
+
+func TestManagerPoolStats(t *testing.T) {
+	cfg := reloadTestConfig("order_db")
+	order := cfg.DatabaseGroups["order"]
+	order.MaxOpenConns = 5
+	cfg.DatabaseGroups["order"] = order
+	mgr, _ := newReloadTestManager(t, cfg)
+
+	stats := mgr.PoolStats()
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 pool stats, got %d", len(stats))
+	}
+	if stats[1].DatabaseGroupKey != "order" || stats[1].MaxOpenConnections != 5 {
+		t.Fatalf("expected order pool with 5 max open conns, got %+v", stats[1])
+	}
+	if stats[0].MaxOpenConnections != dbspi.DefaultMaxOpenConns {
+		t.Fatalf("expected default max open conns, got %+v", stats[0])
+	}
+}
+
+type recordingMetrics struct {
+	mu  sync.Mutex
+	obs []dbspi.QueryObservation
+}
+
+func (r *recordingMetrics) ObserveQuery(_ context.Context, obs dbspi.QueryObservation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.obs = append(r.obs, obs)
+}
+
+func TestGormDbInstrumentMetrics(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/order_db",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDb := &GormDb{db: db}
+	metrics := &recordingMetrics{}
+	server := dbspi.ServerConfig{DatabaseName: "order_db"}
+	if err := gormDb.InstrumentMetrics(metrics, "order", server); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewTableStoreWithCommonFieldAutoFill(gormDb, &testOrder{}, DefaultCommonFieldAutoFillOptions())
+	if _, err := store.Find(context.Background(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics.obs) != 1 {
+		t.Fatalf("expected 1 observation, got %d", len(metrics.obs))
+	}
+	obs := metrics.obs[0]
+	if obs.DatabaseGroupKey != "order" || obs.Database != "order_db" || obs.Table != "order_tab" || obs.Operation != "query" {
+		t.Fatalf("unexpected observation: %+v", obs)
+	}
+}
@@ -0,0 +1,249 @@
+package dbsp
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// reloadDrainPollInterval is how often a retired entry is checked for
+// in-flight operations while draining.
+const reloadDrainPollInterval = 50 * time.Millisecond
+
+// dbDialer opens a database session for one server.
+type dbDialer func(server dbspi.ServerConfig) dbSession
+
+// metricsInstrumenter is implemented by sessions that can report statements to
+// a dbspi.MetricsRecorder.
+type metricsInstrumenter interface {
+	InstrumentMetrics(recorder dbspi.MetricsRecorder, groupKey string, server dbspi.ServerConfig) error
+}
+
+// logLabeler is implemented by sessions whose statement logs can name the
+// database group they serve.
+type logLabeler interface {
+	LabelLogs(groupKey string)
+}
+
+// poolConfigurer is implemented by sessions whose pool limits can be changed
+// without reconnecting.
+type poolConfigurer interface {
+	ConfigurePool(cfg dbspi.ServerConfig) error
+}
+
+// Reload applies cfg to the manager without restarting the process.
+//
+// Database groups whose config is unchanged keep their routing and
+// connections. Changed and new groups are resolved again; servers that stay
+// the same within a group keep their connection pool with updated pool
+// limits. The routing table is swapped atomically: operations started after
+// Reload returns use the new config, while in-flight operations and
+// transactions finish on the connections they started with. Connections that
+// are no longer referenced are closed in the background once those operations
+// drain or ReloadDrainTimeout elapses.
+//
+// On error the manager keeps its current config.
+func (m *Manager) Reload(cfg dbspi.DatabaseConfig) (err error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	// conns and entries are only written under reloadMu, so the snapshot
+	// below stays current until the swap.
+	m.mu.RLock()
+	current, conns := m.entries, m.conns
+	m.mu.RUnlock()
+	if conns == nil {
+		return fmt.Errorf("dbhelper: transaction-scoped manager cannot be reloaded")
+	}
+
+	pool := newConnectionPool(m.opts.dial, m.opts.Metrics, conns)
+	defer func() {
+		if r := recover(); r != nil {
+			pool.closeDialed()
+			err = fmt.Errorf("dbhelper: reload database config: %v", r)
+		}
+	}()
+
+	entries := make(map[string]*resolvedDbEntry, len(cfg.DatabaseGroups))
+	for name, group := range cfg.DatabaseGroups {
+		if old, ok := current[name]; ok && reflect.DeepEqual(old.cfg, group) {
+			entries[name] = old
+			pool.keep(name)
+			continue
+		}
+		entries[name] = resolveDbEntry(name, group, m.opts, pool.dialer(name))
+	}
+
+	var retired []*resolvedDbEntry
+	for name, old := range current {
+		if entries[name] != old {
+			retired = append(retired, old)
+		}
+	}
+	stale := pool.stale()
+
+	m.mu.Lock()
+	m.entries = entries
+	m.conns = pool.opened
+	m.mu.Unlock()
+
+	if len(stale) > 0 {
+		timeout := m.opts.ReloadDrainTimeout
+		if timeout <= 0 {
+			timeout = dbspi.DefaultReloadDrainTimeoutSeconds * time.Second
+		}
+		go drainAndClose(retired, stale, timeout)
+	}
+	return nil
+}
+
+// reloadable reports whether the manager was built from config, as opposed to
+// a transaction-scoped manager.
+func (m *Manager) reloadable() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.conns != nil
+}
+
+// acquireEntry returns the entry for the first key that exists and marks it in
+// use until release is called, so that Reload does not close its connections
+// underneath the caller.
+func (m *Manager) acquireEntry(keys ...string) (*resolvedDbEntry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.acquireEntryLocked(keys...)
+}
+
+// acquireEntryLocked is acquireEntry for callers that hold m.mu.
+func (m *Manager) acquireEntryLocked(keys ...string) (*resolvedDbEntry, bool) {
+	for _, key := range keys {
+		if entry, ok := m.entries[key]; ok {
+			atomic.AddInt64(&entry.inFlight, 1)
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+func (e *resolvedDbEntry) release() {
+	atomic.AddInt64(&e.inFlight, -1)
+}
+
+func drainAndClose(retired []*resolvedDbEntry, stale []dbSession, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for _, entry := range retired {
+		for atomic.LoadInt64(&entry.inFlight) > 0 && time.Now().Before(deadline) {
+			time.Sleep(reloadDrainPollInterval)
+		}
+	}
+	for _, db := range stale {
+		if closer, ok := db.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+}
+
+// ================== Connection Pool ==================
+
+// connectionPool tracks the sessions opened for each database group, keyed by
+// server connection identity, so that a reload can reuse unchanged servers.
+type connectionPool struct {
+	dial     dbDialer
+	metrics  dbspi.MetricsRecorder
+	previous map[string]map[string]dbSession
+	opened   map[string]map[string]dbSession
+}
+
+func newConnectionPool(dial dbDialer, metrics dbspi.MetricsRecorder, previous map[string]map[string]dbSession) *connectionPool {
+	return &connectionPool{
+		dial:     dial,
+		metrics:  metrics,
+		previous: previous,
+		opened:   make(map[string]map[string]dbSession),
+	}
+}
+
+// dialer returns a dbDialer for one database group. It reuses the group's
+// previous session for the same server and opens new sessions otherwise.
+func (p *connectionPool) dialer(group string) dbDialer {
+	return func(server dbspi.ServerConfig) dbSession {
+		server = normalizeServerConfig(server)
+		key := connectionKey(server)
+		if db, ok := p.opened[group][key]; ok {
+			return db
+		}
+		if db, ok := p.previous[group][key]; ok {
+			p.record(group, key, db)
+			if configurer, isConfigurer := db.(poolConfigurer); isConfigurer {
+				if err := configurer.ConfigurePool(server); err != nil {
+					panic(err)
+				}
+			}
+			return db
+		}
+		db := p.dial(server)
+		p.record(group, key, db)
+		if labeler, ok := db.(logLabeler); ok {
+			labeler.LabelLogs(group)
+		}
+		if instrumenter, ok := db.(metricsInstrumenter); ok && p.metrics != nil {
+			if err := instrumenter.InstrumentMetrics(p.metrics, group, server); err != nil {
+				panic(err)
+			}
+		}
+		return db
+	}
+}
+
+// keep carries all previous sessions of an unchanged group over.
+func (p *connectionPool) keep(group string) {
+	for key, db := range p.previous[group] {
+		p.record(group, key, db)
+	}
+}
+
+func (p *connectionPool) record(group, key string, db dbSession) {
+	if p.opened[group] == nil {
+		p.opened[group] = make(map[string]dbSession)
+	}
+	p.opened[group][key] = db
+}
+
+// stale returns previous sessions that are no longer used.
+func (p *connectionPool) stale() []dbSession {
+	var stale []dbSession
+	for group, conns := range p.previous {
+		for key, db := range conns {
+			if p.opened[group][key] != db {
+				stale = append(stale, db)
+			}
+		}
+	}
+	return stale
+}
+
+// closeDialed closes sessions opened by this pool that were not carried over
+// from the previous config. It is used to roll back a failed reload.
+func (p *connectionPool) closeDialed() {
+	for group, conns := range p.opened {
+		for key, db := range conns {
+			if p.previous[group][key] == db {
+				continue
+			}
+			if closer, ok := db.(io.Closer); ok {
+				_ = closer.Close()
+			}
+		}
+	}
+}
+
+// connectionKey identifies a server connection. Pool limits are excluded
+// because they can be changed on a live pool; logger settings are included
+// because the logger is fixed when the connection is opened.
+func connectionKey(server dbspi.ServerConfig) string {
+	return fmt.Sprintf("%s|debug=%t|slow_ms=%d", dbServerDSN(server), server.Debug, server.SlowQueryThresholdMillis)
+}
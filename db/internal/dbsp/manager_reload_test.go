@@ -0,0 +1,372 @@
+package dbsp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// fakeSession is a dbSession that records pool changes and Close calls
+// without talking to a database.
+type fakeSession struct {
+	mu           sync.Mutex
+	server       dbspi.ServerConfig
+	maxOpenConns int
+	closed       bool
+	pingErr      error
+	creates      int
+}
+
+func (s *fakeSession) WithModel(any) dbSession        { return s }
+func (s *fakeSession) WithTableName(string) dbSession { return s }
+func (s *fakeSession) Find(context.Context, any, dbspi.Query, dbspi.Pagination) error {
+	return nil
+}
+func (s *fakeSession) Count(context.Context, dbspi.Query) (uint64, error) { return 0, nil }
+func (s *fakeSession) Create(context.Context, dbspi.Entity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creates++
+	return nil
+}
+func (s *fakeSession) Save(context.Context, dbspi.Entity) error       { return nil }
+func (s *fakeSession) Update(context.Context, dbspi.Entity) error     { return nil }
+func (s *fakeSession) Delete(context.Context, dbspi.Entity) error     { return nil }
+func (s *fakeSession) BatchCreate(context.Context, any, int) error    { return nil }
+func (s *fakeSession) BatchSave(context.Context, any) error           { return nil }
+func (s *fakeSession) Raw(context.Context, any, string, ...any) error { return nil }
+func (s *fakeSession) Exec(context.Context, string, ...any) error     { return nil }
+func (s *fakeSession) DeleteByQuery(context.Context, dbspi.Entity, dbspi.Query) error {
+	return nil
+}
+func (s *fakeSession) UpdateByQuery(context.Context, dbspi.Query, dbspi.Updater) error {
+	return nil
+}
+func (s *fakeSession) FirstOrCreate(context.Context, dbspi.Entity, dbspi.Query) error {
+	return nil
+}
+func (s *fakeSession) Upsert(context.Context, any, upsertSpec, int) error {
+	return nil
+}
+func (s *fakeSession) Transaction(_ context.Context, fn transactionFunc) error {
+	return fn(s)
+}
+
+func (s *fakeSession) ConfigurePool(cfg dbspi.ServerConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxOpenConns = cfg.MaxOpenConns
+	return nil
+}
+
+func (s *fakeSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSession) createCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.creates
+}
+
+func (s *fakeSession) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+type fakeDialer struct {
+	mu       sync.Mutex
+	sessions []*fakeSession
+}
+
+func (d *fakeDialer) dial(server dbspi.ServerConfig) dbSession {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	session := &fakeSession{server: server, maxOpenConns: server.MaxOpenConns}
+	d.sessions = append(d.sessions, session)
+	return session
+}
+
+func (d *fakeDialer) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.sessions)
+}
+
+type reloadTestOrder struct {
+	testOrder
+}
+
+func (*reloadTestOrder) DatabaseGroupKey() string { return "order" }
+
+func newReloadTestManager(t *testing.T, cfg dbspi.DatabaseConfig) (*Manager, *fakeDialer) {
+	t.Helper()
+	dialer := &fakeDialer{}
+	mgr := NewManagerWithOptions(cfg, ManagerOptions{
+		ReloadDrainTimeout: time.Second,
+		dial:               dialer.dial,
+	})
+	return mgr, dialer
+}
+
+func reloadTestConfig(orderDb string) dbspi.DatabaseConfig {
+	return dbspi.DatabaseConfig{
+		DatabaseGroups: map[string]dbspi.DatabaseGroupConfig{
+			dbspi.DefaultDatabaseGroupKey: {Host: "127.0.0.1", Port: 3306, DatabaseName: "main_db"},
+			"order":                       {Host: "127.0.0.1", Port: 3306, DatabaseName: orderDb},
+		},
+	}
+}
+
+func waitClosed(t *testing.T, session *fakeSession) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !session.isClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected retired session to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManagerReloadKeepsUnchangedGroups(t *testing.T) {
+	mgr, dialer := newReloadTestManager(t, reloadTestConfig("order_db"))
+	defaultEntry := mgr.entries[dbspi.DefaultDatabaseGroupKey]
+	oldOrder := mgr.entries["order"].db.(*fakeSession)
+
+	if err := mgr.Reload(reloadTestConfig("order_db_v2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if mgr.entries[dbspi.DefaultDatabaseGroupKey] != defaultEntry {
+		t.Fatal("expected unchanged group to keep its entry")
+	}
+	newOrder := mgr.entries["order"].db.(*fakeSession)
+	if newOrder == oldOrder {
+		t.Fatal("expected changed group to get a new session")
+	}
+	if newOrder.server.DatabaseName != "order_db_v2" {
+		t.Fatalf("expected order_db_v2, got %q", newOrder.server.DatabaseName)
+	}
+	if dialer.count() != 3 {
+		t.Fatalf("expected 3 dialed sessions, got %d", dialer.count())
+	}
+	waitClosed(t, oldOrder)
+	if defaultEntry.db.(*fakeSession).isClosed() {
+		t.Fatal("expected unchanged session to stay open")
+	}
+}
+
+func TestManagerReloadReusesServerWithNewPoolLimits(t *testing.T) {
+	mgr, dialer := newReloadTestManager(t, reloadTestConfig("order_db"))
+	session := mgr.entries["order"].db.(*fakeSession)
+
+	cfg := reloadTestConfig("order_db")
+	order := cfg.DatabaseGroups["order"]
+	order.MaxOpenConns = 7
+	cfg.DatabaseGroups["order"] = order
+	if err := mgr.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if mgr.entries["order"].db != session {
+		t.Fatal("expected same server to reuse its session")
+	}
+	if session.maxOpenConns != 7 {
+		t.Fatalf("expected pool limit 7, got %d", session.maxOpenConns)
+	}
+	if dialer.count() != 2 {
+		t.Fatalf("expected no new sessions, got %d", dialer.count())
+	}
+}
+
+func TestManagerReloadRedialsOnSlowQueryThresholdChange(t *testing.T) {
+	mgr, dialer := newReloadTestManager(t, reloadTestConfig("order_db"))
+	session := mgr.entries["order"].db.(*fakeSession)
+
+	cfg := reloadTestConfig("order_db")
+	order := cfg.DatabaseGroups["order"]
+	order.SlowQueryThresholdMillis = 50
+	cfg.DatabaseGroups["order"] = order
+	if err := mgr.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if mgr.entries["order"].db == session {
+		t.Fatal("expected a new session with the new slow query threshold")
+	}
+	if dialer.count() != 3 {
+		t.Fatalf("expected 3 dialed sessions, got %d", dialer.count())
+	}
+	waitClosed(t, session)
+}
+
+func TestManagerReloadWaitsForInFlightOperations(t *testing.T) {
+	mgr, _ := newReloadTestManager(t, reloadTestConfig("order_db"))
+	oldOrder := mgr.entries["order"].db.(*fakeSession)
+
+	entry, ok := mgr.acquireEntry("order")
+	if !ok {
+		t.Fatal("expected order entry")
+	}
+	if err := mgr.Reload(reloadTestConfig("order_db_v2")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * reloadDrainPollInterval)
+	if oldOrder.isClosed() {
+		t.Fatal("expected retired session to stay open while in use")
+	}
+	entry.release()
+	waitClosed(t, oldOrder)
+}
+
+func TestManagerReloadManagedStoreFollowsNewConfig(t *testing.T) {
+	mgr, _ := newReloadTestManager(t, reloadTestConfig("order_db"))
+	store := ForWithCommonFieldAutoFill(&reloadTestOrder{}, mgr, DefaultCommonFieldAutoFillOptions())
+	managed, ok := store.(*managedTableStore[*reloadTestOrder])
+	if !ok {
+		t.Fatalf("expected managed table store, got %T", store)
+	}
+	before := managed.current.Load().store
+
+	if err := mgr.Reload(reloadTestConfig("order_db_v2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(context.Background(), &reloadTestOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := managed.current.Load()
+	if snapshot.store == before {
+		t.Fatal("expected store to be rebuilt after reload")
+	}
+	if snapshot.entry != mgr.entries["order"] {
+		t.Fatal("expected store to use the reloaded entry")
+	}
+	if got := snapshot.entry.inFlight; got != 0 {
+		t.Fatalf("expected no in-flight operations, got %d", got)
+	}
+}
+
+func TestManagerReloadRemovedGroup(t *testing.T) {
+	mgr, _ := newReloadTestManager(t, reloadTestConfig("order_db"))
+	store := ForWithCommonFieldAutoFill(&reloadTestOrder{}, mgr, DefaultCommonFieldAutoFillOptions())
+	oldOrder := mgr.entries["order"].db.(*fakeSession)
+
+	cfg := reloadTestConfig("order_db")
+	delete(cfg.DatabaseGroups, "order")
+	if err := mgr.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, oldOrder)
+
+	// Without the "order" group the store falls back to the default group.
+	if err := store.Create(context.Background(), &reloadTestOrder{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerReloadInvalidConfigKeepsCurrent(t *testing.T) {
+	mgr, dialer := newReloadTestManager(t, reloadTestConfig("order_db"))
+	entries := mgr.entries
+
+	cfg := reloadTestConfig("order_db")
+	cfg.DatabaseGroups["broken"] = dbspi.DatabaseGroupConfig{
+		Host:             "127.0.0.1",
+		Port:             3306,
+		DatabaseSharding: &dbspi.DatabaseShardingConfig{NameExpr: "db_${idx"},
+	}
+	cfg.DatabaseGroups["extra"] = dbspi.DatabaseGroupConfig{Host: "127.0.0.1", Port: 3306, DatabaseName: "extra_db"}
+	if err := mgr.Reload(cfg); err == nil {
+		t.Fatal("expected reload error for invalid config")
+	}
+
+	if len(mgr.entries) != len(entries) || mgr.entries["order"] != entries["order"] {
+		t.Fatal("expected failed reload to keep current entries")
+	}
+	for _, session := range dialer.sessions[2:] {
+		if !session.isClosed() {
+			t.Fatal("expected sessions dialed by failed reload to be closed")
+		}
+	}
+	for _, session := range dialer.sessions[:2] {
+		if session.isClosed() {
+			t.Fatal("expected current sessions to stay open")
+		}
+	}
+}
+
+func TestManagerReloadRejectsTransactionManager(t *testing.T) {
+	mgr, _ := newReloadTestManager(t, reloadTestConfig("order_db"))
+	err := mgr.Transaction(context.Background(), "order", nil, DefaultCommonFieldAutoFillOptions(), func(txMgr *Manager) error {
+		return txMgr.Reload(reloadTestConfig("order_db_v2"))
+	})
+	if err == nil {
+		t.Fatal("expected transaction-scoped manager reload to fail")
+	}
+}
+
+func TestManagerReloadConcurrentWithStoreConstruction(t *testing.T) {
+	mgr, _ := newReloadTestManager(t, reloadTestConfig("order_db"))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_ = ForWithCommonFieldAutoFill(&reloadTestOrder{}, mgr, DefaultCommonFieldAutoFillOptions())
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		db := "order_db"
+		if i%2 == 0 {
+			db = "order_db_v2"
+		}
+		if err := mgr.Reload(reloadTestConfig(db)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestManagerReloadShardAndRoutedStoresFollowNewConfig(t *testing.T) {
+	mgr, _ := newReloadTestManager(t, reloadTestConfig("order_db"))
+	store := ForWithCommonFieldAutoFill(&reloadTestOrder{}, mgr, DefaultCommonFieldAutoFillOptions())
+	oldOrder := mgr.entries["order"].db.(*fakeSession)
+
+	shard, err := store.Shard(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routed, err := routeChange(context.Background(), store, &reloadTestOrder{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mgr.Reload(reloadTestConfig("order_db_v2")); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, oldOrder)
+	newOrder := mgr.entries["order"].db.(*fakeSession)
+
+	for _, s := range []dbspi.TableStore[*reloadTestOrder]{shard, routed} {
+		if err := s.Create(context.Background(), &reloadTestOrder{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := oldOrder.createCount(); got != 0 {
+		t.Fatalf("expected no writes on the retired session, got %d", got)
+	}
+	if got := newOrder.createCount(); got != 2 {
+		t.Fatalf("expected 2 writes on the reloaded session, got %d", got)
+	}
+	if got := mgr.entries["order"].inFlight; got != 0 {
+		t.Fatalf("expected no in-flight operations, got %d", got)
+	}
+}
@@ -0,0 +1,1400 @@
+package dbsp
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var _ dbSession = (*memoryDb)(nil)
+
+// memorySchemas caches the parsed schemas of entities stored in memory.
+var memorySchemas sync.Map
+
+// errMemoryRawSQL is returned by Raw and Exec of in-memory sessions.
+var errMemoryRawSQL = fmt.Errorf("dbhelper: raw SQL is not supported by in-memory table stores")
+
+// NewMemoryManager creates a Manager whose database targets are in-memory
+// databases instead of MySQL connections.
+//
+// Every database target of cfg gets its own in-memory database, so sharded
+// groups route rows to the same physical databases and tables as they would on
+// MySQL. Databases are kept across Reload while the target's server config is
+// unchanged.
+func NewMemoryManager(cfg dbspi.DatabaseConfig, opts ManagerOptions) *Manager {
+	opts.dial = newMemoryDialer()
+	return NewManagerWithOptions(cfg, opts)
+}
+
+// NewMemoryTableStore creates a non-sharded table store backed by a new
+// in-memory database.
+func NewMemoryTableStore[T dbspi.Entity](entityInstance T, commonFields CommonFieldAutoFillOptions) *GormTableStore[T] {
+	return NewTableStoreWithCommonFieldAutoFill(newMemoryDb(), entityInstance, commonFields.Normalize())
+}
+
+// newMemoryDialer returns a dbDialer that opens one in-memory database per
+// server connection and hands out the same database on every later dial.
+func newMemoryDialer() dbDialer {
+	var mu sync.Mutex
+	databases := make(map[string]*memoryDatabase)
+	return func(server dbspi.ServerConfig) dbSession {
+		mu.Lock()
+		defer mu.Unlock()
+		key := connectionKey(server)
+		database, ok := databases[key]
+		if !ok {
+			database = newMemoryDatabase()
+			databases[key] = database
+		}
+		return &memoryDb{database: database}
+	}
+}
+
+func newMemoryDb() *memoryDb {
+	return &memoryDb{database: newMemoryDatabase()}
+}
+
+// memoryDatabase holds the tables of one in-memory database.
+//
+// Statements are serialized by mu. Transactions are atomic but not isolated:
+// their writes are visible to other sessions before commit and are undone on
+// rollback. Rows are never modified in place, so a rollback undoes exactly the
+// rows its transaction wrote and keeps the writes of other sessions.
+type memoryDatabase struct {
+	mu     sync.Mutex
+	tables map[string]*memoryTable
+}
+
+func newMemoryDatabase() *memoryDatabase {
+	return &memoryDatabase{tables: make(map[string]*memoryTable)}
+}
+
+// memoryTable holds the rows of one table as pointers to entity structs.
+type memoryTable struct {
+	name          string
+	schema        *schema.Schema
+	rows          []reflect.Value
+	autoIncrement int64
+	// uniqueKeys are the primary key and the unique indexes declared in the
+	// entity's gorm tags.
+	uniqueKeys []memoryUniqueKey
+}
+
+type memoryUniqueKey struct {
+	name   string
+	fields []*schema.Field
+}
+
+// memoryUndoLog records the rows written by one transaction, in order.
+type memoryUndoLog struct {
+	entries []memoryUndoEntry
+}
+
+// memoryUndoEntry records one statement: the rows it removed from table and
+// the rows it added. An update removes the old row and adds the new one.
+type memoryUndoEntry struct {
+	table   *memoryTable
+	removed []reflect.Value
+	added   []reflect.Value
+}
+
+// record adds the difference between the rows of table before and after a
+// statement.
+func (l *memoryUndoLog) record(table *memoryTable, before, after []reflect.Value) {
+	entry := memoryUndoEntry{table: table}
+	kept := make(map[uintptr]bool, len(before))
+	for _, row := range before {
+		kept[row.Pointer()] = true
+	}
+	for _, row := range after {
+		if kept[row.Pointer()] {
+			delete(kept, row.Pointer())
+		} else {
+			entry.added = append(entry.added, row)
+		}
+	}
+	for _, row := range before {
+		if kept[row.Pointer()] {
+			entry.removed = append(entry.removed, row)
+		}
+	}
+	if len(entry.removed) > 0 || len(entry.added) > 0 {
+		l.entries = append(l.entries, entry)
+	}
+}
+
+// undo reverts the recorded statements, latest first. Rows another session
+// has replaced since are left as they are. The caller must hold the lock of
+// the database.
+func (l *memoryUndoLog) undo() {
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		entry := l.entries[i]
+		added := make(map[uintptr]bool, len(entry.added))
+		for _, row := range entry.added {
+			added[row.Pointer()] = true
+		}
+		rows := make([]reflect.Value, 0, len(entry.table.rows)+len(entry.removed))
+		for _, row := range entry.table.rows {
+			if !added[row.Pointer()] {
+				rows = append(rows, row)
+			}
+		}
+		entry.table.rows = append(rows, entry.removed...)
+	}
+}
+
+// memoryDb implements dbSession on a memoryDatabase.
+type memoryDb struct {
+	database  *memoryDatabase
+	model     any
+	tableName string
+	tx        *txState
+	// undo records the writes of tx for rollback.
+	undo *memoryUndoLog
+}
+
+// boundTx implements txBound.
+func (d *memoryDb) boundTx() *txState {
+	return d.tx
+}
+
+// Ping implements pinger.
+func (d *memoryDb) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// withRowLock implements rowLocker. The in-memory database serializes every
+// statement, so reads need no locks of their own.
+func (d *memoryDb) withRowLock(dbspi.RowLock) (dbSession, error) {
+	if d.tx == nil {
+		return nil, dbspi.ErrRowLockRequiresTransaction
+	}
+	return d, nil
+}
+
+// WithModel implements dbSession
+func (d *memoryDb) WithModel(model any) dbSession {
+	cloned := *d
+	cloned.model = model
+	return &cloned
+}
+
+// WithTableName implements dbSession
+func (d *memoryDb) WithTableName(tableName string) dbSession {
+	cloned := *d
+	cloned.tableName = tableName
+	return &cloned
+}
+
+// table returns the table of the session, creating it on first use. sample
+// is the value passed to the statement and is used when the session has no
+// model. The caller must hold d.database.mu.
+func (d *memoryDb) table(sample any) (*memoryTable, error) {
+	model := d.model
+	if model == nil {
+		model = sample
+	}
+	if model == nil {
+		return nil, fmt.Errorf("dbhelper: in-memory session has no model")
+	}
+	entitySchema, err := schema.Parse(model, &memorySchemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, fmt.Errorf("dbhelper: parse in-memory entity %T: %w", model, err)
+	}
+	name := d.tableName
+	if name == "" {
+		name = entitySchema.Table
+	}
+	table, ok := d.database.tables[name]
+	if !ok {
+		table = newMemoryTable(name, entitySchema)
+		d.database.tables[name] = table
+	}
+	if table.schema.ModelType != entitySchema.ModelType {
+		return nil, fmt.Errorf("dbhelper: in-memory table %s holds %s rows, not %s", name, table.schema.ModelType, entitySchema.ModelType)
+	}
+	return table, nil
+}
+
+func newMemoryTable(name string, entitySchema *schema.Schema) *memoryTable {
+	table := &memoryTable{name: name, schema: entitySchema}
+	if len(entitySchema.PrimaryFields) > 0 {
+		table.uniqueKeys = append(table.uniqueKeys, memoryUniqueKey{name: "PRIMARY", fields: entitySchema.PrimaryFields})
+	}
+	for _, index := range entitySchema.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		key := memoryUniqueKey{name: index.Name}
+		for _, option := range index.Fields {
+			key.fields = append(key.fields, option.Field)
+		}
+		table.uniqueKeys = append(table.uniqueKeys, key)
+	}
+	for _, field := range entitySchema.Fields {
+		if field.Unique && !field.PrimaryKey {
+			table.uniqueKeys = append(table.uniqueKeys, memoryUniqueKey{name: field.DBName, fields: []*schema.Field{field}})
+		}
+	}
+	return table
+}
+
+// Find implements dbSession
+func (d *memoryDb) Find(ctx context.Context, dest any, query dbspi.Query, pagination dbspi.Pagination) error {
+	d.database.mu.Lock()
+	defer d.database.mu.Unlock()
+	table, err := d.table(dest)
+	if err != nil {
+		return err
+	}
+	rows, err := d.database.filter(ctx, table, queryToGormClause(query))
+	if err != nil {
+		return err
+	}
+	if rows, err = table.paginate(ctx, rows, pagination); err != nil {
+		return err
+	}
+	var selected []*schema.Field
+	if sq, ok := query.(columnSelectionQuery); ok {
+		for _, col := range sq.Columns() {
+			field, err := table.field(col.Name())
+			if err != nil {
+				return err
+			}
+			selected = append(selected, field)
+		}
+	}
+	return table.scan(ctx, dest, rows, selected)
+}
+
+// Count implements dbSession
+func (d *memoryDb) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	d.database.mu.Lock()
+	defer d.database.mu.Unlock()
+	table, err := d.table(nil)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := d.database.filter(ctx, table, queryToGormClause(query))
+	return uint64(len(rows)), err
+}
+
+// Create implements dbSession
+func (d *memoryDb) Create(ctx context.Context, entity dbspi.Entity) error {
+	return d.write(entity, func(table *memoryTable) error {
+		return table.insert(ctx, reflect.ValueOf(entity))
+	})
+}
+
+// Save implements dbSession
+func (d *memoryDb) Save(ctx context.Context, entity dbspi.Entity) error {
+	return d.write(entity, func(table *memoryTable) error {
+		return table.save(ctx, reflect.ValueOf(entity))
+	})
+}
+
+// Update implements dbSession
+//
+// Like gorm's Updates with a struct, only non-zero fields are written.
+func (d *memoryDb) Update(ctx context.Context, entity dbspi.Entity) error {
+	return d.write(entity, func(table *memoryTable) error {
+		index, err := table.indexOfEntity(ctx, reflect.ValueOf(entity))
+		if err != nil || index < 0 {
+			return err
+		}
+		entityValue := reflect.ValueOf(entity)
+		row := copyMemoryRow(table.rows[index])
+		for _, field := range table.schema.Fields {
+			if field.DBName == "" || field.PrimaryKey || !field.Updatable {
+				continue
+			}
+			value, zero := field.ValueOf(ctx, entityValue)
+			if zero {
+				continue
+			}
+			if err := field.Set(ctx, row, value); err != nil {
+				return err
+			}
+		}
+		return table.replace(ctx, index, row)
+	})
+}
+
+// Delete implements dbSession
+func (d *memoryDb) Delete(ctx context.Context, entity dbspi.Entity) error {
+	return d.write(entity, func(table *memoryTable) error {
+		index, err := table.indexOfEntity(ctx, reflect.ValueOf(entity))
+		if err != nil || index < 0 {
+			return err
+		}
+		table.rows = append(table.rows[:index:index], table.rows[index+1:]...)
+		return nil
+	})
+}
+
+// UpdateByQuery implements dbSession
+func (d *memoryDb) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	updates, err := requireUpdaterValues(updater)
+	if err != nil {
+		return err
+	}
+	where := queryToGormClause(query)
+	if where == nil {
+		return gorm.ErrMissingWhereClause
+	}
+	return d.write(nil, func(table *memoryTable) error {
+		for i, row := range table.rows {
+			ok, err := d.database.match(ctx, where, &memoryScope{table: table, row: row})
+			if err != nil {
+				return err
+			}
+			if ok != sqlTrue {
+				continue
+			}
+			updated, err := table.assign(ctx, row, updates)
+			if err != nil {
+				return err
+			}
+			if err := table.replace(ctx, i, updated); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteByQuery implements dbSession
+func (d *memoryDb) DeleteByQuery(ctx context.Context, entity dbspi.Entity, query dbspi.Query) error {
+	where := queryToGormClause(query)
+	if where == nil {
+		return gorm.ErrMissingWhereClause
+	}
+	return d.write(entity, func(table *memoryTable) error {
+		kept := make([]reflect.Value, 0, len(table.rows))
+		for _, row := range table.rows {
+			ok, err := d.database.match(ctx, where, &memoryScope{table: table, row: row})
+			if err != nil {
+				return err
+			}
+			if ok != sqlTrue {
+				kept = append(kept, row)
+			}
+		}
+		table.rows = kept
+		return nil
+	})
+}
+
+// BatchCreate implements dbSession
+func (d *memoryDb) BatchCreate(ctx context.Context, entities any, batchSize int) error {
+	return d.writeEach(entities, func(table *memoryTable, entity reflect.Value) error {
+		return table.insert(ctx, entity)
+	})
+}
+
+// BatchSave implements dbSession
+func (d *memoryDb) BatchSave(ctx context.Context, entities any) error {
+	return d.writeEach(entities, func(table *memoryTable, entity reflect.Value) error {
+		return table.save(ctx, entity)
+	})
+}
+
+// FirstOrCreate implements dbSession
+//
+// When no row matches, the values of the top-level equality conditions of
+// query are assigned to entity before it is created, as gorm does.
+func (d *memoryDb) FirstOrCreate(ctx context.Context, entity dbspi.Entity, query dbspi.Query) error {
+	where := queryToGormClause(query)
+	return d.write(entity, func(table *memoryTable) error {
+		rows, err := d.database.filter(ctx, table, where)
+		if err != nil {
+			return err
+		}
+		entityValue := reflect.ValueOf(entity)
+		if len(rows) > 0 {
+			table.sortByPrimaryKey(rows)
+			entityValue.Elem().Set(rows[0].Elem())
+			return nil
+		}
+		if err := table.assignEqualities(ctx, entityValue, where); err != nil {
+			return err
+		}
+		return table.insert(ctx, entityValue)
+	})
+}
+
+// Upsert implements dbSession
+//
+// A row conflicts when it shares the primary key, a unique index or the
+// conflict columns with the inserted entity.
+func (d *memoryDb) Upsert(ctx context.Context, entities any, spec upsertSpec, batchSize int) error {
+	return d.writeEach(entities, func(table *memoryTable, entity reflect.Value) error {
+		index, err := table.indexOfConflict(ctx, entity, spec.conflictColumns)
+		if err != nil {
+			return err
+		}
+		if index < 0 {
+			return table.insert(ctx, entity)
+		}
+		existing := table.rows[index]
+		if spec.updates != nil {
+			updated, err := table.assign(ctx, existing, spec.updates)
+			if err != nil {
+				return err
+			}
+			return table.replace(ctx, index, updated)
+		}
+		skip := make(map[string]bool, len(spec.conflictColumns)+len(spec.insertOnlyColumns))
+		for _, name := range spec.conflictColumns {
+			skip[name] = true
+		}
+		for _, name := range spec.insertOnlyColumns {
+			skip[name] = true
+		}
+		updated := copyMemoryRow(existing)
+		for _, field := range table.schema.Fields {
+			if field.DBName == "" || field.PrimaryKey || !field.Creatable || !field.Updatable || skip[field.DBName] {
+				continue
+			}
+			value, _ := field.ValueOf(ctx, entity)
+			if err := field.Set(ctx, updated, value); err != nil {
+				return err
+			}
+		}
+		return table.replace(ctx, index, updated)
+	})
+}
+
+// Raw implements dbSession
+func (d *memoryDb) Raw(context.Context, any, string, ...any) error {
+	return errMemoryRawSQL
+}
+
+// Exec implements dbSession
+func (d *memoryDb) Exec(context.Context, string, ...any) error {
+	return errMemoryRawSQL
+}
+
+// Transaction implements dbSession
+//
+// The rows written by fn are undone when fn fails or panics. Nested
+// transactions undo only their own writes, like savepoints.
+func (d *memoryDb) Transaction(ctx context.Context, fn transactionFunc) (err error) {
+	state := &txState{}
+	undo := &memoryUndoLog{}
+	committed := false
+	defer func() {
+		d.database.mu.Lock()
+		defer d.database.mu.Unlock()
+		if !committed {
+			undo.undo()
+		} else if d.undo != nil {
+			d.undo.entries = append(d.undo.entries, undo.entries...)
+		}
+	}()
+	txDB := *d
+	txDB.tx = state
+	txDB.undo = undo
+	err = fn(&txDB)
+	committed = err == nil
+	endTransaction(state, d.tx, err)
+	return err
+}
+
+// write runs fn on the session's table under the database lock. The table is
+// left unchanged when fn fails.
+func (d *memoryDb) write(sample any, fn func(table *memoryTable) error) error {
+	d.database.mu.Lock()
+	defer d.database.mu.Unlock()
+	table, err := d.table(sample)
+	if err != nil {
+		return err
+	}
+	working := *table
+	working.rows = append([]reflect.Value(nil), table.rows...)
+	if err := fn(&working); err != nil {
+		return err
+	}
+	if d.undo != nil {
+		d.undo.record(table, table.rows, working.rows)
+	}
+	*table = working
+	return nil
+}
+
+// writeEach runs fn for every element of entities, a slice of entities or a
+// single entity, as one statement.
+func (d *memoryDb) writeEach(entities any, fn func(table *memoryTable, entity reflect.Value) error) error {
+	values := reflect.ValueOf(entities)
+	if values.Kind() != reflect.Slice {
+		return d.write(entities, func(table *memoryTable) error {
+			return fn(table, values)
+		})
+	}
+	return d.write(entities, func(table *memoryTable) error {
+		for i := 0; i < values.Len(); i++ {
+			entity := values.Index(i)
+			if entity.Kind() != reflect.Ptr {
+				entity = entity.Addr()
+			}
+			if err := fn(table, entity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (t *memoryTable) field(name string) (*schema.Field, error) {
+	field := t.schema.LookUpField(name)
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("dbhelper: unknown column %s in in-memory table %s", name, t.name)
+	}
+	return field, nil
+}
+
+// insert appends a copy of entity, assigning its auto-increment primary key
+// and column defaults like gorm's Create does.
+func (t *memoryTable) insert(ctx context.Context, entity reflect.Value) error {
+	if pk := t.schema.PrioritizedPrimaryField; pk != nil && pk.AutoIncrement {
+		value, zero := pk.ValueOf(ctx, entity)
+		if zero {
+			t.autoIncrement++
+			if err := pk.Set(ctx, entity, t.autoIncrement); err != nil {
+				return err
+			}
+		} else if id, ok := memoryValue(value).(int64); ok && id > t.autoIncrement {
+			t.autoIncrement = id
+		}
+	}
+	for _, field := range t.schema.Fields {
+		if field.DBName == "" || field.DefaultValueInterface == nil {
+			continue
+		}
+		if _, zero := field.ValueOf(ctx, entity); zero {
+			if err := field.Set(ctx, entity, field.DefaultValueInterface); err != nil {
+				return err
+			}
+		}
+	}
+	row := copyMemoryRow(entity)
+	if err := t.checkUnique(ctx, row, -1); err != nil {
+		return err
+	}
+	t.rows = append(t.rows, row)
+	return nil
+}
+
+// save replaces the row with the primary key of entity, or inserts entity
+// when it has no primary key or no row has it.
+func (t *memoryTable) save(ctx context.Context, entity reflect.Value) error {
+	index, err := t.indexOfPrimaryKey(ctx, entity)
+	if err != nil {
+		return err
+	}
+	if index < 0 {
+		return t.insert(ctx, entity)
+	}
+	return t.replace(ctx, index, copyMemoryRow(entity))
+}
+
+func (t *memoryTable) replace(ctx context.Context, index int, row reflect.Value) error {
+	if err := t.checkUnique(ctx, row, index); err != nil {
+		return err
+	}
+	t.rows[index] = row
+	return nil
+}
+
+// checkUnique reports a duplicate key error when a row other than the one at
+// skip shares a unique key with row.
+func (t *memoryTable) checkUnique(ctx context.Context, row reflect.Value, skip int) error {
+	for _, key := range t.uniqueKeys {
+		for i, other := range t.rows {
+			if i == skip {
+				continue
+			}
+			same, err := sameMemoryKey(ctx, key.fields, row, other)
+			if err != nil {
+				return err
+			}
+			if same {
+				return fmt.Errorf("dbhelper: duplicate entry for key %s.%s: %w", t.name, key.name, gorm.ErrDuplicatedKey)
+			}
+		}
+	}
+	return nil
+}
+
+// indexOfEntity returns the index of the row with the primary key of entity,
+// or -1. Like gorm, it refuses entities without a primary key.
+func (t *memoryTable) indexOfEntity(ctx context.Context, entity reflect.Value) (int, error) {
+	if !t.hasPrimaryKey(ctx, entity) {
+		return -1, gorm.ErrMissingWhereClause
+	}
+	return t.indexOfPrimaryKey(ctx, entity)
+}
+
+func (t *memoryTable) hasPrimaryKey(ctx context.Context, entity reflect.Value) bool {
+	if len(t.schema.PrimaryFields) == 0 {
+		return false
+	}
+	for _, field := range t.schema.PrimaryFields {
+		if _, zero := field.ValueOf(ctx, entity); zero {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *memoryTable) indexOfPrimaryKey(ctx context.Context, entity reflect.Value) (int, error) {
+	if !t.hasPrimaryKey(ctx, entity) {
+		return -1, nil
+	}
+	for i, row := range t.rows {
+		same, err := sameMemoryKey(ctx, t.schema.PrimaryFields, entity, row)
+		if err != nil || same {
+			return i, err
+		}
+	}
+	return -1, nil
+}
+
+// indexOfConflict returns the index of the first row that conflicts with
+// entity on a unique key or on conflictColumns, or -1.
+func (t *memoryTable) indexOfConflict(ctx context.Context, entity reflect.Value, conflictColumns []string) (int, error) {
+	keys := t.uniqueKeys
+	if len(conflictColumns) > 0 {
+		key := memoryUniqueKey{name: strings.Join(conflictColumns, ",")}
+		for _, name := range conflictColumns {
+			field, err := t.field(name)
+			if err != nil {
+				return -1, err
+			}
+			key.fields = append(key.fields, field)
+		}
+		keys = append([]memoryUniqueKey{key}, keys...)
+	}
+	for _, key := range keys {
+		for i, row := range t.rows {
+			same, err := sameMemoryKey(ctx, key.fields, entity, row)
+			if err != nil || same {
+				return i, err
+			}
+		}
+	}
+	return -1, nil
+}
+
+// sameMemoryKey reports whether a and b have equal, non-NULL values for every
+// field. Zero primary keys never match, as they are assigned on insert.
+func sameMemoryKey(ctx context.Context, fields []*schema.Field, a, b reflect.Value) (bool, error) {
+	for _, field := range fields {
+		left, zero := field.ValueOf(ctx, a)
+		if zero && field.PrimaryKey {
+			return false, nil
+		}
+		right, _ := field.ValueOf(ctx, b)
+		result, err := compareMemory(memoryValue(left), "=", memoryValue(right))
+		if err != nil || result != sqlTrue {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// assign returns a copy of row with updates applied. Values are plain values
+// or the expressions built by dbspi.Updater's Incr and SetExpr.
+func (t *memoryTable) assign(ctx context.Context, row reflect.Value, updates map[string]any) (reflect.Value, error) {
+	updated := copyMemoryRow(row)
+	scope := &memoryScope{table: t, row: row}
+	for name, value := range updates {
+		field, err := t.field(name)
+		if err != nil {
+			return updated, err
+		}
+		if value, err = scope.evalValue(ctx, value); err != nil {
+			return updated, err
+		}
+		if err := field.Set(ctx, updated, value); err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// assignEqualities sets the values of the column = value conditions at the
+// top level of where on entity.
+func (t *memoryTable) assignEqualities(ctx context.Context, entity reflect.Value, where clause.Expression) error {
+	var exprs []clause.Expression
+	switch expr := where.(type) {
+	case clause.AndConditions:
+		exprs = expr.Exprs
+	case nil:
+	default:
+		exprs = []clause.Expression{expr}
+	}
+	for _, expr := range exprs {
+		eq, ok := expr.(clause.Eq)
+		if !ok || memoryValue(eq.Value) == nil {
+			continue
+		}
+		col, ok := eq.Column.(clause.Column)
+		if !ok {
+			continue
+		}
+		if _, isColumn := eq.Value.(clause.Column); isColumn {
+			continue
+		}
+		field, err := t.field(col.Name)
+		if err != nil {
+			return err
+		}
+		if err := field.Set(ctx, entity, eq.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paginate orders rows by pagination, or by primary key like an InnoDB scan,
+// and applies offset and limit.
+func (t *memoryTable) paginate(ctx context.Context, rows []reflect.Value, pagination dbspi.Pagination) ([]reflect.Value, error) {
+	if pagination == nil || len(pagination.Orders()) == 0 {
+		t.sortByPrimaryKey(rows)
+	} else {
+		fields := make([]*schema.Field, len(pagination.Orders()))
+		for i, order := range pagination.Orders() {
+			field, err := t.field(order.Column().Name())
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = field
+		}
+		var sortErr error
+		sort.SliceStable(rows, func(i, j int) bool {
+			for k, order := range pagination.Orders() {
+				left, _ := fields[k].ValueOf(ctx, rows[i])
+				right, _ := fields[k].ValueOf(ctx, rows[j])
+				c, err := orderMemory(memoryValue(left), memoryValue(right))
+				if err != nil {
+					sortErr = err
+					return false
+				}
+				if c != 0 {
+					return (c < 0) != order.Desc()
+				}
+			}
+			return false
+		})
+		if sortErr != nil {
+			return nil, sortErr
+		}
+	}
+	if pagination == nil {
+		return rows, nil
+	}
+	if offset := pagination.Offset(); offset != nil && *offset > 0 {
+		if *offset >= len(rows) {
+			return nil, nil
+		}
+		rows = rows[*offset:]
+	}
+	if limit := pagination.Limit(); limit != nil && *limit >= 0 && *limit < len(rows) {
+		rows = rows[:*limit]
+	}
+	return rows, nil
+}
+
+func (t *memoryTable) sortByPrimaryKey(rows []reflect.Value) {
+	pk := t.schema.PrioritizedPrimaryField
+	if pk == nil {
+		return
+	}
+	ctx := context.Background()
+	sort.SliceStable(rows, func(i, j int) bool {
+		left, _ := pk.ValueOf(ctx, rows[i])
+		right, _ := pk.ValueOf(ctx, rows[j])
+		c, err := orderMemory(memoryValue(left), memoryValue(right))
+		return err == nil && c < 0
+	})
+}
+
+// scan copies rows into dest, a pointer to a slice of entities or entity
+// pointers. When selected is set, the other columns are left zero.
+func (t *memoryTable) scan(ctx context.Context, dest any, rows []reflect.Value, selected []*schema.Field) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dbhelper: in-memory find needs a pointer to a slice, got %T", dest)
+	}
+	sliceValue := destValue.Elem()
+	elemType := sliceValue.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType != t.schema.ModelType {
+		return fmt.Errorf("dbhelper: in-memory table %s holds %s rows, not %s", t.name, t.schema.ModelType, elemType)
+	}
+	results := reflect.MakeSlice(sliceValue.Type(), 0, len(rows))
+	for _, row := range rows {
+		result := copyMemoryRow(row)
+		if len(selected) > 0 {
+			result = reflect.New(t.schema.ModelType)
+			for _, field := range selected {
+				value, _ := field.ValueOf(ctx, row)
+				if err := field.Set(ctx, result, value); err != nil {
+					return err
+				}
+			}
+		}
+		if !isPtr {
+			result = result.Elem()
+		}
+		results = reflect.Append(results, result)
+	}
+	sliceValue.Set(results)
+	return nil
+}
+
+// copyMemoryRow returns a pointer to a shallow copy of the struct entity
+// points to.
+func copyMemoryRow(entity reflect.Value) reflect.Value {
+	entity = reflect.Indirect(entity)
+	row := reflect.New(entity.Type())
+	row.Elem().Set(entity)
+	return row
+}
+
+// filter returns the rows of table matching where. The caller must hold
+// db.mu.
+func (db *memoryDatabase) filter(ctx context.Context, table *memoryTable, where clause.Expression) ([]reflect.Value, error) {
+	rows := make([]reflect.Value, 0, len(table.rows))
+	for _, row := range table.rows {
+		ok, err := db.match(ctx, where, &memoryScope{table: table, row: row})
+		if err != nil {
+			return nil, err
+		}
+		if ok == sqlTrue {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// sqlBool is a three-valued SQL truth value.
+type sqlBool uint8
+
+const (
+	sqlFalse sqlBool = iota
+	sqlTrue
+	sqlNull
+)
+
+func (b sqlBool) not() sqlBool {
+	switch b {
+	case sqlTrue:
+		return sqlFalse
+	case sqlFalse:
+		return sqlTrue
+	}
+	return sqlNull
+}
+
+func sqlBoolOf(v bool) sqlBool {
+	if v {
+		return sqlTrue
+	}
+	return sqlFalse
+}
+
+// memoryScope is the row a condition is evaluated against. Subqueries add a
+// scope whose outer scope is the row of the enclosing query.
+type memoryScope struct {
+	table *memoryTable
+	row   reflect.Value
+	outer *memoryScope
+}
+
+// column returns the value of col. Qualified columns resolve against the
+// innermost scope of that table and fall back to the innermost scope, so a
+// logical table name also resolves on a sharded physical table.
+func (s *memoryScope) column(ctx context.Context, col clause.Column) (any, error) {
+	scope := s
+	if col.Table != "" {
+		for candidate := s; candidate != nil; candidate = candidate.outer {
+			if candidate.table.name == col.Table {
+				scope = candidate
+				break
+			}
+		}
+	}
+	field, err := scope.table.field(col.Name)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := field.ValueOf(ctx, scope.row)
+	return memoryValue(value), nil
+}
+
+// operand returns the value of a column expression or a literal value.
+func (s *memoryScope) operand(ctx context.Context, v any) (any, error) {
+	if col, ok := v.(clause.Column); ok {
+		return s.column(ctx, col)
+	}
+	return memoryValue(v), nil
+}
+
+// evalValue evaluates an assigned value. Expressions support a single operand
+// and "? + ?" or "? - ?" over columns and values.
+func (s *memoryScope) evalValue(ctx context.Context, v any) (any, error) {
+	switch expr := v.(type) {
+	case clause.Column:
+		return s.column(ctx, expr)
+	case clause.Expr:
+		sqlExpr := strings.Join(strings.Fields(expr.SQL), " ")
+		switch {
+		case sqlExpr == "?" && len(expr.Vars) == 1:
+			return s.operand(ctx, expr.Vars[0])
+		case (sqlExpr == "? + ?" || sqlExpr == "? - ?") && len(expr.Vars) == 2:
+			left, err := s.operand(ctx, expr.Vars[0])
+			if err != nil {
+				return nil, err
+			}
+			right, err := s.operand(ctx, expr.Vars[1])
+			if err != nil {
+				return nil, err
+			}
+			return addMemory(left, right, sqlExpr == "? - ?")
+		}
+		return nil, fmt.Errorf("dbhelper: in-memory table stores do not support the expression %q", expr.SQL)
+	case clause.Expression:
+		return nil, fmt.Errorf("dbhelper: in-memory table stores do not support %T values", v)
+	}
+	return v, nil
+}
+
+// match evaluates where against scope. The caller must hold db.mu.
+func (db *memoryDatabase) match(ctx context.Context, where clause.Expression, scope *memoryScope) (sqlBool, error) {
+	switch expr := where.(type) {
+	case nil:
+		return sqlTrue, nil
+	case clause.Eq:
+		left, err := scope.operand(ctx, expr.Column)
+		if err != nil {
+			return sqlNull, err
+		}
+		if values, ok := memoryList(expr.Value); ok {
+			return inMemory(left, values)
+		}
+		right, err := scope.operand(ctx, expr.Value)
+		if err != nil {
+			return sqlNull, err
+		}
+		if right == nil {
+			return sqlBoolOf(left == nil), nil
+		}
+		return compareMemory(left, "=", right)
+	case clause.Neq:
+		left, err := scope.operand(ctx, expr.Column)
+		if err != nil {
+			return sqlNull, err
+		}
+		right, err := scope.operand(ctx, expr.Value)
+		if err != nil {
+			return sqlNull, err
+		}
+		if right == nil {
+			return sqlBoolOf(left != nil), nil
+		}
+		return compareMemory(left, "<>", right)
+	case clause.Gt:
+		return db.compare(ctx, scope, expr.Column, ">", expr.Value)
+	case clause.Gte:
+		return db.compare(ctx, scope, expr.Column, ">=", expr.Value)
+	case clause.Lt:
+		return db.compare(ctx, scope, expr.Column, "<", expr.Value)
+	case clause.Lte:
+		return db.compare(ctx, scope, expr.Column, "<=", expr.Value)
+	case clause.IN:
+		left, err := scope.operand(ctx, expr.Column)
+		if err != nil {
+			return sqlNull, err
+		}
+		values := expr.Values
+		if len(values) == 1 {
+			if list, ok := values[0].([]any); ok {
+				values = list
+			}
+		}
+		return inMemory(left, values)
+	case clause.Like:
+		left, err := scope.operand(ctx, expr.Column)
+		if err != nil {
+			return sqlNull, err
+		}
+		pattern, ok := expr.Value.(string)
+		if !ok {
+			return sqlNull, fmt.Errorf("dbhelper: in-memory LIKE needs a string pattern, got %T", expr.Value)
+		}
+		return likeMemory(left, pattern), nil
+	case columnComparison:
+		left, err := scope.column(ctx, expr.left)
+		if err != nil {
+			return sqlNull, err
+		}
+		right, err := scope.column(ctx, expr.right)
+		if err != nil {
+			return sqlNull, err
+		}
+		return compareMemory(left, expr.operator, right)
+	case clause.AndConditions:
+		result := sqlTrue
+		for _, inner := range expr.Exprs {
+			ok, err := db.match(ctx, inner, scope)
+			if err != nil || ok == sqlFalse {
+				return sqlFalse, err
+			}
+			if ok == sqlNull {
+				result = sqlNull
+			}
+		}
+		return result, nil
+	case clause.OrConditions:
+		result := sqlFalse
+		for _, inner := range expr.Exprs {
+			ok, err := db.match(ctx, inner, scope)
+			if err != nil || ok == sqlTrue {
+				return ok, err
+			}
+			if ok == sqlNull {
+				result = sqlNull
+			}
+		}
+		return result, nil
+	case clause.NotConditions:
+		return db.matchNot(ctx, expr, scope)
+	case subqueryCondition:
+		return db.matchSubquery(ctx, expr, scope)
+	}
+	return sqlNull, fmt.Errorf("dbhelper: in-memory table stores do not support %T conditions", where)
+}
+
+// matchNot follows how gorm renders NOT: when any operand has a negated form,
+// every operand is negated on its own; otherwise the conjunction is negated.
+func (db *memoryDatabase) matchNot(ctx context.Context, expr clause.NotConditions, scope *memoryScope) (sqlBool, error) {
+	for _, inner := range expr.Exprs {
+		if _, ok := inner.(clause.NegationExpressionBuilder); !ok {
+			continue
+		}
+		result := sqlTrue
+		for _, inner := range expr.Exprs {
+			ok, err := db.match(ctx, inner, scope)
+			if err != nil {
+				return sqlNull, err
+			}
+			switch ok.not() {
+			case sqlFalse:
+				return sqlFalse, nil
+			case sqlNull:
+				result = sqlNull
+			}
+		}
+		return result, nil
+	}
+	ok, err := db.match(ctx, clause.AndConditions{Exprs: expr.Exprs}, scope)
+	return ok.not(), err
+}
+
+func (db *memoryDatabase) matchSubquery(ctx context.Context, cond subqueryCondition, scope *memoryScope) (sqlBool, error) {
+	if err := cond.validate(); err != nil {
+		return sqlNull, err
+	}
+	var values []any
+	if table, ok := db.tables[cond.sub.table]; ok {
+		for _, row := range table.rows {
+			inner := &memoryScope{table: table, row: row, outer: scope}
+			ok, err := db.match(ctx, cond.sub.where, inner)
+			if err != nil {
+				return sqlNull, err
+			}
+			if ok != sqlTrue {
+				continue
+			}
+			if cond.column == nil {
+				values = append(values, nil)
+				continue
+			}
+			value, err := inner.column(ctx, cond.sub.columns[0])
+			if err != nil {
+				return sqlNull, err
+			}
+			values = append(values, value)
+		}
+	}
+	switch cond.operator {
+	case "EXISTS":
+		return sqlBoolOf(len(values) > 0), nil
+	case "NOT EXISTS":
+		return sqlBoolOf(len(values) == 0), nil
+	}
+	left, err := scope.column(ctx, *cond.column)
+	if err != nil {
+		return sqlNull, err
+	}
+	ok, err := inMemory(left, values)
+	if cond.operator == "NOT IN" {
+		ok = ok.not()
+	}
+	return ok, err
+}
+
+func (db *memoryDatabase) compare(ctx context.Context, scope *memoryScope, column any, operator string, value any) (sqlBool, error) {
+	left, err := scope.operand(ctx, column)
+	if err != nil {
+		return sqlNull, err
+	}
+	right, err := scope.operand(ctx, value)
+	if err != nil {
+		return sqlNull, err
+	}
+	return compareMemory(left, operator, right)
+}
+
+// memoryList returns the elements of v when gorm renders it as an IN list.
+func memoryList(v any) ([]any, bool) {
+	switch v.(type) {
+	case []string, []int, []int32, []int64, []uint, []uint32, []uint64, []any:
+		rv := reflect.ValueOf(v)
+		values := make([]any, rv.Len())
+		for i := range values {
+			values[i] = rv.Index(i).Interface()
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+func inMemory(left any, values []any) (sqlBool, error) {
+	result := sqlFalse
+	for _, value := range values {
+		ok, err := compareMemory(left, "=", memoryValue(value))
+		if err != nil || ok == sqlTrue {
+			return ok, err
+		}
+		if ok == sqlNull {
+			result = sqlNull
+		}
+	}
+	return result, nil
+}
+
+// compareMemory compares two normalized values with a SQL operator.
+func compareMemory(left any, operator string, right any) (sqlBool, error) {
+	if left == nil || right == nil {
+		return sqlNull, nil
+	}
+	c, err := orderMemory(left, right)
+	if err != nil {
+		return sqlNull, err
+	}
+	switch operator {
+	case "=":
+		return sqlBoolOf(c == 0), nil
+	case "<>", "!=":
+		return sqlBoolOf(c != 0), nil
+	case ">":
+		return sqlBoolOf(c > 0), nil
+	case ">=":
+		return sqlBoolOf(c >= 0), nil
+	case "<":
+		return sqlBoolOf(c < 0), nil
+	case "<=":
+		return sqlBoolOf(c <= 0), nil
+	}
+	return sqlNull, fmt.Errorf("dbhelper: in-memory table stores do not support the operator %s", operator)
+}
+
+// orderMemory orders two normalized values. NULL sorts first, numbers compare
+// numerically, numeric strings compare with numbers like MySQL does, and
+// strings compare byte-wise.
+func orderMemory(left, right any) (int, error) {
+	switch {
+	case left == nil && right == nil:
+		return 0, nil
+	case left == nil:
+		return -1, nil
+	case right == nil:
+		return 1, nil
+	}
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return compareOrdered(l, r), nil
+		}
+	}
+	if l, ok := left.(uint64); ok {
+		if r, ok := right.(uint64); ok {
+			return compareOrdered(l, r), nil
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	if l, ok := left.(time.Time); ok {
+		if r, ok := right.(time.Time); ok {
+			return l.Compare(r), nil
+		}
+	}
+	l, lok := memoryNumber(left)
+	r, rok := memoryNumber(right)
+	if lok && rok {
+		return compareOrdered(l, r), nil
+	}
+	if reflect.DeepEqual(left, right) {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("dbhelper: in-memory table stores cannot compare %T with %T", left, right)
+}
+
+func compareOrdered[N int64 | uint64 | float64](left, right N) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+	return 0
+}
+
+func memoryNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func addMemory(left, right any, subtract bool) (any, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			if subtract {
+				return l - r, nil
+			}
+			return l + r, nil
+		}
+	}
+	l, lok := memoryNumber(left)
+	r, rok := memoryNumber(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("dbhelper: in-memory table stores cannot add %T and %T", left, right)
+	}
+	if subtract {
+		return l - r, nil
+	}
+	return l + r, nil
+}
+
+// likeMemory matches value against a LIKE pattern with % and _ wildcards and
+// backslash escapes.
+func likeMemory(value any, pattern string) sqlBool {
+	if value == nil {
+		return sqlNull
+	}
+	var expr strings.Builder
+	expr.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			expr.WriteString(".*")
+		case r == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return sqlBoolOf(regexp.MustCompile(expr.String()).MatchString(fmt.Sprint(value)))
+}
+
+// memoryValue normalizes a Go value to the value MySQL would compare: NULL
+// for nil pointers and NULL valuers, int64 for integers and booleans, uint64
+// for integers above math.MaxInt64, float64, string and time.Time.
+func memoryValue(v any) any {
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		if _, ok := rv.Interface().(driver.Valuer); ok {
+			break
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	if valuer, ok := rv.Interface().(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil || value == nil {
+			return nil
+		}
+		rv = reflect.ValueOf(value)
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return int64(1)
+		}
+		return int64(0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	}
+	switch value := rv.Interface().(type) {
+	case time.Time:
+		return value
+	case []byte:
+		return string(value)
+	}
+	return rv.Interface()
+}
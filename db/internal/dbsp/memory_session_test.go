@@ -0,0 +1,263 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm"
+)
+
+type memoryTestUser struct {
+	dbspi.CommonFields
+	Email string  `gorm:"column:email;uniqueIndex"`
+	Name  string  `gorm:"column:name"`
+	Score int64   `gorm:"column:score"`
+	Note  *string `gorm:"column:note"`
+}
+
+func (*memoryTestUser) TableName() string { return "memory_user_tab" }
+
+func newMemoryTestUsers(t *testing.T, ctx context.Context) *GormTableStore[*memoryTestUser] {
+	t.Helper()
+	store := NewMemoryTableStore(&memoryTestUser{}, testCommonFieldAutoFillOptions())
+	note := "vip"
+	for _, user := range []*memoryTestUser{
+		{Email: "a@x.io", Name: "alice", Score: 30, Note: &note},
+		{Email: "b@x.io", Name: "bob", Score: 10},
+		{Email: "c@x.io", Name: "carol", Score: 20},
+	} {
+		if err := store.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func memoryTestNames(users []*memoryTestUser) []string {
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.Name
+	}
+	return names
+}
+
+func TestMemoryTableStoreCreateAssignsIdsAndCommonFields(t *testing.T) {
+	ctx := dbspi.WithOperator(context.Background(), "tester")
+	store := newMemoryTestUsers(t, ctx)
+
+	user, err := store.GetById(ctx, uint64(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "bob" || user.Ctime != 12345 || user.Mtime != 12345 || user.Creator != "tester" {
+		t.Fatalf("user = %+v", user)
+	}
+
+	err = store.Create(ctx, &memoryTestUser{Email: "a@x.io"})
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("duplicate email err = %v", err)
+	}
+	if count, _ := store.Count(ctx, nil); count != 3 {
+		t.Fatalf("count after duplicate = %d", count)
+	}
+}
+
+func TestMemoryTableStoreEvaluatesQueries(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTestUsers(t, ctx)
+	score, name, prefix := int64(15), "bob", "ca"
+
+	tests := []struct {
+		name  string
+		query dbspi.Query
+		want  []string
+	}{
+		{"gt", NewQuery(NewField[int64]("score").Gt(&score)), []string{"alice", "carol"}},
+		{"or", Or(NewField[string]("name").Eq(&name), NewField[string]("name").StartsWith(&prefix)), []string{"bob", "carol"}},
+		{"not", Not(NewField[string]("name").Eq(&name)), []string{"alice", "carol"}},
+		{"in", NewQuery(NewField[uint64]("id").In([]uint64{1, 3})), []string{"alice", "carol"}},
+		{"is null", NewQuery(NewField[string]("note").IsNull()), []string{"bob", "carol"}},
+		{"not equal skips null", NewQuery(NewField[string]("note").NotEq(&name)), []string{"alice"}},
+		{"column", NewQuery(NewField[int64]("score").GtColumn(NewColumn("id"))), []string{"alice", "bob", "carol"}},
+		{"subquery", NewQuery(NewField[uint64]("id").InSubquery(NewSubquery("memory_user_tab", Select(
+			[]dbspi.Column{NewColumn("id")}, NewField[int64]("score").LtEq(&score))))), []string{"bob"}},
+	}
+	for _, tt := range tests {
+		users, err := store.Find(ctx, tt.query, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := memoryTestNames(users); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryTableStorePaginates(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTestUsers(t, ctx)
+	limit, offset := 2, 1
+
+	users, err := store.Find(ctx, nil, NewPagination().AppendOrder(Desc(NewColumn("score"))).WithLimit(&limit).WithOffset(&offset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := memoryTestNames(users); !reflect.DeepEqual(got, []string{"carol", "bob"}) {
+		t.Fatalf("page = %v", got)
+	}
+}
+
+func TestMemoryTableStoreUpdatesAndSoftDeletes(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTestUsers(t, ctx)
+	name := "bob"
+
+	if err := store.UpdateByQuery(ctx, NewQuery(NewField[string]("name").Eq(&name)), NewUpdater().Incr(NewColumn("score"), 5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update(ctx, &memoryTestUser{CommonFields: dbspi.CommonFields{IdField: dbspi.IdField{Id: 3}}, Name: "caroline"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SoftDeleteById(ctx, uint64(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := store.FindNotDeleted(ctx, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Score != 15 || users[1].Name != "caroline" || users[1].Score != 20 {
+		t.Fatalf("users = %+v, %+v", users[0], users[1])
+	}
+	if err := store.DeleteByQuery(ctx, nil); !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("delete without where err = %v", err)
+	}
+}
+
+func TestMemoryTableStoreUpsertKeepsInsertOnlyColumns(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTestUsers(t, ctx)
+	store.commonFields.TimeProvider = func(context.Context) uint64 { return 99 }
+
+	if err := store.Upsert(ctx, &memoryTestUser{Email: "b@x.io", Name: "robert"}, []dbspi.Column{NewColumn("email")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.GetById(ctx, uint64(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "robert" || user.Ctime != 12345 || user.Mtime != 99 {
+		t.Fatalf("user = %+v", user)
+	}
+}
+
+func TestMemoryTransactionRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTestUsers(t, ctx)
+	errAbort := errors.New("abort")
+
+	err := store.db.Transaction(ctx, func(tx dbSession) error {
+		txStore := NewTableStoreWithCommonFieldAutoFill(tx, &memoryTestUser{}, store.commonFields)
+		if err := txStore.DeleteById(ctx, uint64(1)); err != nil {
+			return err
+		}
+		lockTx, err := lockingSession(tx, dbspi.RowLock{Strength: dbspi.LockForUpdate})
+		if err != nil {
+			return err
+		}
+		if _, err := NewTableStoreWithCommonFieldAutoFill(lockTx, &memoryTestUser{}, store.commonFields).Find(ctx, nil, nil); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v", err)
+	}
+	if count, _ := store.Count(ctx, nil); count != 3 {
+		t.Fatalf("count after rollback = %d", count)
+	}
+	if _, err := lockingSession(store.db, dbspi.RowLock{Strength: dbspi.LockForUpdate}); !errors.Is(err, dbspi.ErrRowLockRequiresTransaction) {
+		t.Fatalf("locking read outside transaction err = %v", err)
+	}
+}
+
+func TestMemoryTransactionRollbackKeepsOtherWrites(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTestUsers(t, ctx)
+	errAbort := errors.New("abort")
+
+	err := store.db.Transaction(ctx, func(tx dbSession) error {
+		txStore := NewTableStoreWithCommonFieldAutoFill(tx, &memoryTestUser{}, store.commonFields)
+		if err := txStore.Create(ctx, &memoryTestUser{Email: "d@x.io", Name: "dave"}); err != nil {
+			return err
+		}
+		if err := txStore.UpdateById(ctx, uint64(1), NewUpdater().Set(NewColumn("name"), "alicia")); err != nil {
+			return err
+		}
+		// Another session commits while the transaction is open.
+		if err := store.Create(ctx, &memoryTestUser{Email: "e@x.io", Name: "erin"}); err != nil {
+			return err
+		}
+		if err := store.UpdateById(ctx, uint64(2), NewUpdater().Set(NewColumn("name"), "robert")); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v", err)
+	}
+	users, err := store.Find(ctx, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := memoryTestNames(users)
+	sort.Strings(got)
+	if want := []string{"alice", "carol", "erin", "robert"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("names after rollback = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryManagerRoutesShards(t *testing.T) {
+	mgr := NewMemoryManager(shardedJoinTestConfig(), ManagerOptions{})
+	store := For(&joinTestItem{}, mgr)
+	ctx := context.Background()
+
+	for _, item := range []*joinTestItem{{ID: 1, ShopID: 5, SKU: "a"}, {ID: 2, ShopID: 6, SKU: "b"}} {
+		if err := store.Create(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shopID := int64(5)
+	items, err := store.Find(ctx, NewQuery(NewField[int64]("shop_id").Eq(&shopID)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].SKU != "a" {
+		t.Fatalf("items = %+v", items)
+	}
+
+	stored := 0
+	for _, target := range mgr.entries["order"].dbs {
+		database := target.Db.(*memoryDb).database
+		for name, table := range database.tables {
+			if len(table.rows) == 0 {
+				continue
+			}
+			stored += len(table.rows)
+			row := table.rows[0].Interface().(*joinTestItem)
+			want := map[int64]string{5: "order_db_1/order_item_tab_1", 6: "order_db_0/order_item_tab_2"}[row.ShopID]
+			if got := target.Key + "/" + name; got != want {
+				t.Errorf("shop %d stored in %s, want %s", row.ShopID, got, want)
+			}
+		}
+	}
+	if stored != 2 {
+		t.Fatalf("stored %d rows, want 2", stored)
+	}
+}
@@ -0,0 +1,135 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// rawScanner is implemented by table stores that can scan raw SQL results into
+// destinations other than their entity type.
+type rawScanner interface {
+	RawScan(ctx context.Context, dest any, sql string, args ...any) error
+}
+
+func toRawScanner(store any) (rawScanner, error) {
+	scanner, ok := store.(rawScanner)
+	if !ok {
+		return nil, fmt.Errorf("dbhelper: table store does not support raw SQL scanning; use dbhelper.NewTableStore")
+	}
+	return scanner, nil
+}
+
+// RawInto runs sql through store and scans the rows into R.
+func RawInto[R any](ctx context.Context, store any, sql string, args ...any) ([]R, error) {
+	scanner, err := toRawScanner(store)
+	if err != nil {
+		return nil, err
+	}
+	var results []R
+	err = scanner.RawScan(ctx, &results, sql, args...)
+	return results, err
+}
+
+// ManagerRawInto runs sql on the database group groupKey of mgr and scans the
+// rows into R.
+func ManagerRawInto[R any](ctx context.Context, mgr *Manager, groupKey string, sql string, args ...any) ([]R, error) {
+	if mgr == nil {
+		mgr = DefaultManager()
+	}
+	var results []R
+	err := mgr.RawScan(ctx, groupKey, &results, sql, args...)
+	return results, err
+}
+
+// RawScan runs sql on one database of the group groupKey and scans the rows
+// into dest. Database-sharded groups route with the ShardingKey in ctx, which
+// also resolves {{table:<name>}} placeholders for table-sharded tables.
+func (m *Manager) RawScan(ctx context.Context, groupKey string, dest any, sql string, args ...any) error {
+	if groupKey == "" {
+		groupKey = dbspi.DefaultDatabaseGroupKey
+	}
+	entry, ok := m.acquireEntry(groupKey)
+	if !ok {
+		return fmt.Errorf("dbhelper: database config %q not found", groupKey)
+	}
+	defer entry.release()
+
+	sk, _ := dbspi.ShardingKeyFromContext(ctx)
+	db, _, err := entry.resolveDb(ctx, sk)
+	if err != nil {
+		return err
+	}
+	sql, err = expandTablePlaceholders(sql, func(name string) (string, error) {
+		if name == "" {
+			return "", fmt.Errorf("dbhelper: {{table}} needs a table store; use {{table:<name>}} with a database group")
+		}
+		tableRule, _ := entry.tableRuleFor(name)
+		if tableRule == nil {
+			return name, nil
+		}
+		if sk == nil {
+			return "", fmt.Errorf("table %q: %w", name, dbspi.ErrShardingKeyRequired)
+		}
+		table, err := resolveTable(ctx, tableRule, name, sk)
+		if err != nil {
+			return "", fmt.Errorf("table %q: resolve table failed: %w", name, err)
+		}
+		return table, nil
+	})
+	if err != nil {
+		return err
+	}
+	return db.Raw(ctx, dest, sql, args...)
+}
+
+// resolveDb picks the database of e that sk routes to. Unsharded groups
+// ignore sk.
+func (e *resolvedDbEntry) resolveDb(ctx context.Context, sk *dbspi.ShardingKey) (dbSession, string, error) {
+	switch {
+	case e.dbRule != nil:
+		if sk == nil {
+			return nil, "", dbspi.ErrShardingKeyRequired
+		}
+		key, err := resolveDatabaseTargetKey(ctx, e.dbRule, sk)
+		if err != nil {
+			return nil, "", fmt.Errorf("resolve db key failed: %w", err)
+		}
+		db, err := findDatabaseTarget(e.dbs, key)
+		if err != nil {
+			return nil, "", err
+		}
+		return db, key, nil
+	case e.db != nil:
+		return e.db, "0", nil
+	case len(e.dbs) > 0:
+		return e.dbs[0].Db, e.dbs[0].Key, nil
+	default:
+		return nil, "", fmt.Errorf("dbhelper: database group has no Db target")
+	}
+}
+
+// tablePlaceholderPattern matches {{table}} and {{table:<name>}}.
+var tablePlaceholderPattern = regexp.MustCompile(`\{\{\s*table\s*(?::\s*([A-Za-z0-9_$]+)\s*)?\}\}`)
+
+// expandTablePlaceholders replaces table placeholders in sql with the quoted
+// physical table names returned by resolve. resolve receives the name after
+// "table:", or "" for a bare {{table}}.
+func expandTablePlaceholders(sql string, resolve func(name string) (string, error)) (string, error) {
+	var resolveErr error
+	expanded := tablePlaceholderPattern.ReplaceAllStringFunc(sql, func(match string) string {
+		if resolveErr != nil {
+			return match
+		}
+		name := tablePlaceholderPattern.FindStringSubmatch(match)[1]
+		table, err := resolve(name)
+		if err != nil {
+			resolveErr = err
+			return match
+		}
+		return "`" + table + "`"
+	})
+	return expanded, resolveErr
+}
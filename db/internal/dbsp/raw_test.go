@@ -0,0 +1,57 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm"
+)
+
+type rawTestSkuCount struct {
+	SKU   string `gorm:"column:sku"`
+	Total int64  `gorm:"column:total"`
+}
+
+// Raw scans are not supported by gorm's DryRun mode; the statement is still
+// built and logged, which is what these tests check.
+
+func TestRawIntoExpandsRoutedTable(t *testing.T) {
+	mgr, capture := newJoinTestManager(t, shardedJoinTestConfig())
+	ctx := dbspi.WithShardingKey(context.Background(), dbspi.NewShardingKey().SetValue("shop_id", int64(5)))
+
+	_, err := RawInto[rawTestSkuCount](ctx, For(&joinTestItem{}, mgr),
+		"SELECT sku, COUNT(*) AS total FROM {{table}} GROUP BY sku")
+	if err != nil && !errors.Is(err, gorm.ErrDryRunModeUnsupported) {
+		t.Fatal(err)
+	}
+
+	want := "SELECT sku, COUNT(*) AS total FROM `order_item_tab_1` GROUP BY sku"
+	if capture.sql != want {
+		t.Fatalf("unexpected SQL:\n got %q\nwant %q", capture.sql, want)
+	}
+}
+
+func TestManagerRawIntoResolvesNamedTables(t *testing.T) {
+	mgr, capture := newJoinTestManager(t, shardedJoinTestConfig())
+	sql := "SELECT o.id, i.sku FROM {{table:order_tab}} o JOIN {{ table:order_item_tab }} i ON i.order_id = o.id"
+
+	if _, err := ManagerRawInto[rawTestSkuCount](context.Background(), mgr, "order", sql); !errors.Is(err, dbspi.ErrShardingKeyRequired) {
+		t.Fatalf("expected ErrShardingKeyRequired without a key, got %v", err)
+	}
+
+	ctx := dbspi.WithShardingKey(context.Background(), dbspi.NewShardingKey().SetValue("shop_id", int64(6)))
+	if _, err := ManagerRawInto[rawTestSkuCount](ctx, mgr, "order", sql); err != nil && !errors.Is(err, gorm.ErrDryRunModeUnsupported) {
+		t.Fatal(err)
+	}
+	want := "SELECT o.id, i.sku FROM `order_tab_2` o JOIN `order_item_tab_2` i ON i.order_id = o.id"
+	if capture.sql != want {
+		t.Fatalf("unexpected SQL:\n got %q\nwant %q", capture.sql, want)
+	}
+
+	if _, err := ManagerRawInto[rawTestSkuCount](ctx, mgr, "order", "SELECT * FROM {{table}}"); err == nil {
+		t.Fatal("expected bare {{table}} to be rejected at the database group level")
+	}
+}
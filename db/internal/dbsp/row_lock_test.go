@@ -0,0 +1,77 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+func TestRowLockRequiresTransaction(t *testing.T) {
+	logger := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	db := newUpsertTestDb(t, logger, "user:pass@tcp(127.0.0.1:3306)/order_db")
+	lock := dbspi.RowLock{Strength: dbspi.LockForUpdate}
+
+	if _, err := lockingSession(db, lock); !errors.Is(err, dbspi.ErrRowLockRequiresTransaction) {
+		t.Fatalf("expected ErrRowLockRequiresTransaction, got %v", err)
+	}
+	mgr := NewManagerWithOptions(shardedJoinTestConfig(), ManagerOptions{dial: func(server dbspi.ServerConfig) dbSession {
+		return newUpsertTestDb(t, logger, dbServerDSN(server))
+	}})
+	if _, err := mgr.WithRowLock(lock); !errors.Is(err, dbspi.ErrRowLockRequiresTransaction) {
+		t.Fatalf("expected ErrRowLockRequiresTransaction, got %v", err)
+	}
+	if len(logger.sqls) != 0 {
+		t.Fatalf("expected no statement outside a transaction, got %q", logger.sqls)
+	}
+}
+
+func TestRowLockOnShardedTransactionStore(t *testing.T) {
+	logger := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	dial := func(server dbspi.ServerConfig) dbSession {
+		return newUpsertTestDb(t, logger, dbServerDSN(server))
+	}
+	mgr := NewManagerWithOptions(shardedJoinTestConfig(), ManagerOptions{dial: dial})
+
+	// Bind the manager to order_db_1 the way Manager.Transaction does, without
+	// opening a real transaction.
+	entry, ok := mgr.acquireEntry("order")
+	if !ok {
+		t.Fatal("order entry not found")
+	}
+	defer entry.release()
+	targetDb, err := findDatabaseTarget(entry.dbs, "order_db_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txDb := &GormDb{db: targetDb.(*GormDb).db, tx: &txState{}}
+	txMgr := &Manager{entries: map[string]*resolvedDbEntry{"order": cloneEntryForTransaction(entry, txDb, "order_db_1")}}
+
+	lockMgr, err := txMgr.WithRowLock(dbspi.RowLock{Strength: dbspi.LockForUpdate, Wait: dbspi.LockSkipLocked})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	shopID := int64(5)
+	query := NewQuery(NewField[int64]("shop_id").Eq(&shopID))
+	limit := 10
+	if _, err := For(&joinTestItem{}, lockMgr).Find(ctx, query, NewPagination().WithLimit(&limit)); err != nil {
+		t.Fatal(err)
+	}
+	sql := logger.sqls[len(logger.sqls)-1]
+	if !strings.Contains(sql, "`order_item_tab_1`") || !strings.HasSuffix(sql, "FOR UPDATE SKIP LOCKED") {
+		t.Fatalf("expected a locking read on order_item_tab_1, got %q", sql)
+	}
+
+	// Stores of the transaction built without the lock, and their ctx, are
+	// unaffected.
+	if _, err := For(&joinTestItem{}, txMgr).Find(ctx, query, NewPagination().WithLimit(&limit)); err != nil {
+		t.Fatal(err)
+	}
+	if sql := logger.sqls[len(logger.sqls)-1]; strings.Contains(sql, "FOR UPDATE") {
+		t.Fatalf("expected a plain read, got %q", sql)
+	}
+}
@@ -0,0 +1,62 @@
+package dbsp
+
+import (
+	"slices"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// ShardingColumns returns the columns a ShardingKey needs to route the
+// logical table in the database group configured by entry: the @{column}
+// references of the database and table expressions and the key columns of
+// directories. It returns nil for groups that do not shard table.
+func ShardingColumns(entry dbspi.DatabaseGroupConfig, table string) ([]string, error) {
+	var columns []string
+	add := func(names ...string) {
+		for _, name := range names {
+			if name != "" && !slices.Contains(columns, name) {
+				columns = append(columns, name)
+			}
+		}
+	}
+
+	dbRule, err := buildDbRule(entry.DatabaseSharding)
+	if err != nil {
+		return nil, err
+	}
+	if provider, ok := dbRule.(ShardingKeyColumnsProvider); ok {
+		add(provider.RequiredColumns()...)
+	}
+	if entry.DatabaseDirectory != nil {
+		add(entry.DatabaseDirectory.KeyColumn)
+	}
+
+	tableSharding, tableDirectory := entry.TableSharding, entry.TableDirectory
+	for _, rule := range entry.TableRules {
+		if !slices.Contains(rule.Tables, table) {
+			continue
+		}
+		if rule.TableSharding != nil {
+			tableSharding, tableDirectory = rule.TableSharding, nil
+			if tableSharding.NameExpr == "" && entry.TableSharding != nil {
+				inherited := *tableSharding
+				inherited.NameExpr = entry.TableSharding.NameExpr
+				tableSharding = &inherited
+			}
+		}
+		if rule.TableDirectory != nil {
+			tableSharding, tableDirectory = nil, rule.TableDirectory
+		}
+	}
+	tableRule, err := buildTableRule(tableSharding)
+	if err != nil {
+		return nil, err
+	}
+	if provider, ok := tableRule.(ShardingKeyColumnsProvider); ok {
+		add(provider.RequiredColumns()...)
+	}
+	if tableDirectory != nil {
+		add(tableDirectory.KeyColumn)
+	}
+	return columns, nil
+}
@@ -0,0 +1,255 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachespi"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// ================== Directory Rule ==================
+
+var (
+	_ DatabaseShardingRule        = (*directoryRule)(nil)
+	_ ContextDatabaseShardingRule = (*directoryRule)(nil)
+	_ TableShardingRule           = (*directoryRule)(nil)
+	_ ContextTableShardingRule    = (*directoryRule)(nil)
+	_ TableShardCounter           = (*directoryRule)(nil)
+	_ TableShardEnumerator        = (*directoryRule)(nil)
+	_ ShardingKeyColumnsProvider  = (*directoryRule)(nil)
+)
+
+// directoryRule resolves targets by looking up one key column in a
+// ShardDirectory. It serves both as a database and a table sharding rule.
+type directoryRule struct {
+	directory     dbspi.ShardDirectory
+	keyColumn     string
+	defaultTarget string
+	tables        []string
+	targets       map[string]bool
+	cache         *directoryCache
+}
+
+// NewDirectoryRule creates a directory-based sharding rule from its config.
+// targets lists every target the directory may return: the server keys of a
+// database directory, or cfg.Tables of a table directory. Lookups returning
+// any other target fail instead of routing to a database or table that does
+// not exist.
+func NewDirectoryRule(directory dbspi.ShardDirectory, cfg dbspi.DirectoryShardingConfig, targets []string) (*directoryRule, error) {
+	if directory == nil {
+		return nil, fmt.Errorf("shard directory %q is nil", cfg.Directory)
+	}
+	if cfg.KeyColumn == "" {
+		return nil, fmt.Errorf("directory sharding config requires key_column")
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("shard directory %q has no targets", cfg.Directory)
+	}
+	known := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		known[target] = true
+	}
+	if cfg.DefaultTarget != "" && !known[cfg.DefaultTarget] {
+		return nil, fmt.Errorf("shard directory %q: default_target %q is not a known target", cfg.Directory, cfg.DefaultTarget)
+	}
+	ttl := cfg.CacheTTLSeconds
+	if ttl == 0 {
+		ttl = dbspi.DefaultShardDirectoryCacheTTLSeconds
+	}
+	maxEntries := cfg.CacheMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = dbspi.DefaultShardDirectoryCacheMaxEntries
+	}
+	rule := &directoryRule{
+		directory:     directory,
+		keyColumn:     cfg.KeyColumn,
+		defaultTarget: cfg.DefaultTarget,
+		tables:        cfg.Tables,
+		targets:       known,
+	}
+	if ttl > 0 {
+		rule.cache = newDirectoryCache(time.Duration(ttl)*time.Second, maxEntries)
+	}
+	return rule, nil
+}
+
+// ResolveDatabaseTargetKey looks up sk without a deadline; routing code
+// calls ResolveDatabaseTargetKeyContext with the operation ctx instead.
+func (r *directoryRule) ResolveDatabaseTargetKey(sk *dbspi.ShardingKey) (string, error) {
+	return r.resolve(context.Background(), sk)
+}
+
+func (r *directoryRule) ResolveDatabaseTargetKeyContext(ctx context.Context, sk *dbspi.ShardingKey) (string, error) {
+	return r.resolve(ctx, sk)
+}
+
+// ResolveTable looks up sk without a deadline; routing code calls
+// ResolveTableContext with the operation ctx instead.
+func (r *directoryRule) ResolveTable(_ string, sk *dbspi.ShardingKey) (string, error) {
+	return r.resolve(context.Background(), sk)
+}
+
+func (r *directoryRule) ResolveTableContext(ctx context.Context, _ string, sk *dbspi.ShardingKey) (string, error) {
+	return r.resolve(ctx, sk)
+}
+
+func (r *directoryRule) RequiredColumns() []string {
+	return []string{r.keyColumn}
+}
+
+func (r *directoryRule) ShardCount() int {
+	return len(r.tables)
+}
+
+func (r *directoryRule) ShardName(_ string, index int) (string, error) {
+	if index < 0 || index >= len(r.tables) {
+		return "", fmt.Errorf("shard index %d out of range [0, %d)", index, len(r.tables))
+	}
+	return r.tables[index], nil
+}
+
+func (r *directoryRule) resolve(ctx context.Context, sk *dbspi.ShardingKey) (string, error) {
+	if sk == nil {
+		return "", dbspi.ErrShardingKeyRequired
+	}
+	value, err := sk.Get(r.keyColumn)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprint(value)
+	if target, ok := r.cache.get(key); ok {
+		return target, nil
+	}
+
+	target, err := r.directory.Lookup(ctx, key)
+	if errors.Is(err, dbspi.ErrShardDirectoryEntryNotFound) && r.defaultTarget != "" {
+		target, err = r.defaultTarget, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("shard directory lookup %s=%q: %w", r.keyColumn, key, err)
+	}
+	if !r.targets[target] {
+		return "", fmt.Errorf("shard directory lookup %s=%q: unknown target %q", r.keyColumn, key, target)
+	}
+	r.cache.set(key, target)
+	return target, nil
+}
+
+// ================== Directory Cache ==================
+
+type directoryCacheEntry struct {
+	target    string
+	expiresAt time.Time
+}
+
+// directoryCache is a small TTL cache for resolved directory targets. A nil
+// cache is valid and never hits.
+type directoryCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]directoryCacheEntry
+}
+
+func newDirectoryCache(ttl time.Duration, maxEntries int) *directoryCache {
+	return &directoryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]directoryCacheEntry),
+	}
+}
+
+func (c *directoryCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.target, true
+}
+
+func (c *directoryCache) set(key, target string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		// Still full: evict an arbitrary entry to bound memory.
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = directoryCacheEntry{target: target, expiresAt: now.Add(c.ttl)}
+}
+
+// ================== Built-in Directories ==================
+
+type tableStoreShardDirectory[T dbspi.Entity] struct {
+	store     dbspi.TableStore[T]
+	keyColumn dbspi.Column
+	target    func(T) string
+}
+
+// NewTableStoreShardDirectory creates a ShardDirectory backed by a metadata
+// table. Lookup finds the row whose keyColumn equals the key and maps it to a
+// target with the target function.
+func NewTableStoreShardDirectory[T dbspi.Entity](store dbspi.TableStore[T], keyColumn dbspi.Column, target func(T) string) dbspi.ShardDirectory {
+	return &tableStoreShardDirectory[T]{store: store, keyColumn: keyColumn, target: target}
+}
+
+func (d *tableStoreShardDirectory[T]) Lookup(ctx context.Context, key string) (string, error) {
+	var value any = key
+	exists, entity, err := d.store.Exists(ctx, NewQuery(NewField[any](d.keyColumn.Name()).Eq(&value)))
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", dbspi.ErrShardDirectoryEntryNotFound
+	}
+	return d.target(entity), nil
+}
+
+type cacheShardDirectory struct {
+	cache     cachespi.Cache
+	keyPrefix string
+}
+
+// NewCacheShardDirectory creates a ShardDirectory backed by a cache. Lookup
+// reads the string target stored under keyPrefix+key.
+func NewCacheShardDirectory(cache cachespi.Cache, keyPrefix string) dbspi.ShardDirectory {
+	return &cacheShardDirectory{cache: cache, keyPrefix: keyPrefix}
+}
+
+func (d *cacheShardDirectory) Lookup(ctx context.Context, key string) (string, error) {
+	var target string
+	err := d.cache.Get(ctx, d.keyPrefix+key, &target)
+	if errors.Is(err, cachespi.ErrCacheMiss) {
+		return "", dbspi.ErrShardDirectoryEntryNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return target, nil
+}
@@ -0,0 +1,201 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+type mapShardDirectory struct {
+	targets map[string]string
+	calls   int
+}
+
+func (d *mapShardDirectory) Lookup(_ context.Context, key string) (string, error) {
+	d.calls++
+	target, ok := d.targets[key]
+	if !ok {
+		return "", dbspi.ErrShardDirectoryEntryNotFound
+	}
+	return target, nil
+}
+
+func TestDirectoryRuleResolvesAndCaches(t *testing.T) {
+	dir := &mapShardDirectory{targets: map[string]string{"1001": "vip_db"}}
+	rule, err := NewDirectoryRule(dir, dbspi.DirectoryShardingConfig{
+		Directory: "tenant",
+		KeyColumn: "tenant_id",
+	}, []string{"vip_db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk := dbspi.NewShardingKey().SetValue("tenant_id", int64(1001))
+	for i := 0; i < 3; i++ {
+		got, err := rule.ResolveDatabaseTargetKey(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != "vip_db" {
+			t.Fatalf("expected vip_db, got %q", got)
+		}
+	}
+	if dir.calls != 1 {
+		t.Fatalf("expected 1 directory lookup with local cache, got %d", dir.calls)
+	}
+}
+
+func TestDirectoryRuleCacheDisabled(t *testing.T) {
+	dir := &mapShardDirectory{targets: map[string]string{"1001": "vip_db"}}
+	rule, err := NewDirectoryRule(dir, dbspi.DirectoryShardingConfig{
+		KeyColumn:       "tenant_id",
+		CacheTTLSeconds: -1,
+	}, []string{"vip_db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := dbspi.NewShardingKey().SetValue("tenant_id", int64(1001))
+	_, _ = rule.ResolveDatabaseTargetKey(sk)
+	_, _ = rule.ResolveDatabaseTargetKey(sk)
+	if dir.calls != 2 {
+		t.Fatalf("expected 2 directory lookups without cache, got %d", dir.calls)
+	}
+}
+
+func TestDirectoryRuleDefaultTarget(t *testing.T) {
+	dir := &mapShardDirectory{targets: map[string]string{}}
+	rule, err := NewDirectoryRule(dir, dbspi.DirectoryShardingConfig{
+		KeyColumn:     "tenant_id",
+		DefaultTarget: "shared_db",
+	}, []string{"shared_db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := rule.ResolveDatabaseTargetKey(dbspi.NewShardingKey().SetValue("tenant_id", 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "shared_db" {
+		t.Fatalf("expected shared_db, got %q", got)
+	}
+}
+
+func TestDirectoryRuleNotFound(t *testing.T) {
+	dir := &mapShardDirectory{targets: map[string]string{}}
+	rule, err := NewDirectoryRule(dir, dbspi.DirectoryShardingConfig{KeyColumn: "tenant_id"}, []string{"order_tab_a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rule.ResolveTable("order_tab", dbspi.NewShardingKey().SetValue("tenant_id", 7))
+	if !errors.Is(err, dbspi.ErrShardDirectoryEntryNotFound) {
+		t.Fatalf("expected ErrShardDirectoryEntryNotFound, got: %v", err)
+	}
+}
+
+func TestDirectoryRuleTableEnumeration(t *testing.T) {
+	rule, err := NewDirectoryRule(&mapShardDirectory{}, dbspi.DirectoryShardingConfig{
+		KeyColumn: "tenant_id",
+		Tables:    []string{"order_tab_hot", "order_tab_cold"},
+	}, []string{"order_tab_hot", "order_tab_cold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.ShardCount() != 2 {
+		t.Fatalf("expected 2 shards, got %d", rule.ShardCount())
+	}
+	name, err := rule.ShardName("order_tab", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "order_tab_cold" {
+		t.Fatalf("expected order_tab_cold, got %q", name)
+	}
+	if _, err := rule.ShardName("order_tab", 2); err == nil {
+		t.Fatal("expected out of range error")
+	}
+}
+
+func TestDirectoryRuleRequiresKeyColumn(t *testing.T) {
+	if _, err := NewDirectoryRule(&mapShardDirectory{}, dbspi.DirectoryShardingConfig{}, []string{"db"}); err == nil {
+		t.Fatal("expected error for missing key_column")
+	}
+}
+
+func TestDirectoryRuleAutoKeyExtraction(t *testing.T) {
+	rule, err := NewDirectoryRule(&mapShardDirectory{}, dbspi.DirectoryShardingConfig{KeyColumn: "shop_id"}, []string{"db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := buildShardingKeyResolver(reflect.TypeOf(&testOrder{}), dbspi.DefaultIdFieldName, rule, nil)
+	if resolver == nil {
+		t.Fatal("expected resolver for directory rule")
+	}
+	if !reflect.DeepEqual(resolver.requiredCols, []string{"shop_id"}) {
+		t.Fatalf("expected [shop_id], got %v", resolver.requiredCols)
+	}
+}
+
+func TestBuildDirectoryRuleUnregistered(t *testing.T) {
+	_, err := buildDirectoryRule(&dbspi.DirectoryShardingConfig{Directory: "missing", KeyColumn: "tenant_id"}, nil, nil)
+	if err == nil {
+		t.Fatal("expected error for unregistered directory")
+	}
+}
+
+func TestDirectoryRuleRejectsUnknownTargets(t *testing.T) {
+	dir := &mapShardDirectory{targets: map[string]string{"1001": "retired_db"}}
+	rule, err := NewDirectoryRule(dir, dbspi.DirectoryShardingConfig{KeyColumn: "tenant_id"}, []string{"vip_db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk := dbspi.NewShardingKey().SetValue("tenant_id", 1001)
+	for i := 0; i < 2; i++ {
+		if _, err := rule.ResolveDatabaseTargetKey(sk); err == nil {
+			t.Fatal("expected error for a target outside the configured set")
+		}
+	}
+	if dir.calls != 2 {
+		t.Fatalf("expected unknown targets not to be cached, got %d lookups", dir.calls)
+	}
+
+	_, err = NewDirectoryRule(dir, dbspi.DirectoryShardingConfig{KeyColumn: "tenant_id", DefaultTarget: "shared_db"}, []string{"vip_db"})
+	if err == nil {
+		t.Fatal("expected error for an unknown default target")
+	}
+}
+
+func TestBuildTableDirectoryRuleRequiresTables(t *testing.T) {
+	directories := map[string]dbspi.ShardDirectory{"tenant": &mapShardDirectory{}}
+	_, err := buildTableDirectoryRule(&dbspi.DirectoryShardingConfig{Directory: "tenant", KeyColumn: "tenant_id"}, directories)
+	if err == nil {
+		t.Fatal("expected error for a table directory without tables")
+	}
+}
+
+type ctxShardDirectory struct{}
+
+func (ctxShardDirectory) Lookup(ctx context.Context, _ string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return "vip_db", nil
+}
+
+func TestDirectoryRuleUsesOperationContext(t *testing.T) {
+	rule, err := NewDirectoryRule(ctxShardDirectory{}, dbspi.DirectoryShardingConfig{KeyColumn: "tenant_id", CacheTTLSeconds: -1}, []string{"vip_db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sk := dbspi.NewShardingKey().SetValue("tenant_id", 1001)
+	if _, err := resolveDatabaseTargetKey(ctx, rule, sk); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected lookup to see the canceled ctx, got %v", err)
+	}
+	if _, err := resolveTable(context.Background(), rule, "order_tab", sk); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,6 +17,7 @@ var (
 type exprDbRule struct {
 	tmpl    *expr.Template
 	expands *expr.ExpandSet
+	lookups map[string]map[string]string
 }
 
 // NewExprDbRule creates a DB sharding rule from a name expression template and expand set.
@@ -24,6 +25,12 @@ func NewExprDbRule(tmpl *expr.Template, expands *expr.ExpandSet) *exprDbRule {
 	return &exprDbRule{tmpl: tmpl, expands: expands}
 }
 
+// NewExprDbRuleWithLookupMaps creates a DB sharding rule whose expand
+// expressions may resolve keys through the given named lookup maps.
+func NewExprDbRuleWithLookupMaps(tmpl *expr.Template, expands *expr.ExpandSet, lookups map[string]map[string]string) *exprDbRule {
+	return &exprDbRule{tmpl: tmpl, expands: expands, lookups: lookups}
+}
+
 func (r *exprDbRule) ResolveDatabaseTargetKey(sk *dbspi.ShardingKey) (string, error) {
 	if sk == nil {
 		return "", dbspi.ErrShardingKeyRequired
@@ -41,6 +48,7 @@ func (r *exprDbRule) RequiredColumns() []string {
 
 func (r *exprDbRule) buildContext(sk *dbspi.ShardingKey) (*expr.EvalContext, error) {
 	ctx := expr.NewContext()
+	ctx.SetLookupMaps(r.lookups)
 	if err := ctx.LoadColumnsFromMap(sk.Fields()); err != nil {
 		return nil, fmt.Errorf("load sharding key: %w", err)
 	}
@@ -47,6 +47,86 @@ func TestExprDbRuleRegion(t *testing.T) {
 	}
 }
 
+func TestExprDbRuleLookupMap(t *testing.T) {
+	rule, err := BuildExprDbRuleWithLookupMaps("order_db_${db}", []string{
+		`${db} := enum(0, 1, 2, 3, vip_a)`,
+		`${db} = lookup(@{tenant_id}, "vip_map", @{tenant_id} % 4)`,
+	}, map[string]map[string]string{
+		"vip_map": {"1001": "vip_a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tenantID int64
+		want     string
+	}{
+		{1001, "order_db_vip_a"},
+		{1002, "order_db_2"},
+	}
+	for _, tt := range tests {
+		sk := dbspi.NewShardingKey().SetValue("tenant_id", tt.tenantID)
+		got, err := rule.ResolveDatabaseTargetKey(sk)
+		if err != nil {
+			t.Fatalf("tenant_id=%d: %v", tt.tenantID, err)
+		}
+		if got != tt.want {
+			t.Fatalf("tenant_id=%d: expected %q, got %q", tt.tenantID, tt.want, got)
+		}
+	}
+
+	names, err := rule.(*exprDbRule).EnumerateDbNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 5 || names[4] != "order_db_vip_a" {
+		t.Fatalf("expected VIP db in enumeration, got %v", names)
+	}
+}
+
+func TestExprDbRuleUndefinedLookupMap(t *testing.T) {
+	_, err := BuildExprDbRuleWithLookupMaps("order_db_${db}", []string{
+		`${db} := enum(0, 1)`,
+		`${db} = lookup(@{tenant_id}, "vip_map", 0)`,
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "vip_map") {
+		t.Fatalf("expected undefined lookup map error, got: %v", err)
+	}
+}
+
+func TestExprDbRuleLookupValueNotDeclared(t *testing.T) {
+	_, err := BuildExprDbRuleWithLookupMaps("order_db_${db}", []string{
+		`${db} := enum(0, 1, 2, 3)`,
+		`${db} = if(@{tenant_id} > 1000, lookup(@{tenant_id}, "vip_map", 0), @{tenant_id} % 4)`,
+	}, map[string]map[string]string{
+		"vip_map": {"1001": "vip_a"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "vip_a") {
+		t.Fatalf("expected undeclared lookup value error, got: %v", err)
+	}
+
+	_, err = BuildExprDbRuleWithLookupMaps("order_db_${db}", []string{
+		`${db} := range(0, 4)`,
+		`${db} = lookup(@{tenant_id}, "vip_map", @{tenant_id} % 4)`,
+	}, map[string]map[string]string{
+		"vip_map": {"1001": "3"},
+	})
+	if err != nil {
+		t.Fatalf("expected value within range to be accepted, got: %v", err)
+	}
+}
+
+func TestExprTableRuleRejectsLookup(t *testing.T) {
+	_, err := BuildExprTableRule("order_tab_${idx}", []string{
+		`${idx} := range(0, 4)`,
+		`${idx} = lookup(@{tenant_id}, "vip_map", 0)`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "lookup") {
+		t.Fatalf("expected lookup rejection for table rule, got: %v", err)
+	}
+}
+
 func TestExprDbRuleEnumerate(t *testing.T) {
 	tmpl, err := expr.ParseTemplate("order_${region}_db")
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/MrMiaoMIMI/goshared/db/dbspi"
 	"github.com/MrMiaoMIMI/goshared/db/internal/dbsp/expr"
@@ -73,6 +74,13 @@ func WithCommonFieldAutoFill(commonFields CommonFieldAutoFillOptions) ShardOptio
 // BuildExprDbRule creates an expression-based DB sharding rule from a name template
 // and expand expressions.
 func BuildExprDbRule(nameExpr string, expandExprs []string) (DatabaseShardingRule, error) {
+	return BuildExprDbRuleWithLookupMaps(nameExpr, expandExprs, nil)
+}
+
+// BuildExprDbRuleWithLookupMaps is like BuildExprDbRule but also binds the named
+// maps used by lookup(key, "map_name"). Every map referenced by the expand
+// expressions must be present in lookupMaps.
+func BuildExprDbRuleWithLookupMaps(nameExpr string, expandExprs []string, lookupMaps map[string]map[string]string) (DatabaseShardingRule, error) {
 	tmpl, err := expr.ParseTemplate(nameExpr)
 	if err != nil {
 		return nil, fmt.Errorf("parse db name_expr %q: %w", nameExpr, err)
@@ -81,8 +89,16 @@ func BuildExprDbRule(nameExpr string, expandExprs []string) (DatabaseShardingRul
 	if err != nil {
 		return nil, fmt.Errorf("parse db expand_exprs: %w", err)
 	}
+	for _, name := range expands.LookupMapNames() {
+		if _, ok := lookupMaps[name]; !ok {
+			return nil, fmt.Errorf("db expand_exprs reference undefined lookup map %q", name)
+		}
+	}
+	if err := expands.ValidateLookupValues(lookupMaps); err != nil {
+		return nil, fmt.Errorf("db lookup_maps: %w", err)
+	}
 	autoInferIdentityComputes(tmpl, expands)
-	return NewExprDbRule(tmpl, expands), nil
+	return NewExprDbRuleWithLookupMaps(tmpl, expands, lookupMaps), nil
 }
 
 // BuildExprTableRule creates an expression-based table sharding rule from a name template
@@ -96,6 +112,9 @@ func BuildExprTableRule(nameExpr string, expandExprs []string) (TableShardingRul
 	if err != nil {
 		return nil, fmt.Errorf("parse table expand_exprs: %w", err)
 	}
+	if names := expands.LookupMapNames(); len(names) > 0 {
+		return nil, fmt.Errorf("table expand_exprs reference lookup maps %v; lookup() is only supported in database_sharding", names)
+	}
 	return NewExprTableRule(tmpl, expands)
 }
 
@@ -207,7 +226,7 @@ type ShardingConfig struct {
 func NewShardedTableStoreFromConfig[T dbspi.Entity](entity T, cfg ShardingConfig) dbspi.TableStore[T] {
 	var opts []ShardOption
 
-	dbs, err := buildDatabaseTargets(cfg)
+	dbs, err := buildDatabaseTargets(cfg, NewGormDb)
 	if err != nil {
 		panic(fmt.Sprintf("sharding config: build db targets: %v", err))
 	}
@@ -236,20 +255,20 @@ func NewShardedTableStoreFromConfig[T dbspi.Entity](entity T, cfg ShardingConfig
 	return NewShardedTableStoreWithOptions(entity, opts...)
 }
 
-func newDbFromServer(server dbspi.ServerConfig, dbName string) dbSession {
+func newDbFromServer(server dbspi.ServerConfig, dbName string, dial dbDialer) dbSession {
 	if server.DSN == "" && dbName != "" {
 		server.DatabaseName = dbName
 	}
-	return NewGormDb(server)
+	return dial(server)
 }
 
-func buildDatabaseTargets(cfg ShardingConfig) ([]DatabaseTarget, error) {
+func buildDatabaseTargets(cfg ShardingConfig, dial dbDialer) ([]DatabaseTarget, error) {
 	if len(cfg.Servers) > 0 {
 		targets := make([]DatabaseTarget, len(cfg.Servers))
 		for i, s := range cfg.Servers {
 			targets[i] = DatabaseTarget{
 				Key: s.Key,
-				Db:  newDbFromServer(s.ServerConfig, s.DatabaseName),
+				Db:  newDbFromServer(s.ServerConfig, s.DatabaseName, dial),
 			}
 		}
 		return targets, nil
@@ -281,20 +300,20 @@ func buildDatabaseTargets(cfg ShardingConfig) ([]DatabaseTarget, error) {
 		for i, name := range dbNames {
 			targets[i] = DatabaseTarget{
 				Key: name,
-				Db:  newDbFromServer(*cfg.Server, name),
+				Db:  newDbFromServer(*cfg.Server, name, dial),
 			}
 		}
 		return targets, nil
 	}
 
-	return SingleDb(newDbFromServer(*cfg.Server, cfg.Server.DatabaseName)), nil
+	return SingleDb(newDbFromServer(*cfg.Server, cfg.Server.DatabaseName, dial)), nil
 }
 
 func buildDbRule(cfg *dbspi.DatabaseShardingConfig) (DatabaseShardingRule, error) {
 	if cfg == nil || cfg.NameExpr == "" {
 		return nil, nil
 	}
-	return BuildExprDbRule(cfg.NameExpr, cfg.ExpandExprs)
+	return BuildExprDbRuleWithLookupMaps(cfg.NameExpr, cfg.ExpandExprs, cfg.LookupMaps)
 }
 
 func buildTableRule(cfg *dbspi.TableShardingConfig) (TableShardingRule, error) {
@@ -304,6 +323,34 @@ func buildTableRule(cfg *dbspi.TableShardingConfig) (TableShardingRule, error) {
 	return BuildExprTableRule(cfg.NameExpr, cfg.ExpandExprs)
 }
 
+// buildDirectoryRule builds a database directory rule whose targets are the
+// keys of dbs.
+func buildDirectoryRule(cfg *dbspi.DirectoryShardingConfig, directories map[string]dbspi.ShardDirectory, dbs []DatabaseTarget) (*directoryRule, error) {
+	directory, ok := directories[cfg.Directory]
+	if !ok {
+		return nil, fmt.Errorf("shard directory %q not registered; use dbhelper.WithShardDirectory", cfg.Directory)
+	}
+	targets := make([]string, len(dbs))
+	for i, db := range dbs {
+		targets[i] = db.Key
+	}
+	return NewDirectoryRule(directory, *cfg, targets)
+}
+
+// buildTableDirectoryRule builds a table directory rule whose targets are
+// cfg.Tables. The tables are required: without them FindAll and CountAll
+// could not enumerate the shards.
+func buildTableDirectoryRule(cfg *dbspi.DirectoryShardingConfig, directories map[string]dbspi.ShardDirectory) (*directoryRule, error) {
+	directory, ok := directories[cfg.Directory]
+	if !ok {
+		return nil, fmt.Errorf("shard directory %q not registered; use dbhelper.WithShardDirectory", cfg.Directory)
+	}
+	if len(cfg.Tables) == 0 {
+		return nil, fmt.Errorf("table directory %q requires tables listing every physical table", cfg.Directory)
+	}
+	return NewDirectoryRule(directory, *cfg, cfg.Tables)
+}
+
 // autoInferIdentityComputes checks if a ${var} in the template matches a := declaration
 // but has no corresponding = computation. If so, it auto-generates "${var} = @{var}".
 func autoInferIdentityComputes(tmpl *expr.Template, expands *expr.ExpandSet) {
@@ -337,6 +384,12 @@ func autoInferIdentityComputes(tmpl *expr.Template, expands *expr.ExpandSet) {
 }
 
 type resolvedDbEntry struct {
+	cfg dbspi.DatabaseGroupConfig
+
+	// inFlight counts operations and transactions currently using this entry;
+	// Reload waits for it to drop to zero before closing retired connections.
+	inFlight int64
+
 	db  dbSession
 	dbs []DatabaseTarget
 
@@ -358,7 +411,11 @@ type txBoundDbRule struct {
 }
 
 func (r txBoundDbRule) ResolveDatabaseTargetKey(key *dbspi.ShardingKey) (string, error) {
-	got, err := r.rule.ResolveDatabaseTargetKey(key)
+	return r.ResolveDatabaseTargetKeyContext(context.Background(), key)
+}
+
+func (r txBoundDbRule) ResolveDatabaseTargetKeyContext(ctx context.Context, key *dbspi.ShardingKey) (string, error) {
+	got, err := resolveDatabaseTargetKey(ctx, r.rule, key)
 	if err != nil {
 		return "", err
 	}
@@ -379,9 +436,17 @@ func (r txBoundDbRuleWithColumns) RequiredColumns() []string {
 
 // Manager manages database connections and sharding configurations.
 type Manager struct {
+	// mu guards entries and conns. Reload swaps both while holding reloadMu
+	// as well.
 	mu           sync.RWMutex
 	entries      map[string]*resolvedDbEntry
 	commonFields CommonFieldAutoFillOptions
+
+	// The fields below are only set on managers built from config.
+	// Transaction-scoped managers leave them empty and cannot be reloaded.
+	reloadMu sync.Mutex
+	opts     ManagerOptions
+	conns    map[string]map[string]dbSession
 }
 
 func (*Manager) ManagerHandle() {}
@@ -405,14 +470,13 @@ func (m *Manager) Transaction(ctx context.Context, dbKey string, shardingKey *db
 		dbKey = dbspi.DefaultDatabaseGroupKey
 	}
 
-	m.mu.RLock()
-	entry, ok := m.entries[dbKey]
-	m.mu.RUnlock()
+	entry, ok := m.acquireEntry(dbKey)
 	if !ok {
 		return fmt.Errorf("dbhelper: database config %q not found", dbKey)
 	}
+	defer entry.release()
 
-	db, targetKey, err := resolveTransactionDb(entry, shardingKey)
+	db, targetKey, err := resolveTransactionDb(ctx, entry, shardingKey)
 	if err != nil {
 		return err
 	}
@@ -429,12 +493,46 @@ func (m *Manager) Transaction(ctx context.Context, dbKey string, shardingKey *db
 	})
 }
 
-func resolveTransactionDb(entry *resolvedDbEntry, shardingKey *dbspi.ShardingKey) (dbSession, string, error) {
+// WithRowLock returns a copy of the transaction-scoped manager m whose table
+// stores lock the rows read by Find, Exists, GetById and ExistsById. It fails
+// with dbspi.ErrRowLockRequiresTransaction unless m was passed to the fn of
+// Transaction.
+func (m *Manager) WithRowLock(lock dbspi.RowLock) (*Manager, error) {
+	if m == nil {
+		return nil, dbspi.ErrRowLockRequiresTransaction
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	lockMgr := &Manager{entries: make(map[string]*resolvedDbEntry, len(m.entries)), commonFields: m.commonFields}
+	for key, entry := range m.entries {
+		lockEntry := *entry
+		lockEntry.inFlight = 0
+		if entry.db != nil {
+			db, err := lockingSession(entry.db, lock)
+			if err != nil {
+				return nil, err
+			}
+			lockEntry.db = db
+		}
+		lockEntry.dbs = make([]DatabaseTarget, len(entry.dbs))
+		for i, target := range entry.dbs {
+			db, err := lockingSession(target.Db, lock)
+			if err != nil {
+				return nil, err
+			}
+			lockEntry.dbs[i] = DatabaseTarget{Key: target.Key, Db: db}
+		}
+		lockMgr.entries[key] = &lockEntry
+	}
+	return lockMgr, nil
+}
+
+func resolveTransactionDb(ctx context.Context, entry *resolvedDbEntry, shardingKey *dbspi.ShardingKey) (dbSession, string, error) {
 	if entry.dbRule != nil {
 		if shardingKey == nil {
 			return nil, "", fmt.Errorf("dbhelper: transaction on db-sharded database requires WithTransactionShardingKey")
 		}
-		targetKey, err := entry.dbRule.ResolveDatabaseTargetKey(shardingKey)
+		targetKey, err := resolveDatabaseTargetKey(ctx, entry.dbRule, shardingKey)
 		if err != nil {
 			return nil, "", fmt.Errorf("resolve transaction db key failed: %w", err)
 		}
@@ -465,6 +563,7 @@ func findDatabaseTarget(dbs []DatabaseTarget, targetKey string) (dbSession, erro
 
 func cloneEntryForTransaction(entry *resolvedDbEntry, txDb dbSession, targetKey string) *resolvedDbEntry {
 	txEntry := *entry
+	txEntry.inFlight = 0
 	txEntry.db = txDb
 	txEntry.dbs = []DatabaseTarget{{Key: targetKey, Db: txDb}}
 	if entry.dbRule != nil {
@@ -483,15 +582,51 @@ var (
 	defaultManagerMu sync.RWMutex
 )
 
+// ManagerOptions carries the runtime dependencies of a Manager that cannot be
+// expressed in dbspi.DatabaseConfig.
+type ManagerOptions struct {
+	CommonFields CommonFieldAutoFillOptions
+
+	// ShardDirectories maps directory names referenced by
+	// DirectoryShardingConfig.Directory to their implementations.
+	ShardDirectories map[string]dbspi.ShardDirectory
+
+	// ReloadDrainTimeout bounds how long Reload waits for in-flight operations
+	// before closing retired connections. Zero uses
+	// dbspi.DefaultReloadDrainTimeoutSeconds.
+	ReloadDrainTimeout time.Duration
+
+	// Metrics receives an observation for every statement executed on the
+	// manager's connections. Nil disables metrics.
+	Metrics dbspi.MetricsRecorder
+
+	// dial opens database sessions. It defaults to NewGormDb and is replaced
+	// in tests that run without a database server.
+	dial dbDialer
+}
+
 // NewManager creates a new Manager from the given configuration.
 func NewManager(cfg dbspi.DatabaseConfig, commonFields CommonFieldAutoFillOptions) *Manager {
+	return NewManagerWithOptions(cfg, ManagerOptions{CommonFields: commonFields})
+}
+
+// NewManagerWithOptions creates a new Manager from the given configuration and
+// runtime options.
+func NewManagerWithOptions(cfg dbspi.DatabaseConfig, opts ManagerOptions) *Manager {
+	opts.CommonFields = opts.CommonFields.Normalize()
+	if opts.dial == nil {
+		opts.dial = NewGormDb
+	}
 	mgr := &Manager{
 		entries:      make(map[string]*resolvedDbEntry, len(cfg.DatabaseGroups)),
-		commonFields: commonFields.Normalize(),
+		commonFields: opts.CommonFields,
+		opts:         opts,
 	}
+	pool := newConnectionPool(opts.dial, opts.Metrics, nil)
 	for name, entry := range cfg.DatabaseGroups {
-		mgr.entries[name] = resolveDbEntry(entry)
+		mgr.entries[name] = resolveDbEntry(name, entry, opts, pool.dialer(name))
 	}
+	mgr.conns = pool.opened
 	return mgr
 }
 
@@ -533,29 +668,24 @@ func ForWithCommonFieldAutoFill[T dbspi.Entity](entity T, mgr *Manager, commonFi
 		key = provider.DatabaseGroupKey()
 	}
 
-	mgr.mu.RLock()
-	entry, ok := mgr.entries[key]
-	if !ok {
-		entry, ok = mgr.entries[dbspi.DefaultDatabaseGroupKey]
-	}
-	mgr.mu.RUnlock()
-
+	entry, ok := mgr.acquireEntry(key, dbspi.DefaultDatabaseGroupKey)
 	if !ok {
 		panic(fmt.Sprintf("dbhelper: database config %q not found (and no %q fallback)", key, dbspi.DefaultDatabaseGroupKey))
 	}
+	defer entry.release()
 
-	tableName := entity.TableName()
-	tableRule := entry.defaultTableRule
-	maxConcurrency := entry.maxConcurrency
-
-	if override, exists := entry.entityOverrides[tableName]; exists {
-		if override.tableRule != nil {
-			tableRule = override.tableRule
-		}
-		if override.maxConcurrency != nil {
-			maxConcurrency = *override.maxConcurrency
-		}
+	store := newEntryTableStore(entity, entry, commonFields)
+	if !mgr.reloadable() {
+		// Transaction-scoped managers are never reloaded.
+		return store
 	}
+	return newManagedTableStore(entity, mgr, key, commonFields, entry, store)
+}
+
+// newEntryTableStore builds the table store for entity from one resolved
+// database group.
+func newEntryTableStore[T dbspi.Entity](entity T, entry *resolvedDbEntry, commonFields CommonFieldAutoFillOptions) dbspi.TableStore[T] {
+	tableRule, maxConcurrency := entry.tableRuleFor(entity.TableName())
 
 	if entry.dbRule == nil && tableRule == nil {
 		db := entry.db
@@ -584,6 +714,22 @@ func ForWithCommonFieldAutoFill[T dbspi.Entity](entity T, mgr *Manager, commonFi
 	return NewShardedTableStoreWithOptions(entity, opts...)
 }
 
+// tableRuleFor returns the table rule and scatter-gather concurrency for the
+// logical table, applying per-table overrides.
+func (e *resolvedDbEntry) tableRuleFor(tableName string) (TableShardingRule, int) {
+	tableRule := e.defaultTableRule
+	maxConcurrency := e.maxConcurrency
+	if override, exists := e.entityOverrides[tableName]; exists {
+		if override.tableRule != nil {
+			tableRule = override.tableRule
+		}
+		if override.maxConcurrency != nil {
+			maxConcurrency = *override.maxConcurrency
+		}
+	}
+	return tableRule, maxConcurrency
+}
+
 // ForSoftDelete creates a SoftDeleteTableStore for the given entity using the Manager.
 func ForSoftDelete[T dbspi.Entity](entity T, managers ...*Manager) dbspi.SoftDeleteTableStore[T] {
 	store := For(entity, managers...)
@@ -603,14 +749,27 @@ func ForSoftDeleteWithCommonFieldAutoFill[T dbspi.Entity](entity T, mgr *Manager
 	return softDeleteStore
 }
 
-func resolveDbEntry(entry dbspi.DatabaseGroupConfig) *resolvedDbEntry {
+// resolveDbEntry builds the entry of the database group name. Targets are
+// wrapped with the circuit breaker and timeouts the group configures.
+func resolveDbEntry(name string, entry dbspi.DatabaseGroupConfig, opts ManagerOptions, dial dbDialer) *resolvedDbEntry {
 	resolved := &resolvedDbEntry{
+		cfg:             entry,
 		entityOverrides: make(map[string]*entityOverride),
 		maxConcurrency:  entry.MaxConcurrency,
 	}
 
 	serverCfg := toServerConfig(entry)
 
+	if entry.DatabaseSharding != nil && entry.DatabaseDirectory != nil {
+		panic("dbhelper: database_sharding and database_directory are mutually exclusive")
+	}
+	if entry.DatabaseDirectory != nil && len(entry.Servers) == 0 {
+		panic("dbhelper: database_directory requires the Servers list; directory targets must match server keys")
+	}
+	if entry.TableSharding != nil && entry.TableDirectory != nil {
+		panic("dbhelper: table_sharding and table_directory are mutually exclusive")
+	}
+
 	if entry.DatabaseSharding != nil || len(entry.Servers) > 0 {
 		if entry.DatabaseSharding != nil && len(entry.Servers) == 0 && entry.DSN != "" {
 			panic("dbhelper: DSN cannot be used with database_sharding on a single server " +
@@ -626,11 +785,11 @@ func resolveDbEntry(entry dbspi.DatabaseGroupConfig) *resolvedDbEntry {
 		} else {
 			shardCfg.Server = &serverCfg
 		}
-		dbs, err := buildDatabaseTargets(shardCfg)
+		dbs, err := buildDatabaseTargets(shardCfg, dial)
 		if err != nil {
 			panic(fmt.Sprintf("dbhelper: build db targets: %v", err))
 		}
-		resolved.dbs = dbs
+		resolved.dbs = guardTargets(name, dbs, entry)
 		if entry.DatabaseSharding != nil {
 			rule, err := buildDbRule(entry.DatabaseSharding)
 			if err != nil {
@@ -638,8 +797,15 @@ func resolveDbEntry(entry dbspi.DatabaseGroupConfig) *resolvedDbEntry {
 			}
 			resolved.dbRule = rule
 		}
+		if entry.DatabaseDirectory != nil {
+			rule, err := buildDirectoryRule(entry.DatabaseDirectory, opts.ShardDirectories, resolved.dbs)
+			if err != nil {
+				panic(fmt.Sprintf("dbhelper: build db directory rule: %v", err))
+			}
+			resolved.dbRule = rule
+		}
 	} else {
-		resolved.db = newDbFromServer(serverCfg, entry.DatabaseName)
+		resolved.db = guardSession(newDbFromServer(serverCfg, entry.DatabaseName, dial), newTargetGuard(name, "", entry))
 	}
 
 	if entry.TableSharding != nil {
@@ -649,8 +815,18 @@ func resolveDbEntry(entry dbspi.DatabaseGroupConfig) *resolvedDbEntry {
 		}
 		resolved.defaultTableRule = rule
 	}
+	if entry.TableDirectory != nil {
+		rule, err := buildTableDirectoryRule(entry.TableDirectory, opts.ShardDirectories)
+		if err != nil {
+			panic(fmt.Sprintf("dbhelper: build table directory rule: %v", err))
+		}
+		resolved.defaultTableRule = rule
+	}
 
 	for _, rule := range entry.TableRules {
+		if rule.TableSharding != nil && rule.TableDirectory != nil {
+			panic(fmt.Sprintf("dbhelper: table rule for %v sets both table_sharding and table_directory", rule.Tables))
+		}
 		override := &entityOverride{
 			maxConcurrency: rule.MaxConcurrency,
 		}
@@ -667,6 +843,13 @@ func resolveDbEntry(entry dbspi.DatabaseGroupConfig) *resolvedDbEntry {
 			}
 			override.tableRule = tableRule
 		}
+		if rule.TableDirectory != nil {
+			tableRule, err := buildTableDirectoryRule(rule.TableDirectory, opts.ShardDirectories)
+			if err != nil {
+				panic(fmt.Sprintf("dbhelper: build entity table directory rule: %v", err))
+			}
+			override.tableRule = tableRule
+		}
 		for _, tblName := range rule.Tables {
 			resolved.entityOverrides[tblName] = override
 		}
@@ -677,15 +860,16 @@ func resolveDbEntry(entry dbspi.DatabaseGroupConfig) *resolvedDbEntry {
 
 func toServerConfig(entry dbspi.DatabaseGroupConfig) dbspi.ServerConfig {
 	return dbspi.ServerConfig{
-		DSN:                    entry.DSN,
-		Host:                   entry.Host,
-		Port:                   entry.Port,
-		User:                   entry.User,
-		Password:               entry.Password,
-		DatabaseName:           entry.DatabaseName,
-		Debug:                  entry.Debug,
-		MaxOpenConns:           entry.MaxOpenConns,
-		MaxIdleConns:           entry.MaxIdleConns,
-		ConnMaxLifetimeSeconds: entry.ConnMaxLifetimeSeconds,
+		DSN:                      entry.DSN,
+		Host:                     entry.Host,
+		Port:                     entry.Port,
+		User:                     entry.User,
+		Password:                 entry.Password,
+		DatabaseName:             entry.DatabaseName,
+		Debug:                    entry.Debug,
+		MaxOpenConns:             entry.MaxOpenConns,
+		MaxIdleConns:             entry.MaxIdleConns,
+		ConnMaxLifetimeSeconds:   entry.ConnMaxLifetimeSeconds,
+		SlowQueryThresholdMillis: entry.SlowQueryThresholdMillis,
 	}
 }
@@ -1,6 +1,10 @@
 package dbsp
 
-import "github.com/MrMiaoMIMI/goshared/db/dbspi"
+import (
+	"context"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
 
 // DatabaseShardingRule resolves a ShardingKey to a target key string.
 // The returned string is matched against the configured database target key.
@@ -14,6 +18,37 @@ type TableShardingRule interface {
 	ResolveTable(logicalTable string, key *dbspi.ShardingKey) (string, error)
 }
 
+// ContextDatabaseShardingRule is an optional interface for database sharding
+// rules whose resolution does I/O, such as directory lookups. Routing passes
+// the operation ctx so the lookup honors its deadline and cancellation.
+type ContextDatabaseShardingRule interface {
+	ResolveDatabaseTargetKeyContext(ctx context.Context, key *dbspi.ShardingKey) (targetKey string, err error)
+}
+
+// ContextTableShardingRule is the table counterpart of
+// ContextDatabaseShardingRule.
+type ContextTableShardingRule interface {
+	ResolveTableContext(ctx context.Context, logicalTable string, key *dbspi.ShardingKey) (string, error)
+}
+
+// resolveDatabaseTargetKey resolves key with rule, passing ctx to rules that
+// implement ContextDatabaseShardingRule.
+func resolveDatabaseTargetKey(ctx context.Context, rule DatabaseShardingRule, key *dbspi.ShardingKey) (string, error) {
+	if r, ok := rule.(ContextDatabaseShardingRule); ok {
+		return r.ResolveDatabaseTargetKeyContext(ctx, key)
+	}
+	return rule.ResolveDatabaseTargetKey(key)
+}
+
+// resolveTable resolves key with rule, passing ctx to rules that implement
+// ContextTableShardingRule.
+func resolveTable(ctx context.Context, rule TableShardingRule, logicalTable string, key *dbspi.ShardingKey) (string, error) {
+	if r, ok := rule.(ContextTableShardingRule); ok {
+		return r.ResolveTableContext(ctx, logicalTable, key)
+	}
+	return rule.ResolveTable(logicalTable, key)
+}
+
 // TableShardCounter is an optional interface that table sharding rules can
 // implement to declare the total number of shards. Used by FindAll / CountAll
 // to enumerate all physical tables.
@@ -2,8 +2,10 @@ package dbsp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
@@ -207,16 +209,16 @@ func deduplicateValues(values []any) []any {
 
 // resolveTarget resolves a ShardingKey to the target routing coordinates (db key + table name)
 // without looking up the actual Db instance. Used for same-target validation.
-func (e *shardedTableStore[T]) resolveTarget(sk *dbspi.ShardingKey) (dbKey string, tableName string, err error) {
+func (e *shardedTableStore[T]) resolveTarget(ctx context.Context, sk *dbspi.ShardingKey) (dbKey string, tableName string, err error) {
 	if e.dbRule != nil {
-		dbKey, err = e.dbRule.ResolveDatabaseTargetKey(sk)
+		dbKey, err = resolveDatabaseTargetKey(ctx, e.dbRule, sk)
 		if err != nil {
 			return "", "", fmt.Errorf("resolve db key failed: %w", err)
 		}
 	}
 	tableName = e.entity.TableName()
 	if e.tableRule != nil {
-		tableName, err = e.tableRule.ResolveTable(e.entity.TableName(), sk)
+		tableName, err = resolveTable(ctx, e.tableRule, e.entity.TableName(), sk)
 		if err != nil {
 			return "", "", fmt.Errorf("resolve table failed: %w", err)
 		}
@@ -227,7 +229,7 @@ func (e *shardedTableStore[T]) resolveTarget(sk *dbspi.ShardingKey) (dbKey strin
 // reduceColumns deduplicates multi-value columns and validates that all distinct values
 // for each required sharding column route to the same target (db + table).
 // Returns a single-value map suitable for building a ShardingKey.
-func (e *shardedTableStore[T]) reduceColumns(multiCols map[string][]any) (map[string]any, error) {
+func (e *shardedTableStore[T]) reduceColumns(ctx context.Context, multiCols map[string][]any) (map[string]any, error) {
 	result := make(map[string]any)
 
 	type multiValEntry struct {
@@ -265,7 +267,7 @@ func (e *shardedTableStore[T]) reduceColumns(multiCols map[string][]any) (map[st
 	for _, col := range e.keyResolver.requiredCols {
 		refSk.SetValue(col, result[col])
 	}
-	refDbKey, refTable, err := e.resolveTarget(refSk)
+	refDbKey, refTable, err := e.resolveTarget(ctx, refSk)
 	if err != nil {
 		return nil, err
 	}
@@ -281,7 +283,7 @@ func (e *shardedTableStore[T]) reduceColumns(multiCols map[string][]any) (map[st
 					altSk.SetValue(reqCol, result[reqCol])
 				}
 			}
-			altDbKey, altTable, err := e.resolveTarget(altSk)
+			altDbKey, altTable, err := e.resolveTarget(ctx, altSk)
 			if err != nil {
 				return nil, fmt.Errorf("validate sharding column %q value %v: %w", mvc.name, altVal, err)
 			}
@@ -374,59 +376,107 @@ func (e *shardedTableStore[T]) findDb(targetKey string) (dbSession, error) {
 }
 
 // resolve determines the target Db and physical table name for the given ShardingKey.
-func (e *shardedTableStore[T]) resolve(sk *dbspi.ShardingKey) (dbSession, string, error) {
-	var db dbSession
+func (e *shardedTableStore[T]) resolve(ctx context.Context, sk *dbspi.ShardingKey) (dbSession, string, error) {
+	target, tableName, err := e.resolveShard(ctx, sk)
+	if err != nil {
+		return nil, "", err
+	}
+	return target.Db, tableName, nil
+}
+
+// resolveShard is like resolve but keeps the key of the target Db.
+func (e *shardedTableStore[T]) resolveShard(ctx context.Context, sk *dbspi.ShardingKey) (DatabaseTarget, string, error) {
+	target := e.dbs[0]
 
 	if e.dbRule != nil {
-		targetKey, err := e.dbRule.ResolveDatabaseTargetKey(sk)
+		targetKey, err := resolveDatabaseTargetKey(ctx, e.dbRule, sk)
 		if err != nil {
-			return nil, "", fmt.Errorf("resolve db key failed: %w", err)
+			return DatabaseTarget{}, "", fmt.Errorf("resolve db key failed: %w", err)
 		}
-		db, err = e.findDb(targetKey)
+		db, err := e.findDb(targetKey)
 		if err != nil {
-			return nil, "", err
+			return DatabaseTarget{}, "", err
 		}
-	} else {
-		db = e.dbs[0].Db
+		target = DatabaseTarget{Key: targetKey, Db: db}
 	}
 
 	tableName := e.entity.TableName()
 	if e.tableRule != nil {
 		var err error
-		tableName, err = e.tableRule.ResolveTable(e.entity.TableName(), sk)
+		tableName, err = resolveTable(ctx, e.tableRule, e.entity.TableName(), sk)
 		if err != nil {
-			return nil, "", fmt.Errorf("resolve table failed: %w", err)
+			return DatabaseTarget{}, "", fmt.Errorf("resolve table failed: %w", err)
 		}
 	}
 
-	return db, tableName, nil
+	return target, tableName, nil
 }
 
 // resolveStore creates a single-table store for the given ShardingKey.
-func (e *shardedTableStore[T]) resolveStore(sk *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
-	db, tableName, err := e.resolve(sk)
+func (e *shardedTableStore[T]) resolveStore(ctx context.Context, sk *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
+	target, tableName, err := e.resolveShard(ctx, sk)
 	if err != nil {
 		return nil, err
 	}
-	return NewTableStoreWithTableNameAndCommonFields(db, e.entity, tableName, e.commonFields), nil
+	store := NewTableStoreWithTableNameAndCommonFields(target.Db, e.entity, tableName, e.commonFields)
+	store.databaseKey = target.Key
+	return store, nil
+}
+
+// shardingKeyFromContext returns the ShardingKey in ctx. With
+// TenantShardingKey, the tenant of tenant-aware entities is added to it unless
+// the key already has the tenant column.
+func (e *shardedTableStore[T]) shardingKeyFromContext(ctx context.Context) (*dbspi.ShardingKey, bool) {
+	sk, ok := dbspi.ShardingKeyFromContext(ctx)
+	if !e.commonFields.TenantShardingKey {
+		return sk, ok
+	}
+	accessor, isTenant := any(e.entity).(dbspi.TenantAccessor)
+	if !isTenant {
+		return sk, ok
+	}
+	tenantId, hasTenant := e.commonFields.Normalize().TenantProvider(ctx)
+	if !hasTenant || tenantId == "" {
+		return sk, ok
+	}
+	column := accessor.TenantFieldName()
+	merged := dbspi.NewShardingKey()
+	if ok {
+		if _, err := sk.Get(column); err == nil {
+			return sk, true
+		}
+		for name, value := range sk.Fields() {
+			merged.SetValue(name, value)
+		}
+	}
+	return merged.SetValue(column, tenantId), true
 }
 
 // resolveFromCtx extracts the ShardingKey from context and resolves the table store.
 // This is the fallback for methods where auto-extraction is not possible (Raw, Exec).
 func (e *shardedTableStore[T]) resolveFromCtx(ctx context.Context) (dbspi.TableStore[T], error) {
-	sk, ok := dbspi.ShardingKeyFromContext(ctx)
+	sk, ok := e.shardingKeyFromContext(ctx)
 	if !ok {
 		return nil, dbspi.ErrShardingKeyRequired
 	}
-	return e.resolveStore(sk)
+	return e.resolveStore(ctx, sk)
 }
 
 // resolveForEntity resolves by aggregating ctx key + entity struct fields,
 // then validating all values route to the same target.
 func (e *shardedTableStore[T]) resolveForEntity(ctx context.Context, entity T) (dbspi.TableStore[T], error) {
-	ctxSk, hasCtx := dbspi.ShardingKeyFromContext(ctx)
+	sk, err := e.shardingKeyForEntity(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+	return e.resolveStore(ctx, sk)
+}
+
+// shardingKeyForEntity builds the ShardingKey resolveForEntity routes with.
+func (e *shardedTableStore[T]) shardingKeyForEntity(ctx context.Context, entity T) (*dbspi.ShardingKey, error) {
+	ctxSk, hasCtx := e.shardingKeyFromContext(ctx)
 	if hasCtx && e.keyResolver == nil {
-		return e.resolveStore(ctxSk)
+		return ctxSk, nil
 	}
 	if e.keyResolver != nil {
 		entityCols := e.keyResolver.fromEntity(entity)
@@ -434,15 +484,11 @@ func (e *shardedTableStore[T]) resolveForEntity(ctx context.Context, entity T) (
 		if hasCtx {
 			mergeSingleIntoMulti(multiCols, ctxSk.Fields())
 		}
-		columns, err := e.reduceColumns(multiCols)
+		columns, err := e.reduceColumns(ctx, multiCols)
 		if err != nil {
 			return nil, err
 		}
-		sk, err := e.keyResolver.buildShardingKey(columns, nil)
-		if err != nil {
-			return nil, err
-		}
-		return e.resolveStore(sk)
+		return e.keyResolver.buildShardingKey(columns, nil)
 	}
 	return nil, dbspi.ErrShardingKeyRequired
 }
@@ -450,9 +496,9 @@ func (e *shardedTableStore[T]) resolveForEntity(ctx context.Context, entity T) (
 // resolveForId resolves by aggregating ctx key + id parameter,
 // then validating all values route to the same target.
 func (e *shardedTableStore[T]) resolveForId(ctx context.Context, id any) (dbspi.TableStore[T], error) {
-	ctxSk, hasCtx := dbspi.ShardingKeyFromContext(ctx)
+	ctxSk, hasCtx := e.shardingKeyFromContext(ctx)
 	if hasCtx && e.keyResolver == nil {
-		return e.resolveStore(ctxSk)
+		return e.resolveStore(ctx, ctxSk)
 	}
 	if e.keyResolver != nil {
 		idCols := e.keyResolver.fromId(id)
@@ -460,7 +506,7 @@ func (e *shardedTableStore[T]) resolveForId(ctx context.Context, id any) (dbspi.
 		if hasCtx {
 			mergeSingleIntoMulti(multiCols, ctxSk.Fields())
 		}
-		columns, err := e.reduceColumns(multiCols)
+		columns, err := e.reduceColumns(ctx, multiCols)
 		if err != nil {
 			return nil, err
 		}
@@ -468,7 +514,7 @@ func (e *shardedTableStore[T]) resolveForId(ctx context.Context, id any) (dbspi.
 		if err != nil {
 			return nil, err
 		}
-		return e.resolveStore(sk)
+		return e.resolveStore(ctx, sk)
 	}
 	return nil, dbspi.ErrShardingKeyRequired
 }
@@ -476,16 +522,16 @@ func (e *shardedTableStore[T]) resolveForId(ctx context.Context, id any) (dbspi.
 // resolveForQuery resolves by aggregating ctx key + query conditions,
 // then validating all values route to the same target.
 func (e *shardedTableStore[T]) resolveForQuery(ctx context.Context, query dbspi.Query) (dbspi.TableStore[T], error) {
-	ctxSk, hasCtx := dbspi.ShardingKeyFromContext(ctx)
+	ctxSk, hasCtx := e.shardingKeyFromContext(ctx)
 	if hasCtx && e.keyResolver == nil {
-		return e.resolveStore(ctxSk)
+		return e.resolveStore(ctx, ctxSk)
 	}
 	if e.keyResolver != nil {
 		multiCols, rangeCols := e.keyResolver.fromQuery(query)
 		if hasCtx {
 			mergeSingleIntoMulti(multiCols, ctxSk.Fields())
 		}
-		columns, err := e.reduceColumns(multiCols)
+		columns, err := e.reduceColumns(ctx, multiCols)
 		if err != nil {
 			return nil, err
 		}
@@ -493,7 +539,7 @@ func (e *shardedTableStore[T]) resolveForQuery(ctx context.Context, query dbspi.
 		if err != nil {
 			return nil, err
 		}
-		return e.resolveStore(sk)
+		return e.resolveStore(ctx, sk)
 	}
 	return nil, dbspi.ErrShardingKeyRequired
 }
@@ -501,9 +547,9 @@ func (e *shardedTableStore[T]) resolveForQuery(ctx context.Context, query dbspi.
 // resolveForEntityAndQuery resolves by aggregating ctx key + entity + query,
 // then validating all values route to the same target.
 func (e *shardedTableStore[T]) resolveForEntityAndQuery(ctx context.Context, entity T, query dbspi.Query) (dbspi.TableStore[T], error) {
-	ctxSk, hasCtx := dbspi.ShardingKeyFromContext(ctx)
+	ctxSk, hasCtx := e.shardingKeyFromContext(ctx)
 	if hasCtx && e.keyResolver == nil {
-		return e.resolveStore(ctxSk)
+		return e.resolveStore(ctx, ctxSk)
 	}
 	if e.keyResolver != nil {
 		entityCols := e.keyResolver.fromEntity(entity)
@@ -512,7 +558,7 @@ func (e *shardedTableStore[T]) resolveForEntityAndQuery(ctx context.Context, ent
 		if hasCtx {
 			mergeSingleIntoMulti(merged, ctxSk.Fields())
 		}
-		columns, err := e.reduceColumns(merged)
+		columns, err := e.reduceColumns(ctx, merged)
 		if err != nil {
 			return nil, err
 		}
@@ -520,17 +566,19 @@ func (e *shardedTableStore[T]) resolveForEntityAndQuery(ctx context.Context, ent
 		if err != nil {
 			return nil, err
 		}
-		return e.resolveStore(sk)
+		return e.resolveStore(ctx, sk)
 	}
 	return nil, dbspi.ErrShardingKeyRequired
 }
 
 // Shard explicitly binds subsequent operations to one physical shard.
+// Shard has no operation ctx, so directory lookups it triggers run without a
+// deadline.
 func (e *shardedTableStore[T]) Shard(key *dbspi.ShardingKey) (dbspi.TableStore[T], error) {
 	if key == nil {
 		return nil, dbspi.ErrShardingKeyRequired
 	}
-	return e.resolveStore(key)
+	return e.resolveStore(context.Background(), key)
 }
 
 // ================== CRUD methods ==================
@@ -770,6 +818,48 @@ func (e *shardedTableStore[T]) BatchSave(ctx context.Context, entities []T) erro
 	return store.BatchSave(ctx, entities)
 }
 
+func (e *shardedTableStore[T]) Upsert(ctx context.Context, entity T, conflictColumns []dbspi.Column, updater dbspi.Updater) error {
+	store, err := e.resolveForEntity(ctx, entity)
+	if err != nil {
+		return err
+	}
+	return store.Upsert(ctx, entity, conflictColumns, updater)
+}
+
+// BatchUpsert routes every entity on its own and upserts each shard's rows
+// together. Shards are written one after another, so a failure can leave
+// earlier shards already written.
+func (e *shardedTableStore[T]) BatchUpsert(ctx context.Context, entities []T, conflictColumns []dbspi.Column, updater dbspi.Updater, batchSize int) error {
+	type groupKey struct {
+		db        dbSession
+		tableName string
+	}
+	var order []groupKey
+	groups := make(map[groupKey][]T)
+	for _, entity := range entities {
+		sk, err := e.shardingKeyForEntity(ctx, entity)
+		if err != nil {
+			return err
+		}
+		db, tableName, err := e.resolve(ctx, sk)
+		if err != nil {
+			return err
+		}
+		key := groupKey{db: db, tableName: tableName}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], entity)
+	}
+	for _, key := range order {
+		store := NewTableStoreWithTableNameAndCommonFields(key.db, e.entity, key.tableName, e.commonFields)
+		if err := store.BatchUpsert(ctx, groups[key], conflictColumns, updater, batchSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // -- Multi-source method (resolve from ctx > entity + query) --
 
 func (e *shardedTableStore[T]) FirstOrCreate(ctx context.Context, entity T, query dbspi.Query) (T, error) {
@@ -795,6 +885,41 @@ func (e *shardedTableStore[T]) Raw(ctx context.Context, sql string, args ...any)
 	return sqlStore.Raw(ctx, sql, args...)
 }
 
+// routeChange implements changeRouter. It routes like the write it
+// describes: by query, then id, then entity.
+func (e *shardedTableStore[T]) routeChange(ctx context.Context, entity T, id any, query dbspi.Query) (dbspi.TableStore[T], error) {
+	switch {
+	case query != nil:
+		return e.resolveForQuery(ctx, query)
+	case id != nil:
+		return e.resolveForId(ctx, id)
+	default:
+		return e.resolveForEntity(ctx, entity)
+	}
+}
+
+// boundTx implements txBound. Transaction-bound sharded stores have a single
+// Db target: the transaction.
+func (e *shardedTableStore[T]) boundTx() *txState {
+	if len(e.dbs) == 0 {
+		return nil
+	}
+	return boundTxOf(e.dbs[0].Db)
+}
+
+// RawScan implements rawScanner.
+func (e *shardedTableStore[T]) RawScan(ctx context.Context, dest any, sql string, args ...any) error {
+	store, err := e.resolveFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+	scanner, err := toRawScanner(store)
+	if err != nil {
+		return err
+	}
+	return scanner.RawScan(ctx, dest, sql, args...)
+}
+
 func (e *shardedTableStore[T]) Exec(ctx context.Context, sql string, args ...any) error {
 	store, err := e.resolveFromCtx(ctx)
 	if err != nil {
@@ -811,8 +936,9 @@ func (e *shardedTableStore[T]) Exec(ctx context.Context, sql string, args ...any
 
 // shardTarget represents a resolved (Db, TableName) pair for scatter-gather.
 type shardTarget struct {
-	db        dbSession
-	tableName string
+	db          dbSession
+	databaseKey string
+	tableName   string
 }
 
 // allShardTargets computes all (Db, TableName) combinations for scatter-gather.
@@ -838,10 +964,10 @@ func (e *shardedTableStore[T]) allShardTargets() ([]shardTarget, error) {
 				if err != nil {
 					return nil, fmt.Errorf("enumerate table shard %d failed: %w", i, err)
 				}
-				targets = append(targets, shardTarget{db: dt.Db, tableName: tableName})
+				targets = append(targets, shardTarget{db: dt.Db, databaseKey: dt.Key, tableName: tableName})
 			}
 		} else {
-			targets = append(targets, shardTarget{db: dt.Db, tableName: logicalTable})
+			targets = append(targets, shardTarget{db: dt.Db, databaseKey: dt.Key, tableName: logicalTable})
 		}
 	}
 
@@ -861,35 +987,85 @@ func (e *shardedTableStore[T]) newErrGroup(ctx context.Context) (*errgroup.Group
 	return g, gCtx
 }
 
-func (e *shardedTableStore[T]) FindAll(ctx context.Context, query dbspi.Query, batchSize int) ([]T, error) {
-	targets, err := e.allShardTargets()
-	if err != nil {
-		return nil, err
-	}
-
+// scatter runs fn on every shard target. The first error cancels the other
+// shards and is returned, unless ctx was marked by dbspi.WithPartialResults:
+// then every shard runs to completion and the failed ones are returned as a
+// *dbspi.PartialResultError.
+func (e *shardedTableStore[T]) scatter(ctx context.Context, targets []shardTarget, fn func(ctx context.Context, store *GormTableStore[T]) error) error {
+	partial := dbspi.PartialResultsFromContext(ctx)
 	g, gCtx := e.newErrGroup(ctx)
+	if partial {
+		g = &errgroup.Group{}
+		if e.maxConcurrency > 0 {
+			g.SetLimit(e.maxConcurrency)
+		}
+		gCtx = ctx
+	}
 	var mu sync.Mutex
-	var results []T
+	var failures []dbspi.ShardFailure
 
 	for _, target := range targets {
 		target := target
 		g.Go(func() error {
 			store := NewTableStoreWithTableNameAndCommonFields(target.db, e.entity, target.tableName, e.commonFields)
-			rows, err := e.fetchAllFromShard(gCtx, store, query, batchSize)
-			if err != nil {
+			err := fn(gCtx, store)
+			if err == nil || !partial {
 				return err
 			}
 			mu.Lock()
-			results = append(results, rows...)
+			failures = append(failures, dbspi.ShardFailure{Database: target.databaseKey, Table: target.tableName, Err: err})
 			mu.Unlock()
 			return nil
 		})
 	}
 
 	if err := g.Wait(); err != nil {
+		return err
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Database != failures[j].Database {
+			return failures[i].Database < failures[j].Database
+		}
+		return failures[i].Table < failures[j].Table
+	})
+	return &dbspi.PartialResultError{Failures: failures}
+}
+
+// isPartialResult reports whether err comes with the results of the shards
+// that succeeded.
+func isPartialResult(err error) bool {
+	var partial *dbspi.PartialResultError
+	return errors.As(err, &partial)
+}
+
+func (e *shardedTableStore[T]) FindAll(ctx context.Context, query dbspi.Query, batchSize int) ([]T, error) {
+	targets, err := e.allShardTargets()
+	if err != nil {
 		return nil, err
 	}
-	return results, nil
+
+	var mu sync.Mutex
+	var results []T
+	err = e.scatter(ctx, targets, func(ctx context.Context, store *GormTableStore[T]) error {
+		rows, err := e.fetchAllFromShard(ctx, store, query, batchSize)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		results = append(results, rows...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil && !isPartialResult(err) {
+		return nil, err
+	}
+	return results, err
 }
 
 // fetchAllFromShard fetches all matching rows from a single shard.
@@ -992,33 +1168,41 @@ func toSnakeCase(s string) string {
 	return string(result)
 }
 
+// physicalTables implements physicalTableLister with one store per shard.
+func (e *shardedTableStore[T]) physicalTables() ([]*GormTableStore[T], func(), error) {
+	targets, err := e.allShardTargets()
+	if err != nil {
+		return nil, nil, err
+	}
+	tables := make([]*GormTableStore[T], 0, len(targets))
+	for _, target := range targets {
+		store := NewTableStoreWithTableNameAndCommonFields(target.db, e.entity, target.tableName, e.commonFields)
+		store.databaseKey = target.databaseKey
+		tables = append(tables, store)
+	}
+	return tables, func() {}, nil
+}
+
 func (e *shardedTableStore[T]) CountAll(ctx context.Context, query dbspi.Query) (uint64, error) {
 	targets, err := e.allShardTargets()
 	if err != nil {
 		return 0, err
 	}
 
-	g, gCtx := e.newErrGroup(ctx)
 	var mu sync.Mutex
 	var total uint64
-
-	for _, target := range targets {
-		target := target
-		g.Go(func() error {
-			store := NewTableStoreWithTableNameAndCommonFields(target.db, e.entity, target.tableName, e.commonFields)
-			count, err := store.Count(gCtx, query)
-			if err != nil {
-				return err
-			}
-			mu.Lock()
-			total += count
-			mu.Unlock()
-			return nil
-		})
-	}
-
-	if err := g.Wait(); err != nil {
+	err = e.scatter(ctx, targets, func(ctx context.Context, store *GormTableStore[T]) error {
+		count, err := store.Count(ctx, query)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		total += count
+		mu.Unlock()
+		return nil
+	})
+	if err != nil && !isPartialResult(err) {
 		return 0, err
 	}
-	return total, nil
+	return total, err
 }
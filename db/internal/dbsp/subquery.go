@@ -0,0 +1,142 @@
+package dbsp
+
+import (
+	"fmt"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/gorm/clause"
+)
+
+var (
+	_ gormExpression    = (*GormSubquery)(nil)
+	_ dbspi.Subquery    = (*GormSubquery)(nil)
+	_ clause.Expression = subqueryExpr{}
+)
+
+// GormSubquery implements dbspi.Subquery.
+type GormSubquery struct {
+	expr subqueryExpr
+}
+
+// NewEntitySubquery creates a subquery selecting from the table of entity.
+// When entity implements dbspi.TenantAccessor, the subquery is isolated to
+// the tenant of the ctx it runs with, like the entity's table store.
+func NewEntitySubquery(entity dbspi.Entity, query dbspi.Query) dbspi.Subquery {
+	sub := NewSubquery(entity.TableName(), query).(*GormSubquery)
+	if accessor, ok := entity.(dbspi.TenantAccessor); ok {
+		sub.expr.tenantColumn = accessor.TenantFieldName()
+	}
+	return sub
+}
+
+// NewSubquery creates a subquery selecting from table. The selected columns
+// come from query when it was built with Select; otherwise all columns are
+// selected.
+func NewSubquery(table string, query dbspi.Query) dbspi.Subquery {
+	sub := subqueryExpr{table: table, where: queryToGormClause(query)}
+	if sq, ok := query.(columnSelectionQuery); ok {
+		for _, col := range sq.Columns() {
+			sub.columns = append(sub.columns, columnClause(col))
+		}
+	}
+	return &GormSubquery{expr: sub}
+}
+
+func (s *GormSubquery) ToGormExpression() clause.Expression {
+	return s.expr
+}
+
+// Exists creates an EXISTS (subquery) condition.
+func Exists(sub dbspi.Subquery) dbspi.Condition {
+	return newSubqueryCondition("EXISTS", nil, sub)
+}
+
+// NotExists creates a NOT EXISTS (subquery) condition.
+func NotExists(sub dbspi.Subquery) dbspi.Condition {
+	return newSubqueryCondition("NOT EXISTS", nil, sub)
+}
+
+// InSubquery implements dbspi.Field. sub must select exactly one column;
+// statements using the condition fail otherwise.
+func (f *GormField[T]) InSubquery(sub dbspi.Subquery) dbspi.Condition {
+	column := f.columnExpr()
+	return newSubqueryCondition("IN", &column, sub)
+}
+
+// NotInSubquery implements dbspi.Field. Like InSubquery, sub must select
+// exactly one column.
+func (f *GormField[T]) NotInSubquery(sub dbspi.Subquery) dbspi.Condition {
+	column := f.columnExpr()
+	return newSubqueryCondition("NOT IN", &column, sub)
+}
+
+func newSubqueryCondition(operator string, column *clause.Column, sub dbspi.Subquery) dbspi.Condition {
+	gs, ok := sub.(*GormSubquery)
+	if !ok || gs == nil {
+		return nil
+	}
+	return newCondition(subqueryCondition{column: column, operator: operator, sub: gs.expr})
+}
+
+// subqueryCondition renders "column operator (subquery)" or, without a
+// column, "operator (subquery)". It is a distinct expression type so that
+// sharding key extraction never mistakes subquery values for routing keys.
+type subqueryCondition struct {
+	column   *clause.Column
+	operator string
+	sub      subqueryExpr
+}
+
+// validate reports IN and NOT IN subqueries that do not select exactly one
+// column, which would otherwise render as "IN (SELECT * ...)".
+func (c subqueryCondition) validate() error {
+	if c.column != nil && len(c.sub.columns) != 1 {
+		return fmt.Errorf("dbhelper: %s subquery on %s must select exactly one column, got %d", c.operator, c.sub.table, len(c.sub.columns))
+	}
+	return nil
+}
+
+func (c subqueryCondition) Build(builder clause.Builder) {
+	if err := c.validate(); err != nil {
+		_ = builder.AddError(err)
+		return
+	}
+	if c.column != nil {
+		builder.WriteQuoted(*c.column)
+		builder.WriteByte(' ')
+	}
+	builder.WriteString(c.operator)
+	builder.WriteString(" (")
+	c.sub.Build(builder)
+	builder.WriteByte(')')
+}
+
+// subqueryExpr renders "SELECT columns FROM table WHERE ...".
+type subqueryExpr struct {
+	table   string
+	columns []clause.Column
+	where   clause.Expression
+	// tenantColumn is set when the table is tenant-aware and the tenant
+	// condition has not been added to where yet; see scopeSubqueryTenants.
+	tenantColumn string
+}
+
+func (s subqueryExpr) Build(builder clause.Builder) {
+	builder.WriteString("SELECT ")
+	if len(s.columns) == 0 {
+		builder.WriteByte('*')
+	}
+	for i, col := range s.columns {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteQuoted(col)
+	}
+	builder.WriteString(" FROM ")
+	builder.WriteQuoted(clause.Table{Name: s.table})
+	if s.where != nil {
+		builder.WriteString(" WHERE ")
+		clause.Where{Exprs: []clause.Expression{s.where}}.Build(builder)
+	}
+}
@@ -0,0 +1,85 @@
+package dbsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestSubqueryConditionsRenderSQL(t *testing.T) {
+	capture := &capturingGormLogger{gormLogger: newGormLogger("order_db", dbspi.ServerConfig{})}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/order_db",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: capture})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orderID, sku := NewField[int64]("order_id"), NewField[string]("sku")
+	shopID, badSKU := int64(6), "banned"
+	items := NewSubquery("order_item_tab", Select([]dbspi.Column{orderID}, sku.Eq(&badSKU)))
+	query := And(
+		NewField[int64]("shop_id").Eq(&shopID),
+		NewField[int64]("id").NotInSubquery(items),
+		Exists(NewSubquery("order_item_tab", And(NewField[int64]("shop_id").Eq(&shopID)))),
+	)
+
+	var rows []testOrder
+	db.WithContext(context.Background()).Table("order_tab").Where(queryToGormClause(query)).Find(&rows)
+
+	want := "SELECT * FROM `order_tab` WHERE `shop_id` = ? AND `id` NOT IN (SELECT `order_id` FROM `order_item_tab` WHERE `sku` = ?) AND EXISTS (SELECT * FROM `order_item_tab` WHERE `shop_id` = ?)"
+	if capture.sql != want {
+		t.Fatalf("unexpected SQL:\n got %q\nwant %q", capture.sql, want)
+	}
+}
+
+func TestInSubqueryRequiresOneSelectedColumn(t *testing.T) {
+	ctx := context.Background()
+	users := newMemoryTestUsers(t, ctx)
+	for _, sub := range []dbspi.Subquery{
+		NewSubquery("memory_user_tab", nil),
+		NewSubquery("memory_user_tab", Select([]dbspi.Column{NewColumn("id"), NewColumn("name")})),
+	} {
+		if _, err := users.Find(ctx, NewQuery(NewField[uint64]("id").InSubquery(sub)), nil); err == nil || !strings.Contains(err.Error(), "exactly one column") {
+			t.Fatalf("IN subquery err = %v", err)
+		}
+	}
+
+	capture := &capturingGormLogger{gormLogger: newGormLogger("order_db", dbspi.ServerConfig{})}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:pass@tcp(127.0.0.1:3306)/order_db",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: capture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := NewQuery(NewField[int64]("id").NotInSubquery(NewSubquery("order_item_tab", nil)))
+	var rows []testOrder
+	if err := db.WithContext(ctx).Table("order_tab").Where(queryToGormClause(query)).Find(&rows).Error; err == nil || !strings.Contains(err.Error(), "exactly one column") {
+		t.Fatalf("NOT IN subquery err = %v", err)
+	}
+}
+
+func TestExtractColumnsIgnoresSubqueryValues(t *testing.T) {
+	shopID, otherShopID := int64(6), int64(7)
+	sub := NewSubquery("order_item_tab", Select(
+		[]dbspi.Column{NewField[int64]("order_id")},
+		NewField[int64]("shop_id").Eq(&otherShopID),
+	))
+	query := And(
+		NewField[int64]("shop_id").Eq(&shopID),
+		NewField[int64]("id").InSubquery(sub),
+		NotExists(sub),
+	)
+
+	values, _ := ExtractColumnsFromQuery(query)
+	if got := values["shop_id"]; len(got) != 1 || got[0] != shopID {
+		t.Fatalf("expected only the outer shop_id value, got %v", got)
+	}
+}
@@ -0,0 +1,88 @@
+package dbsp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// tableStoreWrapper is implemented by table store decorators. Jobs that work
+// on the physical tables behind a store, such as PurgeDeleted and Archive,
+// walk the chain of decorators with physicalTablesOf instead of every
+// decorator forwarding each job.
+type tableStoreWrapper[T dbspi.Entity] interface {
+	// unwrap returns the wrapped store, usable until release is called.
+	unwrap() (inner dbspi.TableStore[T], release func(), err error)
+}
+
+// physicalTableLister is implemented by the innermost table stores, which
+// know the physical tables they route to. release must be called once the
+// tables are no longer used.
+type physicalTableLister[T dbspi.Entity] interface {
+	physicalTables() (tables []*GormTableStore[T], release func(), err error)
+}
+
+// deletionObserver is implemented by decorators that keep state per row,
+// such as cached stores. Jobs that delete rows through the physical tables
+// below them report the deleted ids.
+type deletionObserver interface {
+	rowsDeleted(ctx context.Context, ids []any)
+}
+
+// physicalTableSet is the result of physicalTablesOf.
+type physicalTableSet[T dbspi.Entity] struct {
+	tables    []*GormTableStore[T]
+	observers []deletionObserver
+	release   func()
+}
+
+// rowsDeleted reports ids to every deletionObserver above the tables.
+func (s *physicalTableSet[T]) rowsDeleted(ctx context.Context, ids []any) {
+	for _, observer := range s.observers {
+		observer.rowsDeleted(ctx, ids)
+	}
+}
+
+// physicalTablesOf walks the decorators of store down to the store listing
+// its physical tables. job names the caller in the error returned for stores
+// that have none. release of the result must be called once the tables are
+// no longer used.
+func physicalTablesOf[T dbspi.Entity](store dbspi.TableStore[T], job string) (*physicalTableSet[T], error) {
+	set := &physicalTableSet[T]{release: func() {}}
+	for {
+		if observer, ok := store.(deletionObserver); ok {
+			set.observers = append(set.observers, observer)
+		}
+		if lister, ok := store.(physicalTableLister[T]); ok {
+			tables, release, err := lister.physicalTables()
+			if err != nil {
+				set.release()
+				return nil, err
+			}
+			set.tables = tables
+			set.release = chainRelease(release, set.release)
+			return set, nil
+		}
+		wrapper, ok := store.(tableStoreWrapper[T])
+		if !ok {
+			set.release()
+			return nil, fmt.Errorf("dbhelper: table store %T does not support %s", store, job)
+		}
+		inner, release, err := wrapper.unwrap()
+		if err != nil {
+			set.release()
+			return nil, err
+		}
+		set.release = chainRelease(release, set.release)
+		store = inner
+	}
+}
+
+// chainRelease returns a release func calling first, then then.
+func chainRelease(first, then func()) func() {
+	return func() {
+		first()
+		then()
+	}
+}
@@ -0,0 +1,417 @@
+package dbsp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+// ================== Circuit Breaker ==================
+
+// circuitBreaker tracks the failures of one database target. See
+// dbspi.CircuitBreakerConfig for the state machine.
+type circuitBreaker struct {
+	cfg dbspi.CircuitBreakerConfig
+	now func() time.Time
+
+	mu    sync.Mutex
+	state dbspi.CircuitState
+	// generation changes on every state change, so that outcomes of
+	// operations admitted in an earlier state are ignored.
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	succeeded   int
+}
+
+func newCircuitBreaker(cfg dbspi.CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureRatio <= 0 {
+		cfg.FailureRatio = dbspi.DefaultCircuitBreakerFailureRatio
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = dbspi.DefaultCircuitBreakerMinRequests
+	}
+	if cfg.WindowSeconds <= 0 {
+		cfg.WindowSeconds = dbspi.DefaultCircuitBreakerWindowSeconds
+	}
+	if cfg.OpenSeconds <= 0 {
+		cfg.OpenSeconds = dbspi.DefaultCircuitBreakerOpenSeconds
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = dbspi.DefaultCircuitBreakerHalfOpenProbes
+	}
+	b := &circuitBreaker{cfg: cfg, now: time.Now, state: dbspi.CircuitClosed}
+	b.windowStart = b.now()
+	return b
+}
+
+// allow reports whether an operation may run and returns the generation to
+// record its outcome with.
+func (b *circuitBreaker) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if b.state == dbspi.CircuitOpen {
+		if now.Sub(b.openedAt) < time.Duration(b.cfg.OpenSeconds)*time.Second {
+			return 0, false
+		}
+		b.transition(dbspi.CircuitHalfOpen, now)
+	}
+	if b.state == dbspi.CircuitHalfOpen {
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return 0, false
+		}
+		b.probes++
+	}
+	return b.generation, true
+}
+
+// record counts the outcome of an operation admitted with generation.
+func (b *circuitBreaker) record(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	now := b.now()
+	switch b.state {
+	case dbspi.CircuitHalfOpen:
+		if failed {
+			b.transition(dbspi.CircuitOpen, now)
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.cfg.HalfOpenProbes {
+			b.transition(dbspi.CircuitClosed, now)
+		}
+	case dbspi.CircuitClosed:
+		if now.Sub(b.windowStart) >= time.Duration(b.cfg.WindowSeconds)*time.Second {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinRequests && float64(b.failures) >= b.cfg.FailureRatio*float64(b.requests) {
+			b.transition(dbspi.CircuitOpen, now)
+		}
+	}
+}
+
+func (b *circuitBreaker) transition(state dbspi.CircuitState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.windowStart, b.requests, b.failures = now, 0, 0
+	b.probes, b.succeeded = 0, 0
+	if state == dbspi.CircuitOpen {
+		b.openedAt = now
+	}
+}
+
+// State returns the current state. An open breaker whose open period has
+// elapsed reports half-open.
+func (b *circuitBreaker) State() dbspi.CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == dbspi.CircuitOpen && b.now().Sub(b.openedAt) >= time.Duration(b.cfg.OpenSeconds)*time.Second {
+		return dbspi.CircuitHalfOpen
+	}
+	return b.state
+}
+
+// isTargetFailure reports whether err says the database target is unhealthy,
+// as opposed to the statement being rejected or the caller giving up.
+func isTargetFailure(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// ================== Guarded Session ==================
+
+// targetGuard holds the circuit breaker and default timeouts of one database
+// target.
+type targetGuard struct {
+	name        string
+	breaker     *circuitBreaker
+	read        time.Duration
+	write       time.Duration
+	transaction time.Duration
+}
+
+// newTargetGuard returns the guard cfg configures for a target, or nil when
+// cfg sets neither timeouts nor a circuit breaker.
+func newTargetGuard(groupKey, targetKey string, cfg dbspi.DatabaseGroupConfig) *targetGuard {
+	name := groupKey
+	if targetKey != "" {
+		name += "/" + targetKey
+	}
+	guard := &targetGuard{
+		name:        name,
+		read:        time.Duration(cfg.ReadTimeoutMillis) * time.Millisecond,
+		write:       time.Duration(cfg.WriteTimeoutMillis) * time.Millisecond,
+		transaction: time.Duration(cfg.TransactionTimeoutMillis) * time.Millisecond,
+	}
+	if cfg.CircuitBreaker != nil {
+		guard.breaker = newCircuitBreaker(*cfg.CircuitBreaker)
+	}
+	if guard.breaker == nil && guard.read <= 0 && guard.write <= 0 && guard.transaction <= 0 {
+		return nil
+	}
+	return guard
+}
+
+// guardTargets wraps the sessions of targets with the guards cfg configures.
+func guardTargets(groupKey string, targets []DatabaseTarget, cfg dbspi.DatabaseGroupConfig) []DatabaseTarget {
+	guarded := make([]DatabaseTarget, len(targets))
+	for i, target := range targets {
+		guarded[i] = DatabaseTarget{Key: target.Key, Db: guardSession(target.Db, newTargetGuard(groupKey, target.Key, cfg))}
+	}
+	return guarded
+}
+
+func guardSession(db dbSession, guard *targetGuard) dbSession {
+	if guard == nil || db == nil {
+		return db
+	}
+	return &guardedSession{inner: db, guard: guard}
+}
+
+// guardedSession applies a targetGuard to every operation on a session.
+// Statements inside a transaction only get timeouts; the transaction as a
+// whole passes the circuit breaker.
+type guardedSession struct {
+	inner dbSession
+	guard *targetGuard
+	inTx  bool
+}
+
+var (
+	_ dbSession         = (*guardedSession)(nil)
+	_ joinSession       = (*guardedSession)(nil)
+	_ pinger            = (*guardedSession)(nil)
+	_ poolStatsProvider = (*guardedSession)(nil)
+)
+
+func (s *guardedSession) run(ctx context.Context, timeout time.Duration, op func(ctx context.Context) error) error {
+	breaker := s.guard.breaker
+	if s.inTx {
+		breaker = nil
+	}
+	var generation uint64
+	if breaker != nil {
+		var ok bool
+		if generation, ok = breaker.allow(); !ok {
+			return fmt.Errorf("%w: %s", dbspi.ErrCircuitOpen, s.guard.name)
+		}
+	}
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := op(ctx)
+	if breaker != nil {
+		// A caller whose own deadline passed says nothing about the target.
+		breaker.record(generation, isTargetFailure(err) && parent.Err() == nil)
+	}
+	return err
+}
+
+func (s *guardedSession) read(ctx context.Context, op func(ctx context.Context) error) error {
+	return s.run(ctx, s.guard.read, op)
+}
+
+func (s *guardedSession) write(ctx context.Context, op func(ctx context.Context) error) error {
+	return s.run(ctx, s.guard.write, op)
+}
+
+// CircuitState returns the state of the target's circuit breaker, empty
+// when it has none.
+func (s *guardedSession) CircuitState() dbspi.CircuitState {
+	if s.guard.breaker == nil {
+		return ""
+	}
+	return s.guard.breaker.State()
+}
+
+// boundTx implements txBound.
+func (s *guardedSession) boundTx() *txState {
+	return boundTxOf(s.inner)
+}
+
+// withRowLock implements rowLocker.
+func (s *guardedSession) withRowLock(lock dbspi.RowLock) (dbSession, error) {
+	inner, err := lockingSession(s.inner, lock)
+	if err != nil {
+		return nil, err
+	}
+	return &guardedSession{inner: inner, guard: s.guard, inTx: s.inTx}, nil
+}
+
+func (s *guardedSession) WithModel(entity any) dbSession {
+	return &guardedSession{inner: s.inner.WithModel(entity), guard: s.guard, inTx: s.inTx}
+}
+
+func (s *guardedSession) WithTableName(tableName string) dbSession {
+	return &guardedSession{inner: s.inner.WithTableName(tableName), guard: s.guard, inTx: s.inTx}
+}
+
+func (s *guardedSession) Find(ctx context.Context, dest any, query dbspi.Query, pagination dbspi.Pagination) error {
+	return s.read(ctx, func(ctx context.Context) error {
+		return s.inner.Find(ctx, dest, query, pagination)
+	})
+}
+
+func (s *guardedSession) Count(ctx context.Context, query dbspi.Query) (uint64, error) {
+	var count uint64
+	err := s.read(ctx, func(ctx context.Context) (err error) {
+		count, err = s.inner.Count(ctx, query)
+		return err
+	})
+	return count, err
+}
+
+func (s *guardedSession) Create(ctx context.Context, entity dbspi.Entity) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.Create(ctx, entity)
+	})
+}
+
+func (s *guardedSession) Save(ctx context.Context, entity dbspi.Entity) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.Save(ctx, entity)
+	})
+}
+
+func (s *guardedSession) Update(ctx context.Context, entity dbspi.Entity) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.Update(ctx, entity)
+	})
+}
+
+func (s *guardedSession) Delete(ctx context.Context, entity dbspi.Entity) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.Delete(ctx, entity)
+	})
+}
+
+func (s *guardedSession) BatchCreate(ctx context.Context, entities any, batchSize int) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.BatchCreate(ctx, entities, batchSize)
+	})
+}
+
+func (s *guardedSession) BatchSave(ctx context.Context, entities any) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.BatchSave(ctx, entities)
+	})
+}
+
+func (s *guardedSession) UpdateByQuery(ctx context.Context, query dbspi.Query, updater dbspi.Updater) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.UpdateByQuery(ctx, query, updater)
+	})
+}
+
+func (s *guardedSession) DeleteByQuery(ctx context.Context, entity dbspi.Entity, query dbspi.Query) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.DeleteByQuery(ctx, entity, query)
+	})
+}
+
+func (s *guardedSession) FirstOrCreate(ctx context.Context, entity dbspi.Entity, query dbspi.Query) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.FirstOrCreate(ctx, entity, query)
+	})
+}
+
+func (s *guardedSession) Upsert(ctx context.Context, entities any, spec upsertSpec, batchSize int) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.Upsert(ctx, entities, spec, batchSize)
+	})
+}
+
+func (s *guardedSession) Raw(ctx context.Context, dest any, sql string, args ...any) error {
+	return s.read(ctx, func(ctx context.Context) error {
+		return s.inner.Raw(ctx, dest, sql, args...)
+	})
+}
+
+func (s *guardedSession) Exec(ctx context.Context, sql string, args ...any) error {
+	return s.write(ctx, func(ctx context.Context) error {
+		return s.inner.Exec(ctx, sql, args...)
+	})
+}
+
+func (s *guardedSession) Transaction(ctx context.Context, fn transactionFunc) error {
+	inTx := func(tx dbSession) error {
+		return fn(&guardedSession{inner: tx, guard: s.guard, inTx: true})
+	}
+	if s.inTx {
+		return s.inner.Transaction(ctx, inTx)
+	}
+	return s.run(ctx, s.guard.transaction, func(ctx context.Context) error {
+		return s.inner.Transaction(ctx, inTx)
+	})
+}
+
+// FindJoin implements joinSession.
+func (s *guardedSession) FindJoin(ctx context.Context, dest any, stmt joinStatement, pagination dbspi.Pagination) error {
+	session, ok := s.inner.(joinSession)
+	if !ok {
+		return fmt.Errorf("dbhelper: database session does not support joins")
+	}
+	return s.read(ctx, func(ctx context.Context) error {
+		return session.FindJoin(ctx, dest, stmt, pagination)
+	})
+}
+
+// CountJoin implements joinSession.
+func (s *guardedSession) CountJoin(ctx context.Context, stmt joinStatement) (uint64, error) {
+	session, ok := s.inner.(joinSession)
+	if !ok {
+		return 0, fmt.Errorf("dbhelper: database session does not support joins")
+	}
+	var count uint64
+	err := s.read(ctx, func(ctx context.Context) (err error) {
+		count, err = session.CountJoin(ctx, stmt)
+		return err
+	})
+	return count, err
+}
+
+// Ping implements pinger. Pings bypass the circuit breaker so health checks
+// see the target itself.
+func (s *guardedSession) Ping(ctx context.Context) error {
+	p, ok := s.inner.(pinger)
+	if !ok {
+		return fmt.Errorf("dbhelper: database target %s does not support ping", s.guard.name)
+	}
+	return p.Ping(ctx)
+}
+
+// PoolStats implements poolStatsProvider.
+func (s *guardedSession) PoolStats() (dbspi.PoolStats, error) {
+	provider, ok := s.inner.(poolStatsProvider)
+	if !ok {
+		return dbspi.PoolStats{}, fmt.Errorf("dbhelper: database target %s has no connection pool", s.guard.name)
+	}
+	return provider.PoolStats()
+}
@@ -0,0 +1,157 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newCircuitBreaker(dbspi.CircuitBreakerConfig{MinRequests: 4, FailureRatio: 0.5, WindowSeconds: 10, OpenSeconds: 5, HalfOpenProbes: 2})
+	b.now = func() time.Time { return now }
+
+	for _, failed := range []bool{false, true, false, true} {
+		generation, ok := b.allow()
+		if !ok {
+			t.Fatal("closed breaker rejected an operation")
+		}
+		b.record(generation, failed)
+	}
+	if b.State() != dbspi.CircuitOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	if _, ok := b.allow(); ok {
+		t.Fatal("open breaker admitted an operation")
+	}
+
+	now = now.Add(5 * time.Second)
+	if b.State() != dbspi.CircuitHalfOpen {
+		t.Fatalf("state = %s, want half_open", b.State())
+	}
+	first, ok1 := b.allow()
+	second, ok2 := b.allow()
+	if _, ok3 := b.allow(); !ok1 || !ok2 || ok3 {
+		t.Fatalf("half-open admitted %v %v %v, want 2 probes", ok1, ok2, ok3)
+	}
+	b.record(first, true)
+	if b.State() != dbspi.CircuitOpen {
+		t.Fatalf("state = %s after failed probe, want open", b.State())
+	}
+	// The second probe was admitted before the breaker reopened.
+	b.record(second, false)
+	if b.State() != dbspi.CircuitOpen {
+		t.Fatalf("stale probe changed state to %s", b.State())
+	}
+
+	now = now.Add(5 * time.Second)
+	for i := 0; i < 2; i++ {
+		generation, ok := b.allow()
+		if !ok {
+			t.Fatal("half-open breaker rejected a probe")
+		}
+		b.record(generation, false)
+	}
+	if b.State() != dbspi.CircuitClosed {
+		t.Fatalf("state = %s after successful probes, want closed", b.State())
+	}
+}
+
+// hangingSession blocks reads until their context is done.
+type hangingSession struct {
+	fakeSession
+}
+
+func (s *hangingSession) Find(ctx context.Context, _ any, _ dbspi.Query, _ dbspi.Pagination) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *hangingSession) Create(context.Context, dbspi.Entity) error {
+	return errors.New("duplicate entry")
+}
+
+func TestGuardedSessionTimeoutOpensBreaker(t *testing.T) {
+	cfg := dbspi.DatabaseGroupConfig{
+		ReadTimeoutMillis: 10,
+		CircuitBreaker:    &dbspi.CircuitBreakerConfig{MinRequests: 2, FailureRatio: 0.5},
+	}
+	session := guardSession(&hangingSession{}, newTargetGuard("order", "order_db_0", cfg))
+	ctx := context.Background()
+
+	// Statement errors do not count as target failures.
+	for i := 0; i < 2; i++ {
+		if err := session.Create(ctx, &joinTestItem{}); err == nil || errors.Is(err, dbspi.ErrCircuitOpen) {
+			t.Fatalf("create err = %v", err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := session.Find(ctx, nil, nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("find err = %v, want deadline exceeded", err)
+		}
+	}
+	err := session.Find(ctx, nil, nil, nil)
+	if !errors.Is(err, dbspi.ErrCircuitOpen) {
+		t.Fatalf("find err = %v, want circuit open", err)
+	}
+	if got := session.(*guardedSession).CircuitState(); got != dbspi.CircuitOpen {
+		t.Fatalf("state = %s, want open", got)
+	}
+}
+
+func TestShardedScatterReturnsPartialResults(t *testing.T) {
+	cfg := shardedJoinTestConfig()
+	order := cfg.DatabaseGroups["order"]
+	order.CircuitBreaker = &dbspi.CircuitBreakerConfig{}
+	cfg.DatabaseGroups["order"] = order
+	mgr := NewMemoryManager(cfg, ManagerOptions{})
+	store := For(&joinTestItem{}, mgr)
+	ctx := context.Background()
+
+	for _, item := range []*joinTestItem{{ID: 1, ShopID: 5}, {ID: 2, ShopID: 6}, {ID: 3, ShopID: 8}} {
+		if err := store.Create(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, target := range mgr.entries["order"].dbs {
+		if target.Key == "order_db_1" {
+			breaker := target.Db.(*guardedSession).guard.breaker
+			breaker.mu.Lock()
+			breaker.transition(dbspi.CircuitOpen, breaker.now())
+			breaker.mu.Unlock()
+		}
+	}
+
+	if _, err := store.FindAll(ctx, nil, 0); !errors.Is(err, dbspi.ErrCircuitOpen) {
+		t.Fatalf("strict FindAll err = %v, want circuit open", err)
+	}
+
+	partialCtx := dbspi.WithPartialResults(ctx)
+	rows, err := store.FindAll(partialCtx, nil, 10)
+	var partial *dbspi.PartialResultError
+	if !errors.As(err, &partial) || !errors.Is(err, dbspi.ErrCircuitOpen) {
+		t.Fatalf("partial FindAll err = %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v, want the 2 rows of order_db_0", rows)
+	}
+	if len(partial.Failures) != 4 || partial.Failures[0].Database != "order_db_1" || partial.Failures[0].Table != "order_item_tab_0" {
+		t.Fatalf("failures = %+v", partial.Failures)
+	}
+	if count, err := store.CountAll(partialCtx, nil); count != 2 || !errors.As(err, &partial) {
+		t.Fatalf("partial CountAll = %d, err = %v", count, err)
+	}
+
+	for _, health := range mgr.CheckHealth(ctx, time.Second).Targets {
+		want := dbspi.CircuitClosed
+		if health.TargetKey == "order_db_1" {
+			want = dbspi.CircuitOpen
+		}
+		if health.DatabaseGroupKey == "order" && health.Circuit != want {
+			t.Errorf("%s circuit = %q, want %q", health.TargetKey, health.Circuit, want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package dbsp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/cache/cachehelper"
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+)
+
+type tenantTestNote struct {
+	dbspi.CommonFields
+	dbspi.TenantField
+	Title string `gorm:"column:title"`
+}
+
+func (*tenantTestNote) TableName() string { return "tenant_note_tab" }
+
+func newTenantTestNotes(t *testing.T) *GormTableStore[*tenantTestNote] {
+	t.Helper()
+	store := NewMemoryTableStore(&tenantTestNote{}, testCommonFieldAutoFillOptions())
+	for _, note := range []*tenantTestNote{
+		{TenantField: dbspi.TenantField{TenantId: "a"}, Title: "a1"},
+		{TenantField: dbspi.TenantField{TenantId: "a"}, Title: "a2"},
+		{TenantField: dbspi.TenantField{TenantId: "b"}, Title: "b1"},
+	} {
+		if err := store.Create(dbspi.WithAllTenants(context.Background()), note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestTenantIsolationScopesReads(t *testing.T) {
+	store := newTenantTestNotes(t)
+	ctxA := dbspi.WithTenant(context.Background(), "a")
+
+	notes, err := store.Find(ctxA, nil, nil)
+	if err != nil || len(notes) != 2 {
+		t.Fatalf("tenant a notes = %v, err = %v", notes, err)
+	}
+	if count, err := store.Count(ctxA, nil); err != nil || count != 2 {
+		t.Fatalf("tenant a count = %d, err = %v", count, err)
+	}
+	if note, err := store.GetById(ctxA, uint64(3)); err != nil || note != nil {
+		t.Fatalf("tenant a read tenant b note = %+v, err = %v", note, err)
+	}
+	if _, err := store.Find(context.Background(), nil, nil); !errors.Is(err, dbspi.ErrTenantRequired) {
+		t.Fatalf("find without tenant err = %v", err)
+	}
+	if count, err := store.Count(dbspi.WithAllTenants(context.Background()), nil); err != nil || count != 3 {
+		t.Fatalf("all tenants count = %d, err = %v", count, err)
+	}
+}
+
+func TestTenantIsolationGuardsWrites(t *testing.T) {
+	store := newTenantTestNotes(t)
+	ctxA := dbspi.WithTenant(context.Background(), "a")
+	ctxB := dbspi.WithTenant(context.Background(), "b")
+
+	note := &tenantTestNote{Title: "a3"}
+	if err := store.Create(ctxA, note); err != nil || note.TenantId != "a" {
+		t.Fatalf("create stamped tenant %q, err = %v", note.TenantId, err)
+	}
+	if err := store.Create(ctxA, &tenantTestNote{TenantField: dbspi.TenantField{TenantId: "b"}}); !errors.Is(err, dbspi.ErrCrossTenant) {
+		t.Fatalf("create for tenant b err = %v", err)
+	}
+
+	hijack := &tenantTestNote{Title: "hijacked"}
+	hijack.Id = 3
+	if err := store.Update(ctxA, hijack); !errors.Is(err, dbspi.ErrCrossTenant) {
+		t.Fatalf("update of tenant b note err = %v", err)
+	}
+	title := "changed"
+	if err := store.UpdateById(ctxA, uint64(3), NewUpdater().Set(NewField[string]("title"), &title)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteById(ctxA, uint64(3)); err != nil {
+		t.Fatal(err)
+	}
+	b1, err := store.GetById(ctxB, uint64(3))
+	if err != nil || b1 == nil || b1.Title != "b1" {
+		t.Fatalf("tenant b note after tenant a writes = %+v, err = %v", b1, err)
+	}
+
+	tenantB := "b"
+	if err := store.UpdateById(ctxA, uint64(1), NewUpdater().Set(NewField[string](dbspi.DefaultTenantFieldName), &tenantB)); !errors.Is(err, dbspi.ErrCrossTenant) {
+		t.Fatalf("moving a note to tenant b err = %v", err)
+	}
+}
+
+type tenantTestAccount struct {
+	dbspi.CommonFields
+	dbspi.TenantField
+	Email string `gorm:"column:email;uniqueIndex"`
+	Name  string `gorm:"column:name"`
+}
+
+func (*tenantTestAccount) TableName() string { return "tenant_account_tab" }
+
+func TestTenantIsolationGuardsUpsertUniqueKeys(t *testing.T) {
+	store := NewMemoryTableStore(&tenantTestAccount{}, testCommonFieldAutoFillOptions())
+	ctxA := dbspi.WithTenant(context.Background(), "a")
+	ctxB := dbspi.WithTenant(context.Background(), "b")
+	if err := store.Create(ctxA, &tenantTestAccount{Email: "x@a.io", Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	email := []dbspi.Column{NewColumn("email")}
+	if err := store.Upsert(ctxB, &tenantTestAccount{Email: "x@a.io", Name: "mallory"}, email, nil); !errors.Is(err, dbspi.ErrCrossTenant) {
+		t.Fatalf("upsert on tenant a email err = %v", err)
+	}
+	// ON DUPLICATE KEY UPDATE fires on any unique index, not only on the
+	// conflict columns.
+	if err := store.Upsert(ctxB, &tenantTestAccount{Email: "x@a.io", Name: "mallory"}, nil, nil); !errors.Is(err, dbspi.ErrCrossTenant) {
+		t.Fatalf("upsert colliding on unique index err = %v", err)
+	}
+	batch := []*tenantTestAccount{{Email: "y@b.io", Name: "bob"}, {Email: "x@a.io", Name: "mallory"}}
+	if err := store.BatchUpsert(ctxB, batch, email, nil, 10); !errors.Is(err, dbspi.ErrCrossTenant) {
+		t.Fatalf("batch upsert on tenant a email err = %v", err)
+	}
+	if err := store.Upsert(ctxA, &tenantTestAccount{Email: "x@a.io", Name: "alicia"}, email, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := store.Find(dbspi.WithAllTenants(context.Background()), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].TenantId != "a" || accounts[0].Name != "alicia" {
+		t.Fatalf("accounts after upserts = %+v", accounts)
+	}
+}
+
+func TestCachedTableStoreHidesOtherTenants(t *testing.T) {
+	store := NewCachedTableStore[*tenantTestNote](newTenantTestNotes(t), cachehelper.NewInMemCache(), CachedTableStoreOptions{})
+	ctxA := dbspi.WithTenant(context.Background(), "a")
+	ctxB := dbspi.WithTenant(context.Background(), "b")
+
+	if note, err := store.GetById(ctxA, uint64(3)); err != nil || note != nil {
+		t.Fatalf("tenant a read tenant b note = %+v, err = %v", note, err)
+	}
+	if note, err := store.GetById(ctxB, uint64(3)); err != nil || note == nil || note.Title != "b1" {
+		t.Fatalf("tenant b note = %+v, err = %v", note, err)
+	}
+	if _, err := store.GetById(context.Background(), uint64(3)); !errors.Is(err, dbspi.ErrTenantRequired) {
+		t.Fatalf("read without tenant err = %v", err)
+	}
+}
+
+func TestTenantIsolationScopesSubqueries(t *testing.T) {
+	notes := newTenantTestNotes(t)
+	users := NewTableStoreWithCommonFieldAutoFill(notes.db, &memoryTestUser{}, testCommonFieldAutoFillOptions())
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if err := users.Create(context.Background(), &memoryTestUser{Email: name + "@x.io", Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noteIds := NewEntitySubquery(&tenantTestNote{}, Select([]dbspi.Column{NewColumn("id")}))
+	ctxA := dbspi.WithTenant(context.Background(), "a")
+
+	found, err := users.Find(ctxA, NewQuery(NewField[uint64]("id").InSubquery(noteIds)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := memoryTestNames(found); !reflect.DeepEqual(got, []string{"alice", "bob"}) {
+		t.Fatalf("users with tenant a note ids = %v", got)
+	}
+	title := "b1"
+	exists := NewQuery(Exists(NewEntitySubquery(&tenantTestNote{}, NewQuery(NewField[string]("title").Eq(&title)))))
+	if count, err := users.Count(ctxA, exists); err != nil || count != 0 {
+		t.Fatalf("count with tenant b note visible = %d, err = %v", count, err)
+	}
+
+	if _, err := users.Find(context.Background(), NewQuery(NewField[uint64]("id").InSubquery(noteIds)), nil); !errors.Is(err, dbspi.ErrTenantRequired) {
+		t.Fatalf("subquery without tenant err = %v", err)
+	}
+	if count, err := users.Count(dbspi.WithAllTenants(context.Background()), exists); err != nil || count != 3 {
+		t.Fatalf("all tenants count = %d, err = %v", count, err)
+	}
+}
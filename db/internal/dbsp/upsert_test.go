@@ -0,0 +1,122 @@
+package dbsp
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/db/dbspi"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// recordingGormLogger records every statement, in order.
+type recordingGormLogger struct {
+	*gormLogger
+	mu   sync.Mutex
+	sqls []string
+}
+
+func (l *recordingGormLogger) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sqls = append(l.sqls, sql)
+}
+
+func newUpsertTestDb(t *testing.T, logger *recordingGormLogger, dsn string) *GormDb {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       dsn,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &GormDb{db: db}
+}
+
+func TestUpsertKeepsInsertOnlyCommonFields(t *testing.T) {
+	logger := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	db := newUpsertTestDb(t, logger, "user:pass@tcp(127.0.0.1:3306)/test_db")
+	store := NewTableStoreWithCommonFieldAutoFill(db, &commonFieldTestEntity{}, testCommonFieldAutoFillOptions())
+	ctx := dbspi.WithOperator(context.Background(), "alice")
+
+	entity := &commonFieldTestEntity{Name: "a"}
+	if err := store.Upsert(ctx, entity, []dbspi.Column{NewColumn("name")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entity.Ctime != 12345 || entity.Creator != "alice" {
+		t.Fatalf("expected create common fields on insert, got %+v", entity.CommonFields)
+	}
+
+	sql := logger.sqls[len(logger.sqls)-1]
+	_, onConflict, ok := strings.Cut(sql, "ON DUPLICATE KEY UPDATE")
+	if !ok {
+		t.Fatalf("expected ON DUPLICATE KEY UPDATE, got %q", sql)
+	}
+	for _, col := range []string{"`mtime`", "`updater`"} {
+		if !strings.Contains(onConflict, col) {
+			t.Fatalf("expected %s to be updated on conflict, got %q", col, onConflict)
+		}
+	}
+	for _, col := range []string{"`id`", "`ctime`", "`creator`", "`name`"} {
+		if strings.Contains(onConflict, col) {
+			t.Fatalf("expected %s to be kept on conflict, got %q", col, onConflict)
+		}
+	}
+}
+
+func TestUpsertWithUpdaterAddsUpdateCommonFields(t *testing.T) {
+	logger := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	db := newUpsertTestDb(t, logger, "user:pass@tcp(127.0.0.1:3306)/test_db")
+	store := NewTableStoreWithCommonFieldAutoFill(db, &commonFieldTestEntity{}, testCommonFieldAutoFillOptions())
+	ctx := dbspi.WithOperator(context.Background(), "bob")
+
+	updater := NewUpdater().SetExpr(NewColumn("name"), "VALUES(?)", NewColumn("name"))
+	if err := store.Upsert(ctx, &commonFieldTestEntity{Name: "b"}, nil, updater); err != nil {
+		t.Fatal(err)
+	}
+
+	sql := logger.sqls[len(logger.sqls)-1]
+	want := "ON DUPLICATE KEY UPDATE `mtime`=?,`name`=VALUES(`name`),`updater`=?"
+	if !strings.HasSuffix(sql, want) {
+		t.Fatalf("expected SQL to end with %q, got %q", want, sql)
+	}
+}
+
+func TestShardedBatchUpsertGroupsRowsByTarget(t *testing.T) {
+	logger := &recordingGormLogger{gormLogger: newGormLogger("", dbspi.ServerConfig{})}
+	dial := func(server dbspi.ServerConfig) dbSession {
+		return newUpsertTestDb(t, logger, dbServerDSN(server))
+	}
+	mgr := NewManagerWithOptions(shardedJoinTestConfig(), ManagerOptions{dial: dial})
+	store := For(&joinTestItem{}, mgr)
+
+	// Shops 1 and 5 share order_db_1.order_item_tab_1; shop 2 routes to
+	// order_db_0.order_item_tab_2.
+	items := []*joinTestItem{
+		{ShopID: 1, SKU: "a"},
+		{ShopID: 2, SKU: "b"},
+		{ShopID: 5, SKU: "c"},
+	}
+	if err := store.BatchUpsert(context.Background(), items, nil, NewUpdater().Incr(NewColumn("order_id"), 1), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logger.sqls) != 2 {
+		t.Fatalf("expected one statement per target, got %d: %q", len(logger.sqls), logger.sqls)
+	}
+	if !strings.Contains(logger.sqls[0], "`order_item_tab_1`") || strings.Count(logger.sqls[0], "),(") != 1 {
+		t.Fatalf("expected shops 1 and 5 in one order_item_tab_1 statement, got %q", logger.sqls[0])
+	}
+	if !strings.Contains(logger.sqls[1], "`order_item_tab_2`") {
+		t.Fatalf("expected shop 2 in order_item_tab_2, got %q", logger.sqls[1])
+	}
+	if !strings.HasSuffix(logger.sqls[0], "ON DUPLICATE KEY UPDATE `order_id`=`order_id` + ?") {
+		t.Fatalf("expected updater assignments, got %q", logger.sqls[0])
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/MrMiaoMIMI/goshared/logger"
+	"github.com/MrMiaoMIMI/goshared/tracing"
 	"github.com/MrMiaoMIMI/goshared/util/random"
 	"github.com/gin-gonic/gin"
 )
@@ -31,6 +32,32 @@ func RequestID() gin.HandlerFunc {
 	}
 }
 
+// Tracing is a Gin middleware that starts a server span for each request.
+// The span continues the caller's trace when the request carries a W3C
+// traceparent header, and is available to handlers via the request context.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracing.Extract(c.Request.Context(), tracing.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx, span := tracing.Start(ctx, "http.server "+c.Request.Method+" "+route,
+			tracing.String(tracing.AttrHTTPMethod, c.Request.Method),
+			tracing.String(tracing.AttrHTTPRoute, route),
+		)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		span.SetAttributes(tracing.Int(tracing.AttrHTTPStatusCode, c.Writer.Status()))
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+		span.End()
+	}
+}
+
 // AccessLog is a Gin middleware that logs each request with method, path, status, and latency.
 func AccessLog() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -110,7 +137,7 @@ func CORS(allowOrigins ...string) gin.HandlerFunc {
 		if allowAll || allowed {
 			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Request-ID")
+			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Request-ID, traceparent")
 			c.Header("Access-Control-Allow-Credentials", "true")
 			c.Header("Access-Control-Max-Age", "86400")
 		}
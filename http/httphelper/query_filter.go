@@ -0,0 +1,24 @@
+package httphelper
+
+import (
+	"github.com/MrMiaoMIMI/goshared/db/dbhelper"
+	"github.com/gin-gonic/gin"
+)
+
+// BindQueryFilter parses the query string of c with filter.
+//
+// Example:
+//
+//	req, err := httphelper.BindQueryFilter(c, orderFilter)
+//	if err != nil {
+//		serverresp.BadRequestError(c, err)
+//		return
+//	}
+//	orders, err := orderStore.Find(ctx, req.Query, req.Pagination)
+//	...
+//	total, err := orderStore.Count(ctx, req.Query)
+//	...
+//	serverresp.SuccessPage(c, orders, int64(total), req.Page, req.Size)
+func BindQueryFilter(c *gin.Context, filter *dbhelper.QueryFilter) (*dbhelper.QueryFilterResult, error) {
+	return filter.Parse(c.Request.URL.Query())
+}
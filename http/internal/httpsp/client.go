@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/MrMiaoMIMI/goshared/http/httpspi"
+	"github.com/MrMiaoMIMI/goshared/tracing"
 )
 
 var _ httpspi.Client = (*httpClient)(nil)
@@ -321,7 +322,7 @@ func (c *httpClient) ResponseDecoder(decoder httpspi.ResponseDecoder) httpspi.Cl
 	return c
 }
 
-func (c *httpClient) Receive(ctx context.Context, timeout time.Duration, successV, failureV any) (*http.Response, error) {
+func (c *httpClient) Receive(ctx context.Context, timeout time.Duration, successV, failureV any) (resp *http.Response, err error) {
 	reqURL, err := c.buildURL()
 	if err != nil {
 		return nil, err
@@ -336,6 +337,9 @@ func (c *httpClient) Receive(ctx context.Context, timeout time.Duration, success
 		method = http.MethodGet
 	}
 
+	ctx, span := startClientSpan(ctx, method, reqURL)
+	defer func() { endClientSpan(span, resp, err) }()
+
 	maxAttempts := 1 + c.maxRetries
 	var lastResp *http.Response
 	var lastErr error
@@ -361,6 +365,7 @@ func (c *httpClient) Receive(ctx context.Context, timeout time.Duration, success
 		}
 
 		req.Header = c.header.Clone()
+		tracing.Inject(ctx, tracing.HeaderCarrier(req.Header))
 		for _, cookie := range c.cookies {
 			req.AddCookie(cookie)
 		}
@@ -0,0 +1,38 @@
+package httpsp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/MrMiaoMIMI/goshared/tracing"
+)
+
+// startClientSpan starts a span covering one Receive call, including retries.
+func startClientSpan(ctx context.Context, method, reqURL string) (context.Context, tracing.Span) {
+	return tracing.Start(ctx, "http.client "+method,
+		tracing.String(tracing.AttrHTTPMethod, method),
+		tracing.String(tracing.AttrHTTPURL, spanURL(reqURL)),
+	)
+}
+
+func endClientSpan(span tracing.Span, resp *http.Response, err error) {
+	if resp != nil {
+		span.SetAttributes(tracing.Int(tracing.AttrHTTPStatusCode, resp.StatusCode))
+	}
+	span.RecordError(err)
+	span.End()
+}
+
+// spanURL drops the query string and credentials from reqURL, which may carry
+// tokens or personal data.
+func spanURL(reqURL string) string {
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
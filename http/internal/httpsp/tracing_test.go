@@ -0,0 +1,50 @@
+package httpsp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/tracing"
+	"github.com/MrMiaoMIMI/goshared/tracing/tracetest"
+)
+
+func TestReceiveStartsClientSpanAndInjectsTraceparent(t *testing.T) {
+	recorder := tracetest.NewRecorder()
+	tracing.SetTracer(recorder)
+	defer tracing.SetTracer(nil)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(tracing.TraceparentHeader)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx, parent := tracing.Start(context.Background(), "handler")
+	_, err := NewHTTPClient().Base(server.URL).Get("/orders/42").QueryParam("token", "secret").Receive(ctx, time.Second, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "http.client GET" || span.ParentSpanID != parent.SpanContext().SpanID {
+		t.Fatalf("expected an http.client GET child span, got %q", span.Name)
+	}
+	if span.Attributes[tracing.AttrHTTPURL] != server.URL+"/orders/42" || span.Attributes[tracing.AttrHTTPStatusCode] != http.StatusNotFound {
+		t.Fatalf("unexpected attributes: %v", span.Attributes)
+	}
+	header := http.Header{}
+	header.Set(tracing.TraceparentHeader, traceparent)
+	remote := tracing.SpanContextFromContext(tracing.Extract(context.Background(), tracing.HeaderCarrier(header)))
+	if remote != span.SpanContext {
+		t.Fatalf("expected traceparent of the client span, got %q", traceparent)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/IBM/sarama"
 	"github.com/MrMiaoMIMI/goshared/mq/mqspi"
+	"github.com/MrMiaoMIMI/goshared/tracing"
 )
 
 var _ mqspi.AdvancedConsumer = (*SaramaAdvancedConsumer)(nil)
@@ -18,6 +19,7 @@ type SaramaAdvancedConsumer struct {
 	consumerGroup  sarama.ConsumerGroup
 	topics         []string
 	brokers        []string
+	groupID        string
 	credentials    mqspi.Credentials
 	processor      mqspi.MessageProcessor
 	batchProcessor mqspi.BatchMessageProcessor
@@ -72,6 +74,7 @@ func newAdvancedConsumer(config mqspi.AdvancedConsumerConfig, processor mqspi.Me
 		consumerGroup:  consumerGroup,
 		topics:         config.Topics(),
 		brokers:        config.Brokers(),
+		groupID:        config.GroupID(),
 		credentials:    config.Credentials(),
 		processor:      processor,
 		batchProcessor: batchProcessor,
@@ -96,6 +99,7 @@ func (c *SaramaAdvancedConsumer) drainErrors() {
 
 func (c *SaramaAdvancedConsumer) Run() error {
 	handler := &advancedConsumerHandler{
+		groupID:        c.groupID,
 		processor:      c.processor,
 		batchProcessor: c.batchProcessor,
 		maxRetries:     c.maxRetries,
@@ -164,6 +168,7 @@ func (c *SaramaAdvancedConsumer) Check(_ context.Context) error {
 
 // advancedConsumerHandler implements sarama.ConsumerGroupHandler
 type advancedConsumerHandler struct {
+	groupID        string
 	processor      mqspi.MessageProcessor
 	batchProcessor mqspi.BatchMessageProcessor
 	maxRetries     int
@@ -194,7 +199,10 @@ func (h *advancedConsumerHandler) consumeClaimSingle(session sarama.ConsumerGrou
 			msg := fromSaramaConsumerMessage(raw)
 			retryCount := getRetryCount(raw)
 
-			err := h.processor.Process(session.Context(), msg)
+			ctx, span := startConsumeSpan(session.Context(), "kafka.process", h.groupID, msg)
+			err := h.processor.Process(ctx, msg)
+			span.RecordError(err)
+			span.End()
 			if err == nil {
 				session.MarkMessage(raw, "")
 				continue
@@ -250,7 +258,16 @@ func (h *advancedConsumerHandler) consumeClaimBatch(session sarama.ConsumerGroup
 			msgs[i] = fromSaramaConsumerMessage(raw)
 		}
 
-		err := h.batchProcessor.BatchProcess(session.Context(), msgs)
+		ctx, span := tracing.Start(session.Context(), "kafka.process_batch",
+			tracing.String(tracing.AttrMessagingSystem, "kafka"),
+			tracing.String(tracing.AttrMessagingDestination, claim.Topic()),
+			tracing.String(tracing.AttrMessagingConsumerGroup, h.groupID),
+			tracing.Int(tracing.AttrMessagingPartition, int(claim.Partition())),
+			tracing.Int(tracing.AttrMessagingBatchSize, len(msgs)),
+		)
+		err := h.batchProcessor.BatchProcess(ctx, msgs)
+		span.RecordError(err)
+		span.End()
 		if err != nil {
 			for _, raw := range batch {
 				retryCount := getRetryCount(raw)
@@ -19,6 +19,7 @@ type metaKey string
 const (
 	metaKeySession       metaKey = "session"
 	metaKeyRaw           metaKey = "raw"
+	metaKeySpan          metaKey = "span"
 	retryDelayHeader             = "x-retry-delay-seconds"
 	originalTopicHeader          = "x-original-topic"
 )
@@ -33,6 +34,7 @@ type SaramaManualConsumer struct {
 	defaultTopic  string
 	topics        []string
 	brokers       []string
+	groupID       string
 	credentials   mqspi.Credentials
 	syncProducer  sarama.SyncProducer
 
@@ -76,6 +78,7 @@ func NewManualConsumer(config mqspi.ConsumerConfig) (mqspi.ManualConsumer, error
 		defaultTopic:  config.Topic(),
 		topics:        topics,
 		brokers:       config.Brokers(),
+		groupID:       config.GroupID(),
 		credentials:   config.Credentials(),
 		syncProducer:  syncProducer,
 		msgChan:       make(chan *wrappedMessage, 256),
@@ -129,6 +132,10 @@ func (c *SaramaManualConsumer) Consume(ctx context.Context) (*mqspi.ConsumerMess
 		msg := fromSaramaConsumerMessage(wrapped.raw)
 		msg.Metadata[metaKeySession] = wrapped.session
 		msg.Metadata[metaKeyRaw] = wrapped.raw
+		// The span covers the handling of msg and ends when it is settled by
+		// Confirm, ColdRetry or DLQ.
+		_, span := startConsumeSpan(ctx, "kafka.receive", c.groupID, msg)
+		msg.Metadata[metaKeySpan] = span
 		return msg, nil
 	}
 }
@@ -148,6 +155,7 @@ func (c *SaramaManualConsumer) Confirm(msg *mqspi.ConsumerMessage) error {
 	}
 	session.MarkMessage(raw, "")
 	session.Commit()
+	endReceiveSpan(msg, nil)
 	return nil
 }
 
@@ -171,6 +179,7 @@ func (c *SaramaManualConsumer) ColdRetry(_ context.Context, msg *mqspi.ConsumerM
 		retryMsg.Headers = append(retryMsg.Headers, sarama.RecordHeader{Key: h.Key, Value: h.Value})
 	}
 	_, _, err := c.syncProducer.SendMessage(retryMsg)
+	endReceiveSpan(msg, err)
 	return err
 }
 
@@ -193,6 +202,7 @@ func (c *SaramaManualConsumer) DLQ(_ context.Context, msg *mqspi.ConsumerMessage
 		dlqMsg.Headers = append(dlqMsg.Headers, sarama.RecordHeader{Key: h.Key, Value: h.Value})
 	}
 	_, _, err := c.syncProducer.SendMessage(dlqMsg)
+	endReceiveSpan(msg, err)
 	return err
 }
 
@@ -8,6 +8,7 @@ import (
 
 	"github.com/IBM/sarama"
 	"github.com/MrMiaoMIMI/goshared/mq/mqspi"
+	"github.com/MrMiaoMIMI/goshared/tracing"
 )
 
 var _ mqspi.Producer = (*SaramaProducer)(nil)
@@ -16,6 +17,7 @@ type asyncMeta struct {
 	originalMsg *mqspi.ProducerMessage
 	callback    mqspi.AsyncProduceCallback
 	ctx         context.Context
+	span        tracing.Span
 }
 
 type SaramaProducer struct {
@@ -70,20 +72,21 @@ func (p *SaramaProducer) resolveTopic(msgTopic string) string {
 	return p.defaultTopic
 }
 
-func (p *SaramaProducer) Produce(_ context.Context, msg *mqspi.ProducerMessage) error {
+func (p *SaramaProducer) Produce(ctx context.Context, msg *mqspi.ProducerMessage) error {
 	if p.closed.Load() {
 		return mqspi.ErrProducerClosed
 	}
 
 	msg.Topic = p.resolveTopic(msg.Topic)
+	_, span := startProduceSpan(ctx, msg)
 	saramaMsg := toSaramaProducerMessage(msg)
 	partition, offset, err := p.syncProducer.SendMessage(saramaMsg)
-	if err != nil {
-		return err
+	if err == nil {
+		msg.Partition = partition
+		msg.Offset = offset
 	}
-	msg.Partition = partition
-	msg.Offset = offset
-	return nil
+	endProduceSpan(span, msg, err)
+	return err
 }
 
 func (p *SaramaProducer) BatchProduce(ctx context.Context, msgs []*mqspi.ProducerMessage) error {
@@ -110,11 +113,13 @@ func (p *SaramaProducer) AsyncProduce(ctx context.Context, msg *mqspi.ProducerMe
 	}
 
 	msg.Topic = p.resolveTopic(msg.Topic)
+	_, span := startProduceSpan(ctx, msg)
 	saramaMsg := toSaramaProducerMessage(msg)
 	saramaMsg.Metadata = &asyncMeta{
 		originalMsg: msg,
 		callback:    callback,
 		ctx:         ctx,
+		span:        span,
 	}
 	p.asyncProducer.Input() <- saramaMsg
 }
@@ -159,9 +164,14 @@ func (p *SaramaProducer) Close(_ context.Context) error {
 func (p *SaramaProducer) handleAsyncSuccesses() {
 	defer p.wg.Done()
 	for msg := range p.asyncProducer.Successes() {
-		if meta, ok := msg.Metadata.(*asyncMeta); ok && meta.callback != nil {
-			meta.originalMsg.Partition = msg.Partition
-			meta.originalMsg.Offset = msg.Offset
+		meta, ok := msg.Metadata.(*asyncMeta)
+		if !ok {
+			continue
+		}
+		meta.originalMsg.Partition = msg.Partition
+		meta.originalMsg.Offset = msg.Offset
+		endProduceSpan(meta.span, meta.originalMsg, nil)
+		if meta.callback != nil {
 			meta.callback.Handle(meta.ctx, meta.originalMsg, nil)
 		}
 	}
@@ -170,7 +180,12 @@ func (p *SaramaProducer) handleAsyncSuccesses() {
 func (p *SaramaProducer) handleAsyncErrors() {
 	defer p.wg.Done()
 	for pErr := range p.asyncProducer.Errors() {
-		if meta, ok := pErr.Msg.Metadata.(*asyncMeta); ok && meta.callback != nil {
+		meta, ok := pErr.Msg.Metadata.(*asyncMeta)
+		if !ok {
+			continue
+		}
+		endProduceSpan(meta.span, meta.originalMsg, pErr.Err)
+		if meta.callback != nil {
 			meta.callback.Handle(meta.ctx, meta.originalMsg, pErr.Err)
 		}
 	}
@@ -0,0 +1,91 @@
+package mqsp
+
+import (
+	"context"
+
+	"github.com/MrMiaoMIMI/goshared/mq/mqspi"
+	"github.com/MrMiaoMIMI/goshared/tracing"
+)
+
+// headerCarrier adapts message headers to tracing.Carrier. Set replaces an
+// existing header with the same key, so re-produced messages carry the current
+// trace context only.
+type headerCarrier struct {
+	headers *[]mqspi.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if string(h.Key) == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, mqspi.Header{Key: []byte(key), Value: []byte(value)})
+}
+
+// ContextFromMessage returns a copy of ctx whose trace parent is the receive
+// span of msg while it is unsettled, or else the span that produced msg, if
+// msg carries one.
+func ContextFromMessage(ctx context.Context, msg *mqspi.ConsumerMessage) context.Context {
+	if span, ok := msg.Metadata[metaKeySpan].(tracing.Span); ok {
+		return tracing.ContextWithSpan(ctx, span)
+	}
+	return tracing.Extract(ctx, headerCarrier{headers: &msg.Headers})
+}
+
+// startProduceSpan starts a producer span for msg and injects its context into
+// the message headers.
+func startProduceSpan(ctx context.Context, msg *mqspi.ProducerMessage) (context.Context, tracing.Span) {
+	ctx, span := tracing.Start(ctx, "kafka.produce",
+		tracing.String(tracing.AttrMessagingSystem, "kafka"),
+		tracing.String(tracing.AttrMessagingDestination, msg.Topic),
+	)
+	tracing.Inject(ctx, headerCarrier{headers: &msg.Headers})
+	return ctx, span
+}
+
+func endProduceSpan(span tracing.Span, msg *mqspi.ProducerMessage, err error) {
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(
+			tracing.Int(tracing.AttrMessagingPartition, int(msg.Partition)),
+			tracing.Int64(tracing.AttrMessagingOffset, msg.Offset),
+		)
+	}
+	span.End()
+}
+
+// startConsumeSpan starts a consumer span for msg as a child of the span that
+// produced it.
+func startConsumeSpan(ctx context.Context, name, groupID string, msg *mqspi.ConsumerMessage) (context.Context, tracing.Span) {
+	return tracing.Start(ContextFromMessage(ctx, msg), name,
+		tracing.String(tracing.AttrMessagingSystem, "kafka"),
+		tracing.String(tracing.AttrMessagingDestination, msg.Topic),
+		tracing.String(tracing.AttrMessagingConsumerGroup, groupID),
+		tracing.Int(tracing.AttrMessagingPartition, int(msg.Partition)),
+		tracing.Int64(tracing.AttrMessagingOffset, msg.Offset),
+	)
+}
+
+// endReceiveSpan ends the receive span of a message returned by
+// SaramaManualConsumer.Consume, once.
+func endReceiveSpan(msg *mqspi.ConsumerMessage, err error) {
+	span, ok := msg.Metadata[metaKeySpan].(tracing.Span)
+	if !ok {
+		return
+	}
+	delete(msg.Metadata, metaKeySpan)
+	span.RecordError(err)
+	span.End()
+}
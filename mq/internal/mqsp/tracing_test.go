@@ -0,0 +1,90 @@
+package mqsp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/MrMiaoMIMI/goshared/mq/mqspi"
+	"github.com/MrMiaoMIMI/goshared/tracing"
+	"github.com/MrMiaoMIMI/goshared/tracing/tracetest"
+)
+
+// fakeGroupSession records commits; its other methods are not used.
+type fakeGroupSession struct {
+	sarama.ConsumerGroupSession
+	marked    int
+	committed int
+}
+
+func (s *fakeGroupSession) MarkMessage(*sarama.ConsumerMessage, string) { s.marked++ }
+func (s *fakeGroupSession) Commit()                                     { s.committed++ }
+
+func TestProduceSpanContextReachesConsumer(t *testing.T) {
+	recorder := tracetest.NewRecorder()
+	tracing.SetTracer(recorder)
+	defer tracing.SetTracer(nil)
+
+	produced := &mqspi.ProducerMessage{
+		Topic:   "order",
+		Headers: []mqspi.Header{{Key: []byte(tracing.TraceparentHeader), Value: []byte("stale")}},
+	}
+	_, produceSpan := startProduceSpan(context.Background(), produced)
+	endProduceSpan(produceSpan, produced, nil)
+	if len(produced.Headers) != 1 {
+		t.Fatalf("expected the stale traceparent to be replaced, got %d headers", len(produced.Headers))
+	}
+
+	consumed := &mqspi.ConsumerMessage{Topic: "order", Headers: produced.Headers, Partition: 2, Offset: 7}
+	_, consumeSpan := startConsumeSpan(context.Background(), "kafka.process", "billing", consumed)
+	consumeSpan.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	produce, consume := spans[0], spans[1]
+	if consume.ParentSpanID != produce.SpanContext.SpanID || consume.SpanContext.TraceID != produce.SpanContext.TraceID {
+		t.Fatalf("expected consume span to be a child of the produce span")
+	}
+	if consume.Attributes[tracing.AttrMessagingConsumerGroup] != "billing" || consume.Attributes[tracing.AttrMessagingOffset] != int64(7) {
+		t.Fatalf("unexpected attributes: %v", consume.Attributes)
+	}
+}
+
+func TestManualConsumerReceiveSpanEndsOnConfirm(t *testing.T) {
+	recorder := tracetest.NewRecorder()
+	tracing.SetTracer(recorder)
+	defer tracing.SetTracer(nil)
+
+	session := &fakeGroupSession{}
+	consumer := &SaramaManualConsumer{groupID: "billing", msgChan: make(chan *wrappedMessage, 1), ctx: context.Background()}
+	consumer.msgChan <- &wrappedMessage{raw: &sarama.ConsumerMessage{Topic: "order"}, session: session}
+
+	msg, err := consumer.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("expected the receive span to stay open while the message is handled, got %d ended", len(spans))
+	}
+	_, handler := tracing.Start(ContextFromMessage(context.Background(), msg), "handler")
+	handler.End()
+	if err := consumer.Confirm(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := consumer.Confirm(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[1].Name != "kafka.receive" {
+		t.Fatalf("expected the receive span to end once after the handler, got %+v", spans)
+	}
+	if spans[0].ParentSpanID != spans[1].SpanContext.SpanID {
+		t.Fatalf("expected the handler span to be a child of the receive span")
+	}
+	if session.committed != 2 {
+		t.Fatalf("expected 2 commits, got %d", session.committed)
+	}
+}
@@ -1,6 +1,7 @@
 package mqhelper
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -129,6 +130,15 @@ func GetHeaderString(msg *mqspi.ConsumerMessage, key string) string {
 	return string(v)
 }
 
+// ContextFromMessage returns a copy of ctx that continues the trace of msg.
+// Use it with ManualConsumer, whose Consume cannot return a context;
+// AdvancedConsumer already passes it to the processor. Spans started from it
+// are children of the kafka.receive span of msg, which ends when msg is
+// settled with Confirm, ColdRetry or DLQ.
+func ContextFromMessage(ctx context.Context, msg *mqspi.ConsumerMessage) context.Context {
+	return mqsp.ContextFromMessage(ctx, msg)
+}
+
 // UnmarshalValue unmarshals the message value from JSON into dest.
 func UnmarshalValue(msg *mqspi.ConsumerMessage, dest any) error {
 	return json.Unmarshal(msg.Value, dest)
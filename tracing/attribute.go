@@ -0,0 +1,55 @@
+package tracing
+
+// Attribute is a key-value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String creates a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int creates an int attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 creates an int64 attribute.
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool creates a bool attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Standard attribute keys used by the built-in integrations. They follow the
+// OpenTelemetry semantic conventions where one exists.
+const (
+	AttrDBSystem       = "db.system"
+	AttrDBName         = "db.name"
+	AttrDBTable        = "db.sql.table"
+	AttrDBOperation    = "db.operation"
+	AttrDBRowsAffected = "db.rows_affected"
+
+	AttrCacheSystem    = "cache.system"
+	AttrCacheOperation = "cache.operation"
+	AttrCacheKeyPrefix = "cache.key_prefix"
+	AttrCacheKeyCount  = "cache.key_count"
+	AttrCacheHit       = "cache.hit"
+
+	AttrMessagingSystem        = "messaging.system"
+	AttrMessagingDestination   = "messaging.destination.name"
+	AttrMessagingConsumerGroup = "messaging.kafka.consumer.group"
+	AttrMessagingPartition     = "messaging.kafka.partition"
+	AttrMessagingOffset        = "messaging.kafka.offset"
+	AttrMessagingBatchSize     = "messaging.batch.message_count"
+
+	AttrHTTPMethod     = "http.request.method"
+	AttrHTTPURL        = "url.full"
+	AttrHTTPRoute      = "http.route"
+	AttrHTTPStatusCode = "http.response.status_code"
+)
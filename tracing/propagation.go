@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C trace context header used for propagation.
+const TraceparentHeader = "traceparent"
+
+// Carrier reads and writes propagation headers.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// HeaderCarrier adapts http.Header to Carrier.
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string {
+	return http.Header(c).Get(key)
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	http.Header(c).Set(key, value)
+}
+
+// Inject writes the span context in ctx to carrier. It does nothing when ctx
+// has no valid span context.
+func Inject(ctx context.Context, carrier Carrier) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	carrier.Set(TraceparentHeader, fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags))
+}
+
+// Extract reads a span context from carrier and returns a copy of ctx that
+// uses it as the remote parent. ctx is returned unchanged when carrier has no
+// valid traceparent.
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	sc, ok := parseTraceparent(carrier.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+func parseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 ||
+		!isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) ||
+		strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return SpanContext{}, false
+	}
+	return SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: flags[1]&1 == 1,
+	}, true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
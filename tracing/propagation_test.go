@@ -0,0 +1,27 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/MrMiaoMIMI/goshared/tracing"
+	"github.com/MrMiaoMIMI/goshared/tracing/tracetest"
+)
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	recorder := tracetest.NewRecorder()
+	ctx, span := recorder.Start(context.Background(), "producer")
+	header := http.Header{}
+	tracing.Inject(ctx, tracing.HeaderCarrier(header))
+
+	remote := tracing.SpanContextFromContext(tracing.Extract(context.Background(), tracing.HeaderCarrier(header)))
+	if remote != span.SpanContext() {
+		t.Fatalf("expected %+v, got %+v", span.SpanContext(), remote)
+	}
+
+	header.Set(tracing.TraceparentHeader, "00-invalid")
+	if sc := tracing.SpanContextFromContext(tracing.Extract(context.Background(), tracing.HeaderCarrier(header))); sc.IsValid() {
+		t.Fatalf("expected invalid traceparent to be ignored, got %+v", sc)
+	}
+}
@@ -0,0 +1,127 @@
+// Package tracing provides a small tracing abstraction shared by the db,
+// cache, mq and http packages.
+//
+// The default tracer is a no-op. Install an implementation, for example an
+// adapter over an OpenTelemetry tracer, with SetTracer at startup. Trace
+// context crosses process boundaries through Inject and Extract using the
+// W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Tracer starts spans.
+//
+// Start must create a child of the span or remote span context found in ctx
+// (see SpanContextFromContext) and return a context carrying the new span.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is one timed operation in a trace.
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	// TraceID is 32 lowercase hex characters.
+	TraceID string
+	// SpanID is 16 lowercase hex characters.
+	SpanID  string
+	Sampled bool
+}
+
+// IsValid reports whether sc has both a trace id and a span id.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+type spanKey struct{}
+
+type remoteSpanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span as the active span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the active span in ctx, or a no-op span.
+func SpanFromContext(ctx context.Context) Span {
+	if ctx != nil {
+		if span, ok := ctx.Value(spanKey{}).(Span); ok {
+			return span
+		}
+	}
+	return noopSpan{}
+}
+
+// ContextWithRemoteSpanContext returns a copy of ctx carrying sc as the
+// parent for spans started from it, typically after Extract.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context of the active span in ctx,
+// falling back to a remote span context set by Extract.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		if sc := span.SpanContext(); sc.IsValid() {
+			return sc
+		}
+	}
+	sc, _ := ctx.Value(remoteSpanContextKey{}).(SpanContext)
+	return sc
+}
+
+type tracerHolder struct {
+	tracer Tracer
+}
+
+var globalTracer atomic.Pointer[tracerHolder]
+
+// SetTracer installs the global tracer. A nil tracer restores the no-op
+// default.
+func SetTracer(tracer Tracer) {
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	globalTracer.Store(&tracerHolder{tracer: tracer})
+}
+
+// GetTracer returns the global tracer.
+func GetTracer() Tracer {
+	if holder := globalTracer.Load(); holder != nil {
+		return holder.tracer
+	}
+	return noopTracer{}
+}
+
+// Start starts a span with the global tracer.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return GetTracer().Start(ctx, name, attrs...)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SpanContext() SpanContext   { return SpanContext{} }
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
@@ -0,0 +1,132 @@
+// Package tracetest provides an in-memory tracing.Tracer for tests.
+package tracetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/MrMiaoMIMI/goshared/tracing"
+)
+
+var _ tracing.Tracer = (*Recorder)(nil)
+
+// RecordedSpan is a span captured by Recorder.
+type RecordedSpan struct {
+	Name         string
+	SpanContext  tracing.SpanContext
+	ParentSpanID string
+	Attributes   map[string]any
+	Errors       []error
+	StartTime    time.Time
+	EndTime      time.Time
+}
+
+// Recorder is a tracing.Tracer that keeps ended spans in memory.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start implements tracing.Tracer.
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+	parent := tracing.SpanContextFromContext(ctx)
+	traceID := parent.TraceID
+	if !parent.IsValid() {
+		traceID = randomHex(16)
+	}
+	span := &recordingSpan{
+		recorder: r,
+		data: RecordedSpan{
+			Name: name,
+			SpanContext: tracing.SpanContext{
+				TraceID: traceID,
+				SpanID:  randomHex(8),
+				Sampled: true,
+			},
+			ParentSpanID: parent.SpanID,
+			Attributes:   make(map[string]any, len(attrs)),
+			StartTime:    time.Now(),
+		},
+	}
+	span.SetAttributes(attrs...)
+	return tracing.ContextWithSpan(ctx, span), span
+}
+
+// Ended returns a copy of the spans ended so far, in end order.
+func (r *Recorder) Ended() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// Reset drops all recorded spans.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+type recordingSpan struct {
+	recorder *Recorder
+	mu       sync.Mutex
+	data     RecordedSpan
+	ended    bool
+}
+
+func (s *recordingSpan) SpanContext() tracing.SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...tracing.Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	data.Attributes = make(map[string]any, len(s.data.Attributes))
+	for k, v := range s.data.Attributes {
+		data.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	s.recorder.spans = append(s.recorder.spans, data)
+	s.recorder.mu.Unlock()
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keyIDSeparator separates the key id from the base64 ciphertext produced by
+// Keyring.Encrypt. It never occurs in standard base64.
+const keyIDSeparator = ":"
+
+var (
+	ErrInvalidKeyID = errors.New("crypto: key id must be non-empty and must not contain ':'")
+	ErrUnknownKeyID = errors.New("crypto: ciphertext was encrypted with an unknown key")
+)
+
+// Keyring encrypts with its primary key and decrypts with any key it holds.
+// Ciphertexts are prefixed with the id of the key that produced them, as
+// "<key id>:<base64>", so keys can be rotated: add a new key, make it the
+// primary, and existing ciphertexts keep decrypting until they are rewritten.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a Keyring from AES keys by id. Each key must be 16, 24,
+// or 32 bytes long, and primaryKeyID must be one of the ids.
+func NewKeyring(primaryKeyID string, keys map[string][]byte) (*Keyring, error) {
+	copied := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, keyIDSeparator) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidKeyID, id)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("%w: key %q has %d bytes", ErrInvalidKeySize, id, n)
+		}
+		copied[id] = append([]byte(nil), key...)
+	}
+	if _, ok := copied[primaryKeyID]; !ok {
+		return nil, fmt.Errorf("crypto: primary key %q is not in the keyring", primaryKeyID)
+	}
+	return &Keyring{primary: primaryKeyID, keys: copied}, nil
+}
+
+// PrimaryKeyID returns the id of the key Encrypt uses.
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// Encrypt encrypts plaintext with the primary key and returns
+// "<key id>:<base64 ciphertext>".
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	encoded, err := AESEncryptString(k.keys[k.primary], plaintext)
+	if err != nil {
+		return "", err
+	}
+	return k.primary + keyIDSeparator + encoded, nil
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt with the key it names.
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	id, encoded, ok := strings.Cut(ciphertext, keyIDSeparator)
+	if !ok {
+		return "", fmt.Errorf("crypto: ciphertext has no key id")
+	}
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKeyID, id)
+	}
+	return AESDecryptString(key, encoded)
+}
+
+// KeyID returns the id of the key ciphertext was encrypted with, e.g. to find
+// values that still need to be re-encrypted after a rotation.
+func KeyID(ciphertext string) (string, bool) {
+	id, _, ok := strings.Cut(ciphertext, keyIDSeparator)
+	return id, ok
+}
+
+// BlindIndex returns the hex-encoded HMAC-SHA256 of plaintext under key. Equal
+// plaintexts give equal indexes, so the index can be stored next to a
+// ciphertext and used for equality lookups without decrypting. Use a key
+// that is not used for encryption.
+func BlindIndex(key []byte, plaintext string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(plaintext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -86,7 +86,25 @@ func init() {
 // This is a simplified version; for production use with multiple machines,
 // set the machine ID via SetSnowflakeMachineID before calling Snowflake.
 func Snowflake() int64 {
-	return snowflakeGen.Next()
+	return snowflakeGens[0].Next()
+}
+
+// MaxSnowflakeReservedBits is the largest reservedBits accepted by
+// SnowflakeWithReservedBits.
+const MaxSnowflakeReservedBits = 8
+
+// SnowflakeWithReservedBits generates a snowflake-like ID that leaves the
+// top reservedBits bits of an int64 unused, so the ID can be shifted left by
+// reservedBits, e.g. to embed a shard number in the low bits.
+// Layout: 41 bits timestamp (ms) + 10 bits machine + (12 - reservedBits)
+// bits sequence, so at most 4096>>reservedBits IDs are generated per
+// millisecond per machine. IDs share the machine ID of Snowflake.
+// reservedBits must be between 0 and MaxSnowflakeReservedBits.
+func SnowflakeWithReservedBits(reservedBits int) int64 {
+	if reservedBits < 0 || reservedBits > MaxSnowflakeReservedBits {
+		panic(fmt.Sprintf("idutil: snowflake reserved bits must be between 0 and %d", MaxSnowflakeReservedBits))
+	}
+	return snowflakeGens[reservedBits].Next()
 }
 
 // SetSnowflakeMachineID sets the machine ID for snowflake ID generation (0-1023).
@@ -95,20 +113,36 @@ func SetSnowflakeMachineID(id int64) {
 	if id < 0 || id > 1023 {
 		panic("idutil: machine ID must be between 0 and 1023")
 	}
-	snowflakeGen.machineID.Store(id)
+	snowflakeMachineID.Store(id)
 }
 
-var snowflakeGen = &snowflakeGenerator{epoch: 1700000000000}
+const (
+	snowflakeEpoch       = 1700000000000
+	snowflakeMachineBits = 10
+	snowflakeSeqBits     = 12
+)
+
+var (
+	snowflakeMachineID atomic.Int64
+	snowflakeGens      [MaxSnowflakeReservedBits + 1]*snowflakeGenerator
+)
+
+func init() {
+	for reserved := range snowflakeGens {
+		snowflakeGens[reserved] = &snowflakeGenerator{epoch: snowflakeEpoch, seqBits: snowflakeSeqBits - reserved}
+	}
+}
 
 type snowflakeGenerator struct {
-	epoch     int64
-	machineID atomic.Int64
-	sequence  atomic.Int64
-	lastTime  atomic.Int64
+	epoch    int64
+	seqBits  int
+	sequence atomic.Int64
+	lastTime atomic.Int64
 }
 
 func (g *snowflakeGenerator) Next() int64 {
-	mid := g.machineID.Load()
+	mid := snowflakeMachineID.Load()
+	timeShift := snowflakeMachineBits + g.seqBits
 	for {
 		now := time.Now().UnixMilli() - g.epoch
 		last := g.lastTime.Load()
@@ -116,14 +150,14 @@ func (g *snowflakeGenerator) Next() int64 {
 		if now > last {
 			if g.lastTime.CompareAndSwap(last, now) {
 				g.sequence.Store(0)
-				return (now << 22) | (mid << 12) | 0
+				return (now << timeShift) | (mid << g.seqBits) | 0
 			}
 			continue
 		}
 
 		seq := g.sequence.Add(1)
-		if seq < 4096 {
-			return (last << 22) | (mid << 12) | seq
+		if seq < 1<<g.seqBits {
+			return (last << timeShift) | (mid << g.seqBits) | seq
 		}
 
 		time.Sleep(time.Millisecond)
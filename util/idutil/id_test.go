@@ -0,0 +1,31 @@
+package idutil
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSnowflakeWithReservedBitsLeavesRoomToShift(t *testing.T) {
+	for _, bits := range []int{0, 4, MaxSnowflakeReservedBits} {
+		seen := make(map[int64]bool)
+		for i := 0; i < 10000; i++ {
+			id := SnowflakeWithReservedBits(bits)
+			if id <= 0 || id > math.MaxInt64>>bits {
+				t.Fatalf("bits %d: id %d does not fit", bits, id)
+			}
+			if seen[id] {
+				t.Fatalf("bits %d: duplicate id %d", bits, id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestSnowflakeWithReservedBitsRejectsOutOfRange(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	SnowflakeWithReservedBits(MaxSnowflakeReservedBits + 1)
+}
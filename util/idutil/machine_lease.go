@@ -0,0 +1,20 @@
+package idutil
+
+import "context"
+
+// MachineLease is a snowflake machine id leased from shared storage, so that
+// no two live processes generate Snowflake ids with the same machine id.
+// Implementations pass the leased id to SetSnowflakeMachineID and renew the
+// lease in the background until Close.
+//
+// dbhelper.LeaseSnowflakeMachineId returns one backed by a database table.
+type MachineLease interface {
+	// MachineID returns the leased machine id.
+	MachineID() int64
+	// Lost is closed when the lease could not be renewed before it expired
+	// or was taken over by another owner. Stop generating Snowflake ids once
+	// it is closed.
+	Lost() <-chan struct{}
+	// Close stops renewing the lease and releases the machine id.
+	Close(ctx context.Context) error
+}
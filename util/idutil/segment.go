@@ -0,0 +1,13 @@
+package idutil
+
+import "context"
+
+// SegmentAllocator hands out ids per business tag from ranges reserved in
+// shared storage, in the style of Leaf's segment mode. Ids of a tag are
+// monotonic within a process and unique across processes sharing the
+// storage.
+//
+// dbhelper.NewSegmentAllocator returns one backed by a database table.
+type SegmentAllocator interface {
+	Next(ctx context.Context, bizTag string) (uint64, error)
+}